@@ -0,0 +1,561 @@
+// Package backup takes online snapshots of the SQLite database together with
+// the uploaded images, prunes them by age and count, and restores them.
+//
+// A snapshot is a directory named after its creation time holding a copy of
+// the database made with VACUUM INTO, a copy of the images folder and a
+// manifest with the SHA-256 of every file and the schema version.
+package backup
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	nameLayout   = "20060102T150405.000Z"
+	manifestName = "manifest.json"
+	dbName       = "database.db"
+	imagesName   = "images"
+	tmpSuffix    = ".tmp"
+)
+
+// Config says where the live data and the snapshots are. An empty ImagesDir
+// leaves images out, for when they are not kept on local disk.
+type Config struct {
+	DBPath        string
+	ImagesDir     string
+	MigrationsDir string
+	Dir           string
+
+	// KeepLast is the number of most recent snapshots kept by Prune, and
+	// KeepDaily the number of days for which the newest snapshot of the day
+	// is kept. Prune keeps everything when both are zero.
+	KeepLast  int
+	KeepDaily int
+}
+
+// Snapshot describes a snapshot directory through its manifest.
+type Snapshot struct {
+	Dir           string    `json:"-"`
+	Created       time.Time `json:"created"`
+	SchemaVersion uint      `json:"schema_version"`
+	Files         []File    `json:"files"`
+}
+
+// File is an entry of the manifest. Path is relative to the snapshot
+// directory and uses forward slashes.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Name is the snapshot's directory name.
+func (s *Snapshot) Name() string {
+	return filepath.Base(s.Dir)
+}
+
+// Create snapshots the database and images into a new directory in cfg.Dir.
+// The database stays usable while it runs. Images are copied after the
+// database, so the snapshot may hold images uploaded meanwhile but never
+// misses one the database refers to.
+func Create(cfg Config) (*Snapshot, error) {
+	created := time.Now().UTC()
+	dir := filepath.Join(cfg.Dir, created.Format(nameLayout))
+	tmp := dir + tmpSuffix
+
+	err := os.MkdirAll(tmp, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := create(cfg, tmp, created)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	// The snapshot only gets its final name once it is complete.
+	err = os.Rename(tmp, dir)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	snapshot.Dir = dir
+
+	return snapshot, nil
+}
+
+func create(cfg Config, tmp string, created time.Time) (*Snapshot, error) {
+	dbCopy := filepath.Join(tmp, dbName)
+
+	err := vacuumInto(cfg.DBPath, dbCopy)
+	if err != nil {
+		return nil, fmt.Errorf("copying database: %w", err)
+	}
+
+	version, dirty, err := schemaVersion(dbCopy)
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("database is at dirty schema version %d, fix the failed migration first", version)
+	}
+
+	snapshot := &Snapshot{Created: created, SchemaVersion: version}
+
+	file, err := checksum(tmp, dbName)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Files = append(snapshot.Files, file)
+
+	var images []string
+	if cfg.ImagesDir != "" {
+		images, err = copyDir(cfg.ImagesDir, filepath.Join(tmp, imagesName))
+		if err != nil {
+			return nil, fmt.Errorf("copying images: %w", err)
+		}
+	}
+	for _, image := range images {
+		file, err := checksum(tmp, imagesName+"/"+image)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Files = append(snapshot.Files, file)
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(filepath.Join(tmp, manifestName), data, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// vacuumInto writes a compacted, consistent copy of the database at src to
+// dst. It uses its own connection because the server's read pool is
+// query-only, which rules out VACUUM.
+func vacuumInto(src, dst string) error {
+	db, err := sql.Open("sqlite", src+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`VACUUM INTO ?`, dst)
+	if err != nil {
+		return err
+	}
+
+	// The copy keeps the WAL setting, which would make opening it later
+	// create -wal and -shm files next to it.
+	dstDB, err := sql.Open("sqlite", dst)
+	if err != nil {
+		return err
+	}
+	defer dstDB.Close()
+
+	_, err = dstDB.Exec(`PRAGMA journal_mode = DELETE`)
+	return err
+}
+
+// schemaVersion reads the migration version recorded by golang-migrate.
+func schemaVersion(path string) (uint, bool, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=query_only(1)")
+	if err != nil {
+		return 0, false, err
+	}
+	defer db.Close()
+
+	var version uint
+	var dirty bool
+	err = db.QueryRow(`SELECT version, dirty FROM schema_migrations`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("reading schema version: %w", err)
+	}
+
+	return version, dirty, nil
+}
+
+// List returns the complete snapshots in dir, oldest first. Directories
+// without a readable manifest are skipped.
+func List(dir string) ([]*Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasSuffix(entry.Name(), tmpSuffix) {
+			continue
+		}
+		snapshot, err := Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// Open reads the manifest of the snapshot in dir.
+func Open(dir string) (*Snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of %s: %w", dir, err)
+	}
+	snapshot.Dir = dir
+
+	return &snapshot, nil
+}
+
+// Find returns the newest snapshot in dir taken at or before at.
+func Find(dir string, at time.Time) (*Snapshot, error) {
+	snapshots, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if !snapshots[i].Created.After(at) {
+			return snapshots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no snapshot in %s taken at or before %s", dir, at.Format(time.RFC3339))
+}
+
+// Verify checks every file of the snapshot against its manifest and runs
+// SQLite's integrity check on the database copy.
+func Verify(s *Snapshot) error {
+	hasDB := false
+	for _, want := range s.Files {
+		got, err := checksum(s.Dir, want.Path)
+		if err != nil {
+			return err
+		}
+		if got.Size != want.Size || got.SHA256 != want.SHA256 {
+			return fmt.Errorf("%s: %s does not match the manifest", s.Name(), want.Path)
+		}
+		if want.Path == dbName {
+			hasDB = true
+		}
+	}
+	if !hasDB {
+		return fmt.Errorf("%s: manifest does not list %s", s.Name(), dbName)
+	}
+
+	db, err := sql.Open("sqlite", filepath.Join(s.Dir, dbName)+"?_pragma=query_only(1)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	err = db.QueryRow(`PRAGMA integrity_check`).Scan(&result)
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s: integrity check failed: %s", s.Name(), result)
+	}
+
+	return nil
+}
+
+// Prune deletes the snapshots in cfg.Dir that the retention policy does not
+// keep and returns them.
+func Prune(cfg Config) ([]*Snapshot, error) {
+	if cfg.KeepLast <= 0 && cfg.KeepDaily <= 0 {
+		return nil, nil
+	}
+
+	snapshots, err := List(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := map[*Snapshot]bool{}
+	days := map[string]bool{}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		s := snapshots[i]
+		if len(snapshots)-i <= cfg.KeepLast {
+			keep[s] = true
+		}
+		day := s.Created.Format("2006-01-02")
+		if !days[day] && len(days) < cfg.KeepDaily {
+			days[day] = true
+			keep[s] = true
+		}
+	}
+
+	var removed []*Snapshot
+	for _, s := range snapshots {
+		if keep[s] {
+			continue
+		}
+		err := os.RemoveAll(s.Dir)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, s)
+	}
+
+	return removed, nil
+}
+
+// Restore replaces the live database and images with the snapshot's. It
+// refuses to run while the server has the database open. The snapshot is
+// verified and its schema version checked against the migrations first.
+// The replaced files are moved aside with a ".pre-restore-<time>" suffix,
+// which is returned.
+func Restore(cfg Config, s *Snapshot) (string, error) {
+	err := Verify(s)
+	if err != nil {
+		return "", err
+	}
+
+	latest, err := latestMigration(cfg.MigrationsDir)
+	if err != nil {
+		return "", err
+	}
+	if s.SchemaVersion > latest {
+		return "", fmt.Errorf("%s has schema version %d, newer than the latest migration %d", s.Name(), s.SchemaVersion, latest)
+	}
+	if s.SchemaVersion > 0 && !hasMigration(cfg.MigrationsDir, s.SchemaVersion) {
+		return "", fmt.Errorf("%s has schema version %d, which no migration in %s matches", s.Name(), s.SchemaVersion, cfg.MigrationsDir)
+	}
+
+	err = checkNotInUse(cfg.DBPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Stage the copies next to their targets so the final renames stay on
+	// one file system.
+	stagedDB := cfg.DBPath + ".restore"
+	stagedImages := cfg.ImagesDir + ".restore"
+	defer os.Remove(stagedDB)
+
+	err = copyFile(filepath.Join(s.Dir, dbName), stagedDB)
+	if err != nil {
+		return "", err
+	}
+	if cfg.ImagesDir != "" {
+		defer os.RemoveAll(stagedImages)
+		_, err = copyDir(filepath.Join(s.Dir, imagesName), stagedImages)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Every rename is undone if a later one fails, so the live files are
+	// either all replaced or all left in place.
+	var done [][2]string
+	move := func(src, dst string) error {
+		err := os.Rename(src, dst)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err == nil {
+			done = append(done, [2]string{src, dst})
+		}
+		return err
+	}
+
+	suffix := ".pre-restore-" + time.Now().UTC().Format(nameLayout)
+	moves := [][2]string{
+		{cfg.DBPath, cfg.DBPath + suffix},
+		{cfg.DBPath + "-wal", cfg.DBPath + "-wal" + suffix},
+		{cfg.DBPath + "-shm", cfg.DBPath + "-shm" + suffix},
+		{stagedDB, cfg.DBPath},
+	}
+	if cfg.ImagesDir != "" {
+		moves = append(moves, [2]string{cfg.ImagesDir, cfg.ImagesDir + suffix}, [2]string{stagedImages, cfg.ImagesDir})
+	}
+	for _, m := range moves {
+		err = move(m[0], m[1])
+		if err != nil {
+			for i := len(done) - 1; i >= 0; i-- {
+				os.Rename(done[i][1], done[i][0])
+			}
+			return "", err
+		}
+	}
+
+	return suffix, nil
+}
+
+// checkNotInUse fails if another connection has the database at path open.
+// In WAL mode, exclusive locking cannot be taken while any other connection
+// is attached to the shared memory file, even an idle one.
+func checkNotInUse(path string) error {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=locking_mode(EXCLUSIVE)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var n int
+	err = db.QueryRow(`SELECT count(*) FROM sqlite_master`).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("%s is in use, stop the server before restoring: %w", path, err)
+	}
+	return nil
+}
+
+// latestMigration returns the highest version among the up migrations in dir.
+func latestMigration(dir string) (uint, error) {
+	versions, err := migrationVersions(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for version := range versions {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+func hasMigration(dir string, version uint) bool {
+	versions, err := migrationVersions(dir)
+	return err == nil && versions[version]
+}
+
+// migrationVersions reads the versions from golang-migrate's file names,
+// which look like 000020_unique_relations.up.sql.
+func migrationVersions(dir string) (map[uint]bool, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no migrations found in %s", dir)
+	}
+
+	versions := map[uint]bool{}
+	for _, match := range matches {
+		var version uint
+		_, err := fmt.Sscanf(filepath.Base(match), "%d_", &version)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected migration file name %s", match)
+		}
+		versions[version] = true
+	}
+	return versions, nil
+}
+
+func checksum(dir, path string) (File, error) {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return File{}, err
+	}
+
+	return File{Path: path, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// copyDir copies the regular files directly in src to dst and returns their
+// names. A missing src is copied as an empty directory.
+func copyDir(src, dst string) ([]string, error) {
+	err := os.MkdirAll(dst, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		err := copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	err = out.Sync()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,300 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/database/sqlite"
+)
+
+const migrations = "../database/migrations"
+
+// newLive creates a migrated database with one user and an images folder
+// with one image, and returns a config pointing at them.
+func newLive(t *testing.T) (Config, *sqlite.SqliteDB) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := Config{
+		DBPath:        filepath.Join(dir, "database.db"),
+		ImagesDir:     filepath.Join(dir, "images"),
+		MigrationsDir: migrations,
+		Dir:           filepath.Join(dir, "backups"),
+	}
+
+	store, err := sqlite.Open(cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if err := sqlite.Migrate(store.DB, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	addUser(t, store.DB, "ann@example.com")
+	if err := os.MkdirAll(cfg.ImagesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(cfg.ImagesDir, "ann.jpg"), "ann")
+
+	return cfg, store
+}
+
+func addUser(t *testing.T, db *sql.DB, email string) {
+	t.Helper()
+
+	_, err := db.Exec(`INSERT INTO users (email, password, first_name, last_name, date_of_birth) VALUES (?, 'x', 'Test', 'User', '1990-01-01')`, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func userEmails(t *testing.T, path string) string {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT email FROM users ORDER BY user_id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			t.Fatal(err)
+		}
+		emails = append(emails, email)
+	}
+	return strings.Join(emails, ",")
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	cfg, store := newLive(t)
+
+	snapshot, err := Create(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := latestMigration(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.SchemaVersion != latest {
+		t.Fatalf("schema version = %d, want %d", snapshot.SchemaVersion, latest)
+	}
+	if len(snapshot.Files) != 2 {
+		t.Fatalf("manifest lists %+v, want the database and one image", snapshot.Files)
+	}
+
+	// Changes after the snapshot are undone by the restore.
+	addUser(t, store.DB, "bob@example.com")
+	writeFile(t, filepath.Join(cfg.ImagesDir, "bob.jpg"), "bob")
+	store.Close()
+
+	suffix, err := Restore(cfg, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := userEmails(t, cfg.DBPath); got != "ann@example.com" {
+		t.Fatalf("restored users = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.ImagesDir, "bob.jpg")); !os.IsNotExist(err) {
+		t.Fatalf("image added after the snapshot survived the restore: %v", err)
+	}
+	if got := userEmails(t, cfg.DBPath+suffix); got != "ann@example.com,bob@example.com" {
+		t.Fatalf("previous database kept aside has users %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.ImagesDir+suffix, "bob.jpg")); err != nil {
+		t.Fatalf("previous images were not kept aside: %v", err)
+	}
+}
+
+func TestRestoreRefusesOpenDatabase(t *testing.T) {
+	cfg, store := newLive(t)
+
+	snapshot, err := Create(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Restore(cfg, snapshot)
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("Restore error = %v, want the database to be reported in use", err)
+	}
+
+	store.Close()
+	if _, err := Restore(cfg, snapshot); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreRejectsCorruptSnapshot(t *testing.T) {
+	cfg, store := newLive(t)
+
+	snapshot, err := Create(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(snapshot.Dir, "images", "ann.jpg"), "tampered")
+
+	if err := Verify(snapshot); err == nil {
+		t.Fatal("Verify accepted a modified image")
+	}
+
+	addUser(t, store.DB, "bob@example.com")
+	store.Close()
+	if _, err := Restore(cfg, snapshot); err == nil {
+		t.Fatal("Restore accepted a modified image")
+	}
+	if got := userEmails(t, cfg.DBPath); got != "ann@example.com,bob@example.com" {
+		t.Fatalf("live database changed by a rejected restore: %q", got)
+	}
+}
+
+func TestRestoreRejectsNewerSchema(t *testing.T) {
+	cfg, store := newLive(t)
+	store.Close()
+
+	snapshot, err := Create(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Code that only knows the first migration cannot run this snapshot.
+	old := t.TempDir()
+	first, err := filepath.Glob(filepath.Join(migrations, "000001_*"))
+	if err != nil || len(first) == 0 {
+		t.Fatalf("first migration not found: %v", err)
+	}
+	for _, path := range first {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(old, filepath.Base(path)), string(data))
+	}
+	cfg.MigrationsDir = old
+
+	_, err = Restore(cfg, snapshot)
+	if err == nil || !strings.Contains(err.Error(), "newer than the latest migration") {
+		t.Fatalf("Restore error = %v, want a schema version error", err)
+	}
+}
+
+// fakeSnapshot writes a manifest-only snapshot, enough for List, Find and
+// Prune.
+func fakeSnapshot(t *testing.T, dir string, created time.Time) {
+	t.Helper()
+
+	path := filepath.Join(dir, created.Format(nameLayout))
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(Snapshot{Created: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(path, manifestName), string(data))
+}
+
+func TestPruneAndFind(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	var all []time.Time
+	for d := 0; d < 4; d++ {
+		for _, hour := range []int{6, 12, 18} {
+			created := day.AddDate(0, 0, d).Add(time.Duration(hour) * time.Hour)
+			fakeSnapshot(t, dir, created)
+			all = append(all, created)
+		}
+	}
+	// An interrupted backup is neither listed nor pruned.
+	if err := os.MkdirAll(filepath.Join(dir, "20240301T000000.000Z"+tmpSuffix), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := Find(dir, day.AddDate(0, 0, 1).Add(13*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := day.AddDate(0, 0, 1).Add(12 * time.Hour); !snapshot.Created.Equal(want) {
+		t.Fatalf("Find picked %s, want %s", snapshot.Created, want)
+	}
+	if _, err := Find(dir, day); err == nil {
+		t.Fatal("Find returned a snapshot taken after the requested time")
+	}
+
+	removed, err := Prune(Config{Dir: dir, KeepLast: 2, KeepDaily: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != len(all)-4 {
+		t.Fatalf("removed %d snapshots, want %d", len(removed), len(all)-4)
+	}
+
+	snapshots, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, s := range snapshots {
+		kept = append(kept, s.Created.Format("Jan 2 15h"))
+	}
+	sort.Strings(kept)
+	// The two newest, plus the newest of each of the three latest days.
+	want := "Mar 11 18h,Mar 12 18h,Mar 13 12h,Mar 13 18h"
+	if got := strings.Join(kept, ","); got != want {
+		t.Fatalf("kept %s, want %s", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20240301T000000.000Z"+tmpSuffix)); err != nil {
+		t.Fatalf("Prune touched an unfinished backup: %v", err)
+	}
+}
+
+func TestSnapshotWithoutImages(t *testing.T) {
+	cfg, store := newLive(t)
+	cfg.ImagesDir = ""
+
+	snapshot, err := Create(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Files) != 1 || snapshot.Files[0].Path != dbName {
+		t.Fatalf("manifest lists %+v, want only the database", snapshot.Files)
+	}
+
+	addUser(t, store.DB, "bob@example.com")
+	store.Close()
+	if _, err := Restore(cfg, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if got := userEmails(t, cfg.DBPath); got != "ann@example.com" {
+		t.Fatalf("restored users = %q", got)
+	}
+}
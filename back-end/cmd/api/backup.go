@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"social-network/backup"
+)
+
+// backupConfig leaves images out when they are kept in S3, which has its own
+// versioning and replication.
+func (app *application) backupConfig() backup.Config {
+	cfg := backup.Config{
+		DBPath:        dbPath,
+		MigrationsDir: "./database/migrations",
+		Dir:           app.config.backup.dir,
+		KeepLast:      app.config.backup.keepLast,
+		KeepDaily:     app.config.backup.keepDaily,
+	}
+	if app.config.media.backend == "local" {
+		cfg.ImagesDir = app.config.media.dir
+	}
+	return cfg
+}
+
+// backupLoop takes a snapshot every interval, checks it and prunes the ones
+// the retention policy no longer keeps. Failures are logged and retried at the
+// next tick.
+func (app *application) backupLoop() {
+	ticker := time.NewTicker(app.config.backup.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cfg := app.backupConfig()
+
+		snapshot, err := backup.Create(cfg)
+		if err != nil {
+			log.Println("Backup failed:", err)
+			continue
+		}
+		err = backup.Verify(snapshot)
+		if err != nil {
+			log.Println("Backup failed verification:", err)
+			continue
+		}
+		log.Println("Backed up to", snapshot.Dir)
+
+		removed, err := backup.Prune(cfg)
+		if err != nil {
+			log.Println("Pruning backups failed:", err)
+		}
+		for _, s := range removed {
+			log.Println("Removed old backup", s.Dir)
+		}
+	}
+}
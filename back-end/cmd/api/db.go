@@ -2,61 +2,76 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/sqlite"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"social-network/database"
+	"social-network/database/postgres"
+	"social-network/database/sqlite"
 )
 
 var dbPath = "./database/database.db"
 
-func openDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbPath)
+func openPostgres(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("a Postgres connection string is required, set -dsn or DATABASE_URL")
+	}
+
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
 
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func (app *application) connectToDB() (*sql.DB, error) {
-	connection, err := openDB()
-	if err != nil {
-		return nil, err
+func (app *application) connectToDB() (database.Store, error) {
+	switch app.config.db {
+	case "sqlite":
+		store, err := sqlite.Open(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Connected to database")
+		return store, nil
+	case "postgres":
+		connection, err := openPostgres(app.config.dsn)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Connected to Postgres database")
+		return &postgres.PostgresDB{DB: connection}, nil
 	}
-	log.Println("Connected to database")
-	return connection, nil
+	return nil, fmt.Errorf("unknown database backend %q", app.config.db)
 }
 
 func (app *application) applyMigrations() error {
-	// Create a new SQLite driver for Golang Migrate
-	db, err := openDB()
-	if err != nil {
-		return err
-	}
-
-	driver, err := sqlite.WithInstance(db, &sqlite.Config{})
-	if err != nil {
-		return err
+	switch app.config.db {
+	case "sqlite":
+		return migrateSqlite()
+	case "postgres":
+		db, err := openPostgres(app.config.dsn)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return postgres.Migrate(db)
 	}
+	return fmt.Errorf("unknown database backend %q", app.config.db)
+}
 
-	// Create a new migration instance
-	m, err := migrate.NewWithDatabaseInstance("file://./database/migrations", "sqlite", driver)
+func migrateSqlite() error {
+	db, err := sqlite.OpenWriter(dbPath)
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 
-	// Migrate the database to the latest version
-	err = m.Up()
-	if err != nil && err != migrate.ErrNoChange {
-		return err
-	}
-
-	return nil
+	return sqlite.Migrate(db, "./database/migrations")
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"social-network/database"
+	"social-network/media"
+)
+
+// Stable, machine-readable error codes sent in the "code" field of every
+// error response. Clients should branch on these and never on the message.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidJSON        = "invalid_json"
+	CodeInvalidForm        = "invalid_form"
+	CodeInvalidParameter   = "invalid_parameter"
+	CodeMissingParameter   = "missing_parameter"
+	CodeValidationFailed   = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodeEmailTaken         = "email_taken"
+	CodeUnsupportedMedia   = "unsupported_media_type"
+	CodeTooLarge           = "too_large"
+	CodeQuotaExceeded      = "quota_exceeded"
+	CodeInternal           = "internal_error"
+)
+
+const internalErrorMessage = "The server encountered a problem and could not process your request"
+
+// APIError is an error that knows how it should be presented to the client.
+// Err holds the underlying cause, which is logged for 5xx responses but never
+// written to the response body.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  map[string]string
+	Err     error
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	errPageNotFound      = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Error 404, page not found"}
+	errMethodNotAllowed  = &APIError{Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed, Message: "Method not allowed"}
+	errUnauthorized      = &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: "You must be logged in to access this resource"}
+	errInvalidCredential = &APIError{Status: http.StatusUnauthorized, Code: CodeInvalidCredentials, Message: "Email or password is not correct!"}
+	errEmailTaken        = &APIError{Status: http.StatusConflict, Code: CodeEmailTaken, Message: "Email already taken"}
+	errUserNotFound      = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "User not found"}
+	errGroupNotFound     = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Group not found"}
+	errEventNotFound     = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Event not found"}
+	errPostNotFound      = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Post not found"}
+	errCommentNotFound   = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Comment not found"}
+	errTargetNotFound    = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Post, comment or message not found"}
+	errMentionNotFound   = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Mention not found"}
+	errImageNotFound     = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Image not found"}
+	errImageLinkExpired  = &APIError{Status: http.StatusForbidden, Code: CodeForbidden, Message: "Image link is invalid or has expired"}
+	errAttachmentMissing = &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "Attachment not found or already sent"}
+	errQuotaExceeded     = &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodeQuotaExceeded, Message: "Your uploads do not fit in your storage quota"}
+)
+
+// errQuota is returned when an upload would take a user over their media
+// quota.
+var errQuota = errors.New("media quota exceeded")
+
+func errInvalidJSON(err error) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidJSON, Message: "Error decoding JSON data: " + err.Error()}
+}
+
+func errInvalidForm(err error) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidForm, Message: "Error parsing form data: " + err.Error()}
+}
+
+func errInvalidParam(name string) *APIError {
+	return errParam(name, "must be a valid integer")
+}
+
+func errParam(name, problem string) *APIError {
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidParameter,
+		Message: fmt.Sprintf("Invalid %s parameter", name),
+		Fields:  map[string]string{name: problem},
+	}
+}
+
+func errMissingParam(name string) *APIError {
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Code:    CodeMissingParameter,
+		Message: fmt.Sprintf("Missing %s parameter", name),
+		Fields:  map[string]string{name: "is required"},
+	}
+}
+
+func errValidation(fields map[string]string) *APIError {
+	return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidationFailed, Message: "Some fields are invalid", Fields: fields}
+}
+
+func errForbidden(message string) *APIError {
+	return &APIError{Status: http.StatusForbidden, Code: CodeForbidden, Message: message}
+}
+
+// errImage maps a failure to store an uploaded image.
+func errImage(err error, limits media.ImageLimits) *APIError {
+	switch {
+	case errors.Is(err, errQuota):
+		return errQuotaExceeded
+	case errors.Is(err, media.ErrUnsupportedImage):
+		return &APIError{Status: http.StatusUnsupportedMediaType, Code: CodeUnsupportedMedia, Message: "Images must be JPEG, PNG, GIF or WebP files"}
+	case errors.Is(err, media.ErrImageTooLarge):
+		message := fmt.Sprintf("Images can be at most %d MB and %d megapixels", limits.MaxBytes>>20, limits.MaxPixels/1_000_000)
+		return &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodeTooLarge, Message: message}
+	}
+	return errInternal(err, "Error saving image file")
+}
+
+// errAttachment maps a failure to store an uploaded attachment.
+func errAttachment(err error, limits media.AttachmentLimits) *APIError {
+	switch {
+	case errors.Is(err, errQuota):
+		return errQuotaExceeded
+	case errors.Is(err, media.ErrUnsupportedImage), errors.Is(err, media.ErrUnsupportedFile):
+		return &APIError{Status: http.StatusUnsupportedMediaType, Code: CodeUnsupportedMedia, Message: "Attachments must be JPEG, PNG, GIF or WebP images, MP4 or WebM videos or PDF documents"}
+	case errors.Is(err, media.ErrImageTooLarge), errors.Is(err, media.ErrFileTooLarge), errors.Is(err, media.ErrVideoTooLong):
+		message := fmt.Sprintf("Images can be at most %d MB and %d megapixels, videos %d MB and %d seconds, and documents %d MB",
+			limits.Image.MaxBytes>>20, limits.Image.MaxPixels/1_000_000, limits.MaxVideoBytes>>20, int(limits.MaxVideoLength.Seconds()), limits.MaxDocumentBytes>>20)
+		return &APIError{Status: http.StatusRequestEntityTooLarge, Code: CodeTooLarge, Message: message}
+	}
+	return errInternal(err, "Error saving attachment")
+}
+
+// errInternal wraps an unexpected failure. The context and cause end up in
+// the server log only; the client receives a generic message.
+func errInternal(err error, context string) *APIError {
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: internalErrorMessage, Err: fmt.Errorf("%s: %w", context, err)}
+}
+
+// errSession maps a failure to resolve the current session to a 401 unless the
+// database itself failed.
+func errSession(err error) *APIError {
+	if errors.Is(err, database.ErrNoSession) {
+		return errUnauthorized
+	}
+	return errInternal(err, "Error getting data from user sessions")
+}
+
+// errLookup turns sql.ErrNoRows into the given not-found error and anything
+// else into an internal error.
+func errLookup(err error, notFound *APIError, context string) *APIError {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+	return errInternal(err, context)
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"social-network/media"
+	"social-network/models"
+)
+
+// mediaCollection counts what collectMedia did.
+type mediaCollection struct {
+	attachments int // unsent attachments deleted
+	files       int // files removed from the media store
+	adopted     int // files in use that had not been recorded
+	sized       int // recorded files whose size was filled in
+}
+
+// collectMedia cleans up after uploads that were never used: attachments
+// uploaded for a chat message that was never sent, recorded files nothing
+// refers to any more and files in the media store that were never recorded,
+// such as those of a post that failed to save. Anything stored or reused
+// within the -media-gc-grace period is kept, as the upload it belongs to may
+// not refer to it yet.
+func (app *application) collectMedia(ctx context.Context) (mediaCollection, error) {
+	var result mediaCollection
+	before := time.Now().Add(-app.config.media.gc.grace)
+
+	var err error
+	result.attachments, err = app.database.DeletePendingAttachments(before)
+	if err != nil {
+		return result, err
+	}
+
+	unused, err := app.database.UnusedMediaFiles(before)
+	if err != nil {
+		return result, err
+	}
+	for _, name := range unused {
+		removable, err := app.database.DeleteMediaFile(name, before)
+		if err != nil {
+			return result, err
+		}
+		if !removable {
+			continue
+		}
+		err = app.removeFiles(ctx, name)
+		if err != nil {
+			return result, err
+		}
+		result.files++
+	}
+
+	err = app.sweepMedia(ctx, before, &result)
+	return result, err
+}
+
+type storedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// sweepMedia goes through the media store for files without a row. Those in
+// use, stored before files were recorded, get one; the rest are removed once
+// they are older than before. Rows from before sizes were known get the size
+// of their files.
+func (app *application) sweepMedia(ctx context.Context, before time.Time, result *mediaCollection) error {
+	files := make(map[string]storedFile)
+	err := app.media.List(ctx, func(name string, size int64, modTime time.Time) error {
+		files[name] = storedFile{size: size, modTime: modTime}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Variants are handled with the file they were made from.
+	variants := make(map[string][]string)
+	isVariant := make(map[string]bool)
+	for name := range files {
+		for _, v := range media.Variants {
+			variantName := media.VariantName(name, v.Name)
+			if _, ok := files[variantName]; ok && variantName != name {
+				variants[name] = append(variants[name], variantName)
+				isVariant[variantName] = true
+			}
+		}
+	}
+
+	sizes, err := app.database.MediaFileSizes()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if !isVariant[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		size, modTime := files[name].size, files[name].modTime
+		for _, variantName := range variants[name] {
+			size += files[variantName].size
+			if files[variantName].modTime.After(modTime) {
+				modTime = files[variantName].modTime
+			}
+		}
+
+		if recorded, ok := sizes[name]; ok {
+			if recorded == 0 && size > 0 {
+				err := app.database.SetMediaFileSize(name, size)
+				if err != nil {
+					return err
+				}
+				result.sized++
+			}
+			continue
+		}
+		if !modTime.Before(before) {
+			continue
+		}
+
+		used, err := app.database.ImageInUse(name)
+		if err != nil {
+			return err
+		}
+		if used {
+			_, err := app.database.AddMediaFile(models.MediaFile{Name: name, Size: size})
+			if err != nil {
+				return err
+			}
+			result.adopted++
+			continue
+		}
+		err = app.removeFiles(ctx, name)
+		if err != nil {
+			return err
+		}
+		result.files++
+	}
+	return nil
+}
+
+// mediaGCLoop collects unused media when the server starts and then every
+// interval. Failures are logged and retried at the next tick.
+func (app *application) mediaGCLoop() {
+	ticker := time.NewTicker(app.config.media.gc.interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := app.collectMedia(context.Background())
+		if err != nil {
+			log.Println("Collecting unused media failed:", err)
+		}
+		if result != (mediaCollection{}) {
+			log.Printf("Collected media: deleted %d unsent attachments, removed %d files, recorded %d files and the size of %d",
+				result.attachments, result.files, result.adopted, result.sized)
+		}
+		<-ticker.C
+	}
+}
@@ -1,28 +1,27 @@
 package main
 
 import (
-	"crypto/rand"
+	"context"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"social-network/entities"
+	"social-network/media"
 	"social-network/models"
+	"social-network/validator"
 
 	"github.com/gorilla/websocket"
 )
 
-type SqliteDB struct {
-	DB *sql.DB
-}
-
 func (app *application) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	var payload = struct {
 		Status  string `json:"status"`
@@ -38,19 +37,18 @@ func (app *application) HomeHandler(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/register" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
-	// Parse the multipart form data to handle file uploads
-	err := r.ParseMultipartForm(10) // 10 MB max file size
+	err := app.parseUploadForm(w, r, false)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error parsing form data"), http.StatusBadRequest)
+		app.errorJSON(w, err)
 		return
 	}
 
@@ -62,48 +60,45 @@ func (app *application) RegisterHandler(w http.ResponseWriter, r *http.Request)
 	nickname := r.FormValue("nickname")
 	aboutMe := r.FormValue("about_me")
 
-	avatarFile, _, err := r.FormFile("avatar")
-	var avatarFileName string
-	if err != nil {
-		avatarFileName = ""
-	} else {
-		defer avatarFile.Close()
-
-		avatarFolderPath := "database/images/"
-		avatarFileName = firstName + lastName + ".jpg"
-		avatarFileData, err := ioutil.ReadAll(avatarFile)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error reading avatar file"), http.StatusInternalServerError)
-			return
-		}
-
-		err = ioutil.WriteFile(avatarFolderPath+avatarFileName, avatarFileData, 0644)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error saving avatar file"), http.StatusInternalServerError)
-			return
-		}
-	}
-
 	userData := models.UserData{
 		Email:       email,
 		Password:    password,
 		FirstName:   firstName,
 		LastName:    lastName,
 		DateOfBirth: dateOfBirth,
-		Avatar:      avatarFileName,
 		Nickname:    nickname,
 		AboutMe:     aboutMe,
 	}
 
-	_, err = app.database.CheckEmail(userData.Email)
+	if errs := validator.Struct(&userData); errs != nil {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+
+	emailTaken, err := app.database.CheckEmail(userData.Email)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error checking email"))
+		return
+	}
+	if emailTaken {
+		app.errorJSON(w, errEmailTaken)
+		return
+	}
+
+	avatarFileName, err := app.saveImage(r, "avatar", 0)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Email already taken"), http.StatusConflict)
+		app.errorJSON(w, errImage(err, app.config.media.limits.Image))
 		return
 	}
 
+	userData.Avatar = avatarFileName
+
 	err = app.database.Register(&userData)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Email already taken"), http.StatusInternalServerError)
+		if err := app.deleteImage(r.Context(), avatarFileName); err != nil {
+			log.Println("Error deleting avatar:", err)
+		}
+		app.errorJSON(w, errInternal(err, "Error registering user"))
 		return
 	}
 
@@ -113,30 +108,30 @@ func (app *application) RegisterHandler(w http.ResponseWriter, r *http.Request)
 
 func (app *application) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/login" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var userData models.UserData
 	err := app.readJSON(w, r, &userData)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	err = app.database.Login(&userData)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Email or password is not correct!"), http.StatusUnauthorized)
+		app.errorJSON(w, errInvalidCredential)
 		return
 	} else {
 		userId, email, firstName, lastName, err := app.database.DataFromUserData(&userData)
 		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error getting data from user data"), http.StatusInternalServerError)
+			app.errorJSON(w, errInternal(err, "Error getting data from user data"))
 			return
 		}
 		cookieValue := app.addCookie(w, userId, email, firstName, lastName)
@@ -150,50 +145,52 @@ func (app *application) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) LogOutHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/logout" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	err := app.deleteCookie(r)
 	if err != nil {
-		return 
+		app.errorJSON(w, errInternal(err, "Error deleting session"))
+		return
 	}
 	w.WriteHeader(http.StatusAccepted)
 }
 
 func (app *application) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/profile" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, email, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the email"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	userData, err := app.database.GetUserDataByEmail(email)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get user data"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get user data"))
 		return
 	}
 
-	allPosts, err := app.database.ProfilePosts(userID)
+	page, err := app.readPage(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, err)
 		return
 	}
 
-	for i := range allPosts {
-		postID := allPosts[i].PostID
-		comments, err := app.database.GetCommentsByPostID(postID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error getting comments from the database"), http.StatusInternalServerError)
-			return
-		}
+	allPosts, cursors, err := app.database.ProfilePosts(userID, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
+		return
+	}
 
-		allPosts[i].Comments = comments
+	err = app.attachComments(userID, allPosts)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting comments from the database"))
+		return
 	}
 
 	userDataWithPosts := struct {
@@ -204,67 +201,148 @@ func (app *application) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		Posts:    allPosts,
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, userDataWithPosts)
+	_ = app.writeJSON(w, http.StatusOK, userDataWithPosts, app.pageLinks(r, page, cursors))
 }
 
 func (app *application) MainPageHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/main" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	_, email, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the email"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	userData, err := app.database.GetUserDataByEmail(email)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get user data"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get user data"))
 		return
 	}
 
 	_ = app.writeJSON(w, http.StatusOK, userData)
 }
 
+// SearchHandler finds users, posts, comments, groups and events the user may
+// see by the words in them, best matches first. Filters by type, author,
+// group and date are read by readSearch.
 func (app *application) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/search" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	query := r.URL.Query().Get("query")
 	if query == "" {
-		http.Error(w, "Missing search query", http.StatusBadRequest)
+		app.errorJSON(w, errMissingParam("query"))
 		return
 	}
 
-	users, err := app.database.SearchUsers(query)
+	search, err := app.readSearch(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error searching users: %s", err), http.StatusInternalServerError)
+		app.errorJSON(w, err)
 		return
 	}
+	search.Terms = entities.SearchTerms(query)
 
-	_ = app.writeJSON(w, http.StatusOK, users)
+	page, err := app.readSearchPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	results, cursors, err := app.database.Search(userID, search, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error searching"))
+		return
+	}
+
+	for i := range results {
+		snippet, highlights := entities.Highlights(results[i].Snippet)
+		results[i].Snippet = snippet
+		for _, h := range highlights {
+			results[i].Highlights = append(results[i].Highlights, models.Highlight{Offset: h.Offset, Length: h.Length})
+		}
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, results, app.searchLinks(r, page, cursors))
+}
+
+// searchTypes are the result types the "type" parameter of /search accepts.
+var searchTypes = []string{models.SearchUser, models.SearchPost, models.SearchComment, models.SearchGroup, models.SearchEvent}
+
+// readSearch reads the optional filters of a search: "type", a comma
+// separated list of result types, "author" and "group" IDs, and "from" and
+// "to" dates, both included.
+func (app *application) readSearch(r *http.Request) (models.SearchQuery, error) {
+	var search models.SearchQuery
+	query := r.URL.Query()
+
+	if types := query.Get("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			known := false
+			for _, searchType := range searchTypes {
+				known = known || t == searchType
+			}
+			if !known {
+				return search, errParam("type", "must be a list of "+strings.Join(searchTypes, ", "))
+			}
+			search.Types = append(search.Types, t)
+		}
+	}
+
+	ids := map[string]*int{"author": &search.AuthorID, "group": &search.GroupID}
+	for _, name := range []string{"author", "group"} {
+		if value := query.Get(name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil || id < 1 {
+				return search, errInvalidParam(name)
+			}
+			*ids[name] = id
+		}
+	}
+
+	dates := map[string]*time.Time{"from": &search.From, "to": &search.To}
+	for _, name := range []string{"from", "to"} {
+		if value := query.Get(name); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return search, errParam(name, "must be a date such as 2006-01-02")
+			}
+			*dates[name] = date
+		}
+	}
+	if !search.To.IsZero() {
+		search.To = search.To.AddDate(0, 0, 1)
+	}
+
+	return search, nil
 }
 
 func (app *application) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 	userID, _, firstName, lastName, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	followers, err := app.database.Followers(userID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
 		return
 	}
 
 	followings, err := app.database.Following(userID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
 		return
 	}
 
@@ -300,373 +378,1958 @@ func (app *application) GetUsersHandler(w http.ResponseWriter, r *http.Request)
 
 func (app *application) UserHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 	id := strings.TrimPrefix(r.URL.Path, "/user/")
 	id1, err := strconv.Atoi(id)
 	if err != nil {
-		return 
+		app.errorJSON(w, errInvalidParam("id"))
+		return
+	}
+
+	user, err := app.database.GetUser(id1)
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errUserNotFound, "Error getting user from the database"))
+		return
+	}
+
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	followers, err := app.database.Followers(user.UserID)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
+		return
+	}
+
+	following, err := app.database.Following(user.UserID)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
+		return
+	}
+
+	filteredPosts, cursors, err := app.database.UserPosts(userID, user.UserID, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting posts from the database"))
+		return
+	}
+
+	err = app.attachComments(userID, filteredPosts)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting comments from the database"))
+		return
+	}
+
+	userDataWithPosts := struct {
+		CurrentUser int               `json:"current_user"`
+		UserData    *models.UserData  `json:"user_data"`
+		Followers   []models.UserData `json:"followers"`
+		Following   []models.UserData `json:"following"`
+		Posts       []models.Post     `json:"posts"`
+	}{
+		CurrentUser: userID,
+		UserData:    user,
+		Followers:   followers,
+		Following:   following,
+		Posts:       filteredPosts,
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, userDataWithPosts, app.pageLinks(r, page, cursors))
+}
+
+func (app *application) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/create-post" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	err := app.parseUploadForm(w, r, true)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	content := r.FormValue("content")
+	privacy := r.FormValue("privacy")
+	selectedUserID := r.FormValue("selected_user_id")
+	groupID := r.FormValue("group_id")
+	var groupIDInt int
+	if groupID != "" && groupID != "undefined" {
+		groupIDInt, err = strconv.Atoi(groupID)
+		if err != nil {
+			app.errorJSON(w, errInvalidParam("group_id"))
+			return
+		}
+	} else {
+		groupIDInt = 0
+	}
+
+	files, attachments := attachmentForm(r)
+	post := models.Post{
+		Content:        content,
+		Privacy:        privacy,
+		SelectedUserID: selectedUserID,
+		GroupID:        groupIDInt,
+		Attachments:    attachments,
+	}
+
+	if errs := validator.Struct(&post); errs != nil {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+
+	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	post.Mentions, err = app.findMentions(post.Content)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error looking up mentions"))
+		return
+	}
+	post.Hashtags = findHashtags(post.Content)
+
+	err = app.saveAttachments(r.Context(), userId, files, post.Attachments)
+	if err != nil {
+		app.errorJSON(w, errAttachment(err, app.config.media.limits))
+		return
+	}
+
+	post.Image = firstImage(post.Attachments)
+
+	post.UserID = userId
+	post.FirstName = firstName
+	post.LastName = lastName
+
+	err = app.database.CreatePost(&post)
+	if err != nil {
+		app.discardAttachments(r.Context(), post.Attachments)
+		app.errorJSON(w, errInternal(err, "Error adding data to the database"))
+		return
+	}
+	app.notifyMentions(models.Target{PostID: post.PostID}, models.UserData{UserID: userId, FirstName: firstName, LastName: lastName}, post.Mentions, nil)
+	//including an empty comments array for the newly created post.
+	post.Comments = make([]models.Comment, 0)
+	post.Reactions = reactionsOf(nil, post.PostID)
+	post.ImageURL, post.ImageVariants = app.imageLinks(post.Image)
+	app.attachmentLinks(post.Attachments)
+
+	_ = app.writeJSON(w, http.StatusOK, post)
+}
+
+// EditPostHandler replaces the content, privacy, audience and attachments of
+// a post, keeping the version before as a revision. Attachments to keep are
+// listed by ID in the keep field, in their new order, with keep_alt_text
+// beside them; new files follow them.
+func (app *application) EditPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/edit-post" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	err := app.parseUploadForm(w, r, true)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		app.errorJSON(w, errInvalidParam("post_id"))
+		return
+	}
+
+	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	apiErr := app.checkPostAuthor(postID, userId, "Only the author can edit a post")
+	if apiErr != nil {
+		app.errorJSON(w, apiErr)
+		return
+	}
+
+	current, err := app.database.AttachmentsForPosts([]int{postID})
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting attachments from the database"))
+		return
+	}
+	mentioned, err := app.database.MentionsForPosts([]int{postID})
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting mentions from the database"))
+		return
+	}
+	kept, apiErr := keptAttachments(r, current[postID])
+	if apiErr != nil {
+		app.errorJSON(w, apiErr)
+		return
+	}
+
+	files, attachments := attachmentForm(r)
+	post := models.Post{
+		PostID:         postID,
+		UserID:         userId,
+		Content:        r.FormValue("content"),
+		Privacy:        r.FormValue("privacy"),
+		SelectedUserID: r.FormValue("selected_user_id"),
+		Attachments:    append(kept, attachments...),
+	}
+
+	if errs := validator.Struct(&post); errs != nil {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+
+	post.Mentions, err = app.findMentions(post.Content)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error looking up mentions"))
+		return
+	}
+	post.Hashtags = findHashtags(post.Content)
+
+	added := post.Attachments[len(kept):]
+	err = app.saveAttachments(r.Context(), userId, files, added)
+	if err != nil {
+		app.errorJSON(w, errAttachment(err, app.config.media.limits))
+		return
+	}
+
+	post.Image = firstImage(post.Attachments)
+	post.FirstName = firstName
+	post.LastName = lastName
+
+	err = app.database.UpdatePost(&post)
+	if err != nil {
+		app.discardAttachments(r.Context(), added)
+		app.errorJSON(w, errLookup(err, errPostNotFound, "Error updating post"))
+		return
+	}
+	app.notifyMentions(models.Target{PostID: post.PostID}, models.UserData{UserID: userId, FirstName: firstName, LastName: lastName}, post.Mentions, mentioned[postID])
+	post.Comments = make([]models.Comment, 0)
+	post.Reactions, err = app.targetReactions(userId, models.Target{PostID: post.PostID})
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting reactions from the database"))
+		return
+	}
+	post.ImageURL, post.ImageVariants = app.imageLinks(post.Image)
+	app.attachmentLinks(post.Attachments)
+
+	_ = app.writeJSON(w, http.StatusOK, post)
+}
+
+// keptAttachments returns the attachments of a post listed in the keep
+// field, in that order, with the alt text sent in keep_alt_text.
+func keptAttachments(r *http.Request, current []models.Attachment) ([]models.Attachment, *APIError) {
+	byID := make(map[int]models.Attachment, len(current))
+	for _, a := range current {
+		byID[a.AttachmentID] = a
+	}
+
+	var keep, altTexts []string
+	if r.MultipartForm != nil {
+		keep, altTexts = r.MultipartForm.Value["keep"], r.MultipartForm.Value["keep_alt_text"]
+	}
+	kept := make([]models.Attachment, 0, len(keep))
+	for i, value := range keep {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errInvalidParam("keep")
+		}
+		a, ok := byID[id]
+		if !ok {
+			return nil, errParam("keep", fmt.Sprintf("attachment %d is not on this post", id))
+		}
+		delete(byID, id)
+		if i < len(altTexts) {
+			a.AltText = strings.TrimSpace(altTexts[i])
+		}
+		kept = append(kept, a)
+	}
+	return kept, nil
+}
+
+func (app *application) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/delete-post" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	var request models.Post
+	err := app.readJSON(w, r, &request)
+	if err != nil {
+		app.errorJSON(w, errInvalidJSON(err))
+		return
+	}
+
+	userId, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	apiErr := app.checkPostAuthor(request.PostID, userId, "Only the author can delete a post")
+	if apiErr != nil {
+		app.errorJSON(w, apiErr)
+		return
+	}
+
+	names, err := app.database.DeletePost(request.PostID)
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errPostNotFound, "Error deleting post"))
+		return
+	}
+	for _, name := range names {
+		err := app.deleteImage(r.Context(), name)
+		if err != nil {
+			log.Println("Error deleting post file:", err)
+		}
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{Message: "Post deleted"})
+}
+
+// PostRevisionsHandler lists the earlier versions of a post to its author
+// and to moderators.
+func (app *application) PostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/post-revisions" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	postID, err := strconv.Atoi(r.URL.Query().Get("postId"))
+	if err != nil {
+		app.errorJSON(w, errInvalidParam("postId"))
+		return
+	}
+
+	userId, email, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	if !app.isModerator(email) {
+		apiErr := app.checkPostAuthor(postID, userId, "Only the author and moderators can see earlier versions of a post")
+		if apiErr != nil {
+			app.errorJSON(w, apiErr)
+			return
+		}
+	}
+
+	revisions, err := app.database.PostRevisions(postID)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting revisions from the database"))
+		return
+	}
+	if revisions == nil {
+		revisions = make([]models.PostRevision, 0)
+	}
+	for i := range revisions {
+		app.attachmentLinks(revisions[i].Attachments)
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, revisions)
+}
+
+// checkPostAuthor returns an error unless the post exists and was written
+// by userID.
+func (app *application) checkPostAuthor(postID, userID int, forbidden string) *APIError {
+	authorID, err := app.database.PostAuthor(postID)
+	if err != nil {
+		return errLookup(err, errPostNotFound, "Error getting post from the database")
+	}
+	if authorID != userID {
+		return errForbidden(forbidden)
+	}
+	return nil
+}
+
+// saveImage checks the image uploaded in field and stores it under a new
+// random name, see storeUpload. It returns the file name, or "" if no file
+// was sent. The image must fit in the quota of the user, if there is one.
+func (app *application) saveImage(r *http.Request, field string, userID int) (string, error) {
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		return "", nil
+	}
+	defer file.Close()
+
+	img, err := media.ProcessImage(file, app.config.media.limits.Image)
+	if err != nil {
+		return "", err
+	}
+	left, err := app.quotaLeft(userID)
+	if err == nil {
+		err = takeQuota(&left, img)
+	}
+	if err != nil {
+		return "", err
+	}
+	return app.storeUpload(r.Context(), img)
+}
+
+// attachmentForm returns the files uploaded in the attachments field of a
+// multipart form, after the one in the image field older clients send, and
+// an attachment for each. Alt text is read from the alt_text values, in the
+// same order as the attachments field. The files are only read by
+// saveAttachments, once the rest of the form is known to be valid.
+func attachmentForm(r *http.Request) ([]*multipart.FileHeader, []models.Attachment) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+
+	legacy := r.MultipartForm.File["image"]
+	files := append(legacy[:len(legacy):len(legacy)], r.MultipartForm.File["attachments"]...)
+	attachments := make([]models.Attachment, len(files))
+	for i, altText := range r.MultipartForm.Value["alt_text"] {
+		if len(legacy)+i < len(attachments) {
+			attachments[len(legacy)+i].AltText = strings.TrimSpace(altText)
+		}
+	}
+	return files, attachments
+}
+
+// saveAttachments checks and stores each file, filling in its attachment.
+// Together the files must fit in the user's quota. If one fails, the files
+// stored before it are removed again.
+func (app *application) saveAttachments(ctx context.Context, userID int, files []*multipart.FileHeader, attachments []models.Attachment) error {
+	left, err := app.quotaLeft(userID)
+	if err != nil {
+		return err
+	}
+
+	for i, header := range files {
+		upload, err := processAttachment(header, app.config.media.limits)
+		if err == nil {
+			err = takeQuota(&left, upload)
+		}
+		if err == nil {
+			attachments[i].Name, err = app.storeUpload(ctx, upload)
+		}
+		if err != nil {
+			app.discardAttachments(ctx, attachments[:i])
+			return err
+		}
+
+		attachments[i].MimeType = upload.ContentType
+		attachments[i].Width = upload.Width
+		attachments[i].Height = upload.Height
+		attachments[i].Size = int64(len(upload.Data))
+	}
+	return nil
+}
+
+// takeQuota subtracts the upload from the bytes left in a quota, negative
+// for none, or returns errQuota if it does not fit.
+func takeQuota(left *int64, upload *media.Upload) error {
+	if *left < 0 {
+		return nil
+	}
+	size := uploadSize(upload)
+	if size > *left {
+		return errQuota
+	}
+	*left -= size
+	return nil
+}
+
+func processAttachment(header *multipart.FileHeader, limits media.AttachmentLimits) (*media.Upload, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return media.ProcessAttachment(file, limits)
+}
+
+// discardAttachments removes the files of attachments that were stored but
+// could not be saved with their post, comment or message.
+func (app *application) discardAttachments(ctx context.Context, attachments []models.Attachment) {
+	for _, a := range attachments {
+		err := app.deleteImage(ctx, a.Name)
+		if err != nil {
+			log.Println("Error deleting attachment:", err)
+		}
+	}
+}
+
+// firstImage returns the name of the first image among attachments, which
+// older clients show as the image of a post or comment.
+func firstImage(attachments []models.Attachment) string {
+	for _, a := range attachments {
+		if strings.HasPrefix(a.MimeType, "image/") {
+			return a.Name
+		}
+	}
+	return ""
+}
+
+// parseUploadForm parses a multipart form, refusing bodies much larger than
+// its uploads may be: a single image or, with attachments set, as many
+// attachments as a post can carry.
+func (app *application) parseUploadForm(w http.ResponseWriter, r *http.Request, attachments bool) error {
+	limits := app.config.media.limits
+	limit, tooLarge := limits.Image.MaxBytes, errImage(media.ErrImageTooLarge, limits.Image)
+	if attachments {
+		limit, tooLarge = models.MaxAttachments*limits.MaxBytes(), errAttachment(media.ErrFileTooLarge, limits)
+	}
+	limit += maxFormFieldsSize
+	if r.ContentLength > limit {
+		return tooLarge
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	err := r.ParseMultipartForm(maxFormMemory)
+	if err != nil {
+		return errInvalidForm(err)
+	}
+	return nil
+}
+
+// ImageHandler serves an uploaded image, either by streaming it from the
+// media store or, with -s3-redirect, by redirecting to a signed URL. Links
+// made by imageURL work on their own; otherwise the logged in user must be
+// allowed to see the post or comment the image belongs to.
+func (app *application) ImageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/images/")
+	if !media.ValidName(name) {
+		app.errorJSON(w, errImageNotFound)
+		return
+	}
+
+	if r.URL.Query().Has("sig") {
+		if !app.validImageSignature(name, r.URL.Query()) {
+			app.errorJSON(w, errImageLinkExpired)
+			return
+		}
+	} else {
+		userID, _, _, _, err := app.database.DataFromSession(r)
+		if err != nil {
+			app.errorJSON(w, errSession(err))
+			return
+		}
+
+		visible, err := app.database.CanViewImage(userID, name)
+		if err != nil {
+			app.errorJSON(w, errInternal(err, "Error checking image access"))
+			return
+		}
+		if !visible {
+			app.errorJSON(w, errImageNotFound)
+			return
+		}
+	}
+
+	// Images uploaded before variants were made only have the original.
+	file := name
+	if size := r.URL.Query().Get("size"); size != "" {
+		if !media.IsVariant(size) {
+			app.errorJSON(w, errParam("size", "must be one of small, medium or large"))
+			return
+		}
+		file = media.VariantName(name, size)
+	}
+	image, err := app.media.Open(r.Context(), file)
+	if errors.Is(err, media.ErrNotFound) && file != name {
+		file = name
+		image, err = app.media.Open(r.Context(), file)
+	}
+	if errors.Is(err, media.ErrNotFound) {
+		app.errorJSON(w, errImageNotFound)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error reading image"))
+		return
+	}
+	defer image.Close()
+
+	if signer, ok := app.media.(media.Signer); ok && app.config.media.redirect {
+		url, err := signer.SignedURL(r.Context(), file, signedURLExpiry)
+		if err != nil {
+			app.errorJSON(w, errInternal(err, "Error signing image URL"))
+			return
+		}
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+
+	if image.ContentType != "" {
+		w.Header().Set("Content-Type", image.ContentType)
+	}
+	// Documents are downloaded rather than opened on this origin.
+	if !strings.HasPrefix(image.ContentType, "image/") && !strings.HasPrefix(image.ContentType, "video/") {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private")
+	http.ServeContent(w, r, file, image.ModTime, image)
+}
+
+// AvatarHandler replaces the avatar of the logged in user with the image
+// uploaded as avatar, or removes it on DELETE. It answers with the user's
+// data.
+func (app *application) AvatarHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/avatar" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	avatar := ""
+	if r.Method == http.MethodPost {
+		err = app.parseUploadForm(w, r, false)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+
+		avatar, err = app.saveImage(r, "avatar", userID)
+		if err != nil {
+			app.errorJSON(w, errImage(err, app.config.media.limits.Image))
+			return
+		}
+		if avatar == "" {
+			app.errorJSON(w, errMissingParam("avatar"))
+			return
+		}
+	}
+
+	previous, err := app.database.SetAvatar(userID, avatar)
+	if err != nil {
+		if err := app.deleteImage(r.Context(), avatar); err != nil {
+			log.Println("Error deleting avatar:", err)
+		}
+		app.errorJSON(w, errLookup(err, errUserNotFound, "Error updating avatar"))
+		return
+	}
+	err = app.deleteImage(r.Context(), previous)
+	if err != nil {
+		log.Println("Error deleting avatar:", err)
+	}
+
+	user, err := app.database.GetUser(userID)
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errUserNotFound, "Error getting user data"))
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, user)
+}
+
+// AttachmentsHandler stores files ahead of the chat message they will be
+// sent with. The message links them by the returned IDs.
+func (app *application) AttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/attachments" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	err = app.parseUploadForm(w, r, true)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	files, attachments := attachmentForm(r)
+	if len(files) == 0 {
+		app.errorJSON(w, errMissingParam("attachments"))
+		return
+	}
+
+	errs := validator.Errors{}
+	models.ValidateAttachments(errs, attachments)
+	if len(errs) > 0 {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+
+	err = app.saveAttachments(r.Context(), userID, files, attachments)
+	if err != nil {
+		app.errorJSON(w, errAttachment(err, app.config.media.limits))
+		return
+	}
+
+	err = app.database.CreateAttachments(userID, attachments)
+	if err != nil {
+		app.discardAttachments(r.Context(), attachments)
+		app.errorJSON(w, errInternal(err, "Error adding data to the database"))
+		return
+	}
+	app.attachmentLinks(attachments)
+
+	_ = app.writeJSON(w, http.StatusCreated, attachments)
+}
+
+// MediaUsageHandler reports the storage each user takes up, most first.
+func (app *application) MediaUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/admin/media-usage" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	report, err := app.database.MediaUsageReport()
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting media usage"))
+		return
+	}
+	if report == nil {
+		report = []models.MediaUsage{}
+	}
+	for i := range report {
+		report[i].Limit = app.mediaLimit(report[i])
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, report)
+}
+
+// MediaQuotaHandler sets the quota of one user and answers with their usage.
+func (app *application) MediaQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/admin/media-quota" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	var quota models.MediaQuota
+	err := app.readJSON(w, r, &quota)
+	if err != nil {
+		app.errorJSON(w, errInvalidJSON(err))
+		return
+	}
+
+	if errs := validator.Struct(&quota); errs != nil {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+
+	err = app.database.SetMediaQuota(quota.UserID, quota.Quota)
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errUserNotFound, "Error setting media quota"))
+		return
+	}
+
+	usage, err := app.database.MediaUsage(quota.UserID)
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errUserNotFound, "Error getting media usage"))
+		return
+	}
+	usage.Limit = app.mediaLimit(usage)
+
+	_ = app.writeJSON(w, http.StatusOK, usage)
+}
+
+func (app *application) AllPostsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/all-posts" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	filteredPosts, cursors, err := app.database.FeedPosts(userID, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting posts from the database"))
+		return
+	}
+
+	err = app.attachComments(userID, filteredPosts)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting comments from the database"))
+		return
+	}
+
+	err = app.followedTags(userID, filteredPosts)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting followed hashtags from the database"))
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, filteredPosts, app.pageLinks(r, page, cursors))
+}
+
+func (app *application) CommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/create-comment" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	err := app.parseUploadForm(w, r, true)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	commentContent := r.FormValue("comment")
+	postID := r.FormValue("post_id")
+	var postIDInt int
+	postIDInt, err = strconv.Atoi(postID)
+	if err != nil {
+		app.errorJSON(w, errInvalidParam("post_id"))
+		return
+	}
+
+	var parentID int
+	if r.FormValue("parent_id") != "" {
+		parentID, err = strconv.Atoi(r.FormValue("parent_id"))
+		if err != nil {
+			app.errorJSON(w, errInvalidParam("parent_id"))
+			return
+		}
+	}
+
+	files, attachments := attachmentForm(r)
+	comment := models.Comment{
+		PostID:      postIDInt,
+		ParentID:    parentID,
+		Comment:     commentContent,
+		Attachments: attachments,
+	}
+
+	if errs := validator.Struct(&comment); errs != nil {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+
+	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	if comment.ParentID != 0 {
+		apiErr := app.checkReply(&comment)
+		if apiErr != nil {
+			app.errorJSON(w, apiErr)
+			return
+		}
+	}
+
+	comment.Mentions, err = app.findMentions(comment.Comment)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error looking up mentions"))
+		return
+	}
+	comment.Hashtags = findHashtags(comment.Comment)
+
+	err = app.saveAttachments(r.Context(), userId, files, comment.Attachments)
+	if err != nil {
+		app.errorJSON(w, errAttachment(err, app.config.media.limits))
+		return
+	}
+
+	comment.Image = firstImage(comment.Attachments)
+
+	comment.UserID = userId
+	comment.FirstName = firstName
+	comment.LastName = lastName
+
+	err = app.database.CreateComment(&comment)
+	if err != nil {
+		app.discardAttachments(r.Context(), comment.Attachments)
+		app.errorJSON(w, errInternal(err, "Error adding data to the database"))
+		return
+	}
+	app.notifyMentions(models.Target{CommentID: comment.CommentID}, models.UserData{UserID: userId, FirstName: firstName, LastName: lastName}, comment.Mentions, nil)
+	comment.Reactions = reactionsOf(nil, comment.CommentID)
+	comment.ImageURL, comment.ImageVariants = app.imageLinks(comment.Image)
+	app.attachmentLinks(comment.Attachments)
+
+	_ = app.writeJSON(w, http.StatusOK, comment)
+}
+
+// checkReply makes sure a reply answers a comment on the same post that was
+// not deleted, without going deeper than -comment-max-depth, and sets its
+// depth.
+func (app *application) checkReply(comment *models.Comment) *APIError {
+	parent, err := app.database.GetComment(comment.ParentID)
+	if err != nil {
+		return errLookup(err, errCommentNotFound, "Error getting comment from the database")
+	}
+	switch {
+	case parent.PostID != comment.PostID:
+		return errParam("parent_id", "must be a comment on the same post")
+	case parent.Deleted:
+		return errParam("parent_id", "comment was deleted")
+	case parent.Depth >= app.config.commentDepth:
+		return errParam("parent_id", fmt.Sprintf("replies can be nested at most %d deep", app.config.commentDepth))
+	}
+	comment.Depth = parent.Depth + 1
+	return nil
+}
+
+// EditCommentHandler replaces the text and attachments of a comment, which
+// are sent like those of /edit-post.
+func (app *application) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/edit-comment" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	err := app.parseUploadForm(w, r, true)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.FormValue("comment_id"))
+	if err != nil {
+		app.errorJSON(w, errInvalidParam("comment_id"))
+		return
+	}
+
+	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	comment, err := app.database.GetComment(commentID)
+	if err == nil && comment.Deleted {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errCommentNotFound, "Error getting comment from the database"))
+		return
+	}
+	if comment.UserID != userId {
+		app.errorJSON(w, errForbidden("Only the author can edit a comment"))
+		return
+	}
+
+	current, err := app.database.AttachmentsForComments([]int{commentID})
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting attachments from the database"))
+		return
+	}
+	mentioned, err := app.database.MentionsForComments([]int{commentID})
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting mentions from the database"))
+		return
+	}
+	kept, apiErr := keptAttachments(r, current[commentID])
+	if apiErr != nil {
+		app.errorJSON(w, apiErr)
+		return
+	}
+
+	files, attachments := attachmentForm(r)
+	comment.Comment = r.FormValue("comment")
+	comment.Attachments = append(kept, attachments...)
+
+	if errs := validator.Struct(&comment); errs != nil {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+
+	comment.Mentions, err = app.findMentions(comment.Comment)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error looking up mentions"))
+		return
+	}
+	comment.Hashtags = findHashtags(comment.Comment)
+
+	added := comment.Attachments[len(kept):]
+	err = app.saveAttachments(r.Context(), userId, files, added)
+	if err != nil {
+		app.errorJSON(w, errAttachment(err, app.config.media.limits))
+		return
+	}
+
+	comment.Image = firstImage(comment.Attachments)
+	comment.FirstName = firstName
+	comment.LastName = lastName
+
+	removed, err := app.database.UpdateComment(&comment)
+	if err != nil {
+		app.discardAttachments(r.Context(), added)
+		app.errorJSON(w, errLookup(err, errCommentNotFound, "Error updating comment"))
+		return
+	}
+	for _, name := range removed {
+		err := app.deleteImage(r.Context(), name)
+		if err != nil {
+			log.Println("Error deleting comment file:", err)
+		}
+	}
+	app.notifyMentions(models.Target{CommentID: comment.CommentID}, models.UserData{UserID: userId, FirstName: firstName, LastName: lastName}, comment.Mentions, mentioned[commentID])
+	comment.Reactions, err = app.targetReactions(userId, models.Target{CommentID: comment.CommentID})
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting reactions from the database"))
+		return
+	}
+	comment.ImageURL, comment.ImageVariants = app.imageLinks(comment.Image)
+	app.attachmentLinks(comment.Attachments)
+
+	_ = app.writeJSON(w, http.StatusOK, comment)
+}
+
+// DeleteCommentHandler lets the author of a comment, or of the post it is
+// on, delete it.
+func (app *application) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/delete-comment" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	var request models.Comment
+	err := app.readJSON(w, r, &request)
+	if err != nil {
+		app.errorJSON(w, errInvalidJSON(err))
+		return
+	}
+
+	userId, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	comment, err := app.database.GetComment(request.CommentID)
+	if err == nil && comment.Deleted {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errCommentNotFound, "Error getting comment from the database"))
+		return
+	}
+	if comment.UserID != userId {
+		apiErr := app.checkPostAuthor(comment.PostID, userId, "Only the author of the comment or the post can delete a comment")
+		if apiErr != nil {
+			app.errorJSON(w, apiErr)
+			return
+		}
+	}
+
+	names, err := app.database.DeleteComment(comment.CommentID)
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errCommentNotFound, "Error deleting comment"))
+		return
+	}
+	for _, name := range names {
+		err := app.deleteImage(r.Context(), name)
+		if err != nil {
+			log.Println("Error deleting comment file:", err)
+		}
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, JSONResponse{Message: "Comment deleted"})
+}
+
+// CommentsHandler pages through the top-level comments of a post or, with
+// parentId, the replies to one of them. Each comes with its reply_count.
+func (app *application) CommentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/comments" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	postID, err := strconv.Atoi(r.URL.Query().Get("postId"))
+	if err != nil {
+		app.errorJSON(w, errInvalidParam("postId"))
+		return
+	}
+
+	var parentID int
+	if r.URL.Query().Get("parentId") != "" {
+		parentID, err = strconv.Atoi(r.URL.Query().Get("parentId"))
+		if err != nil {
+			app.errorJSON(w, errInvalidParam("parentId"))
+			return
+		}
+	}
+
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	// Comments are as visible as their post, and so are their files. Posts
+	// the user may not see are reported as missing, like in checkTarget.
+	visible, err := app.database.CanReact(userID, models.Target{PostID: postID})
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error checking access to the post"))
+		return
+	}
+	if !visible {
+		app.errorJSON(w, errPostNotFound)
+		return
+	}
+
+	comments, cursors, err := app.database.PostComments(postID, parentID, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting comments from the database"))
+		return
+	}
+
+	commentIDs := make([]int, len(comments))
+	for i := range comments {
+		commentIDs[i] = comments[i].CommentID
+	}
+	attachments, err := app.database.AttachmentsForComments(commentIDs)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting attachments from the database"))
+		return
+	}
+
+	reactions, err := app.database.ReactionsForComments(userID, commentIDs)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting reactions from the database"))
+		return
+	}
+	mentions, err := app.database.MentionsForComments(commentIDs)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting mentions from the database"))
+		return
+	}
+	hashtags, err := app.database.HashtagsForComments(commentIDs)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting hashtags from the database"))
+		return
+	}
+	for i := range comments {
+		comments[i].Attachments = attachments[comments[i].CommentID]
+		comments[i].Reactions = reactionsOf(reactions, comments[i].CommentID)
+		comments[i].Mentions = mentions[comments[i].CommentID]
+		comments[i].Hashtags = hashtags[comments[i].CommentID]
+		comments[i].ImageURL, comments[i].ImageVariants = app.imageLinks(comments[i].Image)
+		app.attachmentLinks(comments[i].Attachments)
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, comments, app.pageLinks(r, page, cursors))
+}
+
+// attachComments fills in the comments of every post, replies nested under
+// the comments they answer, and the attachments, reactions, mentions and
+// hashtags of both with one query each instead of one per post, and links to
+// their files.
+func (app *application) attachComments(viewerID int, posts []models.Post) error {
+	postIDs := make([]int, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].PostID
+	}
+
+	comments, err := app.database.CommentsForPosts(postIDs)
+	if err != nil {
+		return err
+	}
+	postAttachments, err := app.database.AttachmentsForPosts(postIDs)
+	if err != nil {
+		return err
+	}
+	postReactions, err := app.database.ReactionsForPosts(viewerID, postIDs)
+	if err != nil {
+		return err
+	}
+	postMentions, err := app.database.MentionsForPosts(postIDs)
+	if err != nil {
+		return err
+	}
+	postHashtags, err := app.database.HashtagsForPosts(postIDs)
+	if err != nil {
+		return err
+	}
+
+	var commentIDs []int
+	for _, list := range comments {
+		for _, c := range list {
+			commentIDs = append(commentIDs, c.CommentID)
+		}
+	}
+	commentAttachments, err := app.database.AttachmentsForComments(commentIDs)
+	if err != nil {
+		return err
+	}
+	commentReactions, err := app.database.ReactionsForComments(viewerID, commentIDs)
+	if err != nil {
+		return err
+	}
+	commentMentions, err := app.database.MentionsForComments(commentIDs)
+	if err != nil {
+		return err
+	}
+	commentHashtags, err := app.database.HashtagsForComments(commentIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Comments = comments[posts[i].PostID]
+		posts[i].Attachments = postAttachments[posts[i].PostID]
+		posts[i].Reactions = reactionsOf(postReactions, posts[i].PostID)
+		posts[i].Mentions = postMentions[posts[i].PostID]
+		posts[i].Hashtags = postHashtags[posts[i].PostID]
+		posts[i].ImageURL, posts[i].ImageVariants = app.imageLinks(posts[i].Image)
+		app.attachmentLinks(posts[i].Attachments)
+		for j := range posts[i].Comments {
+			c := &posts[i].Comments[j]
+			c.Attachments = commentAttachments[c.CommentID]
+			c.Reactions = reactionsOf(commentReactions, c.CommentID)
+			c.Mentions = commentMentions[c.CommentID]
+			c.Hashtags = commentHashtags[c.CommentID]
+			c.ImageURL, c.ImageVariants = app.imageLinks(c.Image)
+			app.attachmentLinks(c.Attachments)
+		}
+		posts[i].Comments = threadComments(posts[i].Comments)
+	}
+	return nil
+}
+
+// threadComments nests comments, in the order they were written, under the
+// comments they reply to and returns the top-level ones.
+func threadComments(comments []models.Comment) []models.Comment {
+	if comments == nil {
+		return nil
+	}
+	replies := make(map[int][]models.Comment)
+	for _, c := range comments {
+		replies[c.ParentID] = append(replies[c.ParentID], c)
+	}
+	var nest func(parentID int) []models.Comment
+	nest = func(parentID int) []models.Comment {
+		thread := replies[parentID]
+		for i := range thread {
+			thread[i].Replies = nest(thread[i].CommentID)
+		}
+		return thread
+	}
+	return nest(0)
+}
+
+func (app *application) ReactHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/react" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	var reaction models.Reaction
+	err := app.readJSON(w, r, &reaction)
+	if err != nil {
+		app.errorJSON(w, errInvalidJSON(err))
+		return
+	}
+
+	reaction = models.Reaction{Target: reaction.Target, Emoji: reaction.Emoji}
+	if errs := validator.Struct(&reaction); errs != nil {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+	if reaction.Emoji != "" && !app.isReaction(reaction.Emoji) {
+		app.errorJSON(w, errValidation(map[string]string{"emoji": "must be one of " + strings.Join(app.config.reactions, " ")}))
+		return
+	}
+
+	reaction.UserID, _, _, _, err = app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	apiErr := app.checkTarget(reaction.UserID, reaction.Target)
+	if apiErr != nil {
+		app.errorJSON(w, apiErr)
+		return
+	}
+
+	err = app.database.SetReaction(&reaction)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error saving the reaction"))
+		return
+	}
+
+	reactions, err := app.targetReactions(reaction.UserID, reaction.Target)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting reactions from the database"))
+		return
+	}
+	app.pushReactions(models.ReactionUpdate{Type: "reactions", Target: reaction.Target, Counts: reactions.Counts})
+
+	_ = app.writeJSON(w, http.StatusOK, reactions)
+}
+
+func (app *application) ReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/reactions" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	target, apiErr := reactionTargetParam(r)
+	if apiErr != nil {
+		app.errorJSON(w, apiErr)
+		return
+	}
+
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	apiErr = app.checkTarget(userID, target)
+	if apiErr != nil {
+		app.errorJSON(w, apiErr)
+		return
+	}
+
+	reactions, cursors, err := app.database.Reactors(target, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting reactions from the database"))
+		return
+	}
+	if reactions == nil {
+		reactions = make([]models.Reaction, 0)
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, reactions, app.pageLinks(r, page, cursors))
+}
+
+func (app *application) ReactionEmojisHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/reaction-emojis" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, app.config.reactions)
+}
+
+// parseReactions splits the -reactions flag into the emoji users can react
+// with, in the order given.
+func parseReactions(list string) []string {
+	var reactions []string
+	for _, emoji := range strings.Split(list, ",") {
+		if emoji = strings.TrimSpace(emoji); emoji != "" {
+			reactions = append(reactions, emoji)
+		}
+	}
+	return reactions
+}
+
+func (app *application) isReaction(emoji string) bool {
+	for _, reaction := range app.config.reactions {
+		if reaction == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTarget returns an error unless the user may see the target.
+// Targets they may not see are reported as missing, so reacting cannot be
+// used to find out which exist.
+func (app *application) checkTarget(userID int, target models.Target) *APIError {
+	visible, err := app.database.CanReact(userID, target)
+	if err != nil {
+		return errInternal(err, "Error checking access to the reaction target")
+	}
+	if !visible {
+		return errTargetNotFound
+	}
+	return nil
+}
+
+// reactionTargetParam reads the target from exactly one of the postId,
+// commentId and messageId query parameters.
+func reactionTargetParam(r *http.Request) (models.Target, *APIError) {
+	var target models.Target
+	given := 0
+	for _, param := range []struct {
+		name string
+		id   *int
+	}{{"postId", &target.PostID}, {"commentId", &target.CommentID}, {"messageId", &target.MessageID}} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return target, errInvalidParam(param.name)
+		}
+		*param.id = id
+		given++
+	}
+
+	switch given {
+	case 0:
+		return target, errMissingParam("postId")
+	case 1:
+		return target, nil
+	}
+	return target, errParam("postId", "only one of postId, commentId and messageId can be given")
+}
+
+// targetReactions counts the reactions to one target.
+func (app *application) targetReactions(viewerID int, target models.Target) (models.Reactions, error) {
+	var reactions map[int]models.Reactions
+	var err error
+	id := target.MessageID
+	switch {
+	case target.PostID != 0:
+		id = target.PostID
+		reactions, err = app.database.ReactionsForPosts(viewerID, []int{id})
+	case target.CommentID != 0:
+		id = target.CommentID
+		reactions, err = app.database.ReactionsForComments(viewerID, []int{id})
+	default:
+		reactions, err = app.database.ReactionsForMessages(viewerID, []int{id})
+	}
+	return reactionsOf(reactions, id), err
+}
+
+// reactionsOf returns the reactions to one of the targets in reactions, with
+// empty counts rather than nil ones if it has none.
+func reactionsOf(reactions map[int]models.Reactions, id int) models.Reactions {
+	summary := reactions[id]
+	if summary.Counts == nil {
+		summary.Counts = map[string]int{}
+	}
+	return summary
+}
+
+// defaultSearchLimit is how many results /search returns unless the request
+// asks for another number.
+const defaultSearchLimit = 20
+
+// defaultTrendingLimit is how many tags /trending-hashtags lists unless the
+// limit parameter says otherwise.
+const defaultTrendingLimit = 10
+
+// maxMentions caps how many mentions in one text are looked up, so a single
+// post cannot notify everyone.
+const maxMentions = 50
+
+// findMentions looks up the users the text mentions. Mentions of users that
+// do not exist are left as plain text.
+func (app *application) findMentions(text string) ([]models.Mention, error) {
+	found := entities.Mentions(text)
+	if len(found) > maxMentions {
+		found = found[:maxMentions]
+	}
+
+	var nicknames []string
+	for _, m := range found {
+		if m.UserID == 0 {
+			nicknames = append(nicknames, m.Nickname)
+		}
+	}
+	byNickname, err := app.database.UsersByNicknames(nicknames)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]int, len(found))
+	for i, m := range found {
+		userIDs[i] = m.UserID
+		if m.UserID == 0 {
+			userIDs[i] = byNickname[strings.ToLower(m.Nickname)]
+		}
+	}
+	users, err := app.database.UsersByIDs(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions := make([]models.Mention, 0, len(found))
+	for i, m := range found {
+		user, ok := users[userIDs[i]]
+		if !ok {
+			continue
+		}
+		mentions = append(mentions, models.Mention{
+			UserID:    user.UserID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Nickname:  user.Nickname,
+			Offset:    m.Offset,
+			Length:    m.Length,
+		})
+	}
+	return mentions, nil
+}
+
+// notifyMentions tells the users mentioned in a target who were not in
+// before, the mentions it had until now, that they were mentioned, if they
+// may see it. Authors are not told about their own mentions.
+func (app *application) notifyMentions(target models.Target, author models.UserData, mentions, before []models.Mention) {
+	told := map[int]bool{author.UserID: true}
+	for _, m := range before {
+		told[m.UserID] = true
+	}
+	for _, m := range mentions {
+		if told[m.UserID] {
+			continue
+		}
+		told[m.UserID] = true
+		m.Target = target
+		m.AuthorID, m.AuthorFirstName, m.AuthorLastName = author.UserID, author.FirstName, author.LastName
+		app.pushMention(m)
+	}
+}
+
+// pushMention tells a user who was just mentioned over their chat
+// connection, if they have one open and may see where they were mentioned.
+func (app *application) pushMention(mention models.Mention) {
+	visible, err := app.database.CanReact(mention.UserID, mention.Target)
+	if err != nil || !visible {
+		return
+	}
+
+	data, err := json.Marshal(models.MentionUpdate{Type: "mention", Mention: mention})
+	if err != nil {
+		log.Println("Failed to marshal mention:", err)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if conn, ok := connections[mention.UserID]; ok {
+		err = conn.WriteMessage(websocket.TextMessage, data)
+		if err != nil {
+			log.Println("Failed to write mention to user", strconv.Itoa(mention.UserID)+":", err)
+		}
+	}
+}
+
+// MentionsHandler lists the mentions of the current user, newest first.
+func (app *application) MentionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/mentions" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
 	}
 
-	user, err := app.database.GetUser(id1)
+	mentions, cursors, err := app.database.UserMentions(userID, page)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting user from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting mentions from the database"))
 		return
 	}
+	if mentions == nil {
+		mentions = make([]models.Mention, 0)
+	}
 
-	allPosts, err := app.database.GetPostsByUserID(user.UserID)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+	_ = app.writeJSON(w, http.StatusOK, mentions, app.pageLinks(r, page, cursors))
+}
+
+func (app *application) MentionSeenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/mention-seen" {
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	followers, err := app.database.Followers(user.UserID)
+	var mention models.Mention
+	err = app.readJSON(w, r, &mention)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
-	following, err := app.database.Following(user.UserID)
+	err = app.database.MarkMentionSeen(userID, mention.MentionID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errLookup(err, errMentionNotFound, "Error updating mention"))
 		return
 	}
 
-	var filteredPosts []models.Post
-	for i := range allPosts {
-		post := allPosts[i]
-		if post.GroupID == 0 && post.Privacy == "public" {
-			filteredPosts = append(filteredPosts, post)
-		} else if post.Privacy == "for-selected-users" {
-			if post.SelectedUserID == "" {
-				continue
-			}
-			selectedUserIDs := strings.Split(post.SelectedUserID, ",")
-			for _, user := range selectedUserIDs {
-				selectedUserID, err := strconv.Atoi(user)
-				if err != nil {
-					app.errorJSON(w, fmt.Errorf("Error converting selected user ID to integer"), http.StatusInternalServerError)
-					return
-				}
-				if selectedUserID == userID {
-					filteredPosts = append(filteredPosts, post)
-					break
+	_ = app.writeJSON(w, http.StatusOK, models.Mention{MentionID: mention.MentionID, UserID: userID, Seen: true})
+}
+
+// findHashtags returns the hashtags in the text of a post or comment.
+func findHashtags(text string) []models.Hashtag {
+	found := entities.Hashtags(text)
+	hashtags := make([]models.Hashtag, len(found))
+	for i, h := range found {
+		hashtags[i] = models.Hashtag{Tag: h.Tag, Offset: h.Offset, Length: h.Length}
+	}
+	return hashtags
+}
+
+// followedTags marks the posts that carry, themselves or in a comment, a tag
+// the user follows with the tags that brought them into the feed.
+func (app *application) followedTags(userID int, posts []models.Post) error {
+	tags, err := app.database.FollowedHashtags(userID)
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+	followed := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		followed[tag] = true
+	}
+
+	for i := range posts {
+		seen := make(map[string]bool)
+		var add func(hashtags []models.Hashtag, comments []models.Comment)
+		add = func(hashtags []models.Hashtag, comments []models.Comment) {
+			for _, h := range hashtags {
+				if followed[h.Tag] && !seen[h.Tag] {
+					seen[h.Tag] = true
+					posts[i].FollowedTags = append(posts[i].FollowedTags, h.Tag)
 				}
 			}
-		} else {
-			isFollowing, err := app.database.IsFollowing(userID, post.UserID)
-			if err != nil {
-				app.errorJSON(w, fmt.Errorf("Error checking if the user is following the post author"), http.StatusInternalServerError)
-				return
-			}
-			if post.GroupID == 0 && isFollowing {
-				filteredPosts = append(filteredPosts, post)
+			for _, c := range comments {
+				add(c.Hashtags, c.Replies)
 			}
 		}
+		add(posts[i].Hashtags, posts[i].Comments)
 	}
+	return nil
+}
 
-	//comments for each post and add them to the filtered posts
-	for i := range filteredPosts {
-		postID := filteredPosts[i].PostID
-		comments, err := app.database.GetCommentsByPostID(postID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error getting comments from the database"), http.StatusInternalServerError)
-			return
-		}
-
-		filteredPosts[i].Comments = comments
+// tagParam reads a tag, with or without its #, from the named query
+// parameter.
+func tagParam(r *http.Request, name string) (string, *APIError) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return "", errMissingParam(name)
 	}
-
-	userDataWithPosts := struct {
-		CurrentUser int               `json:"current_user"`
-		UserData    *models.UserData  `json:"user_data"`
-		Followers   []models.UserData `json:"followers"`
-		Following   []models.UserData `json:"following"`
-		Posts       []models.Post     `json:"posts"`
-	}{
-		CurrentUser: userID,
-		UserData:    user,
-		Followers:   followers,
-		Following:   following,
-		Posts:       filteredPosts,
+	tag, ok := entities.NormalizeTag(value)
+	if !ok {
+		return "", errInvalidTag(name)
 	}
+	return tag, nil
+}
 
-	_ = app.writeJSON(w, http.StatusOK, userDataWithPosts)
+func errInvalidTag(name string) *APIError {
+	return errParam(name, fmt.Sprintf("must be up to %d letters, digits and underscores, at least one a letter", entities.MaxTagLength))
 }
 
-func (app *application) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+// HashtagHandler lists the posts the user may see that carry a tag, newest
+// first.
+func (app *application) HashtagHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
-	if r.URL.Path != "/create-post" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+	if r.URL.Path != "/hashtag" {
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
-	err := r.ParseMultipartForm(10)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error parsing form data"), http.StatusBadRequest)
+	tag, apiErr := tagParam(r, "tag")
+	if apiErr != nil {
+		app.errorJSON(w, apiErr)
 		return
 	}
 
-	content := r.FormValue("content")
-	privacy := r.FormValue("privacy")
-	selectedUserID := r.FormValue("selected_user_id")
-	groupID := r.FormValue("group_id")
-	var groupIDInt int
-	if groupID != "" && groupID != "undefined" {
-		groupIDInt, err = strconv.Atoi(groupID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error converting string to integer"), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		groupIDInt = 0
-	}
-
-	imageFile, _, err := r.FormFile("image")
-	var imageFileName string
+	page, err := app.readPage(r)
 	if err != nil {
-		imageFileName = ""
-	} else {
-		defer imageFile.Close()
-
-		imageFolderPath := "database/images/"
-		//generating a random image name
-		randomBytes := make([]byte, 16)
-		_, err := rand.Read(randomBytes)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error generating random image name"), http.StatusInternalServerError)
-			return
-		}
-
-		//converting random bytes to a hexadecimal string
-		imageName := hex.EncodeToString(randomBytes) + ".jpg"
-		imageFileName = imageName
-
-		imageFileData, err := ioutil.ReadAll(imageFile)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error reading image file"), http.StatusInternalServerError)
-			return
-		}
-
-		err = ioutil.WriteFile(imageFolderPath+imageFileName, imageFileData, 0644)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error saving image file"), http.StatusInternalServerError)
-			return
-		}
+		app.errorJSON(w, err)
+		return
 	}
 
-	post := models.Post{
-		Content:        content,
-		Privacy:        privacy,
-		SelectedUserID: selectedUserID,
-		GroupID:        groupIDInt,
-		Image:          imageFileName,
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
 	}
 
-	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
+	posts, cursors, err := app.database.TagPosts(userID, tag, page)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting posts from the database"))
 		return
 	}
+	if posts == nil {
+		posts = make([]models.Post, 0)
+	}
 
-	post.UserID = userId
-	post.FirstName = firstName
-	post.LastName = lastName
-
-	err = app.database.CreatePost(&post)
+	err = app.attachComments(userID, posts)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error adding data to the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting comments from the database"))
 		return
 	}
-	//including an empty comments array for the newly created post.
-	post.Comments = make([]models.Comment, 0)
 
-	_ = app.writeJSON(w, http.StatusOK, post)
+	_ = app.writeJSON(w, http.StatusOK, posts, app.pageLinks(r, page, cursors))
 }
 
-func (app *application) AllPostsHandler(w http.ResponseWriter, r *http.Request) {
+// TrendingHashtagsHandler lists the tags used most within -trending-window
+// in posts and comments the user may see.
+func (app *application) TrendingHashtagsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
-	if r.URL.Path != "/all-posts" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+	if r.URL.Path != "/trending-hashtags" {
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
+	limit := defaultTrendingLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageLimit {
+			app.errorJSON(w, errParam("limit", fmt.Sprintf("must be between 1 and %d", maxPageLimit)))
+			return
+		}
+		limit = n
+	}
+
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	var allPosts []models.Post
-
-	allPosts, err = app.database.AllPosts()
+	tags, err := app.database.TrendingTags(userID, time.Now().Add(-app.config.trending), limit)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting trending hashtags from the database"))
 		return
 	}
-
-	var filteredPosts []models.Post
-
-	for _, post := range allPosts {
-		if post.GroupID == 0 && (post.Privacy == "public" || post.UserID == userID) {
-			filteredPosts = append(filteredPosts, post)
-		} else if post.Privacy == "for-selected-users" {
-			selectedUserIDs := strings.Split(post.SelectedUserID, ",")
-			for _, user := range selectedUserIDs {
-				selectedUserID, err := strconv.Atoi(user)
-				if err != nil {
-					app.errorJSON(w, fmt.Errorf("Error converting selected user ID to integer"), http.StatusInternalServerError)
-					return
-				}
-				if selectedUserID == userID {
-					filteredPosts = append(filteredPosts, post)
-					break
-				}
-			}
-		} else {
-			isFollowing, err := app.database.IsFollowing(userID, post.UserID)
-			if err != nil {
-				app.errorJSON(w, fmt.Errorf("Error checking if the user is following the post author"), http.StatusInternalServerError)
-				return
-			}
-			if post.GroupID == 0 && isFollowing {
-				filteredPosts = append(filteredPosts, post)
-			}
-		}
-	}
-
-	//comments for each post and add them to the filtered posts
-	for i := range filteredPosts {
-		postID := filteredPosts[i].PostID
-		comments, err := app.database.GetCommentsByPostID(postID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error getting comments from the database"), http.StatusInternalServerError)
-			return
-		}
-
-		filteredPosts[i].Comments = comments
+	if tags == nil {
+		tags = make([]models.TrendingTag, 0)
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, filteredPosts)
+	_ = app.writeJSON(w, http.StatusOK, tags)
 }
 
-func (app *application) CommentHandler(w http.ResponseWriter, r *http.Request) {
+// FollowHashtagHandler makes the user follow a tag, or stop following it.
+// Posts in the user's groups that carry a tag they follow join their feed.
+func (app *application) FollowHashtagHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
-	if r.URL.Path != "/create-comment" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+	if r.URL.Path != "/follow-hashtag" {
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
-	err := r.ParseMultipartForm(10)
+	var follow models.HashtagFollow
+	err := app.readJSON(w, r, &follow)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error parsing form data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
-	commentContent := r.FormValue("comment")
-	postID := r.FormValue("post_id")
-	var postIDInt int
-	postIDInt, err = strconv.Atoi(postID)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error converting string to integer"), http.StatusInternalServerError)
+	tag, ok := entities.NormalizeTag(follow.Tag)
+	if !ok {
+		app.errorJSON(w, errInvalidTag("tag"))
 		return
 	}
+	follow.Tag = tag
 
-	imageFile, _, err := r.FormFile("image")
-	var imageFileName string
+	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		imageFileName = ""
-	} else {
-		defer imageFile.Close()
-
-		imageFolderPath := "database/images/"
-		randomBytes := make([]byte, 16)
-		_, err := rand.Read(randomBytes)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error generating random image name"), http.StatusInternalServerError)
-			return
-		}
+		app.errorJSON(w, errSession(err))
+		return
+	}
 
-		imageName := hex.EncodeToString(randomBytes) + ".jpg"
-		imageFileName = imageName
+	err = app.database.SetHashtagFollow(userID, follow.Tag, follow.Following)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error updating followed hashtags"))
+		return
+	}
 
-		imageFileData, err := ioutil.ReadAll(imageFile)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error reading image file"), http.StatusInternalServerError)
-			return
-		}
+	_ = app.writeJSON(w, http.StatusOK, follow)
+}
 
-		err = ioutil.WriteFile(imageFolderPath+imageFileName, imageFileData, 0644)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error saving image file"), http.StatusInternalServerError)
-			return
-		}
+func (app *application) FollowedHashtagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
 	}
 
-	comment := models.Comment{
-		PostID:  postIDInt,
-		Comment: commentContent,
-		Image:   imageFileName,
+	if r.URL.Path != "/followed-hashtags" {
+		app.errorJSON(w, errPageNotFound)
+		return
 	}
 
-	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
+	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	comment.UserID = userId
-	comment.FirstName = firstName
-	comment.LastName = lastName
-
-	err = app.database.CreateComment(&comment)
+	tags, err := app.database.FollowedHashtags(userID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error adding data to the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting followed hashtags from the database"))
 		return
 	}
+	if tags == nil {
+		tags = make([]string, 0)
+	}
 
-	_ = app.writeJSON(w, http.StatusOK, comment)
+	_ = app.writeJSON(w, http.StatusOK, tags)
 }
 
 func (app *application) ProfileTypeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/profile-type" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userId, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	err = app.database.UpdateProfileType(userId)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to update the profile type"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to update the profile type"))
 		return
 	}
 
@@ -675,102 +2338,70 @@ func (app *application) ProfileTypeHandler(w http.ResponseWriter, r *http.Reques
 
 func (app *application) FollowHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/follow" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var request models.FollowRequest
 	err := app.readJSON(w, r, &request)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	userId, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
-		return
-	}
-
-	isPublic, err := app.database.IsUserPublic(request.FollowingID)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get user's public status"), http.StatusInternalServerError)
-		return
-	}
-
-	isFollowing, err := app.database.IsFollowing(userId, request.FollowingID)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to check if user is following"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	isPending, err := app.database.IsPending(userId, request.FollowingID)
+	err = app.database.ToggleFollow(userId, request.FollowingID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errLookup(err, errUserNotFound, "Failed to update follow status"))
 		return
 	}
 
-	if isFollowing || isPending {
-		err = app.database.UnfollowUser(userId, request.FollowingID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to unfollow user: %w", err), http.StatusInternalServerError)
-			return
-		}
-	} else if isPublic {
-		err = app.database.FollowUser(userId, request.FollowingID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to follow user: %w", err), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		err = app.database.FollowNotPublicUser(userId, request.FollowingID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to follow user: %w", err), http.StatusInternalServerError)
-			return
-		}
-	}
-
 	_ = app.writeJSON(w, http.StatusOK, request)
 }
 
 func (app *application) FollowerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/follower-check" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	followingId := r.URL.Query().Get("userId")
 	followingIdInt, err := strconv.Atoi(followingId)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Invalid groupId parameter"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidParam("userId"))
 		return
 	}
 
 	userId, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	isFollowing, err := app.database.IsFollowing(userId, followingIdInt)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to check if user is following"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to check if user is following"))
 		return
 	}
 
 	isPending, err := app.database.IsPending(userId, followingIdInt)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
 		return
 	}
 
@@ -787,91 +2418,107 @@ func (app *application) FollowerHandler(w http.ResponseWriter, r *http.Request)
 
 func (app *application) FollowingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/following" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userId, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	var following []models.UserData
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
-	following, err = app.database.Following(userId)
+	following, cursors, err := app.database.FollowingPage(userId, page)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the list of followed users: %w", err), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get the list of followed users"))
 		return
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, following)
+	_ = app.writeJSON(w, http.StatusOK, following, app.pageLinks(r, page, cursors))
 }
 
 func (app *application) FollowersHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/followers" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userId, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	var followers []models.UserData
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
-	followers, err = app.database.Followers(userId)
+	followers, cursors, err := app.database.FollowersPage(userId, page)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the list of followed users: %w", err), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get the list of followers"))
 		return
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, followers)
+	_ = app.writeJSON(w, http.StatusOK, followers, app.pageLinks(r, page, cursors))
 }
 
 func (app *application) FollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/follow-requests" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	followRequests, err := app.database.FollowRequests(userID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get follow requests"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get follow requests"))
+		return
+	}
+
+	followerIDs := make([]int, len(followRequests))
+	for i, request := range followRequests {
+		followerIDs[i] = request.FollowingID
+	}
+
+	users, err := app.database.UsersByIDs(followerIDs)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Failed to get user data for follow requests"))
 		return
 	}
 
 	var usersData []*models.UserData
-	for _, request := range followRequests {
-		user, err := app.database.GetUserByID(request.FollowingID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to get user data for follower ID: %d", request.FollowerID), http.StatusInternalServerError)
-			return
+	for _, id := range followerIDs {
+		if user, ok := users[id]; ok {
+			usersData = append(usersData, user)
 		}
-		usersData = append(usersData, user)
 	}
 
 	_ = app.writeJSON(w, http.StatusOK, usersData)
@@ -879,31 +2526,31 @@ func (app *application) FollowRequestsHandler(w http.ResponseWriter, r *http.Req
 
 func (app *application) AcceptFollowerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/accept-follower" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	var request models.FollowRequest
 	err = app.readJSON(w, r, &request)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	err = app.database.AcceptFollower(userID, request.FollowerID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to update follower status"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to update follower status"))
 		return
 	}
 
@@ -912,31 +2559,31 @@ func (app *application) AcceptFollowerHandler(w http.ResponseWriter, r *http.Req
 
 func (app *application) DeclineFollowerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/decline-follower" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	var request models.FollowRequest
 	err = app.readJSON(w, r, &request)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	err = app.database.DeclineFollower(userID, request.FollowerID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to decline follower request"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to decline follower request"))
 		return
 	}
 
@@ -945,25 +2592,30 @@ func (app *application) DeclineFollowerHandler(w http.ResponseWriter, r *http.Re
 
 func (app *application) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/create-group" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var group models.Group
 	err := app.readJSON(w, r, &group)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
+		return
+	}
+
+	if errs := validator.Struct(&group); errs != nil {
+		app.errorJSON(w, errValidation(errs))
 		return
 	}
 
 	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
@@ -971,106 +2623,88 @@ func (app *application) CreateGroupHandler(w http.ResponseWriter, r *http.Reques
 	group.FirstName = firstName
 	group.LastName = lastName
 
-	groupID, err := app.database.CreateGroup(&group)
+	// The selected users are invited along with creating the group.
+	_, err = app.database.CreateGroup(&group)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error adding data to the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error adding data to the database"))
 		return
 	}
 
-	var selectedUserIDs []string
-
-	if len(group.SelectedUserID) > 0 {
-		selectedUserIDs = strings.Split(group.SelectedUserID, ",")
-	}
-
-	//adding selected users to the groupmembers table
-	for _, userIDStr := range selectedUserIDs {
-		userID, err := strconv.Atoi(userIDStr)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error converting string to int"), http.StatusInternalServerError)
-			continue
-		}
-		groupMembers := models.GroupMembers{
-			GroupID:        groupID,
-			GroupTitle:     group.Title,
-			GroupCreatorID: group.UserID,
-			MemberID:       userID,
-		}
-
-		err = app.database.AddGroupMembers(&groupMembers)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error adding data to the database"), http.StatusInternalServerError)
-			return
-		}
-	}
-
 	_ = app.writeJSON(w, http.StatusOK, group)
 }
 
 func (app *application) AllGroupsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/all-groups" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
-	var allGroups []models.Group
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
-	allGroups, err := app.database.AllGroups()
+	allGroups, cursors, err := app.database.AllGroups(page)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
 		return
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, allGroups)
+	_ = app.writeJSON(w, http.StatusOK, allGroups, app.pageLinks(r, page, cursors))
 }
 
 func (app *application) GroupHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 	id := strings.TrimPrefix(r.URL.Path, "/group/")
 	id1, err := strconv.Atoi(id)
 	if err != nil {
+		app.errorJSON(w, errInvalidParam("id"))
 		return
 	}
 
 	userID, _, firstName, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	group, err := app.database.GetGroup(id1)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting group data from database"), http.StatusInternalServerError)
+		app.errorJSON(w, errLookup(err, errGroupNotFound, "Error getting group data from database"))
 		return
 	}
 
 	groupMembers, err := app.database.GetGroupMembers(id1)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting group members from database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error getting group members from database"))
+		return
+	}
+
+	users, err := app.database.UsersByIDs(groupMembers)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Failed to get user data"))
 		return
 	}
 
 	var usersData []*models.UserData
 	for _, memberID := range groupMembers {
-		user, err := app.database.GetUserByID(memberID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to get user data"), http.StatusInternalServerError)
-			return
+		if user, ok := users[memberID]; ok {
+			usersData = append(usersData, user)
 		}
-		usersData = append(usersData, user)
 	}
 
 	requestPending, err := app.database.CheckPending(userID, group.GroupID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error checking pending status"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error checking pending status"))
 		return
 	}
 
@@ -1095,75 +2729,104 @@ func (app *application) GroupHandler(w http.ResponseWriter, r *http.Request) {
 	_ = app.writeJSON(w, http.StatusOK, groupResponse)
 }
 
+func (app *application) GroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.errorJSON(w, errMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path != "/group-members" {
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	groupID, err := strconv.Atoi(r.URL.Query().Get("groupId"))
+	if err != nil {
+		app.errorJSON(w, errInvalidParam("groupId"))
+		return
+	}
+
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	members, cursors, err := app.database.GroupMemberList(groupID, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting group members from database"))
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, members, app.pageLinks(r, page, cursors))
+}
+
 func (app *application) GroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/group-posts" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	groupId := r.URL.Query().Get("groupId")
 	groupIdInt, err := strconv.Atoi(groupId)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Invalid groupId parameter"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidParam("groupId"))
 		return
 	}
 
-	var allPosts []models.Post
-
-	allPosts, err = app.database.AllPosts()
+	page, err := app.readPage(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, err)
 		return
 	}
 
-	var filteredPosts []models.Post
-
-	for _, post := range allPosts {
-		if post.GroupID == groupIdInt {
-			filteredPosts = append(filteredPosts, post)
-		}
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
 	}
 
-	for i := range filteredPosts {
-		postID := filteredPosts[i].PostID
-		comments, err := app.database.GetCommentsByPostID(postID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error getting comments from the database"), http.StatusInternalServerError)
-			return
-		}
+	filteredPosts, cursors, err := app.database.GroupPosts(userID, groupIdInt, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
+		return
+	}
 
-		filteredPosts[i].Comments = comments
+	err = app.attachComments(userID, filteredPosts)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting comments from the database"))
+		return
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, filteredPosts)
+	_ = app.writeJSON(w, http.StatusOK, filteredPosts, app.pageLinks(r, page, cursors))
 }
 
 func (app *application) InviteNewMemberHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/invite" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var groupMembers models.GroupMembers
 	err := app.readJSON(w, r, &groupMembers)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	groupData, err := app.database.GetGroup(groupMembers.GroupID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get group data"), http.StatusInternalServerError)
+		app.errorJSON(w, errLookup(err, errGroupNotFound, "Failed to get group data"))
 		return
 	}
 
@@ -1172,7 +2835,7 @@ func (app *application) InviteNewMemberHandler(w http.ResponseWriter, r *http.Re
 
 	err = app.database.InviteNewMember(&groupMembers)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error adding data to the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error adding data to the database"))
 		return
 	}
 
@@ -1181,24 +2844,24 @@ func (app *application) InviteNewMemberHandler(w http.ResponseWriter, r *http.Re
 
 func (app *application) GroupInvitationHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/group-invitations" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	groupInvitations, err := app.database.GroupInvitations(userID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get group requests"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get group requests"))
 		return
 	}
 
@@ -1209,13 +2872,23 @@ func (app *application) GroupInvitationHandler(w http.ResponseWriter, r *http.Re
 		InvitedUser    *models.UserData `json:"invited_user"`
 	}
 
+	memberIDs := make([]int, len(groupInvitations))
+	for i, invitation := range groupInvitations {
+		memberIDs[i] = invitation.MemberID
+	}
+
+	users, err := app.database.UsersByIDs(memberIDs)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Failed to get user data"))
+		return
+	}
+
 	var groupInvitationsWithUserData []GroupInvitationWithUserData
 
 	for _, invitation := range groupInvitations {
-		user, err := app.database.GetUserByID(invitation.MemberID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to get user data"), http.StatusInternalServerError)
-			return
+		user, ok := users[invitation.MemberID]
+		if !ok {
+			continue
 		}
 
 		invitationData := GroupInvitationWithUserData{
@@ -1233,25 +2906,25 @@ func (app *application) GroupInvitationHandler(w http.ResponseWriter, r *http.Re
 
 func (app *application) AcceptGroupInvitationHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/accept-group-invitation" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var invitation models.GroupMembers
 	err := app.readJSON(w, r, &invitation)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	err = app.database.AcceptGroupInvitation(invitation.GroupID, invitation.MemberID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to update invitation status"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to update invitation status"))
 		return
 	}
 
@@ -1260,25 +2933,25 @@ func (app *application) AcceptGroupInvitationHandler(w http.ResponseWriter, r *h
 
 func (app *application) DeclineGroupInvitationHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/decline-group-invitation" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var invitation models.GroupMembers
 	err := app.readJSON(w, r, &invitation)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	err = app.database.DeclineGroupInvitation(invitation.GroupID, invitation.MemberID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to update invitation status"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to update invitation status"))
 		return
 	}
 
@@ -1287,53 +2960,50 @@ func (app *application) DeclineGroupInvitationHandler(w http.ResponseWriter, r *
 
 func (app *application) RequestToJoinGroupHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/request-to-join-group" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var request models.GroupMembers
 	err := app.readJSON(w, r, &request)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
-	group, err := app.database.GetGroup(request.GroupID)
+	_, err = app.database.GetGroup(request.GroupID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get group data"), http.StatusInternalServerError)
+		app.errorJSON(w, errLookup(err, errGroupNotFound, "Failed to get group data"))
 		return
 	}
 
-	groupTitle := group.Title
-	groupCreatorID := group.UserID
-
 	userId, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	isMember, err := app.database.IsMember(userId, request.GroupID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to check if user is following"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to check if user is following"))
 		return
 	}
 
 	if isMember {
 		err = app.database.LeaveGroup(userId, request.GroupID)
 		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to unfollow user: %w", err), http.StatusInternalServerError)
+			app.errorJSON(w, errInternal(err, "Failed to unfollow user"))
 			return
 		}
 	} else {
-		err = app.database.JoinGroup(userId, request.GroupID, groupTitle, groupCreatorID)
+		err = app.database.JoinGroup(userId, request.GroupID)
 		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to follow user: %w", err), http.StatusInternalServerError)
+			app.errorJSON(w, errInternal(err, "Failed to follow user"))
 			return
 		}
 	}
@@ -1342,24 +3012,24 @@ func (app *application) RequestToJoinGroupHandler(w http.ResponseWriter, r *http
 
 func (app *application) GroupRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/group-requests" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	groupRequests, err := app.database.GroupRequests(userID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get group requests"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get group requests"))
 		return
 	}
 
@@ -1370,13 +3040,23 @@ func (app *application) GroupRequestsHandler(w http.ResponseWriter, r *http.Requ
 		Member         *models.UserData `json:"member"`
 	}
 
+	memberIDs := make([]int, len(groupRequests))
+	for i, request := range groupRequests {
+		memberIDs[i] = request.MemberID
+	}
+
+	users, err := app.database.UsersByIDs(memberIDs)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Failed to get user data for group requests"))
+		return
+	}
+
 	var groupRequestsWithUserData []GroupRequestWithUserData
 
 	for _, request := range groupRequests {
-		user, err := app.database.GetUserByID(request.MemberID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to get user data for member ID: %d", request.MemberID), http.StatusInternalServerError)
-			return
+		user, ok := users[request.MemberID]
+		if !ok {
+			continue
 		}
 
 		requestData := GroupRequestWithUserData{
@@ -1394,25 +3074,25 @@ func (app *application) GroupRequestsHandler(w http.ResponseWriter, r *http.Requ
 
 func (app *application) AcceptGroupRequestHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/accept-group-request" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var request models.GroupMembers
 	err := app.readJSON(w, r, &request)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	err = app.database.AcceptGroupRequest(request.GroupID, request.MemberID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to update request status"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to update request status"))
 		return
 	}
 
@@ -1421,25 +3101,25 @@ func (app *application) AcceptGroupRequestHandler(w http.ResponseWriter, r *http
 
 func (app *application) DeclineGroupRequestHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/decline-group-request" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var request models.GroupMembers
 	err := app.readJSON(w, r, &request)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	err = app.database.DeclineGroupRequest(request.GroupID, request.MemberID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to update request status"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to update request status"))
 		return
 	}
 
@@ -1448,25 +3128,30 @@ func (app *application) DeclineGroupRequestHandler(w http.ResponseWriter, r *htt
 
 func (app *application) CreateEventHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/create-event" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var event models.Event
 	err := app.readJSON(w, r, &event)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
+		return
+	}
+
+	if errs := validator.Struct(&event); errs != nil {
+		app.errorJSON(w, errValidation(errs))
 		return
 	}
 
 	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
@@ -1474,35 +3159,9 @@ func (app *application) CreateEventHandler(w http.ResponseWriter, r *http.Reques
 	event.FirstName = firstName
 	event.LastName = lastName
 
-	eventID, err := app.database.CreateEvent(&event)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error adding data to the database"), http.StatusInternalServerError)
-		return
-	}
-
-	groupMembers, err := app.database.GetGroupMembers(event.GroupID)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting group members from database"), http.StatusInternalServerError)
-		return
-	}
-
-	for _, memberID := range groupMembers {
-		err = app.database.EventNotifications(eventID, memberID, event.GroupID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Error adding data to the database"), http.StatusInternalServerError)
-			return
-		}
-	}
-
-	groupCreatorID, err := app.database.GetGroupCreator(event.GroupID)
+	_, err = app.database.CreateEvent(&event)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting group members from database"), http.StatusInternalServerError)
-		return
-	}
-
-	err = app.database.EventNotifications(eventID, groupCreatorID, event.GroupID)
-	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error adding data to the database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Error adding data to the database"))
 		return
 	}
 
@@ -1511,24 +3170,24 @@ func (app *application) CreateEventHandler(w http.ResponseWriter, r *http.Reques
 
 func (app *application) GroupEventNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/group-event-notifications" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	eventNotifications, err := app.database.GetEventNotifications(userID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get event notifications"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get event notifications"))
 		return
 	}
 
@@ -1544,13 +3203,13 @@ func (app *application) GroupEventNotificationsHandler(w http.ResponseWriter, r
 	for _, notification := range eventNotifications {
 		group, err := app.database.GetGroup(notification.GroupID)
 		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to get group data for group ID"), http.StatusInternalServerError)
+			app.errorJSON(w, errInternal(err, "Failed to get group data for group ID"))
 			return
 		}
 
 		event, err := app.database.GetEvent(notification.EventID)
 		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to get group data for group ID"), http.StatusInternalServerError)
+			app.errorJSON(w, errInternal(err, "Failed to get group data for group ID"))
 			return
 		}
 
@@ -1569,31 +3228,31 @@ func (app *application) GroupEventNotificationsHandler(w http.ResponseWriter, r
 
 func (app *application) EventSeenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/group-event-seen" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	var eventNotification models.EventNotifications
 	err = app.readJSON(w, r, &eventNotification)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	err = app.database.DeleteFromEventNotifications(eventNotification.EventID, userID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to delete from database"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to delete from database"))
 		return
 	}
 
@@ -1602,91 +3261,94 @@ func (app *application) EventSeenHandler(w http.ResponseWriter, r *http.Request)
 
 func (app *application) GroupEventsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/group-events" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	groupId := r.URL.Query().Get("groupId")
 	groupIdInt, err := strconv.Atoi(groupId)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Invalid groupId parameter"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidParam("groupId"))
 		return
 	}
 
-	var allEvents []models.Event
-
-	allEvents, err = app.database.AllEvents()
+	page, err := app.readPage(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from the database"), http.StatusInternalServerError)
+		app.errorJSON(w, err)
 		return
 	}
 
-	var filteredEvents []models.Event
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
 
-	for _, event := range allEvents {
-		if event.GroupID == groupIdInt {
-			filteredEvents = append(filteredEvents, event)
-		}
+	events, cursors, err := app.database.GroupEvents(userID, groupIdInt, page)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Error getting data from the database"))
+		return
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, filteredEvents)
+	_ = app.writeJSON(w, http.StatusOK, events, app.pageLinks(r, page, cursors))
 }
 
 func (app *application) GroupEventHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 	id := strings.TrimPrefix(r.URL.Path, "/group-event/")
 	id1, err := strconv.Atoi(id)
 	if err != nil {
+		app.errorJSON(w, errInvalidParam("id"))
 		return
 	}
 
 	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error getting data from user sessions"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
 	event, err := app.database.GetEvent(id1)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorJSON(w, errLookup(err, errEventNotFound, "Error getting event from the database"))
 		return
 	}
 
 	isGroupMember, err := app.database.CheckMembership(userID, event.GroupID)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorJSON(w, errInternal(err, "Error checking group membership"))
 		return
 	}
 
 	isGroupCreator, err := app.database.CheckCreator(userID, event.GroupID)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorJSON(w, errInternal(err, "Error checking group creator"))
 		return
 	}
 
 	participants, err := app.database.GetParticipants(id1)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorJSON(w, errInternal(err, "Error getting event participants"))
 		return
 	}
 
 	isGoing, err := app.database.IsGoing(userID, id1)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to check if user is going"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to check if user is going"))
 		return
 	}
 
 	isNotGoing, err := app.database.IsNotGoing(userID, id1)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to check if user is going"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to check if user is going"))
 		return
 	}
 
@@ -1711,185 +3373,335 @@ func (app *application) GroupEventHandler(w http.ResponseWriter, r *http.Request
 
 func (app *application) GoingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/going" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var going models.EventParticipants
 	err := app.readJSON(w, r, &going)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
-	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
+	userId, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	isNotGoing, err := app.database.IsNotGoing(userId, going.EventID)
+	err = app.database.RespondToEvent(userId, going.EventID, true)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to check if user is going"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to mark as going"))
 		return
 	}
 
-	if isNotGoing {
-		err = app.database.NotGoingToGoingEvent(userId, going.EventID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to mark as going: %w", err), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		err = app.database.GoingToEvent(userId, going.EventID, firstName, lastName)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to mark as going: %w", err), http.StatusInternalServerError)
-			return
-		}
-	}
-
 	_ = app.writeJSON(w, http.StatusOK, going)
 }
 
 func (app *application) NotGoingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Invalid request method"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/not-going" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var notGoing models.EventParticipants
 	err := app.readJSON(w, r, &notGoing)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
-	userId, _, firstName, lastName, err := app.database.DataFromSession(r)
+	userId, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the user ID from the session"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	isGoing, err := app.database.IsGoing(userId, notGoing.EventID)
+	err = app.database.RespondToEvent(userId, notGoing.EventID, false)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to check if user is going"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to mark as not going"))
 		return
 	}
 
-	if isGoing {
-		err = app.database.GoingToNotGoingEvent(userId, notGoing.EventID)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to mark as not going: %w", err), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		err = app.database.NotGoingToEvent(userId, notGoing.EventID, firstName, lastName)
-		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to mark as not going: %w", err), http.StatusInternalServerError)
-			return
-		}
-	}
-
 	_ = app.writeJSON(w, http.StatusOK, notGoing)
 }
 
 func (app *application) AddMessageHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/message" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
 	var message models.Message
 	err := app.readJSON(w, r, &message)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Error decoding JSON data"), http.StatusBadRequest)
+		app.errorJSON(w, errInvalidJSON(err))
 		return
 	}
 
 	message = models.Message{
 		Message:       message.Message,
-		FirstNameFrom: message.FirstNameFrom,
+		UserIDTo:      message.UserIDTo,
+		GroupID:       message.GroupID,
 		FirstNameTo:   message.FirstNameTo,
+		AttachmentIDs: message.AttachmentIDs,
 		Date:          time.Now(),
 	}
-	_, _, message.FirstNameFrom, _, err = app.database.DataFromSession(r)
+
+	if errs := validator.Struct(&message); errs != nil {
+		app.errorJSON(w, errValidation(errs))
+		return
+	}
+
+	var lastName string
+	message.UserIDFrom, _, message.FirstNameFrom, lastName, err = app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the name"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	if message.Message != "" {
-		err = app.database.AddMessage(message.Message, message.FirstNameFrom, message.FirstNameTo, message.Date)
+	// Older clients address group chats by title and people by first name.
+	if message.UserIDTo == 0 && message.GroupID == 0 {
+		message.GroupID, err = app.database.GroupIDByTitle(message.FirstNameTo)
+		if errors.Is(err, sql.ErrNoRows) {
+			message.UserIDTo, err = app.database.UserIDByFirstName(message.FirstNameTo)
+		}
+		if err != nil {
+			app.errorJSON(w, errLookup(err, errUserNotFound, "Failed to find the message recipient"))
+			return
+		}
+	}
+
+	if message.GroupID != 0 {
+		err = app.groupChatAccess(message.UserIDFrom, message.GroupID)
 		if err != nil {
-			app.errorJSON(w, fmt.Errorf("Failed to add message"), http.StatusInternalServerError)
+			app.errorJSON(w, err)
 			return
 		}
 	}
-	_ = app.writeJSON(w, http.StatusCreated, message)
+
+	message.Mentions, err = app.findMentions(message.Message)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Failed to look up mentions"))
+		return
+	}
+
+	err = app.database.AddMessage(&message)
+	if err != nil {
+		app.errorJSON(w, errLookup(err, errAttachmentMissing, "Failed to add message"))
+		return
+	}
+	app.notifyMentions(models.Target{MessageID: message.MessageID}, models.UserData{UserID: message.UserIDFrom, FirstName: message.FirstNameFrom, LastName: lastName}, message.Mentions, nil)
+
+	messages := []models.Message{message}
+	err = app.attachMessageFiles(message.UserIDFrom, messages)
+	if err != nil {
+		app.errorJSON(w, errInternal(err, "Failed to get attachments"))
+		return
+	}
+	_ = app.writeJSON(w, http.StatusCreated, messages[0])
+}
+
+// attachMessageFiles fills in the attachments, reactions and mentions of
+// messages with one query each, and links to their files.
+func (app *application) attachMessageFiles(viewerID int, messages []models.Message) error {
+	ids := make([]int, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].MessageID
+	}
+
+	attachments, err := app.database.AttachmentsForMessages(ids)
+	if err != nil {
+		return err
+	}
+	reactions, err := app.database.ReactionsForMessages(viewerID, ids)
+	if err != nil {
+		return err
+	}
+	mentions, err := app.database.MentionsForMessages(ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].MessageID]
+		messages[i].Mentions = mentions[messages[i].MessageID]
+		app.attachmentLinks(messages[i].Attachments)
+		summary := reactionsOf(reactions, messages[i].MessageID)
+		messages[i].Reactions = &summary
+	}
+	return nil
 }
 
 func (app *application) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/conversation-history/" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	otherID, err := app.chatUserID(r, "userId", "firstNameTo")
+	if err != nil {
+		app.errorJSON(w, err)
 		return
 	}
 
-	firstNameTo := r.URL.Query().Get("firstNameTo")
-	_, _, firstNameFrom, _, err := app.database.DataFromSession(r)
+	page, err := app.readPage(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the name"), http.StatusInternalServerError)
+		app.errorJSON(w, err)
 		return
 	}
 
-	messages, err := app.database.GetMessages(firstNameFrom, firstNameTo)
+	messages, cursors, err := app.database.GetMessages(userID, otherID, page)
+	if err == nil {
+		err = app.attachMessageFiles(userID, messages)
+	}
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get messages"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get messages"))
 		return
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, messages)
+	_ = app.writeJSON(w, http.StatusOK, messages, app.pageLinks(r, page, cursors))
 }
 
 func (app *application) GetGroupMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/group-conversation-history/" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	groupID, err := app.chatGroupID(r, "groupName")
+	if err == nil {
+		err = app.groupChatAccess(userID, groupID)
+	}
+	if err != nil {
+		app.errorJSON(w, err)
 		return
 	}
 
-	groupName := r.URL.Query().Get("groupName")
+	page, err := app.readPage(r)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
 
-	messages, err := app.database.GetGroupMessages(groupName)
+	messages, cursors, err := app.database.GetGroupMessages(groupID, page)
+	if err == nil {
+		err = app.attachMessageFiles(userID, messages)
+	}
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get messages"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get messages"))
 		return
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, messages)
+	_ = app.writeJSON(w, http.StatusOK, messages, app.pageLinks(r, page, cursors))
+}
+
+// chatUserID reads a user ID from the idParam query parameter. Older clients
+// send a first name in nameParam instead, which is looked up.
+func (app *application) chatUserID(r *http.Request, idParam, nameParam string) (int, error) {
+	query := r.URL.Query()
+	if id := query.Get(idParam); id != "" {
+		userID, err := strconv.Atoi(id)
+		if err != nil {
+			return 0, errInvalidParam(idParam)
+		}
+		return userID, nil
+	}
+
+	name := query.Get(nameParam)
+	if name == "" {
+		return 0, errMissingParam(idParam)
+	}
+
+	userID, err := app.database.UserIDByFirstName(name)
+	if err != nil {
+		return 0, errLookup(err, errUserNotFound, "Failed to find user")
+	}
+	return userID, nil
+}
+
+// chatGroupID reads the groupId query parameter, falling back to looking up
+// the group title older clients send in nameParam.
+func (app *application) chatGroupID(r *http.Request, nameParam string) (int, error) {
+	query := r.URL.Query()
+	if id := query.Get("groupId"); id != "" {
+		groupID, err := strconv.Atoi(id)
+		if err != nil {
+			return 0, errInvalidParam("groupId")
+		}
+		return groupID, nil
+	}
+
+	name := query.Get(nameParam)
+	if name == "" {
+		return 0, errMissingParam("groupId")
+	}
+
+	groupID, err := app.database.GroupIDByTitle(name)
+	if err != nil {
+		return 0, errLookup(err, errGroupNotFound, "Failed to find group")
+	}
+	return groupID, nil
+}
+
+// groupChatAccess returns an error unless the user may use the group's chat:
+// its creator and members whose request or invitation is not pending may.
+func (app *application) groupChatAccess(userID, groupID int) error {
+	creator, err := app.database.CheckCreator(userID, groupID)
+	if err != nil {
+		return errInternal(err, "Failed to check the group creator")
+	}
+	if creator {
+		return nil
+	}
+
+	members, err := app.database.GetGroupMembers(groupID)
+	if err != nil {
+		return errInternal(err, "Failed to get group members")
+	}
+	for _, memberID := range members {
+		if memberID == userID {
+			return nil
+		}
+	}
+	return errForbidden("Only members of the group can use its chat")
 }
 
 var (
@@ -1898,28 +3710,29 @@ var (
 		return r.Header.Get("Origin") == allowedOrigin
 	},
 	}
-	connections = make(map[string]*websocket.Conn)
+	// The open chat connections, keyed by the ID of the user in the session.
+	connections = make(map[int]*websocket.Conn)
 	mutex       = sync.Mutex{}
 )
 
 func (app *application) WebsocketHandler(w http.ResponseWriter, r *http.Request) {
-	// Upgrade the HTTP connection to a WebSocket connection in order to enable full-duplex communication and support WebSocket-specific features
-	conn, err := upgrader.Upgrade(w, r, nil)
-
+	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		log.Println("Failed to upgrade connection:", err)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	_, _, firstName, _, err := app.database.DataFromSession(r)
+	// Upgrade the HTTP connection to a WebSocket connection in order to enable full-duplex communication and support WebSocket-specific features
+	conn, err := upgrader.Upgrade(w, r, nil)
+
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the name"), http.StatusInternalServerError)
+		log.Println("Failed to upgrade connection:", err)
 		return
 	}
 
 	// Add the WebSocket connection to the connections map to maintain active WebSocket connections.
 	mutex.Lock()
-	connections[firstName] = conn
+	connections[userID] = conn
 	mutex.Unlock()
 	// The function enters a loop to continuously read messages from the client.
 	for {
@@ -1940,65 +3753,73 @@ func (app *application) WebsocketHandler(w http.ResponseWriter, r *http.Request)
 			break
 		}
 
-		// Calling the handleMessage function, passing the recipient user's name, writer user's name, and the message as parameters to handle the received message.
-		app.handleMessage(r, w, msg.FirstNameFrom, msg.FirstNameTo, msg)
+		// Calling the handleMessage function to deliver the received message to its recipient and sender.
+		app.handleMessage(r, msg)
 	}
 
-	// Remove the WebSocket connection from the connections map when the connection is closed
+	// Remove the WebSocket connection from the connections map when the
+	// connection is closed, unless a newer one has replaced it.
 	mutex.Lock()
-	delete(connections, firstName)
+	if connections[userID] == conn {
+		delete(connections, userID)
+	}
 	mutex.Unlock()
 }
 
-func (app *application) handleMessage(r *http.Request, w http.ResponseWriter, senderFirstName string, receiverFirstName string, message models.Message) {
-	// Check if the recipient user has an active WebSocket connection
-	mutex.Lock()
-	recipientConn, recipientFound := connections[receiverFirstName]
-	mutex.Unlock()
-	// Check if the sender user has an active WebSocket connection
-	_, _, senderFirstName, _, err := app.database.DataFromSession(r)
+func (app *application) handleMessage(r *http.Request, message models.Message) {
+	senderID, _, senderFirstName, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the name"), http.StatusInternalServerError)
+		log.Println("Failed to get the sender from the session:", err)
 		return
 	}
-	mutex.Lock()
-	senderConn, senderFound := connections[senderFirstName]
-	mutex.Unlock()
+
+	// Older clients address the recipient by first name only.
+	receiverID := message.UserIDTo
+	if receiverID == 0 {
+		receiverID, err = app.database.UserIDByFirstName(message.FirstNameTo)
+		if err != nil {
+			log.Println("Failed to find the recipient:", err)
+			return
+		}
+	}
 
 	chatMessage := models.Message{
 		Message:       message.Message,
+		UserIDFrom:    senderID,
+		UserIDTo:      receiverID,
 		FirstNameFrom: senderFirstName,
-		FirstNameTo:   receiverFirstName,
+		FirstNameTo:   message.FirstNameTo,
+		Attachments:   message.Attachments,
 		Date:          message.Date,
 	}
+	data, err := json.Marshal(chatMessage)
+	if err != nil {
+		log.Println("Failed to marshal message:", err)
+		return
+	}
 
-	if recipientFound {
-		// Send the message to the recipient user's WebSocket connection
-		data, err := json.Marshal(chatMessage)
-		if err != nil {
-			log.Println("Failed to marshal message:", err)
-			return
-		}
+	// Writes happen under the mutex: a connection may only have one writer at
+	// a time, and the recipient's own handler may be writing to it as well.
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// Send the message to the recipient user's WebSocket connection
+	if recipientConn, ok := connections[receiverID]; ok {
 		err = recipientConn.WriteMessage(websocket.TextMessage, data)
 		if err != nil {
 			log.Println("Failed to write message to recipient:", err)
 		}
 	} else {
-		log.Println("No active WebSocket connection found for recipient:", receiverFirstName)
+		log.Println("No active WebSocket connection found for recipient:", receiverID)
 	}
-	if senderFound {
-		// Send the message to the sender's WebSocket connection
-		data, err := json.Marshal(chatMessage)
-		if err != nil {
-			log.Println("Failed to marshal message:", err)
-			return
-		}
+	// Send the message to the sender's WebSocket connection
+	if senderConn, ok := connections[senderID]; ok {
 		err = senderConn.WriteMessage(websocket.TextMessage, data)
 		if err != nil {
 			log.Println("Failed to write message to sender:", err)
 		}
 	} else {
-		log.Println("No active WebSocket connection found for sender:", senderFirstName)
+		log.Println("No active WebSocket connection found for sender:", senderID)
 	}
 }
 
@@ -2009,26 +3830,41 @@ var (
 			return r.Header.Get("Origin") == allowedOrigin
 		},
 	}
-	// Use a map to maintain active WebSocket connections for group chats.
-	groupConnections = make(map[string]map[*websocket.Conn]bool)
+	// Use a map to maintain active WebSocket connections for group chats,
+	// keyed by group ID, with the user behind each connection.
+	groupConnections = make(map[int]map[*websocket.Conn]int)
 	groupMutex       = sync.Mutex{}
 )
 
 func (app *application) GroupWebsocketHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _, firstName, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
+		return
+	}
+
+	// Older clients name the group by its title in the group parameter.
+	groupID, err := app.chatGroupID(r, "group")
+	if err == nil {
+		err = app.groupChatAccess(userID, groupID)
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
 	conn, err := upgraderGroup.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Failed to upgrade connection:", err)
 		return
 	}
 
-	groupName := r.URL.Query().Get("group")
-
 	// Lock and add the WebSocket connection to the group's connection map
 	groupMutex.Lock()
-	if groupConnections[groupName] == nil {
-		groupConnections[groupName] = make(map[*websocket.Conn]bool)
+	if groupConnections[groupID] == nil {
+		groupConnections[groupID] = make(map[*websocket.Conn]int)
 	}
-	groupConnections[groupName][conn] = true
+	groupConnections[groupID][conn] = userID
 	groupMutex.Unlock()
 
 	for {
@@ -2047,56 +3883,149 @@ func (app *application) GroupWebsocketHandler(w http.ResponseWriter, r *http.Req
 			break
 		}
 
-		broadcastGroupMessage(groupName, groupMsg)
+		// The sender and group come from the connection, not the client.
+		groupMsg.UserIDFrom, groupMsg.FirstNameFrom, groupMsg.GroupID = userID, firstName, groupID
+		broadcastGroupMessage(groupID, groupMsg)
 	}
 
 	// Remove the WebSocket connection from the group's connection map when the connection is closed
 	groupMutex.Lock()
-	delete(groupConnections[groupName], conn)
+	delete(groupConnections[groupID], conn)
 	groupMutex.Unlock()
 	conn.Close()
 }
 
-func broadcastGroupMessage(groupName string, message models.Message) {
+func broadcastGroupMessage(groupID int, message models.Message) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Println("Failed to marshal message:", err)
+		return
+	}
+	broadcastGroupData(groupID, data)
+}
+
+func broadcastGroupData(groupID int, data []byte) {
 	groupMutex.Lock()
 	defer groupMutex.Unlock()
 
 	// Iterate over all WebSocket connections in the group and send the message
-	for conn := range groupConnections[groupName] {
-		data, err := json.Marshal(message)
+	for conn := range groupConnections[groupID] {
+		err := conn.WriteMessage(websocket.TextMessage, data)
 		if err != nil {
-			log.Println("Failed to marshal message:", err)
+			log.Println("Failed to write message to connection:", err)
 			continue
 		}
+	}
+}
 
-		err = conn.WriteMessage(websocket.TextMessage, data)
+// pushReactions sends the new counts of a target to the open chat
+// connections of the users who may see it. Reactions to group messages go to
+// the group chat, to the members who still may see the message.
+func (app *application) pushReactions(update models.ReactionUpdate) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		log.Println("Failed to marshal reactions:", err)
+		return
+	}
+
+	var userIDs []int
+	if update.MessageID != 0 {
+		message, err := app.database.GetMessage(update.MessageID)
 		if err != nil {
-			log.Println("Failed to write message to connection:", err)
+			log.Println("Failed to get the message:", err)
+			return
+		}
+		if message.GroupID != 0 {
+			app.pushGroupReactions(message.GroupID, update.Target, data)
+			return
+		}
+		userIDs = []int{message.UserIDFrom, message.UserIDTo}
+	} else {
+		// Who may see the target is looked up before taking the lock.
+		mutex.Lock()
+		for userID := range connections {
+			userIDs = append(userIDs, userID)
+		}
+		mutex.Unlock()
+	}
+	viewers := app.targetViewers(userIDs, update.Target)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for userID := range viewers {
+		if conn, ok := connections[userID]; ok {
+			err = conn.WriteMessage(websocket.TextMessage, data)
+			if err != nil {
+				log.Println("Failed to write reactions to user", strconv.Itoa(userID)+":", err)
+			}
+		}
+	}
+}
+
+// pushGroupReactions sends data to the connections in the group's chat whose
+// users may see the target.
+func (app *application) pushGroupReactions(groupID int, target models.Target, data []byte) {
+	var userIDs []int
+	groupMutex.Lock()
+	for _, userID := range groupConnections[groupID] {
+		userIDs = append(userIDs, userID)
+	}
+	groupMutex.Unlock()
+	viewers := app.targetViewers(userIDs, target)
+
+	groupMutex.Lock()
+	defer groupMutex.Unlock()
+	for conn, userID := range groupConnections[groupID] {
+		if !viewers[userID] {
 			continue
 		}
+		err := conn.WriteMessage(websocket.TextMessage, data)
+		if err != nil {
+			log.Println("Failed to write reactions to user", strconv.Itoa(userID)+":", err)
+		}
+	}
+}
+
+// targetViewers returns the set of users among userIDs who may see target,
+// looked up with one query however many of them are online.
+func (app *application) targetViewers(userIDs []int, target models.Target) map[int]bool {
+	viewers := make(map[int]bool, len(userIDs))
+	if len(userIDs) == 0 {
+		return viewers
+	}
+	ids, err := app.database.WhoCanReact(userIDs, target)
+	if err != nil {
+		log.Println("Failed to check who may see the reactions:", err)
+	}
+	for _, userID := range ids {
+		viewers[userID] = true
 	}
+	return viewers
 }
 
 func (app *application) UnreadMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/unread-messages" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
 		return
 	}
 
-	_, _, firstName, _, err := app.database.DataFromSession(r)
+	userID, _, _, _, err := app.database.DataFromSession(r)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the name"), http.StatusInternalServerError)
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	unreadMessages, err := app.database.GetUnreadMessages(firstName)
+	unreadMessages, err := app.database.GetUnreadMessages(userID)
+	if err == nil {
+		err = app.attachMessageFiles(userID, unreadMessages)
+	}
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get messages"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to get messages"))
 		return
 	}
 
@@ -2105,25 +4034,30 @@ func (app *application) UnreadMessagesHandler(w http.ResponseWriter, r *http.Req
 
 func (app *application) MarkMessagesAsReadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		app.errorJSON(w, fmt.Errorf("Method not allowed"), http.StatusMethodNotAllowed)
+		app.errorJSON(w, errMethodNotAllowed)
 		return
 	}
 
 	if r.URL.Path != "/mark-messages-as-read/" {
-		app.errorJSON(w, fmt.Errorf("Error 404, page not found"), http.StatusNotFound)
+		app.errorJSON(w, errPageNotFound)
+		return
+	}
+
+	userID, _, _, _, err := app.database.DataFromSession(r)
+	if err != nil {
+		app.errorJSON(w, errSession(err))
 		return
 	}
 
-	firstNameFrom := r.URL.Query().Get("firstNameFrom")
-	_, _, firstNameto, _, err := app.database.DataFromSession(r)
+	senderID, err := app.chatUserID(r, "userIdFrom", "firstNameFrom")
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to get the name"), http.StatusInternalServerError)
+		app.errorJSON(w, err)
 		return
 	}
 
-	err = app.database.MarkMessagesAsRead(firstNameto, firstNameFrom)
+	err = app.database.MarkMessagesAsRead(userID, senderID)
 	if err != nil {
-		app.errorJSON(w, fmt.Errorf("Failed to update messages"), http.StatusInternalServerError)
+		app.errorJSON(w, errInternal(err, "Failed to update messages"))
 		return
 	}
 
@@ -0,0 +1,2721 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/database"
+	"social-network/database/memory"
+	"social-network/database/sqlite"
+	"social-network/media"
+	"social-network/models"
+	"social-network/validator"
+
+	"github.com/gorilla/websocket"
+)
+
+// testStores lists the backends the handler tests run against. Each entry
+// returns an empty store.
+var testStores = map[string]func(t *testing.T) database.Store{
+	"memory": func(t *testing.T) database.Store { return memory.New() },
+	"sqlite": newSqliteStore,
+}
+
+func newSqliteStore(t *testing.T) database.Store {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sqlite.Migrate(store.DB, "../../database/migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+const testImageSecret = "test secret"
+
+// newTestApp returns an application on store that keeps uploads in a
+// temporary folder.
+func newTestApp(t *testing.T, store database.Store) *application {
+	images, err := media.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{database: store, media: images}
+	app.config.media.secret = testImageSecret
+	app.config.media.limits = media.DefaultAttachmentLimits
+	app.config.commentDepth = defaultCommentDepth
+	app.config.reactions = parseReactions(defaultReactions)
+	app.config.trending = 24 * time.Hour
+	return app
+}
+
+// runWithStores runs test once per backend, each with its own server.
+func runWithStores(t *testing.T, test func(t *testing.T, srv *httptest.Server)) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		test(t, srv)
+	})
+}
+
+// runWithApps is runWithStores for tests that also look behind the API.
+func runWithApps(t *testing.T, test func(t *testing.T, app *application, srv *httptest.Server)) {
+	for name, newStore := range testStores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			t.Cleanup(func() { store.Close() })
+
+			app := newTestApp(t, store)
+			srv := httptest.NewServer(app.routes())
+			t.Cleanup(srv.Close)
+
+			test(t, app, srv)
+		})
+	}
+}
+
+// testClient is a browser-like client with its own cookie jar.
+type testClient struct {
+	t      *testing.T
+	srv    *httptest.Server
+	client *http.Client
+}
+
+func newTestClient(t *testing.T, srv *httptest.Server) *testClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{t: t, srv: srv, client: &http.Client{Jar: jar}}
+}
+
+func (c *testClient) do(req *http.Request) (*http.Response, []byte) {
+	c.t.Helper()
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return res, body
+}
+
+func (c *testClient) get(path string) (*http.Response, []byte) {
+	c.t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, c.srv.URL+path, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return c.do(req)
+}
+
+func (c *testClient) postJSON(path string, data interface{}) (*http.Response, []byte) {
+	c.t.Helper()
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.srv.URL+path, bytes.NewReader(payload))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req)
+}
+
+func (c *testClient) postForm(path string, fields map[string]string) (*http.Response, []byte) {
+	c.t.Helper()
+
+	return c.postFiles(path, fields, nil)
+}
+
+// postFiles sends a multipart form with the given fields and file uploads.
+func (c *testClient) postFiles(path string, fields map[string]string, files map[string][]byte) (*http.Response, []byte) {
+	c.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	for name, data := range files {
+		part, err := form.CreateFormFile(name, name+".jpg")
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if _, err := part.Write(data); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		c.t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.srv.URL+path, &body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return c.do(req)
+}
+
+func registerForm(email, firstName string) map[string]string {
+	return map[string]string{
+		"email":         email,
+		"password":      "secret1",
+		"first_name":    firstName,
+		"last_name":     "Tester",
+		"date_of_birth": "1990-01-01",
+	}
+}
+
+// signUp registers a user, logs them in and returns their client and ID.
+func signUp(t *testing.T, srv *httptest.Server, firstName string) (*testClient, int) {
+	t.Helper()
+
+	c := newTestClient(t, srv)
+	email := strings.ToLower(firstName) + "@example.com"
+
+	res, body := c.postForm("/register", registerForm(email, firstName))
+	expectStatus(t, res, body, http.StatusOK)
+
+	res, body = c.postJSON("/login", map[string]string{"email": email, "password": "secret1"})
+	expectStatus(t, res, body, http.StatusOK)
+
+	res, body = c.get("/search?query=" + firstName)
+	expectStatus(t, res, body, http.StatusOK)
+	var users []models.UserData
+	decode(t, body, &users)
+	for _, u := range users {
+		if u.FirstName == firstName {
+			return c, u.UserID
+		}
+	}
+	t.Fatalf("registered user %s not found by search", firstName)
+	return nil, 0
+}
+
+func expectStatus(t *testing.T, res *http.Response, body []byte, status int) {
+	t.Helper()
+
+	if res.StatusCode != status {
+		t.Fatalf("%s %s: got status %d, want %d: %s", res.Request.Method, res.Request.URL.Path, res.StatusCode, status, body)
+	}
+}
+
+func expectError(t *testing.T, res *http.Response, body []byte, status int, code string) JSONResponse {
+	t.Helper()
+
+	expectStatus(t, res, body, status)
+	var payload JSONResponse
+	decode(t, body, &payload)
+	if !payload.Error || payload.Code != code {
+		t.Fatalf("got error code %q, want %q: %s", payload.Code, code, body)
+	}
+	return payload
+}
+
+func decode(t *testing.T, body []byte, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+}
+
+func postContents(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	var posts []models.Post
+	decode(t, body, &posts)
+	contents := make([]string, len(posts))
+	for i, p := range posts {
+		contents[i] = p.Content
+	}
+	return contents
+}
+
+func TestRegisterValidation(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		c := newTestClient(t, srv)
+
+		form := registerForm("not-an-email", "Ann")
+		form["password"] = "abc"
+		res, body := c.postForm("/register", form)
+
+		payload := expectError(t, res, body, http.StatusUnprocessableEntity, CodeValidationFailed)
+		for _, field := range []string{"email", "password"} {
+			if _, ok := payload.Fields[field]; !ok {
+				t.Errorf("expected a validation error for %s, got %v", field, payload.Fields)
+			}
+		}
+	})
+}
+
+func TestRegisterDuplicateEmail(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		c := newTestClient(t, srv)
+
+		res, body := c.postForm("/register", registerForm("ann@example.com", "Ann"))
+		expectStatus(t, res, body, http.StatusOK)
+
+		res, body = c.postForm("/register", registerForm("ann@example.com", "Anna"))
+		expectError(t, res, body, http.StatusConflict, CodeEmailTaken)
+	})
+}
+
+func TestLoginInvalidCredentials(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		signUp(t, srv, "Ann")
+		c := newTestClient(t, srv)
+
+		res, body := c.postJSON("/login", map[string]string{"email": "ann@example.com", "password": "wrong-password"})
+		expectError(t, res, body, http.StatusUnauthorized, CodeInvalidCredentials)
+
+		res, body = c.postJSON("/login", map[string]string{"email": "nobody@example.com", "password": "secret1"})
+		expectError(t, res, body, http.StatusUnauthorized, CodeInvalidCredentials)
+	})
+}
+
+func TestAuthRequired(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		c := newTestClient(t, srv)
+
+		res, body := c.get("/all-posts")
+		expectError(t, res, body, http.StatusUnauthorized, CodeUnauthorized)
+
+		ann, _ := signUp(t, srv, "Ann")
+		res, body = ann.get("/logout")
+		expectStatus(t, res, body, http.StatusAccepted)
+
+		res, body = ann.get("/all-posts")
+		expectError(t, res, body, http.StatusUnauthorized, CodeUnauthorized)
+	})
+}
+
+func TestFeedVisibility(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, _ := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		cat, _ := signUp(t, srv, "Cat")
+
+		for _, post := range []map[string]string{
+			{"content": "for everyone", "privacy": "public"},
+			{"content": "for followers", "privacy": "private"},
+			{"content": "for bob", "privacy": "for-selected-users", "selected_user_id": fmt.Sprint(bobID)},
+		} {
+			res, body := ann.postForm("/create-post", post)
+			expectStatus(t, res, body, http.StatusOK)
+		}
+
+		cases := []struct {
+			name   string
+			client *testClient
+			want   []string
+		}{
+			{"author", ann, []string{"for bob", "for followers", "for everyone"}},
+			{"selected user", bob, []string{"for bob", "for everyone"}},
+			{"stranger", cat, []string{"for everyone"}},
+		}
+		for _, tc := range cases {
+			res, body := tc.client.get("/all-posts")
+			expectStatus(t, res, body, http.StatusOK)
+			if got := postContents(t, body); strings.Join(got, "|") != strings.Join(tc.want, "|") {
+				t.Errorf("%s sees %q, want %q", tc.name, got, tc.want)
+			}
+		}
+	})
+}
+
+func TestFeedPagination(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, _ := signUp(t, srv, "Ann")
+		for i := 1; i <= 3; i++ {
+			res, body := ann.postForm("/create-post", map[string]string{"content": fmt.Sprintf("post %d", i), "privacy": "public"})
+			expectStatus(t, res, body, http.StatusOK)
+		}
+
+		res, body := ann.get("/all-posts?limit=2")
+		expectStatus(t, res, body, http.StatusOK)
+		if got := postContents(t, body); strings.Join(got, "|") != "post 3|post 2" {
+			t.Fatalf("first page = %q", got)
+		}
+
+		link := res.Header.Get("Link")
+		start, end := strings.Index(link, "<"), strings.Index(link, `>; rel="next"`)
+		if start < 0 || end < 0 {
+			t.Fatalf("missing next link in %q", link)
+		}
+
+		res, body = ann.get(link[start+1 : end])
+		expectStatus(t, res, body, http.StatusOK)
+		if got := postContents(t, body); strings.Join(got, "|") != "post 1" {
+			t.Fatalf("second page = %q", got)
+		}
+		if strings.Contains(res.Header.Get("Link"), `rel="next"`) {
+			t.Errorf("last page should not link to a next page: %q", res.Header.Get("Link"))
+		}
+
+		res, body = ann.get("/all-posts?limit=0")
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+	})
+}
+
+func TestFollowPrivateUser(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, annID := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+
+		res, body := ann.postJSON("/profile-type", nil)
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = ann.postForm("/create-post", map[string]string{"content": "followers only", "privacy": "private"})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+		res, body = ann.postForm("/create-comment", map[string]string{"comment": "for followers too", "post_id": fmt.Sprint(post.PostID)})
+		expectStatus(t, res, body, http.StatusOK)
+		comments := fmt.Sprintf("/comments?postId=%d", post.PostID)
+
+		res, body = bob.postJSON("/follow", models.FollowRequest{FollowingID: annID})
+		expectStatus(t, res, body, http.StatusOK)
+
+		checkFollow := func(wantFollowing, wantPending bool) {
+			t.Helper()
+
+			res, body := bob.get(fmt.Sprintf("/follower-check?userId=%d", annID))
+			expectStatus(t, res, body, http.StatusOK)
+			var status struct {
+				IsFollowing bool `json:"is_following"`
+				IsPending   bool `json:"is_pending"`
+			}
+			decode(t, body, &status)
+			if status.IsFollowing != wantFollowing || status.IsPending != wantPending {
+				t.Fatalf("follow status = %+v, want following=%v pending=%v", status, wantFollowing, wantPending)
+			}
+		}
+		checkFollow(false, true)
+
+		res, body = bob.get("/all-posts")
+		expectStatus(t, res, body, http.StatusOK)
+		if got := postContents(t, body); len(got) != 0 {
+			t.Fatalf("pending follower sees %q", got)
+		}
+		res, body = bob.get(comments)
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		res, body = ann.get("/follow-requests")
+		expectStatus(t, res, body, http.StatusOK)
+		var requests []models.UserData
+		decode(t, body, &requests)
+		if len(requests) != 1 || requests[0].UserID != bobID {
+			t.Fatalf("follow requests = %+v, want Bob", requests)
+		}
+
+		res, body = ann.postJSON("/accept-follower", models.FollowRequest{FollowerID: bobID})
+		expectStatus(t, res, body, http.StatusOK)
+		checkFollow(true, false)
+
+		res, body = bob.get("/all-posts")
+		expectStatus(t, res, body, http.StatusOK)
+		if got := postContents(t, body); strings.Join(got, "|") != "followers only" {
+			t.Fatalf("accepted follower sees %q", got)
+		}
+		res, body = bob.get(comments)
+		expectStatus(t, res, body, http.StatusOK)
+		var got []models.Comment
+		decode(t, body, &got)
+		if len(got) != 1 || got[0].Comment != "for followers too" {
+			t.Fatalf("accepted follower sees comments %+v", got)
+		}
+	})
+}
+
+func TestUnknownGroupNotFound(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, _ := signUp(t, srv, "Ann")
+
+		res, body := ann.get("/group/999")
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+	})
+}
+
+func TestFollowToggle(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		_, annID := signUp(t, srv, "Ann")
+		bob, _ := signUp(t, srv, "Bob")
+
+		following := func() []models.UserData {
+			t.Helper()
+
+			res, body := bob.get("/following")
+			expectStatus(t, res, body, http.StatusOK)
+			var users []models.UserData
+			decode(t, body, &users)
+			return users
+		}
+
+		res, body := bob.postJSON("/follow", models.FollowRequest{FollowingID: annID})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := following(); len(got) != 1 || got[0].UserID != annID {
+			t.Fatalf("following after follow = %+v, want Ann", got)
+		}
+
+		res, body = bob.postJSON("/follow", models.FollowRequest{FollowingID: annID})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := following(); len(got) != 0 {
+			t.Fatalf("following after unfollow = %+v, want none", got)
+		}
+
+		res, body = bob.postJSON("/follow", models.FollowRequest{FollowingID: 999})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+	})
+}
+
+func TestGroupEventNotificationsAndAnswers(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, annID := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		cara, _ := signUp(t, srv, "Cara")
+
+		// Ann also invites herself, so she is both the creator and a member.
+		res, body := ann.postJSON("/create-group", models.Group{
+			Title:          "Hikers",
+			Description:    "Weekend walks",
+			SelectedUserID: fmt.Sprintf("%d,%d", annID, bobID),
+		})
+		expectStatus(t, res, body, http.StatusOK)
+		var group models.Group
+		decode(t, body, &group)
+
+		for _, member := range []struct {
+			client *testClient
+			id     int
+		}{{ann, annID}, {bob, bobID}} {
+			res, body = member.client.postJSON("/accept-group-invitation", models.GroupMembers{GroupID: group.GroupID, MemberID: member.id})
+			expectStatus(t, res, body, http.StatusOK)
+		}
+
+		res, body = ann.postJSON("/create-event", models.Event{
+			Title:       "Hike",
+			Description: "Up the hill",
+			Time:        time.Now().AddDate(0, 0, 7).Format(validator.DateLayout),
+			GroupID:     group.GroupID,
+		})
+		expectStatus(t, res, body, http.StatusOK)
+		var event models.Event
+		decode(t, body, &event)
+		if event.EventID == 0 {
+			t.Fatalf("created event has no ID: %s", body)
+		}
+
+		for _, tc := range []struct {
+			name   string
+			client *testClient
+			want   int
+		}{
+			{"creator", ann, 1},
+			{"member", bob, 1},
+			{"outsider", cara, 0},
+		} {
+			res, body := tc.client.get("/group-event-notifications")
+			expectStatus(t, res, body, http.StatusOK)
+			var notifications []struct {
+				EventID int `json:"event_id"`
+			}
+			decode(t, body, &notifications)
+			if len(notifications) != tc.want {
+				t.Fatalf("%s has %d notifications, want %d", tc.name, len(notifications), tc.want)
+			}
+			if tc.want > 0 && notifications[0].EventID != event.EventID {
+				t.Fatalf("%s notified about event %d, want %d", tc.name, notifications[0].EventID, event.EventID)
+			}
+		}
+
+		answer := models.EventParticipants{EventID: event.EventID}
+		for _, path := range []string{"/going", "/going", "/not-going"} {
+			res, body = bob.postJSON(path, answer)
+			expectStatus(t, res, body, http.StatusOK)
+		}
+
+		res, body = bob.get(fmt.Sprintf("/group-event/%d", event.EventID))
+		expectStatus(t, res, body, http.StatusOK)
+		var details struct {
+			Participants []models.EventParticipants `json:"participants"`
+			Going        bool                       `json:"going"`
+			NotGoing     bool                       `json:"not_going"`
+		}
+		decode(t, body, &details)
+		if len(details.Participants) != 1 || details.Going || !details.NotGoing {
+			t.Fatalf("event answers = %+v, want Bob once, not going", details)
+		}
+	})
+}
+
+func TestSessionCookie(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		c := newTestClient(t, srv)
+		res, body := c.postForm("/register", registerForm("ann@example.com", "Ann"))
+		expectStatus(t, res, body, http.StatusOK)
+
+		res, body = c.postJSON("/login", map[string]string{"email": "ann@example.com", "password": "secret1"})
+		expectStatus(t, res, body, http.StatusOK)
+		var login struct {
+			Session string `json:"session"`
+		}
+		decode(t, body, &login)
+		var cookie *http.Cookie
+		for _, ck := range res.Cookies() {
+			if ck.Name == "sessionId" {
+				cookie = ck
+			}
+		}
+		if cookie == nil || cookie.Value != login.Session {
+			t.Fatalf("login set cookie %+v, want the session %q", cookie, login.Session)
+		}
+
+		res, body = c.get("/main")
+		expectStatus(t, res, body, http.StatusOK)
+		var user models.UserData
+		decode(t, body, &user)
+		if user.Email != "ann@example.com" {
+			t.Fatalf("/main returned %q, want the logged in user", user.Email)
+		}
+
+		forged := newTestClient(t, srv)
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/main", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "sessionId", Value: "not-a-session"})
+		res, body = forged.do(req)
+		expectError(t, res, body, http.StatusUnauthorized, CodeUnauthorized)
+	})
+}
+
+func TestUserProfileVisibility(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, annID := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		cat, catID := signUp(t, srv, "Cat")
+		dan, _ := signUp(t, srv, "Dan")
+
+		res, body := bob.postJSON("/follow", models.FollowRequest{FollowingID: annID})
+		expectStatus(t, res, body, http.StatusOK)
+
+		res, body = ann.postJSON("/create-group", models.Group{Title: "Club", Description: "Members only"})
+		expectStatus(t, res, body, http.StatusOK)
+		var group models.Group
+		decode(t, body, &group)
+
+		for _, post := range []map[string]string{
+			{"content": "public", "privacy": "public"},
+			{"content": "private", "privacy": "private"},
+			{"content": "for cat", "privacy": "for-selected-users", "selected_user_id": fmt.Sprint(catID)},
+			{"content": "in club", "privacy": "public", "group_id": fmt.Sprint(group.GroupID)},
+		} {
+			res, body := ann.postForm("/create-post", post)
+			expectStatus(t, res, body, http.StatusOK)
+		}
+
+		// Group posts show up on neither the profile nor the feed.
+		cases := []struct {
+			name   string
+			client *testClient
+			want   string
+		}{
+			{"author", ann, "for cat|private|public"},
+			{"follower", bob, "private|public"},
+			{"selected user", cat, "for cat|public"},
+			{"stranger", dan, "public"},
+		}
+		for _, tc := range cases {
+			res, body := tc.client.get(fmt.Sprintf("/user/%d", annID))
+			expectStatus(t, res, body, http.StatusOK)
+			var profile struct {
+				UserData  models.UserData   `json:"user_data"`
+				Followers []models.UserData `json:"followers"`
+				Posts     []models.Post     `json:"posts"`
+			}
+			decode(t, body, &profile)
+			if profile.UserData.UserID != annID {
+				t.Fatalf("%s: profile of user %d, want %d", tc.name, profile.UserData.UserID, annID)
+			}
+			if len(profile.Followers) != 1 || profile.Followers[0].UserID != bobID {
+				t.Fatalf("%s: followers = %+v, want Bob", tc.name, profile.Followers)
+			}
+			var contents []string
+			for _, p := range profile.Posts {
+				contents = append(contents, p.Content)
+			}
+			if got := strings.Join(contents, "|"); got != tc.want {
+				t.Errorf("%s sees %q on the profile, want %q", tc.name, got, tc.want)
+			}
+
+			res, body = tc.client.get("/all-posts")
+			expectStatus(t, res, body, http.StatusOK)
+			if got := strings.Join(postContents(t, body), "|"); got != tc.want {
+				t.Errorf("%s sees %q in the feed, want %q", tc.name, got, tc.want)
+			}
+		}
+
+		res, body = dan.get("/user/999")
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		res, body = dan.get("/user/ann")
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+	})
+}
+
+func TestFollowRequests(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		_, annID := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		cat, catID := signUp(t, srv, "Cat")
+
+		followStatus := func(c *testClient, userID int) string {
+			t.Helper()
+
+			res, body := c.get(fmt.Sprintf("/follower-check?userId=%d", userID))
+			expectStatus(t, res, body, http.StatusOK)
+			var status struct {
+				IsFollowing bool `json:"is_following"`
+				IsPending   bool `json:"is_pending"`
+			}
+			decode(t, body, &status)
+			return fmt.Sprintf("following=%v pending=%v", status.IsFollowing, status.IsPending)
+		}
+
+		// Public profiles are followed straight away.
+		res, body := bob.postJSON("/follow", models.FollowRequest{FollowingID: annID})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := followStatus(bob, annID); got != "following=true pending=false" {
+			t.Fatalf("following a public user: %s", got)
+		}
+
+		// Private profiles get a request, which can be declined.
+		res, body = cat.postJSON("/profile-type", nil)
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = bob.postJSON("/follow", models.FollowRequest{FollowingID: catID})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := followStatus(bob, catID); got != "following=false pending=true" {
+			t.Fatalf("following a private user: %s", got)
+		}
+
+		res, body = cat.postJSON("/decline-follower", models.FollowRequest{FollowerID: bobID})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := followStatus(bob, catID); got != "following=false pending=false" {
+			t.Fatalf("after the request was declined: %s", got)
+		}
+		res, body = cat.get("/follow-requests")
+		expectStatus(t, res, body, http.StatusOK)
+		var requests []models.UserData
+		decode(t, body, &requests)
+		if len(requests) != 0 {
+			t.Fatalf("follow requests after declining = %+v", requests)
+		}
+
+		res, body = cat.get("/followers")
+		expectStatus(t, res, body, http.StatusOK)
+		var followers []models.UserData
+		decode(t, body, &followers)
+		if len(followers) != 0 {
+			t.Fatalf("declined follower listed: %+v", followers)
+		}
+	})
+}
+
+// groupState returns what userID's client sees on the group page.
+func groupState(t *testing.T, c *testClient, groupID int) (members []int, pending bool) {
+	t.Helper()
+
+	res, body := c.get(fmt.Sprintf("/group/%d", groupID))
+	expectStatus(t, res, body, http.StatusOK)
+	var page struct {
+		GroupMembers   []int `json:"group_members"`
+		RequestPending bool  `json:"request_pending"`
+	}
+	decode(t, body, &page)
+	return page.GroupMembers, page.RequestPending
+}
+
+func TestGroupInvitations(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, _ := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		cat, catID := signUp(t, srv, "Cat")
+		dan, danID := signUp(t, srv, "Dan")
+
+		res, body := ann.postJSON("/create-group", models.Group{
+			Title:          "Readers",
+			Description:    "Book club",
+			SelectedUserID: fmt.Sprintf("%d,%d", bobID, catID),
+		})
+		expectStatus(t, res, body, http.StatusOK)
+		var group models.Group
+		decode(t, body, &group)
+
+		invitations := func(c *testClient) []int {
+			t.Helper()
+
+			res, body := c.get("/group-invitations")
+			expectStatus(t, res, body, http.StatusOK)
+			var list []struct {
+				GroupID int `json:"group_id"`
+			}
+			decode(t, body, &list)
+			var ids []int
+			for _, invitation := range list {
+				ids = append(ids, invitation.GroupID)
+			}
+			return ids
+		}
+
+		for _, c := range []*testClient{bob, cat} {
+			if got := invitations(c); len(got) != 1 || got[0] != group.GroupID {
+				t.Fatalf("invitations = %v, want group %d", got, group.GroupID)
+			}
+		}
+
+		res, body = bob.postJSON("/accept-group-invitation", models.GroupMembers{GroupID: group.GroupID, MemberID: bobID})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = cat.postJSON("/decline-group-invitation", models.GroupMembers{GroupID: group.GroupID, MemberID: catID})
+		expectStatus(t, res, body, http.StatusOK)
+		for _, c := range []*testClient{bob, cat} {
+			if got := invitations(c); len(got) != 0 {
+				t.Fatalf("invitations after answering = %v", got)
+			}
+		}
+		if members, _ := groupState(t, ann, group.GroupID); len(members) != 1 || members[0] != bobID {
+			t.Fatalf("members = %v, want Bob", members)
+		}
+
+		// Members can invite others later.
+		res, body = bob.postJSON("/invite", models.GroupMembers{GroupID: group.GroupID, MemberID: danID})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := invitations(dan); len(got) != 1 || got[0] != group.GroupID {
+			t.Fatalf("invitations = %v, want group %d", got, group.GroupID)
+		}
+		res, body = bob.postJSON("/invite", models.GroupMembers{GroupID: 999, MemberID: danID})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		res, body = bob.postForm("/create-post", map[string]string{"content": "chapter one", "privacy": "public", "group_id": fmt.Sprint(group.GroupID)})
+		expectStatus(t, res, body, http.StatusOK)
+		for _, tc := range []struct {
+			name   string
+			client *testClient
+			want   string
+		}{
+			{"creator", ann, "chapter one"},
+			{"member", bob, "chapter one"},
+			{"declined", cat, ""},
+			{"invited", dan, ""},
+		} {
+			res, body := tc.client.get(fmt.Sprintf("/group-posts?groupId=%d", group.GroupID))
+			expectStatus(t, res, body, http.StatusOK)
+			if got := strings.Join(postContents(t, body), "|"); got != tc.want {
+				t.Errorf("%s sees group posts %q, want %q", tc.name, got, tc.want)
+			}
+		}
+	})
+}
+
+func TestGroupJoinRequests(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, _ := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		cat, catID := signUp(t, srv, "Cat")
+
+		res, body := ann.postJSON("/create-group", models.Group{Title: "Runners", Description: "Morning runs"})
+		expectStatus(t, res, body, http.StatusOK)
+		var group models.Group
+		decode(t, body, &group)
+		join := models.GroupMembers{GroupID: group.GroupID}
+
+		requests := func() []int {
+			t.Helper()
+
+			res, body := ann.get("/group-requests")
+			expectStatus(t, res, body, http.StatusOK)
+			var list []struct {
+				Member models.UserData `json:"member"`
+			}
+			decode(t, body, &list)
+			var ids []int
+			for _, request := range list {
+				ids = append(ids, request.Member.UserID)
+			}
+			return ids
+		}
+
+		for _, c := range []*testClient{bob, cat} {
+			res, body = c.postJSON("/request-to-join-group", join)
+			expectStatus(t, res, body, http.StatusOK)
+		}
+		if _, pending := groupState(t, bob, group.GroupID); !pending {
+			t.Fatal("Bob's request is not pending")
+		}
+		if got := requests(); len(got) != 2 {
+			t.Fatalf("requests = %v, want Bob and Cat", got)
+		}
+
+		res, body = ann.postJSON("/accept-group-request", models.GroupMembers{GroupID: group.GroupID, MemberID: bobID})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = ann.postJSON("/decline-group-request", models.GroupMembers{GroupID: group.GroupID, MemberID: catID})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := requests(); len(got) != 0 {
+			t.Fatalf("requests after answering = %v", got)
+		}
+		members, pending := groupState(t, bob, group.GroupID)
+		if pending || len(members) != 1 || members[0] != bobID {
+			t.Fatalf("members = %v pending = %v, want Bob as a member", members, pending)
+		}
+		if members, pending := groupState(t, cat, group.GroupID); pending || len(members) != 1 {
+			t.Fatalf("declined request: members = %v pending = %v", members, pending)
+		}
+
+		// Asking again leaves the group.
+		res, body = bob.postJSON("/request-to-join-group", join)
+		expectStatus(t, res, body, http.StatusOK)
+		if members, _ := groupState(t, bob, group.GroupID); len(members) != 0 {
+			t.Fatalf("members after leaving = %v", members)
+		}
+
+		res, body = bob.postJSON("/request-to-join-group", models.GroupMembers{GroupID: 999})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+	})
+}
+
+func TestEventAnswerToggles(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, annID := signUp(t, srv, "Ann")
+
+		res, body := ann.postJSON("/create-group", models.Group{Title: "Chess", Description: "Weekly games", SelectedUserID: fmt.Sprint(annID)})
+		expectStatus(t, res, body, http.StatusOK)
+		var group models.Group
+		decode(t, body, &group)
+
+		res, body = ann.postJSON("/create-event", models.Event{
+			Title:       "Tournament",
+			Description: "Bring a board",
+			Time:        time.Now().AddDate(0, 0, 3).Format(validator.DateLayout),
+			GroupID:     group.GroupID,
+		})
+		expectStatus(t, res, body, http.StatusOK)
+		var event models.Event
+		decode(t, body, &event)
+
+		answer := models.EventParticipants{EventID: event.EventID}
+		for _, step := range []struct {
+			path            string
+			going, notGoing bool
+		}{
+			{"/going", true, false},
+			{"/not-going", false, true},
+			{"/going", true, false},
+			{"/not-going", false, true},
+			{"/not-going", false, true},
+		} {
+			res, body := ann.postJSON(step.path, answer)
+			expectStatus(t, res, body, http.StatusOK)
+
+			res, body = ann.get(fmt.Sprintf("/group-event/%d", event.EventID))
+			expectStatus(t, res, body, http.StatusOK)
+			var details struct {
+				Participants []models.EventParticipants `json:"participants"`
+				Going        bool                       `json:"going"`
+				NotGoing     bool                       `json:"not_going"`
+			}
+			decode(t, body, &details)
+			if details.Going != step.going || details.NotGoing != step.notGoing || len(details.Participants) != 1 {
+				t.Fatalf("after %s: going=%v not_going=%v participants=%d", step.path, details.Going, details.NotGoing, len(details.Participants))
+			}
+		}
+
+		res, body = ann.get("/group-event/999")
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+	})
+}
+
+// dialChat opens a websocket as c, sending the front end's origin.
+func dialChat(t *testing.T, c *testClient, path string) *websocket.Conn {
+	t.Helper()
+
+	dialer := websocket.Dialer{Jar: c.client.Jar, HandshakeTimeout: 5 * time.Second}
+	header := http.Header{"Origin": {"http://localhost:3000"}}
+	conn, res, err := dialer.Dial("ws"+strings.TrimPrefix(c.srv.URL, "http")+path, header)
+	if err != nil {
+		status := 0
+		if res != nil {
+			status = res.StatusCode
+		}
+		t.Fatalf("dialing %s: %v (status %d)", path, err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func sendChat(t *testing.T, conn *websocket.Conn, message models.Message) {
+	t.Helper()
+
+	if err := conn.WriteJSON(message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readChat(t *testing.T, conn *websocket.Conn) models.Message {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message models.Message
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+// TestWebsocketChat runs against one SQLite-backed server only: the chat
+// connections are kept in package-level maps keyed by user and group ID.
+func TestWebsocketChat(t *testing.T) {
+	store := newSqliteStore(t)
+	t.Cleanup(func() { store.Close() })
+	srv := httptest.NewServer(newTestApp(t, store).routes())
+	t.Cleanup(srv.Close)
+
+	ann, annID := signUp(t, srv, "Ann")
+	bob, bobID := signUp(t, srv, "Bob")
+
+	dialer := websocket.Dialer{Jar: ann.client.Jar}
+	if _, res, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil); err == nil || res == nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("dial from another origin: err=%v, want 403", err)
+	}
+
+	annConn := dialChat(t, ann, "/ws")
+	bobConn := dialChat(t, bob, "/ws")
+
+	// A message to oneself comes back twice, once as recipient and once as
+	// sender, which also shows the connection is registered.
+	for _, c := range []struct {
+		conn *websocket.Conn
+		name string
+		id   int
+	}{{annConn, "Ann", annID}, {bobConn, "Bob", bobID}} {
+		sendChat(t, c.conn, models.Message{Message: "ping", UserIDTo: c.id, FirstNameTo: c.name})
+		for i := 0; i < 2; i++ {
+			if got := readChat(t, c.conn); got.Message != "ping" || got.UserIDFrom != c.id {
+				t.Fatalf("%s got %+v, want their own ping", c.name, got)
+			}
+		}
+	}
+
+	sendChat(t, annConn, models.Message{Message: "hi bob", UserIDTo: bobID, FirstNameTo: "Bob"})
+	for _, conn := range []*websocket.Conn{bobConn, annConn} {
+		got := readChat(t, conn)
+		if got.Message != "hi bob" || got.UserIDFrom != annID || got.FirstNameFrom != "Ann" || got.FirstNameTo != "Bob" {
+			t.Fatalf("delivered %+v, want Ann's message to Bob", got)
+		}
+	}
+
+	// Ann creates Hikers and Bob joins it. Runners is Cat's.
+	cat, _ := signUp(t, srv, "Cat")
+	res, body := ann.postJSON("/create-group", models.Group{Title: "Hikers", Description: "Weekend hikes"})
+	expectStatus(t, res, body, http.StatusOK)
+	var hikers models.Group
+	decode(t, body, &hikers)
+	res, body = bob.postJSON("/request-to-join-group", models.GroupMembers{GroupID: hikers.GroupID})
+	expectStatus(t, res, body, http.StatusOK)
+	res, body = ann.postJSON("/accept-group-request", models.GroupMembers{GroupID: hikers.GroupID, MemberID: bobID})
+	expectStatus(t, res, body, http.StatusOK)
+	res, body = cat.postJSON("/create-group", models.Group{Title: "Runners", Description: "Morning runs"})
+	expectStatus(t, res, body, http.StatusOK)
+	var runners models.Group
+	decode(t, body, &runners)
+
+	// Only members open a group's room, read its history or post to it.
+	dialStatus := func(c *testClient, path string) int {
+		t.Helper()
+		dialer := websocket.Dialer{Jar: c.client.Jar}
+		header := http.Header{"Origin": {"http://localhost:3000"}}
+		conn, res, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+path, header)
+		if err == nil {
+			conn.Close()
+			t.Fatalf("dialing %s succeeded", path)
+		}
+		if res == nil {
+			t.Fatalf("dialing %s: %v", path, err)
+		}
+		return res.StatusCode
+	}
+	hikersRoom := fmt.Sprintf("/chatroom/?groupId=%d", hikers.GroupID)
+	if got := dialStatus(newTestClient(t, srv), hikersRoom); got != http.StatusUnauthorized {
+		t.Fatalf("dial without a session: status %d, want 401", got)
+	}
+	if got := dialStatus(cat, hikersRoom); got != http.StatusForbidden {
+		t.Fatalf("dial by a non-member: status %d, want 403", got)
+	}
+	res, body = cat.get(fmt.Sprintf("/group-conversation-history/?groupId=%d", hikers.GroupID))
+	expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+	res, body = bob.get(fmt.Sprintf("/group-conversation-history/?groupId=%d", hikers.GroupID))
+	expectStatus(t, res, body, http.StatusOK)
+	res, body = cat.postJSON("/message", models.Message{Message: "let me in", GroupID: hikers.GroupID})
+	expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+	res, body = cat.postJSON("/message", models.Message{Message: "let me in", FirstNameTo: "Hikers"})
+	expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+
+	// The sender is taken from the session, whoever the message claims to
+	// be from.
+	annRoom := dialChat(t, ann, hikersRoom)
+	sendChat(t, annRoom, models.Message{Message: "ann here", FirstNameFrom: "Bob"})
+	if got := readChat(t, annRoom); got.Message != "ann here" || got.UserIDFrom != annID || got.FirstNameFrom != "Ann" || got.GroupID != hikers.GroupID {
+		t.Fatalf("Ann got %+v, want her own message", got)
+	}
+
+	// Older clients name the group by title.
+	bobRoom := dialChat(t, bob, "/chatroom/?group=Hikers")
+	sendChat(t, bobRoom, models.Message{Message: "bob here"})
+	for _, conn := range []*websocket.Conn{bobRoom, annRoom} {
+		if got := readChat(t, conn); got.Message != "bob here" || got.FirstNameFrom != "Bob" {
+			t.Fatalf("group chat delivered %+v, want Bob's message", got)
+		}
+	}
+
+	// Other rooms do not receive the message.
+	otherRoom := dialChat(t, cat, fmt.Sprintf("/chatroom/?groupId=%d", runners.GroupID))
+	sendChat(t, annRoom, models.Message{Message: "hikers only"})
+	for _, conn := range []*websocket.Conn{annRoom, bobRoom} {
+		if got := readChat(t, conn); got.Message != "hikers only" {
+			t.Fatalf("group chat delivered %+v, want Ann's message", got)
+		}
+	}
+	otherRoom.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := otherRoom.ReadMessage(); err == nil {
+		t.Fatalf("another room received %s", data)
+	}
+}
+
+// testImage returns a w by h image encoded in format, jpeg or png.
+func testImage(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i)
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageUploadAndServe(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		c := newTestClient(t, srv)
+		avatar := testImage(t, "jpeg", 100, 100)
+		res, body := c.postFiles("/register", registerForm("ann@example.com", "Ann"), map[string][]byte{"avatar": avatar})
+		expectStatus(t, res, body, http.StatusOK)
+		var user models.UserData
+		decode(t, body, &user)
+
+		res, body = c.get("/images/" + user.Avatar)
+		expectError(t, res, body, http.StatusUnauthorized, CodeUnauthorized)
+
+		res, body = c.postJSON("/login", map[string]string{"email": "ann@example.com", "password": "secret1"})
+		expectStatus(t, res, body, http.StatusOK)
+
+		picture := testImage(t, "png", 1600, 900)
+		res, body = c.postFiles("/create-post", map[string]string{"content": "with a picture", "privacy": "public"}, map[string][]byte{"image": picture})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+		if post.Image == "" {
+			t.Fatalf("post has no image: %s", body)
+		}
+
+		for name, want := range map[string][]byte{user.Avatar: avatar, post.Image: picture} {
+			res, body := c.get("/images/" + name)
+			expectStatus(t, res, body, http.StatusOK)
+			if !bytes.Equal(body, want) {
+				t.Fatalf("/images/%s returned %q, want %q", name, body, want)
+			}
+			if got := res.Header.Get("Content-Type"); got != http.DetectContentType(want) {
+				t.Errorf("/images/%s has content type %q", name, got)
+			}
+		}
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/images/"+post.Image, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", "bytes=5-11")
+		res, body = c.do(req)
+		expectStatus(t, res, body, http.StatusPartialContent)
+		if !bytes.Equal(body, picture[5:12]) {
+			t.Fatalf("range request returned %q", body)
+		}
+
+		// Variants are scaled down copies; images without them, such as
+		// uploads from before they were made, are served whole.
+		for name, width := range map[string]int{"small": 160, "medium": 640, "large": 1280} {
+			if post.ImageVariants[name] != post.ImageURL+"&size="+name {
+				t.Errorf("%s variant link is %q", name, post.ImageVariants[name])
+			}
+			res, body := c.get("/images/" + post.Image + "?size=" + name)
+			expectStatus(t, res, body, http.StatusOK)
+			config, format, err := image.DecodeConfig(bytes.NewReader(body))
+			if err != nil || format != "png" || config.Width != width {
+				t.Errorf("%s variant is a %dpx wide %s (%v), want %dpx", name, config.Width, format, err, width)
+			}
+		}
+		res, body = c.get("/images/" + user.Avatar + "?size=small")
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = c.get("/images/" + post.Image + "?size=huge")
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+
+		for _, name := range []string{"missing.jpg", "nested%2Fdatabase.db", ".upload-1"} {
+			res, body := c.get("/images/" + name)
+			expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		}
+	})
+}
+
+func TestImageAccess(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann := newTestClient(t, srv)
+		res, body := ann.postFiles("/register", registerForm("ann@example.com", "Ann"), map[string][]byte{"avatar": testImage(t, "jpeg", 10, 10)})
+		expectStatus(t, res, body, http.StatusOK)
+		var annData models.UserData
+		decode(t, body, &annData)
+		res, body = ann.postJSON("/login", map[string]string{"email": "ann@example.com", "password": "secret1"})
+		expectStatus(t, res, body, http.StatusOK)
+
+		bob, bobID := signUp(t, srv, "Bob")
+		dan, _ := signUp(t, srv, "Dan")
+		anonymous := newTestClient(t, srv)
+
+		res, body = bob.get("/search?query=Ann")
+		expectStatus(t, res, body, http.StatusOK)
+		var users []models.UserData
+		decode(t, body, &users)
+		if len(users) != 1 {
+			t.Fatalf("search for Ann returned %+v", users)
+		}
+		annID := users[0].UserID
+
+		res, body = ann.postJSON("/profile-type", nil)
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = bob.postJSON("/follow", models.FollowRequest{FollowingID: annID})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = ann.postJSON("/accept-follower", models.FollowRequest{FollowerID: bobID})
+		expectStatus(t, res, body, http.StatusOK)
+
+		private := testImage(t, "png", 20, 10)
+		res, body = ann.postFiles("/create-post", map[string]string{"content": "private picture", "privacy": "private"}, map[string][]byte{"image": private})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+		if post.ImageURL == "" {
+			t.Fatalf("post has no image URL: %s", body)
+		}
+
+		res, body = bob.postFiles("/create-comment", map[string]string{"comment": "nice", "post_id": fmt.Sprint(post.PostID)}, map[string][]byte{"image": testImage(t, "jpeg", 10, 20)})
+		expectStatus(t, res, body, http.StatusOK)
+		var comment models.Comment
+		decode(t, body, &comment)
+
+		// Without a signed link, images follow the visibility of their post.
+		for _, name := range []string{post.Image, comment.Image} {
+			for _, c := range []*testClient{ann, bob} {
+				res, body := c.get("/images/" + name)
+				expectStatus(t, res, body, http.StatusOK)
+			}
+			res, body := dan.get("/images/" + name)
+			expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+			res, body = anonymous.get("/images/" + name)
+			expectError(t, res, body, http.StatusUnauthorized, CodeUnauthorized)
+		}
+
+		// Avatars are visible to everyone logged in.
+		res, body = dan.get("/images/" + annData.Avatar)
+		expectStatus(t, res, body, http.StatusOK)
+
+		// Comment listings link their images, and are only shown to those
+		// who may see the post.
+		res, body = bob.get(fmt.Sprintf("/comments?postId=%d", post.PostID))
+		expectStatus(t, res, body, http.StatusOK)
+		var comments []models.Comment
+		decode(t, body, &comments)
+		if len(comments) != 1 || comments[0].ImageURL == "" {
+			t.Fatalf("comments = %+v, want a linked image", comments)
+		}
+		res, body = dan.get(fmt.Sprintf("/comments?postId=%d", post.PostID))
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		// Signed links work without a session until they expire.
+		res, body = anonymous.get(post.ImageURL)
+		expectStatus(t, res, body, http.StatusOK)
+		if !bytes.Equal(body, private) {
+			t.Fatalf("signed link returned %q", body)
+		}
+		res, body = anonymous.get(comment.ImageURL)
+		expectStatus(t, res, body, http.StatusOK)
+
+		signer := &application{}
+		signer.config.media.secret = testImageSecret
+		expired := time.Now().Add(-time.Minute).Unix()
+		for _, link := range []string{
+			strings.Replace(post.ImageURL, post.Image, comment.Image, 1),
+			fmt.Sprintf("/images/%s?expires=%d&sig=%s", post.Image, expired, signer.imageSignature(post.Image, expired)),
+			"/images/" + post.Image + "?sig=",
+		} {
+			res, body := anonymous.get(link)
+			expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+		}
+	})
+}
+
+func TestImageUploadLimits(t *testing.T) {
+	store := memory.New()
+	defer store.Close()
+	app := newTestApp(t, store)
+	app.config.media.limits = media.AttachmentLimits{
+		Image:            media.ImageLimits{MaxBytes: 64 << 10, MaxPixels: 1000 * 1000},
+		MaxVideoBytes:    64 << 10,
+		MaxVideoLength:   time.Minute,
+		MaxDocumentBytes: 64 << 10,
+	}
+	srv := httptest.NewServer(app.routes())
+	defer srv.Close()
+
+	c, _ := signUp(t, srv, "Ann")
+	for name, tc := range map[string]struct {
+		image  []byte
+		status int
+		code   string
+	}{
+		"not an image":    {[]byte("<svg onload=alert(1)>"), http.StatusUnsupportedMediaType, CodeUnsupportedMedia},
+		"too many pixels": {testImage(t, "jpeg", 1001, 1000), http.StatusRequestEntityTooLarge, CodeTooLarge},
+		"too many bytes":  {append([]byte("%PDF-1.7\n"), make([]byte, 200<<10)...), http.StatusRequestEntityTooLarge, CodeTooLarge},
+		"too large form":  {make([]byte, 2<<20), http.StatusRequestEntityTooLarge, CodeTooLarge},
+	} {
+		res, body := c.postFiles("/create-post", map[string]string{"content": name, "privacy": "public"}, map[string][]byte{"image": tc.image})
+		if res.StatusCode != tc.status {
+			t.Errorf("%s: got status %d, want %d: %s", name, res.StatusCode, tc.status, body)
+			continue
+		}
+		expectError(t, res, body, tc.status, tc.code)
+	}
+
+	res, body := c.get("/all-posts")
+	expectStatus(t, res, body, http.StatusOK)
+	if posts := postContents(t, body); len(posts) != 0 {
+		t.Fatalf("rejected uploads created posts %v", posts)
+	}
+}
+
+// postAttachments posts a multipart form with files in the attachments
+// field and their alt text, in order.
+func (c *testClient) postAttachments(path string, fields map[string]string, files [][]byte, altTexts []string) (*http.Response, []byte) {
+	c.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	for i, data := range files {
+		part, err := form.CreateFormFile("attachments", fmt.Sprintf("file%d", i))
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if _, err := part.Write(data); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	for _, altText := range altTexts {
+		if err := form.WriteField("alt_text", altText); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		c.t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.srv.URL+path, &body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return c.do(req)
+}
+
+var testPDF = []byte("%PDF-1.7\n1 0 obj\n<<>>\nendobj\n%%EOF\n")
+
+func TestPostAttachments(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, annID := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+
+		files := [][]byte{testImage(t, "png", 30, 20), testPDF, testImage(t, "jpeg", 20, 30)}
+		res, body := ann.postAttachments("/create-post", map[string]string{"content": "album", "privacy": "private"}, files, []string{"a wide one", "", "a tall one"})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+
+		want := []struct {
+			mimeType, altText string
+			width             int
+		}{{"image/png", "a wide one", 30}, {"application/pdf", "", 0}, {"image/jpeg", "a tall one", 20}}
+		if len(post.Attachments) != len(want) {
+			t.Fatalf("post has attachments %+v", post.Attachments)
+		}
+		for i, w := range want {
+			a := post.Attachments[i]
+			if a.MimeType != w.mimeType || a.AltText != w.altText || a.Width != w.width || a.URL == "" || (len(a.Variants) > 0) != (w.width > 0) {
+				t.Errorf("attachment %d is %+v, want %+v", i, a, w)
+			}
+		}
+		// Older clients show the first image.
+		if post.Image != post.Attachments[0].Name || post.ImageURL == "" {
+			t.Errorf("post image is %q, want %q", post.Image, post.Attachments[0].Name)
+		}
+
+		res, body = ann.get(post.Attachments[1].URL)
+		expectStatus(t, res, body, http.StatusOK)
+		if !bytes.Equal(body, testPDF) || res.Header.Get("Content-Type") != "application/pdf" || res.Header.Get("Content-Disposition") != "attachment" {
+			t.Fatalf("document served as %q, %q: %q", res.Header.Get("Content-Type"), res.Header.Get("Content-Disposition"), body)
+		}
+
+		res, body = bob.postAttachments("/create-comment", map[string]string{"comment": "a reply", "post_id": fmt.Sprint(post.PostID)}, [][]byte{testPDF}, []string{"notes"})
+		expectStatus(t, res, body, http.StatusOK)
+		var comment models.Comment
+		decode(t, body, &comment)
+		if len(comment.Attachments) != 1 || comment.Attachments[0].AltText != "notes" || comment.Image != "" {
+			t.Fatalf("comment is %+v", comment)
+		}
+
+		res, body = ann.get("/all-posts")
+		expectStatus(t, res, body, http.StatusOK)
+		var posts []models.Post
+		decode(t, body, &posts)
+		if len(posts) != 1 || len(posts[0].Attachments) != 3 || posts[0].Attachments[2].AltText != "a tall one" ||
+			len(posts[0].Comments) != 1 || len(posts[0].Comments[0].Attachments) != 1 {
+			t.Fatalf("feed is %+v", posts)
+		}
+
+		// The post is private, so Bob, who does not follow Ann, may not
+		// open its files.
+		for _, a := range post.Attachments {
+			res, body := bob.get("/images/" + a.Name)
+			expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		}
+		res, body = bob.get(fmt.Sprintf("/comments?postId=%d", post.PostID))
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		tooMany := make([][]byte, models.MaxAttachments+1)
+		for i := range tooMany {
+			tooMany[i] = testPDF
+		}
+		res, body = ann.postAttachments("/create-post", map[string]string{"content": "too many", "privacy": "public"}, tooMany, nil)
+		expectError(t, res, body, http.StatusUnprocessableEntity, CodeValidationFailed)
+		res, body = ann.postAttachments("/create-post", map[string]string{"content": "script", "privacy": "public"}, [][]byte{[]byte("<html><script></script></html>")}, nil)
+		expectError(t, res, body, http.StatusUnsupportedMediaType, CodeUnsupportedMedia)
+
+		// Files for chat messages are uploaded first and linked by ID, once.
+		res, body = ann.postAttachments("/attachments", nil, [][]byte{testImage(t, "png", 10, 10)}, []string{"a square"})
+		expectStatus(t, res, body, http.StatusCreated)
+		var uploaded []models.Attachment
+		decode(t, body, &uploaded)
+		if len(uploaded) != 1 || uploaded[0].AttachmentID == 0 || uploaded[0].URL == "" {
+			t.Fatalf("uploaded %+v", uploaded)
+		}
+		ids := []int{uploaded[0].AttachmentID}
+
+		res, body = bob.postJSON("/message", models.Message{Message: "mine now", UserIDTo: annID, AttachmentIDs: ids})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		res, body = ann.postJSON("/message", models.Message{Message: "look", UserIDTo: bobID, AttachmentIDs: ids})
+		expectStatus(t, res, body, http.StatusCreated)
+		var message models.Message
+		decode(t, body, &message)
+		if len(message.Attachments) != 1 || message.Attachments[0].AltText != "a square" || message.Attachments[0].URL == "" {
+			t.Fatalf("message is %+v", message)
+		}
+		res, body = ann.postJSON("/message", models.Message{Message: "again", UserIDTo: bobID, AttachmentIDs: ids})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		res, body = bob.get(fmt.Sprintf("/conversation-history/?userId=%d", annID))
+		expectStatus(t, res, body, http.StatusOK)
+		var messages []models.Message
+		decode(t, body, &messages)
+		if len(messages) != 1 || len(messages[0].Attachments) != 1 || messages[0].Attachments[0].Name != uploaded[0].Name {
+			t.Fatalf("history is %+v", messages)
+		}
+		res, body = bob.get("/images/" + uploaded[0].Name)
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = newTestClient(t, srv).postAttachments("/attachments", nil, [][]byte{testPDF}, nil)
+		expectError(t, res, body, http.StatusUnauthorized, CodeUnauthorized)
+	})
+}
+
+// expectFiles checks which of the files exist in the media store.
+func expectFiles(t *testing.T, app *application, files map[string]bool) {
+	t.Helper()
+
+	for name, want := range files {
+		obj, err := app.media.Open(context.Background(), name)
+		if err == nil {
+			obj.Close()
+		}
+		if exists := err == nil; exists != want {
+			t.Errorf("file %s exists: %v, want %v (%v)", name, exists, want, err)
+		}
+	}
+}
+
+// failingRegister is a store that cannot register anyone.
+type failingRegister struct{ database.Store }
+
+func (failingRegister) Register(*models.UserData) error { return errors.New("register failed") }
+
+func TestRegisterDiscardsAvatar(t *testing.T) {
+	store := newSqliteStore(t)
+	t.Cleanup(func() { store.Close() })
+	app := newTestApp(t, failingRegister{store})
+	srv := httptest.NewServer(app.routes())
+	t.Cleanup(srv.Close)
+
+	res, body := newTestClient(t, srv).postFiles("/register", registerForm("ann@example.com", "Ann"), map[string][]byte{"avatar": testImage(t, "png", 30, 20)})
+	expectError(t, res, body, http.StatusInternalServerError, CodeInternal)
+
+	files, err := os.ReadDir(app.media.(*media.Local).Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("%d files left after a failed registration", len(files))
+	}
+	unused, err := store.UnusedMediaFiles(time.Now().Add(time.Hour))
+	if err != nil || len(unused) != 0 {
+		t.Errorf("unused media files = %q, %v", unused, err)
+	}
+}
+
+func TestAvatarReplaceAndDelete(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		// Namesakes used to share one file.
+		var avatars []string
+		var clients []*testClient
+		for i, size := range []int{10, 20} {
+			c := newTestClient(t, srv)
+			email := fmt.Sprintf("mia%d@example.com", i)
+			res, body := c.postFiles("/register", registerForm(email, "Mia"), map[string][]byte{"avatar": testImage(t, "png", size, size)})
+			expectStatus(t, res, body, http.StatusOK)
+			var user models.UserData
+			decode(t, body, &user)
+			if !generatedName.MatchString(user.Avatar) {
+				t.Fatalf("avatar is called %q", user.Avatar)
+			}
+			avatars = append(avatars, user.Avatar)
+
+			res, body = c.postJSON("/login", map[string]string{"email": email, "password": "secret1"})
+			expectStatus(t, res, body, http.StatusOK)
+			clients = append(clients, c)
+		}
+		if avatars[0] == avatars[1] {
+			t.Fatal("namesakes share an avatar")
+		}
+		mia := clients[0]
+
+		res, body := mia.postFiles("/avatar", nil, map[string][]byte{"avatar": testImage(t, "jpeg", 30, 30)})
+		expectStatus(t, res, body, http.StatusOK)
+		var user models.UserData
+		decode(t, body, &user)
+		if user.Avatar == avatars[0] || !strings.HasSuffix(user.Avatar, ".jpg") {
+			t.Fatalf("avatar after replacing it is %q", user.Avatar)
+		}
+		expectFiles(t, app, map[string]bool{
+			avatars[0]:                              false,
+			media.VariantName(avatars[0], "small"):  false,
+			avatars[1]:                              true,
+			user.Avatar:                             true,
+			media.VariantName(user.Avatar, "small"): true,
+		})
+
+		res, body = mia.postFiles("/avatar", nil, nil)
+		expectError(t, res, body, http.StatusBadRequest, CodeMissingParameter)
+		res, body = mia.postFiles("/avatar", nil, map[string][]byte{"avatar": []byte("<svg onload=alert(1)>")})
+		expectError(t, res, body, http.StatusUnsupportedMediaType, CodeUnsupportedMedia)
+		res, body = mia.get("/avatar")
+		expectError(t, res, body, http.StatusMethodNotAllowed, CodeMethodNotAllowed)
+
+		req, err := http.NewRequest(http.MethodDelete, srv.URL+"/avatar", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, body = mia.do(req)
+		expectStatus(t, res, body, http.StatusOK)
+		previous := user.Avatar
+		decode(t, body, &user)
+		if user.Avatar != "" {
+			t.Fatalf("avatar after deleting it is %q", user.Avatar)
+		}
+		expectFiles(t, app, map[string]bool{previous: false, avatars[1]: true})
+	})
+}
+
+func TestMigrateAvatars(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		ctx := context.Background()
+		photo := testImage(t, "jpeg", 40, 40)
+		for name, data := range map[string][]byte{"MiaLuna.jpg": photo, "Broken.jpg": []byte("not an image")} {
+			if err := app.media.Put(ctx, name, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		current, err := app.storeUpload(ctx, &media.Upload{Ext: ".png", Data: []byte("png")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before := map[string]string{
+			"mia1@example.com":    "MiaLuna.jpg",
+			"mia2@example.com":    "MiaLuna.jpg",
+			"broken@example.com":  "Broken.jpg",
+			"missing@example.com": "Missing.jpg",
+			"current@example.com": current,
+		}
+		for email, avatar := range before {
+			user := models.UserData{Email: email, Password: "secret1", FirstName: "Mia", LastName: "Luna", DateOfBirth: "1990-01-01", Avatar: avatar}
+			if err := app.database.Register(&user); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		moved, err := app.migrateAvatars(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if moved != 3 {
+			t.Fatalf("moved %d avatars, want 3", moved)
+		}
+
+		after := make(map[string]string)
+		for email := range before {
+			user, err := app.database.GetUserDataByEmail(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after[email] = user.Avatar
+		}
+		if after["missing@example.com"] != "Missing.jpg" || after["current@example.com"] != current {
+			t.Fatalf("avatars that could not or need not move changed: %v", after)
+		}
+		if after["mia1@example.com"] != after["mia2@example.com"] {
+			t.Fatal("the same avatar was stored twice")
+		}
+		for _, email := range []string{"mia1@example.com", "mia2@example.com", "broken@example.com"} {
+			if !generatedName.MatchString(after[email]) {
+				t.Fatalf("avatar of %s is called %q", email, after[email])
+			}
+		}
+		expectFiles(t, app, map[string]bool{
+			"MiaLuna.jpg":               false,
+			"Broken.jpg":                false,
+			after["mia1@example.com"]:   true,
+			after["mia2@example.com"]:   true,
+			after["broken@example.com"]: true,
+			media.VariantName(after["mia1@example.com"], "small"): true,
+		})
+
+		obj, err := app.media.Open(ctx, after["broken@example.com"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(obj)
+		obj.Close()
+		if err != nil || string(data) != "not an image" {
+			t.Fatalf("copy of an avatar that is no image holds %q (%v)", data, err)
+		}
+
+		moved, err = app.migrateAvatars(ctx)
+		if err != nil || moved != 0 {
+			t.Fatalf("second run moved %d avatars (%v), want none", moved, err)
+		}
+
+		mia1, _, _, _, err := app.database.DataFromUserData(&models.UserData{Email: "mia1@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := app.database.SetAvatar(mia1, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.deleteImage(ctx, after["mia1@example.com"]); err != nil {
+			t.Fatal(err)
+		}
+		expectFiles(t, app, map[string]bool{after["mia2@example.com"]: true})
+	})
+}
+
+func TestMediaDeduplication(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		app.config.admins = parseAdmins("ann@example.com")
+		ann, annID := signUp(t, srv, "Ann")
+		photo := testImage(t, "png", 30, 20)
+
+		var names []string
+		for _, content := range []string{"first", "second"} {
+			res, body := ann.postAttachments("/create-post", map[string]string{"content": content, "privacy": "public"}, [][]byte{photo}, nil)
+			expectStatus(t, res, body, http.StatusOK)
+			var post models.Post
+			decode(t, body, &post)
+			names = append(names, post.Attachments[0].Name)
+		}
+		if names[0] != names[1] {
+			t.Fatalf("the same image was stored as %s and %s", names[0], names[1])
+		}
+
+		res, body := ann.get("/admin/media-usage")
+		expectStatus(t, res, body, http.StatusOK)
+		var report []models.MediaUsage
+		decode(t, body, &report)
+		if len(report) != 1 || report[0].UserID != annID || report[0].Files != 1 || report[0].Bytes <= int64(len(photo)) {
+			t.Fatalf("usage report is %+v", report)
+		}
+	})
+}
+
+func TestMediaQuota(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		app.config.admins = parseAdmins(" Ann@example.com ")
+		app.config.media.quota = 1
+		ann, _ := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		photo := testImage(t, "png", 30, 20)
+
+		res, body := bob.postAttachments("/create-post", map[string]string{"content": "over", "privacy": "public"}, [][]byte{photo}, nil)
+		expectError(t, res, body, http.StatusRequestEntityTooLarge, CodeQuotaExceeded)
+		res, body = bob.postFiles("/avatar", nil, map[string][]byte{"avatar": photo})
+		expectError(t, res, body, http.StatusRequestEntityTooLarge, CodeQuotaExceeded)
+
+		res, body = bob.get("/admin/media-usage")
+		expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+		res, body = bob.postJSON("/admin/media-quota", models.MediaQuota{UserID: bobID})
+		expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+
+		unlimited := int64(0)
+		res, body = ann.postJSON("/admin/media-quota", models.MediaQuota{UserID: bobID, Quota: &unlimited})
+		expectStatus(t, res, body, http.StatusOK)
+		var usage models.MediaUsage
+		decode(t, body, &usage)
+		if usage.UserID != bobID || usage.Quota == nil || *usage.Quota != 0 || usage.Limit != 0 {
+			t.Fatalf("usage after lifting the quota is %+v", usage)
+		}
+
+		res, body = bob.postAttachments("/create-post", map[string]string{"content": "fits", "privacy": "public"}, [][]byte{photo}, nil)
+		expectStatus(t, res, body, http.StatusOK)
+
+		negative := int64(-1)
+		res, body = ann.postJSON("/admin/media-quota", models.MediaQuota{UserID: bobID, Quota: &negative})
+		expectError(t, res, body, http.StatusUnprocessableEntity, CodeValidationFailed)
+		res, body = ann.postJSON("/admin/media-quota", models.MediaQuota{UserID: 999})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		res, body = ann.get("/admin/media-usage")
+		expectStatus(t, res, body, http.StatusOK)
+		var report []models.MediaUsage
+		decode(t, body, &report)
+		if len(report) != 2 || report[0].UserID != bobID || report[0].Files != 1 || report[1].Bytes != 0 || report[1].Limit != 1 {
+			t.Fatalf("usage report is %+v", report)
+		}
+	})
+}
+
+func TestCollectMedia(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		ctx := context.Background()
+		ann, _ := signUp(t, srv, "Ann")
+		put := func(name string, data []byte) {
+			t.Helper()
+			if err := app.media.Put(ctx, name, bytes.NewReader(data), int64(len(data)), ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		res, body := ann.postAttachments("/attachments", nil, [][]byte{testPDF}, nil)
+		expectStatus(t, res, body, http.StatusCreated)
+		var pending []models.Attachment
+		decode(t, body, &pending)
+
+		res, body = ann.postAttachments("/create-post", map[string]string{"content": "kept", "privacy": "public"}, [][]byte{testImage(t, "png", 30, 20)}, nil)
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+
+		unused, err := app.storeUpload(ctx, &media.Upload{Ext: ".png", Data: []byte("unused")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		orphan := "0123456789abcdef0123456789abcdef.png"
+		put(orphan, []byte("orphan"))
+		put(media.VariantName(orphan, "small"), []byte("small"))
+		put("Legacy.jpg", []byte("legacy"))
+		legacy := models.UserData{Email: "legacy@example.com", Password: "secret1", FirstName: "Old", LastName: "Timer", DateOfBirth: "1990-01-01", Avatar: "Legacy.jpg"}
+		if err := app.database.Register(&legacy); err != nil {
+			t.Fatal(err)
+		}
+
+		// Within the grace period nothing is touched.
+		app.config.media.gc.grace = time.Hour
+		result, err := app.collectMedia(ctx)
+		if err != nil || result != (mediaCollection{}) {
+			t.Fatalf("collecting within the grace period did %+v (%v)", result, err)
+		}
+
+		app.config.media.gc.grace = -time.Minute
+		result, err = app.collectMedia(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (mediaCollection{attachments: 1, files: 3, adopted: 1}); result != want {
+			t.Fatalf("collected %+v, want %+v", result, want)
+		}
+		expectFiles(t, app, map[string]bool{
+			pending[0].Name:                    false,
+			unused:                             false,
+			orphan:                             false,
+			media.VariantName(orphan, "small"): false,
+			post.Attachments[0].Name:           true,
+			media.VariantName(post.Attachments[0].Name, "small"): true,
+			"Legacy.jpg": true,
+		})
+
+		sizes, err := app.database.MediaFileSizes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sizes["Legacy.jpg"] != int64(len("legacy")) {
+			t.Fatalf("recorded sizes %v", sizes)
+		}
+		result, err = app.collectMedia(ctx)
+		if err != nil || result != (mediaCollection{}) {
+			t.Fatalf("second collection did %+v (%v)", result, err)
+		}
+	})
+}
+
+func TestEditAndDeletePost(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		app.config.moderators = parseAdmins("mod@example.com")
+		ann, _ := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		mod, _ := signUp(t, srv, "Mod")
+		photo := testImage(t, "png", 30, 20)
+
+		res, body := ann.postAttachments("/create-post", map[string]string{"content": "first", "privacy": "public"}, [][]byte{photo, testPDF}, []string{"photo", "paper"})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+		if post.EditedAt != nil {
+			t.Fatalf("new post is marked edited at %v", post.EditedAt)
+		}
+		original, paper := post.Attachments[0], post.Attachments[1]
+
+		edit := map[string]string{
+			"post_id":          fmt.Sprint(post.PostID),
+			"content":          "second",
+			"privacy":          "for-selected-users",
+			"selected_user_id": fmt.Sprint(bobID),
+			"keep":             fmt.Sprint(paper.AttachmentID),
+			"keep_alt_text":    "the paper",
+		}
+		res, body = bob.postAttachments("/edit-post", edit, nil, nil)
+		expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+
+		edit["keep"] = fmt.Sprint(paper.AttachmentID + 100)
+		res, body = ann.postAttachments("/edit-post", edit, nil, nil)
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+
+		edit["keep"] = fmt.Sprint(paper.AttachmentID)
+		newPhoto := testImage(t, "png", 40, 20)
+		res, body = ann.postAttachments("/edit-post", edit, [][]byte{newPhoto}, []string{"new"})
+		expectStatus(t, res, body, http.StatusOK)
+		var edited models.Post
+		decode(t, body, &edited)
+		if edited.EditedAt == nil || len(edited.Attachments) != 2 ||
+			edited.Attachments[0].AttachmentID != paper.AttachmentID || edited.Attachments[0].AltText != "the paper" ||
+			edited.Attachments[1].AltText != "new" || edited.Image != edited.Attachments[1].Name {
+			t.Fatalf("edited post is %+v", edited)
+		}
+
+		res, body = bob.get("/all-posts")
+		expectStatus(t, res, body, http.StatusOK)
+		var feed []models.Post
+		decode(t, body, &feed)
+		if len(feed) != 1 || feed[0].Content != "second" || feed[0].EditedAt == nil || len(feed[0].Attachments) != 2 {
+			t.Fatalf("feed after editing is %+v", feed)
+		}
+		res, body = mod.get("/all-posts")
+		expectStatus(t, res, body, http.StatusOK)
+		if got := postContents(t, body); len(got) != 0 {
+			t.Fatalf("post taken off public is still shown: %q", got)
+		}
+
+		res, body = bob.get(fmt.Sprintf("/post-revisions?postId=%d", post.PostID))
+		expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+		for _, c := range []*testClient{ann, mod} {
+			res, body = c.get(fmt.Sprintf("/post-revisions?postId=%d", post.PostID))
+			expectStatus(t, res, body, http.StatusOK)
+			var revisions []models.PostRevision
+			decode(t, body, &revisions)
+			if len(revisions) != 1 || revisions[0].Content != "first" || revisions[0].Privacy != "public" ||
+				len(revisions[0].Attachments) != 2 || revisions[0].Attachments[0].Name != original.Name || revisions[0].Attachments[1].AltText != "paper" {
+				t.Fatalf("revisions are %+v", revisions)
+			}
+		}
+
+		res, body = bob.postAttachments("/create-comment", map[string]string{"post_id": fmt.Sprint(post.PostID), "comment": "nice"}, [][]byte{testImage(t, "png", 50, 20)}, nil)
+		expectStatus(t, res, body, http.StatusOK)
+		var comment models.Comment
+		decode(t, body, &comment)
+
+		res, body = bob.postJSON("/delete-post", models.Post{PostID: post.PostID})
+		expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+		res, body = ann.postJSON("/delete-post", models.Post{PostID: post.PostID})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = ann.postJSON("/delete-post", models.Post{PostID: post.PostID})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		res, body = ann.postAttachments("/edit-post", edit, nil, nil)
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		res, body = ann.get(fmt.Sprintf("/comments?postId=%d", post.PostID))
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		expectFiles(t, app, map[string]bool{
+			original.Name:                             false,
+			paper.Name:                                false,
+			edited.Attachments[1].Name:                false,
+			comment.Attachments[0].Name:               false,
+			media.VariantName(original.Name, "small"): false,
+		})
+	})
+}
+
+func TestThreadedComments(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		app.config.commentDepth = 2
+		ann, _ := signUp(t, srv, "Ann")
+		bob, _ := signUp(t, srv, "Bob")
+		cat, _ := signUp(t, srv, "Cat")
+
+		res, body := ann.postForm("/create-post", map[string]string{"content": "thread", "privacy": "public"})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+		postID := fmt.Sprint(post.PostID)
+
+		comment := func(c *testClient, parentID int, text string, files [][]byte) models.Comment {
+			t.Helper()
+			fields := map[string]string{"post_id": postID, "comment": text}
+			if parentID != 0 {
+				fields["parent_id"] = fmt.Sprint(parentID)
+			}
+			res, body := c.postAttachments("/create-comment", fields, files, nil)
+			expectStatus(t, res, body, http.StatusOK)
+			var created models.Comment
+			decode(t, body, &created)
+			return created
+		}
+
+		top := comment(bob, 0, "top", [][]byte{testImage(t, "png", 30, 20)})
+		reply := comment(cat, top.CommentID, "reply", nil)
+		deep := comment(bob, reply.CommentID, "deep", nil)
+		if reply.Depth != 1 || deep.Depth != 2 || deep.ParentID != reply.CommentID {
+			t.Fatalf("reply is %+v, deep reply %+v", reply, deep)
+		}
+		res, body = bob.postForm("/create-comment", map[string]string{"post_id": postID, "comment": "too deep", "parent_id": fmt.Sprint(deep.CommentID)})
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+		res, body = bob.postForm("/create-comment", map[string]string{"post_id": postID, "comment": "lost", "parent_id": "999"})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		res, body = cat.postAttachments("/edit-comment", map[string]string{"comment_id": fmt.Sprint(top.CommentID), "comment": "mine now"}, nil, nil)
+		expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+		res, body = bob.postAttachments("/edit-comment", map[string]string{"comment_id": fmt.Sprint(top.CommentID), "comment": "top, edited"}, nil, nil)
+		expectStatus(t, res, body, http.StatusOK)
+		var edited models.Comment
+		decode(t, body, &edited)
+		if edited.EditedAt == nil || edited.Comment != "top, edited" || len(edited.Attachments) != 0 {
+			t.Fatalf("edited comment is %+v", edited)
+		}
+		expectFiles(t, app, map[string]bool{top.Attachments[0].Name: false})
+
+		res, body = cat.postJSON("/delete-comment", models.Comment{CommentID: top.CommentID})
+		expectError(t, res, body, http.StatusForbidden, CodeForbidden)
+		// Ann owns the post, so she can delete Bob's comment. It has replies
+		// and stays as a tombstone.
+		res, body = ann.postJSON("/delete-comment", models.Comment{CommentID: top.CommentID})
+		expectStatus(t, res, body, http.StatusOK)
+
+		res, body = ann.get("/all-posts")
+		expectStatus(t, res, body, http.StatusOK)
+		var feed []models.Post
+		decode(t, body, &feed)
+		if len(feed) != 1 || len(feed[0].Comments) != 1 {
+			t.Fatalf("feed is %+v", feed)
+		}
+		tombstone := feed[0].Comments[0]
+		if !tombstone.Deleted || tombstone.Comment != "" || tombstone.FirstName != "" || tombstone.ReplyCount != 1 ||
+			len(tombstone.Replies) != 1 || tombstone.Replies[0].Comment != "reply" || len(tombstone.Replies[0].Replies) != 1 {
+			t.Fatalf("thread after deleting its first comment is %+v", tombstone)
+		}
+
+		res, body = ann.get(fmt.Sprintf("/comments?postId=%s&parentId=%d", postID, reply.CommentID))
+		expectStatus(t, res, body, http.StatusOK)
+		var replies []models.Comment
+		decode(t, body, &replies)
+		if len(replies) != 1 || replies[0].CommentID != deep.CommentID {
+			t.Fatalf("replies are %+v", replies)
+		}
+
+		res, body = bob.postForm("/create-comment", map[string]string{"post_id": postID, "comment": "to nothing", "parent_id": fmt.Sprint(top.CommentID)})
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+		res, body = bob.postAttachments("/edit-comment", map[string]string{"comment_id": fmt.Sprint(top.CommentID), "comment": "back"}, nil, nil)
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+
+		// Once the last reply goes, so do the tombstones above it.
+		for _, c := range []struct {
+			client *testClient
+			id     int
+		}{{cat, reply.CommentID}, {bob, deep.CommentID}} {
+			res, body = c.client.postJSON("/delete-comment", models.Comment{CommentID: c.id})
+			expectStatus(t, res, body, http.StatusOK)
+		}
+		res, body = ann.get("/comments?postId=" + postID)
+		expectStatus(t, res, body, http.StatusOK)
+		var remaining []models.Comment
+		decode(t, body, &remaining)
+		if len(remaining) != 0 {
+			t.Fatalf("comments left are %+v", remaining)
+		}
+	})
+}
+
+func react(t *testing.T, c *testClient, reaction models.Reaction) models.Reactions {
+	t.Helper()
+
+	res, body := c.postJSON("/react", reaction)
+	expectStatus(t, res, body, http.StatusOK)
+	var reactions models.Reactions
+	decode(t, body, &reactions)
+	return reactions
+}
+
+func TestReactions(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, _ := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		cat, _ := signUp(t, srv, "Cat")
+
+		res, body := ann.postForm("/create-post", map[string]string{"content": "public", "privacy": "public"})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+		if post.Reactions.Counts == nil || len(post.Reactions.Counts) != 0 {
+			t.Fatalf("new post has reactions %+v", post.Reactions)
+		}
+		res, body = cat.postForm("/create-post", map[string]string{"content": "followers only", "privacy": "private"})
+		expectStatus(t, res, body, http.StatusOK)
+		var hidden models.Post
+		decode(t, body, &hidden)
+		res, body = bob.postForm("/create-comment", map[string]string{"post_id": fmt.Sprint(post.PostID), "comment": "nice"})
+		expectStatus(t, res, body, http.StatusOK)
+		var comment models.Comment
+		decode(t, body, &comment)
+
+		target := models.Target{PostID: post.PostID}
+		got := react(t, bob, models.Reaction{Target: target, Emoji: "👍"})
+		if got.Counts["👍"] != 1 || got.Mine != "👍" {
+			t.Fatalf("after Bob's reaction the post has %+v", got)
+		}
+		react(t, cat, models.Reaction{Target: target, Emoji: "❤️"})
+		// A second reaction replaces the first.
+		got = react(t, bob, models.Reaction{Target: target, Emoji: "😂"})
+		if len(got.Counts) != 2 || got.Counts["❤️"] != 1 || got.Counts["😂"] != 1 || got.Mine != "😂" {
+			t.Fatalf("after Bob changed his reaction the post has %+v", got)
+		}
+		react(t, ann, models.Reaction{Target: models.Target{CommentID: comment.CommentID}, Emoji: "👍"})
+
+		res, body = bob.postJSON("/react", models.Reaction{Target: target, Emoji: "🦄"})
+		expectError(t, res, body, http.StatusUnprocessableEntity, CodeValidationFailed)
+		res, body = bob.postJSON("/react", models.Reaction{Target: models.Target{PostID: post.PostID, CommentID: comment.CommentID}, Emoji: "👍"})
+		expectError(t, res, body, http.StatusUnprocessableEntity, CodeValidationFailed)
+		res, body = bob.postJSON("/react", models.Reaction{Target: models.Target{PostID: hidden.PostID}, Emoji: "👍"})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		res, body = bob.get(fmt.Sprintf("/reactions?postId=%d", hidden.PostID))
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		res, body = bob.get(fmt.Sprintf("/reactions?postId=%d&commentId=%d", post.PostID, comment.CommentID))
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+
+		res, body = bob.get("/all-posts")
+		expectStatus(t, res, body, http.StatusOK)
+		var feed []models.Post
+		decode(t, body, &feed)
+		if len(feed) != 1 || feed[0].Reactions.Mine != "😂" || feed[0].Reactions.Counts["❤️"] != 1 ||
+			len(feed[0].Comments) != 1 || feed[0].Comments[0].Reactions.Counts["👍"] != 1 || feed[0].Comments[0].Reactions.Mine != "" {
+			t.Fatalf("Bob's feed is %+v", feed)
+		}
+
+		res, body = ann.get(fmt.Sprintf("/reactions?postId=%d&limit=1", post.PostID))
+		expectStatus(t, res, body, http.StatusOK)
+		var reactors []models.Reaction
+		decode(t, body, &reactors)
+		if len(reactors) != 1 || reactors[0].UserID != bobID || reactors[0].Emoji != "😂" || reactors[0].FirstName != "Bob" {
+			t.Fatalf("newest reaction is %+v, want Bob's", reactors)
+		}
+
+		got = react(t, bob, models.Reaction{Target: target})
+		if len(got.Counts) != 1 || got.Counts["❤️"] != 1 || got.Mine != "" {
+			t.Fatalf("after Bob removed his reaction the post has %+v", got)
+		}
+
+		res, body = ann.postJSON("/message", models.Message{Message: "hi", UserIDTo: bobID})
+		expectStatus(t, res, body, http.StatusCreated)
+		var message models.Message
+		decode(t, body, &message)
+		res, body = cat.postJSON("/react", models.Reaction{Target: models.Target{MessageID: message.MessageID}, Emoji: "👍"})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		react(t, bob, models.Reaction{Target: models.Target{MessageID: message.MessageID}, Emoji: "👍"})
+
+		res, body = ann.get(fmt.Sprintf("/conversation-history/?userId=%d", bobID))
+		expectStatus(t, res, body, http.StatusOK)
+		var history []models.Message
+		decode(t, body, &history)
+		if len(history) != 1 || history[0].Reactions == nil || history[0].Reactions.Counts["👍"] != 1 || history[0].Reactions.Mine != "" {
+			t.Fatalf("conversation is %+v", history)
+		}
+	})
+}
+
+// TestReactionPush runs against one SQLite-backed server only, like
+// TestWebsocketChat.
+func TestWhoCanReact(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		ann, annID := signUp(t, srv, "Ann")
+		bob, bobID := signUp(t, srv, "Bob")
+		_, catID := signUp(t, srv, "Cat")
+
+		res, body := ann.postJSON("/profile-type", nil)
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = bob.postJSON("/follow", models.FollowRequest{FollowingID: annID})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = ann.postJSON("/accept-follower", models.FollowRequest{FollowerID: bobID})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = ann.postForm("/create-post", map[string]string{"content": "followers only", "privacy": "private"})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+
+		viewers, err := app.database.WhoCanReact([]int{catID, bobID, 999, annID}, models.Target{PostID: post.PostID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Ints(viewers)
+		if want := []int{annID, bobID}; fmt.Sprint(viewers) != fmt.Sprint(want) {
+			t.Errorf("viewers = %v, want %v", viewers, want)
+		}
+	})
+}
+
+func TestReactionPush(t *testing.T) {
+	store := newSqliteStore(t)
+	t.Cleanup(func() { store.Close() })
+	srv := httptest.NewServer(newTestApp(t, store).routes())
+	t.Cleanup(srv.Close)
+
+	ann, _ := signUp(t, srv, "Ann")
+	bob, bobID := signUp(t, srv, "Bob")
+	annConn := dialChat(t, ann, "/ws")
+	bobConn := dialChat(t, bob, "/ws")
+
+	// Another Ann connects after her; connections are told apart by user.
+	namesake := newTestClient(t, srv)
+	res, body := namesake.postForm("/register", registerForm("ann2@example.com", "Ann"))
+	expectStatus(t, res, body, http.StatusOK)
+	res, body = namesake.postJSON("/login", map[string]string{"email": "ann2@example.com", "password": "secret1"})
+	expectStatus(t, res, body, http.StatusOK)
+	namesakeConn := dialChat(t, namesake, "/ws")
+
+	post := func(privacy string) int {
+		t.Helper()
+		res, body := ann.postForm("/create-post", map[string]string{"content": privacy, "privacy": privacy})
+		expectStatus(t, res, body, http.StatusOK)
+		var created models.Post
+		decode(t, body, &created)
+		return created.PostID
+	}
+	read := func(conn *websocket.Conn) models.ReactionUpdate {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var update models.ReactionUpdate
+		if err := conn.ReadJSON(&update); err != nil {
+			t.Fatal(err)
+		}
+		return update
+	}
+
+	// Bob does not follow Ann, so only she hears about her private post.
+	private := post("private")
+	react(t, ann, models.Reaction{Target: models.Target{PostID: private}, Emoji: "👍"})
+	if got := read(annConn); got.Type != "reactions" || got.PostID != private || got.Counts["👍"] != 1 {
+		t.Fatalf("Ann got %+v", got)
+	}
+
+	public := post("public")
+	react(t, ann, models.Reaction{Target: models.Target{PostID: public}, Emoji: "😮"})
+	for name, conn := range map[string]*websocket.Conn{"Ann": annConn, "Bob": bobConn, "the other Ann": namesakeConn} {
+		if got := read(conn); got.PostID != public || got.Counts["😮"] != 1 {
+			t.Fatalf("%s got %+v, want the counts of the public post", name, got)
+		}
+	}
+
+	// Reactions to group messages reach the group chat of current members
+	// only: Bob leaves with his room still open.
+	res, body = ann.postJSON("/create-group", models.Group{Title: "Hikers", Description: "Weekend hikes"})
+	expectStatus(t, res, body, http.StatusOK)
+	var group models.Group
+	decode(t, body, &group)
+	res, body = bob.postJSON("/request-to-join-group", models.GroupMembers{GroupID: group.GroupID})
+	expectStatus(t, res, body, http.StatusOK)
+	res, body = ann.postJSON("/accept-group-request", models.GroupMembers{GroupID: group.GroupID, MemberID: bobID})
+	expectStatus(t, res, body, http.StatusOK)
+	room := fmt.Sprintf("/chatroom/?groupId=%d", group.GroupID)
+	annRoom := dialChat(t, ann, room)
+	bobRoom := dialChat(t, bob, room)
+	res, body = bob.postJSON("/request-to-join-group", models.GroupMembers{GroupID: group.GroupID})
+	expectStatus(t, res, body, http.StatusOK)
+
+	res, body = ann.postJSON("/message", models.Message{Message: "members only", GroupID: group.GroupID})
+	expectStatus(t, res, body, http.StatusCreated)
+	var message models.Message
+	decode(t, body, &message)
+	react(t, ann, models.Reaction{Target: models.Target{MessageID: message.MessageID}, Emoji: "👍"})
+	if got := read(annRoom); got.MessageID != message.MessageID || got.Counts["👍"] != 1 {
+		t.Fatalf("Ann got %+v, want the counts of the group message", got)
+	}
+	for name, conn := range map[string]*websocket.Conn{"Bob's room": bobRoom, "the other Ann": namesakeConn} {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if _, data, err := conn.ReadMessage(); err == nil {
+			t.Fatalf("%s received %s", name, data)
+		}
+	}
+}
+
+func mentions(t *testing.T, c *testClient) []models.Mention {
+	t.Helper()
+	res, body := c.get("/mentions")
+	expectStatus(t, res, body, http.StatusOK)
+	var list []models.Mention
+	decode(t, body, &list)
+	return list
+}
+
+func TestMentions(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann, annID := signUp(t, srv, "Ann")
+		cat, catID := signUp(t, srv, "Cat")
+
+		bob := newTestClient(t, srv)
+		form := registerForm("bob@example.com", "Bob")
+		form["nickname"] = "Bobby"
+		res, body := bob.postForm("/register", form)
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = bob.postJSON("/login", map[string]string{"email": "bob@example.com", "password": "secret1"})
+		expectStatus(t, res, body, http.StatusOK)
+
+		content := fmt.Sprintf("hi @bobby, @[user:%d], @ann and @nobody; mail bob@bobby", catID)
+		res, body = ann.postForm("/create-post", map[string]string{"content": content, "privacy": "public"})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+		if len(post.Mentions) != 2 || post.Mentions[0].Nickname != "Bobby" || post.Mentions[0].Offset != 3 || post.Mentions[0].Length != 6 ||
+			post.Mentions[1].UserID != catID || post.Mentions[1].FirstName != "Cat" {
+			t.Fatalf("post mentions %+v", post.Mentions)
+		}
+		bobID := post.Mentions[0].UserID
+
+		// Bob does not follow Ann, so he is not told about her private post.
+		res, body = ann.postForm("/create-post", map[string]string{"content": "@Bobby secret", "privacy": "private"})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = cat.postForm("/create-comment", map[string]string{"post_id": fmt.Sprint(post.PostID), "comment": "@BOBBY look"})
+		expectStatus(t, res, body, http.StatusOK)
+		var comment models.Comment
+		decode(t, body, &comment)
+		if len(comment.Mentions) != 1 || comment.Mentions[0].UserID != bobID {
+			t.Fatalf("comment mentions %+v", comment.Mentions)
+		}
+		res, body = ann.postForm("/create-post", map[string]string{"content": fmt.Sprintf("me, @[user:%d]", annID), "privacy": "public"})
+		expectStatus(t, res, body, http.StatusOK)
+
+		got := mentions(t, bob)
+		if len(got) != 2 || got[0].CommentID != comment.CommentID || got[0].AuthorFirstName != "Cat" ||
+			got[1].PostID != post.PostID || got[1].AuthorID != annID || got[1].Seen {
+			t.Fatalf("Bob's mentions are %+v", got)
+		}
+		if got := mentions(t, ann); len(got) != 0 {
+			t.Fatalf("Ann's own mention is listed: %+v", got)
+		}
+
+		res, body = bob.get("/all-posts")
+		expectStatus(t, res, body, http.StatusOK)
+		var feed []models.Post
+		decode(t, body, &feed)
+		for _, p := range feed {
+			if p.PostID == post.PostID && (len(p.Mentions) != 2 || len(p.Comments) != 1 || len(p.Comments[0].Mentions) != 1) {
+				t.Fatalf("post in Bob's feed is %+v", p)
+			}
+		}
+
+		res, body = cat.postJSON("/mention-seen", models.Mention{MentionID: got[0].MentionID})
+		expectError(t, res, body, http.StatusNotFound, CodeNotFound)
+		res, body = bob.postJSON("/mention-seen", models.Mention{MentionID: got[0].MentionID})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := mentions(t, bob); !got[0].Seen || got[1].Seen {
+			t.Fatalf("after marking the newest seen Bob's mentions are %+v", got)
+		}
+
+		res, body = ann.postForm("/edit-post", map[string]string{"post_id": fmt.Sprint(post.PostID), "content": "hi @Cat", "privacy": "public"})
+		expectStatus(t, res, body, http.StatusOK)
+		decode(t, body, &post)
+		if len(post.Mentions) != 0 {
+			t.Fatalf("edited post mentions %+v, want none as Cat has no nickname", post.Mentions)
+		}
+		if got := mentions(t, bob); len(got) != 1 || got[0].CommentID != comment.CommentID {
+			t.Fatalf("after the edit Bob's mentions are %+v", got)
+		}
+
+		res, body = ann.postJSON("/message", models.Message{Message: "see @bobby", UserIDTo: bobID})
+		expectStatus(t, res, body, http.StatusCreated)
+		var message models.Message
+		decode(t, body, &message)
+		if len(message.Mentions) != 1 || message.Mentions[0].Offset != 4 {
+			t.Fatalf("message mentions %+v", message.Mentions)
+		}
+		if got := mentions(t, bob); len(got) != 2 || got[0].MessageID != message.MessageID {
+			t.Fatalf("Bob's mentions are %+v, want the message first", got)
+		}
+		if got := mentions(t, cat); len(got) != 0 {
+			t.Fatalf("Cat's mentions are %+v after the post was edited", got)
+		}
+	})
+}
+
+// TestMentionsStoredAtomically makes storing a mention fail, on a user that
+// does not exist, and checks the post or comment is not stored either.
+func TestMentionsStoredAtomically(t *testing.T) {
+	store := newSqliteStore(t)
+	t.Cleanup(func() { store.Close() })
+	srv := httptest.NewServer(newTestApp(t, store).routes())
+	t.Cleanup(srv.Close)
+
+	ann, annID := signUp(t, srv, "Ann")
+	missing := []models.Mention{{UserID: 999, Length: 4}}
+	tags := []models.Hashtag{{Tag: "lost", Offset: 5, Length: 5}}
+
+	err := store.CreatePost(&models.Post{UserID: annID, Content: "@bob #lost", Privacy: "public", Mentions: missing, Hashtags: tags})
+	if err == nil {
+		t.Fatal("post with a mention of a missing user was stored")
+	}
+	posts, _, err := store.ProfilePosts(annID, database.Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 0 {
+		t.Fatalf("posts after the failed write: %+v", posts)
+	}
+
+	res, body := ann.postForm("/create-post", map[string]string{"content": "hello", "privacy": "public"})
+	expectStatus(t, res, body, http.StatusOK)
+	var post models.Post
+	decode(t, body, &post)
+	err = store.CreateComment(&models.Comment{PostID: post.PostID, UserID: annID, Comment: "@bob #lost", Mentions: missing, Hashtags: tags})
+	if err == nil {
+		t.Fatal("comment with a mention of a missing user was stored")
+	}
+	comments, err := store.CommentsForPosts([]int{post.PostID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments[post.PostID]) != 0 {
+		t.Fatalf("comments after the failed write: %+v", comments[post.PostID])
+	}
+	if got := trending(t, ann); got != "" {
+		t.Fatalf("trending tags after the failed writes: %s", got)
+	}
+}
+
+func TestMentionPush(t *testing.T) {
+	store := newSqliteStore(t)
+	t.Cleanup(func() { store.Close() })
+	srv := httptest.NewServer(newTestApp(t, store).routes())
+	t.Cleanup(srv.Close)
+
+	ann, annID := signUp(t, srv, "Ann")
+	bob, bobID := signUp(t, srv, "Bob")
+	bobConn := dialChat(t, bob, "/ws")
+
+	res, body := ann.postForm("/create-post", map[string]string{"content": fmt.Sprintf("hi @[user:%d]", bobID), "privacy": "public"})
+	expectStatus(t, res, body, http.StatusOK)
+	var post models.Post
+	decode(t, body, &post)
+
+	bobConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var update models.MentionUpdate
+	if err := bobConn.ReadJSON(&update); err != nil {
+		t.Fatal(err)
+	}
+	if update.Type != "mention" || update.PostID != post.PostID || update.UserID != bobID || update.AuthorID != annID || update.Offset != 3 {
+		t.Fatalf("Bob got %+v", update)
+	}
+
+	// A second Bob hears about his own mentions only.
+	namesake := newTestClient(t, srv)
+	res, body = namesake.postForm("/register", registerForm("bob2@example.com", "Bob"))
+	expectStatus(t, res, body, http.StatusOK)
+	res, body = namesake.postJSON("/login", map[string]string{"email": "bob2@example.com", "password": "secret1"})
+	expectStatus(t, res, body, http.StatusOK)
+	res, body = namesake.get("/search?query=Bob")
+	expectStatus(t, res, body, http.StatusOK)
+	var users []models.UserData
+	decode(t, body, &users)
+	var namesakeID int
+	for _, u := range users {
+		if u.UserID != bobID {
+			namesakeID = u.UserID
+		}
+	}
+	namesakeConn := dialChat(t, namesake, "/ws")
+
+	res, body = ann.postForm("/create-post", map[string]string{"content": fmt.Sprintf("hey @[user:%d]", namesakeID), "privacy": "public"})
+	expectStatus(t, res, body, http.StatusOK)
+	decode(t, body, &post)
+
+	namesakeConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := namesakeConn.ReadJSON(&update); err != nil {
+		t.Fatal(err)
+	}
+	if update.PostID != post.PostID || update.UserID != namesakeID {
+		t.Fatalf("the second Bob got %+v", update)
+	}
+	bobConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := bobConn.ReadMessage(); err == nil {
+		t.Fatalf("Bob received %s", data)
+	}
+}
+
+func trending(t *testing.T, c *testClient) string {
+	t.Helper()
+	res, body := c.get("/trending-hashtags")
+	expectStatus(t, res, body, http.StatusOK)
+	var tags []models.TrendingTag
+	decode(t, body, &tags)
+	var got []string
+	for _, tag := range tags {
+		got = append(got, fmt.Sprintf("%s:%d/%d", tag.Tag, tag.Uses, tag.Users))
+	}
+	return strings.Join(got, " ")
+}
+
+func feedContents(t *testing.T, c *testClient, path string) []models.Post {
+	t.Helper()
+	res, body := c.get(path)
+	expectStatus(t, res, body, http.StatusOK)
+	var posts []models.Post
+	decode(t, body, &posts)
+	return posts
+}
+
+func TestHashtags(t *testing.T) {
+	runWithApps(t, func(t *testing.T, app *application, srv *httptest.Server) {
+		ann, _ := signUp(t, srv, "Ann")
+		bob, _ := signUp(t, srv, "Bob")
+		cat, _ := signUp(t, srv, "Cat")
+
+		res, body := ann.postForm("/create-post", map[string]string{"content": "#Go is fun, #go #rust", "privacy": "public"})
+		expectStatus(t, res, body, http.StatusOK)
+		var post models.Post
+		decode(t, body, &post)
+		if len(post.Hashtags) != 3 || post.Hashtags[0] != (models.Hashtag{Tag: "go", Offset: 0, Length: 3}) || post.Hashtags[2].Tag != "rust" {
+			t.Fatalf("post hashtags %+v", post.Hashtags)
+		}
+		res, body = cat.postForm("/create-post", map[string]string{"content": "#go secret", "privacy": "private"})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = bob.postForm("/create-comment", map[string]string{"post_id": fmt.Sprint(post.PostID), "comment": "#rust too"})
+		expectStatus(t, res, body, http.StatusOK)
+
+		if got := feedContents(t, bob, "/hashtag?tag=%23GO"); len(got) != 1 || got[0].PostID != post.PostID {
+			t.Fatalf("Bob's #go page is %+v", got)
+		}
+		if got := feedContents(t, bob, "/hashtag?tag=rust"); len(got) != 1 || len(got[0].Comments) != 1 || got[0].Comments[0].Hashtags[0].Tag != "rust" {
+			t.Fatalf("Bob's #rust page is %+v", got)
+		}
+		if got := feedContents(t, cat, "/hashtag?tag=go"); len(got) != 2 {
+			t.Fatalf("Cat's #go page has %d posts, want hers too", len(got))
+		}
+		res, body = bob.get("/hashtag?tag=123")
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+
+		// Posts count once per tag however often they use it, and Cat's
+		// private post only for Cat.
+		if got := trending(t, bob); got != "rust:2/2 go:1/1" {
+			t.Fatalf("Bob's trending tags are %q", got)
+		}
+		if got := trending(t, cat); got != "go:2/2 rust:2/2" {
+			t.Fatalf("Cat's trending tags are %q", got)
+		}
+		// Editing keeps when a tag was first used, so it does not count again.
+		res, body = ann.postForm("/edit-post", map[string]string{"post_id": fmt.Sprint(post.PostID), "content": "#rust only", "privacy": "public"})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := trending(t, bob); got != "rust:2/2" {
+			t.Fatalf("after the edit Bob's trending tags are %q", got)
+		}
+		app.config.trending = -time.Minute
+		if got := trending(t, bob); got != "" {
+			t.Fatalf("trending tags from the future are %q", got)
+		}
+
+		res, body = ann.postJSON("/create-group", models.Group{Title: "Club", Description: "Members only"})
+		expectStatus(t, res, body, http.StatusOK)
+		var group models.Group
+		decode(t, body, &group)
+		res, body = ann.postForm("/create-post", map[string]string{"content": "#rust in the club", "privacy": "public", "group_id": fmt.Sprint(group.GroupID)})
+		expectStatus(t, res, body, http.StatusOK)
+		var groupPost models.Post
+		decode(t, body, &groupPost)
+
+		for _, c := range []*testClient{ann, bob} {
+			res, body = c.postJSON("/follow-hashtag", models.HashtagFollow{Tag: "#Rust", Following: true})
+			expectStatus(t, res, body, http.StatusOK)
+		}
+		res, body = ann.postJSON("/follow-hashtag", models.HashtagFollow{Tag: "no-tag", Following: true})
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+		res, body = ann.get("/followed-hashtags")
+		expectStatus(t, res, body, http.StatusOK)
+		if strings.TrimSpace(string(body)) != `["rust"]` {
+			t.Fatalf("Ann follows %s", body)
+		}
+
+		// The group post joins Ann's feed, but not Bob's as he is not in the
+		// group.
+		feed := feedContents(t, ann, "/all-posts")
+		if len(feed) != 2 || feed[0].PostID != groupPost.PostID || len(feed[0].FollowedTags) != 1 || feed[0].FollowedTags[0] != "rust" {
+			t.Fatalf("Ann's feed is %+v", feed)
+		}
+		if got := feedContents(t, bob, "/all-posts"); len(got) != 1 || got[0].PostID != post.PostID {
+			t.Fatalf("Bob's feed is %+v", got)
+		}
+
+		res, body = ann.postJSON("/follow-hashtag", models.HashtagFollow{Tag: "rust"})
+		expectStatus(t, res, body, http.StatusOK)
+		if got := feedContents(t, ann, "/all-posts"); len(got) != 1 || got[0].FollowedTags != nil {
+			t.Fatalf("after unfollowing Ann's feed is %+v", got)
+		}
+	})
+}
+
+// search returns the results of a search as "type:id" in their order.
+func search(t *testing.T, c *testClient, path string) ([]models.SearchResult, string) {
+	t.Helper()
+	res, body := c.get(path)
+	expectStatus(t, res, body, http.StatusOK)
+	var results []models.SearchResult
+	decode(t, body, &results)
+	var got []string
+	for _, result := range results {
+		got = append(got, fmt.Sprintf("%s:%d", result.Type, result.ID))
+	}
+	return results, strings.Join(got, " ")
+}
+
+func TestSearch(t *testing.T) {
+	runWithStores(t, func(t *testing.T, srv *httptest.Server) {
+		ann := newTestClient(t, srv)
+		form := registerForm("ann@example.com", "Ann")
+		form["nickname"] = "Annie"
+		form["about_me"] = "Kayaking every weekend"
+		res, body := ann.postForm("/register", form)
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = ann.postJSON("/login", map[string]string{"email": "ann@example.com", "password": "secret1"})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = ann.postJSON("/profile-type", nil)
+		expectStatus(t, res, body, http.StatusOK)
+		bob, bobID := signUp(t, srv, "Bob")
+		cat, _ := signUp(t, srv, "Cat")
+
+		results, _ := search(t, cat, "/search?query=annie")
+		if len(results) != 1 || results[0].Type != models.SearchUser || results[0].FirstName != "Ann" {
+			t.Fatalf("search for Ann's nickname found %+v", results)
+		}
+		annID := results[0].UserID
+
+		post := func(c *testClient, fields map[string]string) int {
+			res, body := c.postForm("/create-post", fields)
+			expectStatus(t, res, body, http.StatusOK)
+			var post models.Post
+			decode(t, body, &post)
+			return post.PostID
+		}
+		public := post(ann, map[string]string{"content": "Kayaking on the lake", "privacy": "public"})
+		private := post(ann, map[string]string{"content": "Secret kayak trip", "privacy": "private"})
+		res, body = bob.postForm("/create-comment", map[string]string{"post_id": fmt.Sprint(public), "comment": "Kayaks are great"})
+		expectStatus(t, res, body, http.StatusOK)
+		var comment models.Comment
+		decode(t, body, &comment)
+
+		res, body = ann.postJSON("/create-group", models.Group{Title: "Paddlers", Description: "Kayak club"})
+		expectStatus(t, res, body, http.StatusOK)
+		var group models.Group
+		decode(t, body, &group)
+		inGroup := post(ann, map[string]string{"content": "Kayak meetup", "privacy": "public", "group_id": fmt.Sprint(group.GroupID)})
+		res, body = ann.postJSON("/create-event", models.Event{
+			Title:       "Race",
+			Description: "Bring your kayak",
+			Time:        time.Now().AddDate(0, 0, 7).Format(validator.DateLayout),
+			GroupID:     group.GroupID,
+		})
+		expectStatus(t, res, body, http.StatusOK)
+		var event models.Event
+		decode(t, body, &event)
+
+		// Cat sees neither Ann's private post, the group's post and event nor
+		// the about me of her private profile.
+		results, got := search(t, cat, "/search?query=KAYAK")
+		want := map[string]bool{
+			fmt.Sprintf("post:%d", public):               true,
+			fmt.Sprintf("comment:%d", comment.CommentID): true,
+			fmt.Sprintf("group:%d", group.GroupID):       true,
+		}
+		if len(results) != len(want) {
+			t.Fatalf("Cat's search found %s", got)
+		}
+		for _, result := range results {
+			if !want[fmt.Sprintf("%s:%d", result.Type, result.ID)] {
+				t.Fatalf("Cat's search found %s", got)
+			}
+			if result.Type == models.SearchComment {
+				if result.Snippet != "Kayaks are great" || len(result.Highlights) != 1 || result.Highlights[0] != (models.Highlight{Offset: 0, Length: 6}) || result.PostID != public {
+					t.Fatalf("comment result %+v", result)
+				}
+			}
+		}
+		if _, got := search(t, ann, "/search?query=kayak&type=user,post,event"); len(strings.Fields(got)) != 5 || !strings.Contains(got, fmt.Sprintf("post:%d", private)) {
+			t.Fatalf("Ann's search found %s", got)
+		}
+		if _, got := search(t, cat, "/search?query=kayaking+lake"); got != fmt.Sprintf("post:%d", public) {
+			t.Fatalf("search for both words found %s", got)
+		}
+
+		// Filters leave out the types they do not apply to.
+		if _, got := search(t, cat, fmt.Sprintf("/search?query=kayak&author=%d", bobID)); got != fmt.Sprintf("comment:%d", comment.CommentID) {
+			t.Fatalf("search by Bob found %s", got)
+		}
+		if _, got := search(t, ann, fmt.Sprintf("/search?query=kayak&author=%d&type=post", annID)); len(strings.Fields(got)) != 3 {
+			t.Fatalf("Ann's posts found %s", got)
+		}
+		_, got = search(t, ann, fmt.Sprintf("/search?query=kayak&group=%d", group.GroupID))
+		if len(strings.Fields(got)) != 2 || !strings.Contains(got, fmt.Sprintf("post:%d", inGroup)) || !strings.Contains(got, fmt.Sprintf("event:%d", event.EventID)) {
+			t.Fatalf("search in the group found %s", got)
+		}
+		day := func(days int) string { return time.Now().AddDate(0, 0, days).Format("2006-01-02") }
+		if _, got := search(t, cat, "/search?query=kayak&from="+day(-1)+"&to="+day(1)); len(strings.Fields(got)) != 2 {
+			t.Fatalf("search within the dates found %s", got)
+		}
+		if _, got := search(t, cat, "/search?query=kayak&from="+day(2)); got != "" {
+			t.Fatalf("search from the future found %s", got)
+		}
+
+		// Pages of one result follow the ranked order both ways.
+		_, all := search(t, cat, "/search?query=kayak")
+		link := func(res *http.Response, rel string) string {
+			for _, l := range strings.Split(res.Header.Get("Link"), ", ") {
+				if strings.HasSuffix(l, `>; rel="`+rel+`"`) {
+					return l[1:strings.Index(l, ">")]
+				}
+			}
+			return ""
+		}
+		var pages []string
+		var last *http.Response
+		for path := "/search?query=kayak&limit=1"; path != ""; path = link(last, "next") {
+			res, body := cat.get(path)
+			expectStatus(t, res, body, http.StatusOK)
+			_, got := search(t, cat, path)
+			pages, last = append(pages, got), res
+		}
+		if got := strings.Join(pages, " "); got != all || len(pages) < 3 {
+			t.Fatalf("pages %q, want each of %q", pages, all)
+		}
+		var back []string
+		for path := link(last, "prev"); path != ""; path = link(last, "prev") {
+			res, body := cat.get(path)
+			expectStatus(t, res, body, http.StatusOK)
+			_, got := search(t, cat, path)
+			back, last = append([]string{got}, back...), res
+		}
+		if got := strings.Join(back, " "); got != strings.Join(pages[:len(pages)-1], " ") {
+			t.Fatalf("pages back %q, want %q", back, pages[:len(pages)-1])
+		}
+		res, body = cat.get("/search?query=kayak&cursor=" + encodeCursor(1, false))
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+		res, body = cat.get("/search?query=kayak&type=message")
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+		res, body = cat.get("/search?query=kayak&from=yesterday")
+		expectError(t, res, body, http.StatusBadRequest, CodeInvalidParameter)
+		if _, got := search(t, cat, "/search?query=%22*%3A()"); got != "" {
+			t.Fatalf("search without words found %s", got)
+		}
+
+		// Edits and deletions reach the index.
+		res, body = ann.postForm("/edit-post", map[string]string{"post_id": fmt.Sprint(public), "content": "Canoeing now", "privacy": "public"})
+		expectStatus(t, res, body, http.StatusOK)
+		res, body = bob.postJSON("/delete-comment", models.Comment{CommentID: comment.CommentID})
+		expectStatus(t, res, body, http.StatusOK)
+		if _, got := search(t, cat, "/search?query=kayak&type=post,comment"); got != "" {
+			t.Fatalf("after the edit Cat's search found %s", got)
+		}
+		if _, got := search(t, cat, "/search?query=canoe"); got != fmt.Sprintf("post:%d", public) {
+			t.Fatalf("search for the new content found %s", got)
+		}
+	})
+}
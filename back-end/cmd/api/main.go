@@ -1,32 +1,140 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
-	"social-network/database/sqlite"
-
+	"os"
+	"social-network/database"
+	"social-network/media"
+	"time"
 )
 
 const port = 8080
 
+// defaultCommentDepth is how deep replies to comments can be nested unless
+// -comment-max-depth says otherwise.
+const defaultCommentDepth = 3
+
+// defaultReactions are the emoji users can react with unless -reactions
+// says otherwise.
+const defaultReactions = "👍,❤️,😂,😮,😢,😡"
+
+type config struct {
+	db    string
+	dsn   string
+	media struct {
+		backend  string
+		dir      string
+		s3       media.S3Config
+		redirect bool
+		secret   string
+		limits   media.AttachmentLimits
+		quota    int64
+		gc       struct {
+			interval time.Duration
+			grace    time.Duration
+		}
+	}
+	admins       map[string]bool
+	moderators   map[string]bool
+	commentDepth int
+	reactions    []string
+	trending     time.Duration
+	backup       struct {
+		dir       string
+		interval  time.Duration
+		keepLast  int
+		keepDaily int
+	}
+}
+
 type application struct {
-	database sqlite.SqliteDB
+	config   config
+	database database.Store
+	media    media.Store
 }
 
 func main() {
 	var app application
+	flag.StringVar(&app.config.db, "db", "sqlite", "Database backend (sqlite|postgres)")
+	flag.StringVar(&app.config.dsn, "dsn", os.Getenv("DATABASE_URL"), "Postgres connection string")
+	flag.StringVar(&dbPath, "sqlite-file", dbPath, "SQLite database file")
+	flag.StringVar(&app.config.media.backend, "media", "local", "Storage for uploaded images (local|s3)")
+	flag.StringVar(&app.config.media.dir, "media-dir", "./database/images", "Folder for uploaded images with -media local")
+	flag.StringVar(&app.config.media.s3.Endpoint, "s3-endpoint", os.Getenv("S3_ENDPOINT"), "S3 host and port, without a scheme")
+	flag.StringVar(&app.config.media.s3.Bucket, "s3-bucket", os.Getenv("S3_BUCKET"), "S3 bucket for uploaded images")
+	flag.StringVar(&app.config.media.s3.Region, "s3-region", os.Getenv("S3_REGION"), "S3 region")
+	flag.StringVar(&app.config.media.s3.AccessKey, "s3-access-key", os.Getenv("S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&app.config.media.s3.SecretKey, "s3-secret-key", os.Getenv("S3_SECRET_KEY"), "S3 secret key")
+	flag.BoolVar(&app.config.media.s3.UseSSL, "s3-ssl", true, "Connect to S3 over HTTPS")
+	flag.BoolVar(&app.config.media.redirect, "s3-redirect", false, "Redirect image requests to signed S3 URLs instead of streaming them")
+	flag.Int64Var(&app.config.media.limits.Image.MaxBytes, "image-max-bytes", media.DefaultImageLimits.MaxBytes, "Largest image upload in bytes")
+	flag.IntVar(&app.config.media.limits.Image.MaxPixels, "image-max-pixels", media.DefaultImageLimits.MaxPixels, "Largest image upload in pixels, width times height")
+	flag.Int64Var(&app.config.media.limits.MaxVideoBytes, "video-max-bytes", media.DefaultAttachmentLimits.MaxVideoBytes, "Largest video attachment in bytes")
+	flag.DurationVar(&app.config.media.limits.MaxVideoLength, "video-max-length", media.DefaultAttachmentLimits.MaxVideoLength, "Longest video attachment")
+	flag.Int64Var(&app.config.media.limits.MaxDocumentBytes, "document-max-bytes", media.DefaultAttachmentLimits.MaxDocumentBytes, "Largest PDF attachment in bytes")
+	flag.StringVar(&app.config.media.secret, "image-secret", os.Getenv("IMAGE_URL_SECRET"), "Key for signing image links, shared by every instance")
+	flag.Int64Var(&app.config.media.quota, "media-quota", 0, "Storage each user may take up in bytes, 0 for no limit")
+	flag.DurationVar(&app.config.media.gc.interval, "media-gc-interval", time.Hour, "Time between collections of unused media files, 0 disables them")
+	flag.DurationVar(&app.config.media.gc.grace, "media-gc-grace", 24*time.Hour, "How long unused media files are kept before they are collected")
+	admins := flag.String("admins", os.Getenv("ADMIN_EMAILS"), "Comma-separated emails of the users who may manage media quotas")
+	flag.IntVar(&app.config.commentDepth, "comment-max-depth", defaultCommentDepth, "How deep replies to comments can be nested, 0 for no replies")
+	moderators := flag.String("moderators", os.Getenv("MODERATOR_EMAILS"), "Comma-separated emails of the users who may see earlier versions of posts")
+	reactions := flag.String("reactions", defaultReactions, "Comma-separated emoji users can react to posts, comments and messages with")
+	flag.DurationVar(&app.config.trending, "trending-window", 24*time.Hour, "How far back hashtags count towards trending ones")
+	flag.StringVar(&app.config.backup.dir, "backup-dir", "./backups", "Directory for SQLite backups")
+	flag.DurationVar(&app.config.backup.interval, "backup-interval", 0, "Time between SQLite backups, 0 disables them")
+	flag.IntVar(&app.config.backup.keepLast, "backup-keep-last", 24, "Number of most recent backups to keep")
+	flag.IntVar(&app.config.backup.keepDaily, "backup-keep-daily", 7, "Number of days to keep the last backup of")
+	flag.Parse()
+	app.config.admins = parseAdmins(*admins)
+	app.config.moderators = parseAdmins(*moderators)
+	app.config.reactions = parseReactions(*reactions)
+
+	if app.config.backup.interval > 0 && app.config.db != "sqlite" {
+		log.Fatal("-backup-interval only works with the sqlite backend, back up Postgres with its own tools")
+	}
+
 	err := app.applyMigrations()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	conn, err := app.connectToDB()
+	store, err := app.connectToDB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	app.database = store
+	defer app.database.Close()
+
+	app.media, err = app.connectToMedia()
+	if err != nil {
+		log.Fatal(err)
+	}
+	moved, err := app.migrateAvatars(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
-	app.database = sqlite.SqliteDB{DB: conn}
-	defer app.database.Connection().Close()
+	if moved > 0 {
+		log.Printf("Gave %d avatars a random name", moved)
+	}
+	if app.config.media.secret == "" {
+		app.config.media.secret, err = randomSecret()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("No -image-secret given, image links will stop working when the server restarts")
+	}
+
+	if app.config.backup.interval > 0 {
+		go app.backupLoop()
+	}
+	if app.config.media.gc.interval > 0 {
+		go app.mediaGCLoop()
+	}
 
 	log.Println("Starting application on port", port)
 	err = http.ListenAndServe(fmt.Sprintf(":%d", port), app.routes())
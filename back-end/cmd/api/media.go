@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/media"
+	"social-network/models"
+)
+
+// signedURLExpiry is how long signed image links, and the S3 URLs handed out
+// with -s3-redirect, work at least.
+const signedURLExpiry = 15 * time.Minute
+
+const (
+	// maxFormMemory is how much of a multipart form is kept in memory; the
+	// rest of the uploaded files go to temporary files.
+	maxFormMemory = 10 << 20
+	// maxFormFieldsSize is allowed on top of the image limit for the other
+	// fields of an upload form.
+	maxFormFieldsSize = 1 << 20
+)
+
+func (app *application) connectToMedia() (media.Store, error) {
+	switch app.config.media.backend {
+	case "local":
+		return media.NewLocal(app.config.media.dir)
+	case "s3":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		store, err := media.NewS3(ctx, app.config.media.s3)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Storing images in S3 bucket", app.config.media.s3.Bucket)
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown media backend %q", app.config.media.backend)
+}
+
+// generatedName matches the names storeUpload gives to files.
+var generatedName = regexp.MustCompile(`^[0-9a-f]{32}\.[a-z]+$`)
+
+// randomName returns a new random file name with the extension ext.
+func randomName(ext string) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b) + ext, nil
+}
+
+// storeUpload stores a processed upload and its variants under a new random
+// name, which it returns. An upload with the same contents as a stored file
+// is not stored again; it gets the name of that file instead.
+func (app *application) storeUpload(ctx context.Context, upload *media.Upload) (string, error) {
+	sum := sha256.Sum256(upload.Data)
+	hash := hex.EncodeToString(sum[:])
+	name, err := app.database.MediaFileByHash(hash)
+	if err == nil {
+		return name, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	name, err = randomName(upload.Ext)
+	if err != nil {
+		return "", err
+	}
+
+	for variant, data := range upload.Variants {
+		variantName := media.VariantName(name, variant)
+		err = app.media.Put(ctx, variantName, bytes.NewReader(data), int64(len(data)), mime.TypeByExtension(path.Ext(variantName)))
+		if err != nil {
+			return "", err
+		}
+	}
+	err = app.media.Put(ctx, name, bytes.NewReader(upload.Data), int64(len(upload.Data)), upload.ContentType)
+	if err != nil {
+		return "", err
+	}
+
+	// The same file may have been uploaded at the same time, in which case
+	// the copy recorded first is kept.
+	stored, err := app.database.AddMediaFile(models.MediaFile{Name: name, Hash: hash, Size: uploadSize(upload)})
+	if err != nil || stored != name {
+		removeErr := app.removeFiles(ctx, name)
+		if removeErr != nil {
+			log.Println("Error deleting duplicate upload:", removeErr)
+		}
+	}
+	return stored, err
+}
+
+// uploadSize is the storage an upload takes up with its variants.
+func uploadSize(upload *media.Upload) int64 {
+	size := int64(len(upload.Data))
+	for _, data := range upload.Variants {
+		size += int64(len(data))
+	}
+	return size
+}
+
+// deleteImage removes an image and its variants, unless something still
+// refers to it or it was reused within the -media-gc-grace period by an
+// upload that may not refer to it yet.
+func (app *application) deleteImage(ctx context.Context, name string) error {
+	if name == "" {
+		return nil
+	}
+	removable, err := app.database.DeleteMediaFile(name, time.Now().Add(-app.config.media.gc.grace))
+	if err != nil || !removable {
+		return err
+	}
+	return app.removeFiles(ctx, name)
+}
+
+// removeFiles deletes a stored file and its variants, if it has any.
+func (app *application) removeFiles(ctx context.Context, name string) error {
+	files := []string{name}
+	for _, v := range media.Variants {
+		files = append(files, media.VariantName(name, v.Name))
+	}
+	for _, file := range files {
+		err := app.media.Delete(ctx, file)
+		if err != nil && !errors.Is(err, media.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// quotaLeft returns how many bytes the user may still store, or -1 if there
+// is no limit. User 0, someone who is only signing up, has none.
+func (app *application) quotaLeft(userID int) (int64, error) {
+	if userID == 0 {
+		return -1, nil
+	}
+	usage, err := app.database.MediaUsage(userID)
+	if err != nil {
+		return 0, err
+	}
+	limit := app.mediaLimit(usage)
+	if limit == 0 {
+		return -1, nil
+	}
+	if usage.Bytes > limit {
+		return 0, nil
+	}
+	return limit - usage.Bytes, nil
+}
+
+// mediaLimit returns the quota in force for a user, 0 for none.
+func (app *application) mediaLimit(usage models.MediaUsage) int64 {
+	if usage.Quota != nil {
+		return *usage.Quota
+	}
+	return app.config.media.quota
+}
+
+// migrateAvatars moves avatars stored under names made from the user's name,
+// such as ElinaTomson.jpg, to random names. Users with the same name shared
+// one file, so each of them is moved on their own. Avatars that are no
+// images, or are over the limits, are copied as they are.
+func (app *application) migrateAvatars(ctx context.Context) (int, error) {
+	avatars, err := app.database.UserAvatars()
+	if err != nil {
+		return 0, err
+	}
+
+	userIDs := make([]int, 0, len(avatars))
+	for userID, avatar := range avatars {
+		if !generatedName.MatchString(avatar) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Ints(userIDs)
+
+	moved := 0
+	for _, userID := range userIDs {
+		old := avatars[userID]
+		name, err := app.copyImage(ctx, old)
+		if errors.Is(err, media.ErrNotFound) {
+			log.Printf("Avatar %s of user %d is missing", old, userID)
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+
+		_, err = app.database.SetAvatar(userID, name)
+		if err != nil {
+			return moved, err
+		}
+		err = app.deleteImage(ctx, old)
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// copyImage stores a copy of the image called name under a new random name.
+func (app *application) copyImage(ctx context.Context, name string) (string, error) {
+	obj, err := app.media.Open(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+
+	img, err := media.ProcessImage(obj, app.config.media.limits.Image)
+	if err == nil {
+		return app.storeUpload(ctx, img)
+	}
+	if !errors.Is(err, media.ErrUnsupportedImage) && !errors.Is(err, media.ErrImageTooLarge) {
+		return "", err
+	}
+
+	_, err = obj.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	copyName, err := randomName(path.Ext(name))
+	if err != nil {
+		return "", err
+	}
+	err = app.media.Put(ctx, copyName, obj, obj.Size, obj.ContentType)
+	if err != nil {
+		return "", err
+	}
+	return app.database.AddMediaFile(models.MediaFile{Name: copyName, Size: obj.Size})
+}
+
+// randomSecret is used to sign image links when no -image-secret is given.
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// imageURL returns a link to the uploaded file name that works without a
+// session until it expires. The expiry is rounded so that an image keeps the
+// same link, and stays in the browser cache, for a while.
+func (app *application) imageURL(name string) string {
+	if name == "" {
+		return ""
+	}
+
+	expires := time.Now().Add(2 * signedURLExpiry).Truncate(signedURLExpiry).Unix()
+	query := url.Values{
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {app.imageSignature(name, expires)},
+	}
+	return "/images/" + url.PathEscape(name) + "?" + query.Encode()
+}
+
+func (app *application) imageSignature(name string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(app.config.media.secret))
+	fmt.Fprintf(mac, "%s\n%d", name, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// imageLinks returns the signed link to an uploaded image and the links to
+// its variants by name.
+func (app *application) imageLinks(name string) (string, map[string]string) {
+	link := app.imageURL(name)
+	if link == "" {
+		return "", nil
+	}
+
+	variants := make(map[string]string, len(media.Variants))
+	for _, v := range media.Variants {
+		variants[v.Name] = link + "&size=" + v.Name
+	}
+	return link, variants
+}
+
+// attachmentLinks fills in the signed links to each attachment and, for
+// images, to its variants.
+func (app *application) attachmentLinks(attachments []models.Attachment) {
+	for i := range attachments {
+		a := &attachments[i]
+		if strings.HasPrefix(a.MimeType, "image/") {
+			a.URL, a.Variants = app.imageLinks(a.Name)
+		} else {
+			a.URL = app.imageURL(a.Name)
+		}
+	}
+}
+
+// validImageSignature checks the expires and sig parameters of a link made
+// by imageURL.
+func (app *application) validImageSignature(name string, query url.Values) bool {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(query.Get("sig")), []byte(app.imageSignature(name, expires)))
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
 	"net/http"
+	"strings"
 )
 
 func (app *application) enableCORS(h http.Handler) http.Handler {
@@ -24,12 +24,47 @@ func (app *application) authRequired(next http.Handler) http.Handler {
 		// Get the session ID (cookie value) from the request.
 		_, err := app.GetSessionIDFromCookie(r)
 		if err != nil {
-			// If the user is not authenticated, redirect to a login page or return an error message.
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			fmt.Printf("User not authorized")
+			app.errorJSON(w, errUnauthorized)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// adminRequired lets through only the users named by -admins.
+func (app *application) adminRequired(next http.Handler) http.Handler {
+	return app.authRequired(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, email, _, _, err := app.database.DataFromSession(r)
+		if err != nil {
+			app.errorJSON(w, errSession(err))
+			return
+		}
+		if !app.config.admins[strings.ToLower(email)] {
+			app.errorJSON(w, errForbidden("Only administrators can access this resource"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// isModerator reports whether the user with email was named by -moderators
+// or -admins.
+func (app *application) isModerator(email string) bool {
+	email = strings.ToLower(email)
+	return app.config.admins[email] || app.config.moderators[email]
+}
+
+// parseAdmins turns the comma-separated emails of -admins or -moderators
+// into a set.
+func parseAdmins(list string) map[string]bool {
+	admins := make(map[string]bool)
+	for _, email := range strings.Split(list, ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" {
+			admins[email] = true
+		}
+	}
+	return admins
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"social-network/database"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// Cursors are opaque to clients: a direction marker and a row key, base64
+// encoded so nobody is tempted to build them by hand.
+func encodeCursor(key int, backward bool) string {
+	return encodeRawCursor(strconv.Itoa(key), backward)
+}
+
+func decodeCursor(cursor string) (int, bool, error) {
+	keyStr, backward, err := decodeRawCursor(cursor)
+	if err != nil {
+		return 0, false, err
+	}
+
+	key, err := strconv.Atoi(keyStr)
+	if err != nil || key <= 0 {
+		return 0, false, fmt.Errorf("malformed cursor")
+	}
+
+	return key, backward, nil
+}
+
+// Search results have no single row key, so their cursors hold the rank,
+// type and ID of the result to continue from.
+func encodeSearchCursor(key database.SearchKey, backward bool) string {
+	rank := strconv.FormatFloat(key.Rank, 'g', -1, 64)
+	return encodeRawCursor(fmt.Sprintf("%s:%s:%d", rank, key.Type, key.ID), backward)
+}
+
+func decodeSearchCursor(cursor string) (database.SearchKey, bool, error) {
+	var key database.SearchKey
+	raw, backward, err := decodeRawCursor(cursor)
+	if err != nil {
+		return key, false, err
+	}
+
+	parts := strings.Split(raw, ":")
+	if len(parts) != 3 {
+		return key, false, fmt.Errorf("malformed cursor")
+	}
+	key.Rank, err = strconv.ParseFloat(parts[0], 64)
+	if err != nil || math.IsNaN(key.Rank) || math.IsInf(key.Rank, 0) {
+		return key, false, fmt.Errorf("malformed cursor")
+	}
+	for _, t := range searchTypes {
+		if parts[1] == t {
+			key.Type = t
+		}
+	}
+	key.ID, err = strconv.Atoi(parts[2])
+	if err != nil || key.ID <= 0 || key.Type == "" {
+		return key, false, fmt.Errorf("malformed cursor")
+	}
+
+	return key, backward, nil
+}
+
+func encodeRawCursor(key string, backward bool) string {
+	direction := "n"
+	if backward {
+		direction = "p"
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(direction + ":" + key))
+}
+
+func decodeRawCursor(cursor string) (string, bool, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", false, err
+	}
+
+	direction, key, found := strings.Cut(string(raw), ":")
+	if !found || (direction != "n" && direction != "p") {
+		return "", false, fmt.Errorf("malformed cursor")
+	}
+
+	return key, direction == "p", nil
+}
+
+// readLimit reads the optional "limit" query parameter.
+func (app *application) readLimit(r *http.Request, defaultLimit int) (int, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		return defaultLimit, nil
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > maxPageLimit {
+		return 0, errParam("limit", fmt.Sprintf("must be between 1 and %d", maxPageLimit))
+	}
+	return n, nil
+}
+
+// readPage reads the optional "cursor" and "limit" query parameters.
+func (app *application) readPage(r *http.Request) (database.Page, error) {
+	var page database.Page
+	limit, err := app.readLimit(r, defaultPageLimit)
+	if err != nil {
+		return page, err
+	}
+	page.Limit = limit
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		key, backward, err := decodeCursor(cursor)
+		if err != nil {
+			return page, errParam("cursor", "is not a valid cursor")
+		}
+		page.Cursor = key
+		page.Backward = backward
+	}
+
+	return page, nil
+}
+
+// readSearchPage reads the "cursor" and "limit" query parameters of a
+// search, whose cursors are those of encodeSearchCursor.
+func (app *application) readSearchPage(r *http.Request) (database.SearchPage, error) {
+	var page database.SearchPage
+	limit, err := app.readLimit(r, defaultSearchLimit)
+	if err != nil {
+		return page, err
+	}
+	page.Limit = limit
+
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		key, backward, err := decodeSearchCursor(cursor)
+		if err != nil {
+			return page, errParam("cursor", "is not a valid cursor")
+		}
+		page.Cursor = &key
+		page.Backward = backward
+	}
+
+	return page, nil
+}
+
+// pageLinks builds a Link header pointing at the next and previous pages of
+// the current request, keeping its other query parameters.
+func (app *application) pageLinks(r *http.Request, page database.Page, cursors database.Cursors) http.Header {
+	var next, prev string
+	if cursors.Next != 0 {
+		next = encodeCursor(cursors.Next, false)
+	}
+	if cursors.Prev != 0 {
+		prev = encodeCursor(cursors.Prev, true)
+	}
+	return cursorLinks(r, page.Limit, next, prev)
+}
+
+// searchLinks is pageLinks for a page of search results.
+func (app *application) searchLinks(r *http.Request, page database.SearchPage, cursors database.SearchCursors) http.Header {
+	var next, prev string
+	if cursors.Next != nil {
+		next = encodeSearchCursor(*cursors.Next, false)
+	}
+	if cursors.Prev != nil {
+		prev = encodeSearchCursor(*cursors.Prev, true)
+	}
+	return cursorLinks(r, page.Limit, next, prev)
+}
+
+// cursorLinks builds the Link header of pageLinks and searchLinks from the
+// encoded cursors, an empty one meaning there is no page on that side.
+func cursorLinks(r *http.Request, limit int, next, prev string) http.Header {
+	var links []string
+
+	link := func(cursor, rel string) {
+		query := r.URL.Query()
+		query.Set("cursor", cursor)
+		query.Set("limit", strconv.Itoa(limit))
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, query.Encode(), rel))
+	}
+
+	if next != "" {
+		link(next, "next")
+	}
+	if prev != "" {
+		link(prev, "prev")
+	}
+
+	headers := http.Header{}
+	if len(links) > 0 {
+		headers.Set("Link", strings.Join(links, ", "))
+	}
+	return headers
+}
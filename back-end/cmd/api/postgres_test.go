@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"social-network/database"
+	"social-network/database/postgres"
+)
+
+// The Postgres run of the handler tests uses the server in POSTGRES_TEST_DSN
+// when it is set. Otherwise it starts a throwaway cluster with initdb and
+// pg_ctl, and skips when those are not installed, or fails if REQUIRE_POSTGRES
+// is set, as it is in CI. Every test gets a fresh schema, so an existing
+// database is left as it was found.
+func init() {
+	testStores["postgres"] = newPostgresStore
+}
+
+var (
+	pgOnce    sync.Once
+	pgDSN     string
+	pgStop    func()
+	pgErr     error
+	pgSchemas int32
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if pgStop != nil {
+		pgStop()
+	}
+	os.Exit(code)
+}
+
+func newPostgresStore(t *testing.T) database.Store {
+	pgOnce.Do(func() {
+		pgDSN, pgStop, pgErr = postgresServer()
+	})
+	if pgErr != nil {
+		if os.Getenv("REQUIRE_POSTGRES") != "" {
+			t.Fatalf("no Postgres server: %v", pgErr)
+		}
+		t.Skipf("no Postgres server: %v", pgErr)
+	}
+
+	admin, err := sql.Open("postgres", pgDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("handlers_test_%d_%d", os.Getpid(), atomic.AddInt32(&pgSchemas, 1))
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Error(err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(pgDSN, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := postgres.Migrate(db); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	return &postgres.PostgresDB{DB: db}
+}
+
+// withSearchPath points every connection of dsn at schema. lib/pq passes
+// unknown connection parameters on to the server as run-time settings.
+func withSearchPath(dsn, schema string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			query := u.Query()
+			query.Set("search_path", schema)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + schema
+}
+
+// postgresServer returns a DSN for the test server and a function stopping it
+// if it was started here.
+func postgresServer() (string, func(), error) {
+	if dsn := os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		return dsn, nil, nil
+	}
+
+	initdb, err := postgresBinary("initdb")
+	if err != nil {
+		return "", nil, err
+	}
+	pgCtl, err := postgresBinary("pg_ctl")
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "social-network-pg")
+	if err != nil {
+		return "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb: %v: %s", err, out)
+	}
+
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses='' -c fsync=off", port, dir)
+	out, err = exec.Command(pgCtl, "-D", data, "-l", filepath.Join(dir, "server.log"), "-o", options, "-w", "start").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start: %v: %s", err, out)
+	}
+
+	stop := func() {
+		exec.Command(pgCtl, "-D", data, "-m", "immediate", "stop").Run()
+		os.RemoveAll(dir)
+	}
+	dsn := fmt.Sprintf("host=%s port=%d user=postgres dbname=postgres sslmode=disable", dir, port)
+	return dsn, stop, nil
+}
+
+// postgresBinary looks for a Postgres server binary on PATH and in the
+// versioned directories Debian and Ubuntu install them to.
+func postgresBinary(name string) (string, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	matches, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql", "*", "bin", name))
+	if len(matches) > 0 {
+		return matches[len(matches)-1], nil
+	}
+	return "", errors.New("set POSTGRES_TEST_DSN or install the Postgres server binaries (" + name + " not found)")
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -11,8 +11,8 @@ func (app *application) routes() http.Handler {
 	mux.HandleFunc("/login", app.LoginHandler)
 	mux.HandleFunc("/logout", app.LogOutHandler)
 
-	fileServer := http.FileServer(http.Dir("./database/images"))
-	mux.Handle("/images/", app.authRequired(http.StripPrefix("/images/", fileServer)))
+	mux.HandleFunc("/images/", app.ImageHandler)
+	mux.Handle("/avatar", app.authRequired(http.HandlerFunc(app.AvatarHandler)))
 	mux.Handle("/profile", app.authRequired(http.HandlerFunc(app.ProfileHandler)))
 	mux.Handle("/profile-type", app.authRequired(http.HandlerFunc(app.ProfileTypeHandler)))
 	mux.Handle("/main", app.authRequired(http.HandlerFunc(app.MainPageHandler)))
@@ -20,8 +20,23 @@ func (app *application) routes() http.Handler {
 	mux.Handle("/search", app.authRequired(http.HandlerFunc(app.SearchHandler)))
 	mux.Handle("/user/", app.authRequired(http.HandlerFunc(app.UserHandler)))
 	mux.Handle("/create-post", app.authRequired(http.HandlerFunc(app.CreatePostHandler)))
+	mux.Handle("/edit-post", app.authRequired(http.HandlerFunc(app.EditPostHandler)))
+	mux.Handle("/delete-post", app.authRequired(http.HandlerFunc(app.DeletePostHandler)))
+	mux.Handle("/post-revisions", app.authRequired(http.HandlerFunc(app.PostRevisionsHandler)))
 	mux.Handle("/all-posts", app.authRequired(http.HandlerFunc(app.AllPostsHandler)))
 	mux.Handle("/create-comment", app.authRequired(http.HandlerFunc(app.CommentHandler)))
+	mux.Handle("/comments", app.authRequired(http.HandlerFunc(app.CommentsHandler)))
+	mux.Handle("/edit-comment", app.authRequired(http.HandlerFunc(app.EditCommentHandler)))
+	mux.Handle("/delete-comment", app.authRequired(http.HandlerFunc(app.DeleteCommentHandler)))
+	mux.Handle("/react", app.authRequired(http.HandlerFunc(app.ReactHandler)))
+	mux.Handle("/reactions", app.authRequired(http.HandlerFunc(app.ReactionsHandler)))
+	mux.Handle("/reaction-emojis", app.authRequired(http.HandlerFunc(app.ReactionEmojisHandler)))
+	mux.Handle("/mentions", app.authRequired(http.HandlerFunc(app.MentionsHandler)))
+	mux.Handle("/mention-seen", app.authRequired(http.HandlerFunc(app.MentionSeenHandler)))
+	mux.Handle("/hashtag", app.authRequired(http.HandlerFunc(app.HashtagHandler)))
+	mux.Handle("/trending-hashtags", app.authRequired(http.HandlerFunc(app.TrendingHashtagsHandler)))
+	mux.Handle("/follow-hashtag", app.authRequired(http.HandlerFunc(app.FollowHashtagHandler)))
+	mux.Handle("/followed-hashtags", app.authRequired(http.HandlerFunc(app.FollowedHashtagsHandler)))
 	mux.Handle("/follow", app.authRequired(http.HandlerFunc(app.FollowHandler)))
 	mux.Handle("/follower-check", app.authRequired(http.HandlerFunc(app.FollowerHandler)))
 	mux.Handle("/following", app.authRequired(http.HandlerFunc(app.FollowingHandler)))
@@ -32,6 +47,7 @@ func (app *application) routes() http.Handler {
 	mux.Handle("/create-group", app.authRequired(http.HandlerFunc(app.CreateGroupHandler)))
 	mux.Handle("/all-groups", app.authRequired(http.HandlerFunc(app.AllGroupsHandler)))
 	mux.Handle("/group/", app.authRequired(http.HandlerFunc(app.GroupHandler)))
+	mux.Handle("/group-members", app.authRequired(http.HandlerFunc(app.GroupMembersHandler)))
 	mux.Handle("/group-posts", app.authRequired(http.HandlerFunc(app.GroupPostsHandler)))
 	mux.Handle("/invite", app.authRequired(http.HandlerFunc(app.InviteNewMemberHandler)))
 	mux.Handle("/group-invitations", app.authRequired(http.HandlerFunc(app.GroupInvitationHandler)))
@@ -50,11 +66,15 @@ func (app *application) routes() http.Handler {
 	mux.Handle("/not-going", app.authRequired(http.HandlerFunc(app.NotGoingHandler)))
 	mux.Handle("/ws", app.authRequired(http.HandlerFunc(app.WebsocketHandler)))
 	mux.Handle("/chatroom/", app.authRequired(http.HandlerFunc(app.GroupWebsocketHandler)))
+	mux.Handle("/attachments", app.authRequired(http.HandlerFunc(app.AttachmentsHandler)))
 	mux.Handle("/message", app.authRequired(http.HandlerFunc(app.AddMessageHandler)))
 	mux.Handle("/conversation-history/", app.authRequired(http.HandlerFunc(app.GetMessagesHandler)))
 	mux.Handle("/group-conversation-history/", app.authRequired(http.HandlerFunc(app.GetGroupMessagesHandler)))
 	mux.Handle("/unread-messages", app.authRequired(http.HandlerFunc(app.UnreadMessagesHandler)))
 	mux.Handle("/mark-messages-as-read/", app.authRequired(http.HandlerFunc(app.MarkMessagesAsReadHandler)))
 
+	mux.Handle("/admin/media-usage", app.adminRequired(http.HandlerFunc(app.MediaUsageHandler)))
+	mux.Handle("/admin/media-quota", app.adminRequired(http.HandlerFunc(app.MediaQuotaHandler)))
+
 	return handler
 }
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
 	"net/http"
 )
 
 type JSONResponse struct {
-	Error   bool        `json:"error"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Error   bool              `json:"error"`
+	Code    string            `json:"code,omitempty"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Data    interface{}       `json:"data,omitempty"`
 }
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
@@ -56,16 +59,33 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data in
 	return nil
 }
 
+// errorJSON writes err as a JSON error response. An *APIError carries its own
+// status and code; any other error is treated as a bad request unless a status
+// is given. Server errors are logged and replaced with a generic message.
 func (app *application) errorJSON(w http.ResponseWriter, err error, status ...int) {
-	statusCode := http.StatusBadRequest
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		statusCode := http.StatusBadRequest
+		if len(status) > 0 {
+			statusCode = status[0]
+		}
+		apiErr = &APIError{Status: statusCode, Code: codeForStatus(statusCode), Message: err.Error()}
+		if statusCode >= http.StatusInternalServerError {
+			apiErr.Message = internalErrorMessage
+			apiErr.Err = err
+		}
+	}
 
-	if len(status) > 0 {
-		statusCode = status[0]
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Printf("internal error: %v", apiErr.Err)
 	}
 
-	var payload JSONResponse
-	payload.Error = true
-	payload.Message = err.Error()
+	payload := JSONResponse{
+		Error:   true,
+		Code:    apiErr.Code,
+		Message: apiErr.Message,
+		Fields:  apiErr.Fields,
+	}
 
-	_ = app.writeJSON(w, statusCode, payload)
+	_ = app.writeJSON(w, apiErr.Status, payload)
 }
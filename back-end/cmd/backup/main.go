@@ -0,0 +1,125 @@
+// Command backup manages snapshots of the SQLite database and images outside
+// the server. Run it from the back-end folder:
+//
+//	go run ./cmd/backup create
+//	go run ./cmd/backup list
+//	go run ./cmd/backup verify [-snapshot NAME]
+//	go run ./cmd/backup prune
+//	go run ./cmd/backup restore (-snapshot NAME | -at TIME)
+//
+// Restoring replaces the live files, so stop the server first.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"social-network/backup"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+
+	var cfg backup.Config
+	var name, at string
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.StringVar(&cfg.DBPath, "db", "./database/database.db", "SQLite database file")
+	flags.StringVar(&cfg.ImagesDir, "images", "./database/images", "Images directory")
+	flags.StringVar(&cfg.MigrationsDir, "migrations", "./database/migrations", "Migrations directory")
+	flags.StringVar(&cfg.Dir, "dir", "./backups", "Backup directory")
+	flags.IntVar(&cfg.KeepLast, "keep-last", 24, "Number of most recent backups prune keeps")
+	flags.IntVar(&cfg.KeepDaily, "keep-daily", 7, "Number of days prune keeps the last backup of")
+	flags.StringVar(&name, "snapshot", "", "Snapshot name, the newest one by default")
+	flags.StringVar(&at, "at", "", "Restore the newest snapshot taken at or before this RFC 3339 time")
+	flags.Parse(os.Args[2:])
+
+	switch command {
+	case "create":
+		snapshot, err := backup.Create(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = backup.Verify(snapshot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(snapshot.Dir)
+
+	case "list":
+		snapshots, err := backup.List(cfg.Dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range snapshots {
+			fmt.Printf("%s\t%s\tschema %d\t%d files\n", s.Name(), s.Created.Local().Format(time.RFC3339), s.SchemaVersion, len(s.Files))
+		}
+
+	case "verify":
+		snapshot, err := pick(cfg, name, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = backup.Verify(snapshot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(snapshot.Name(), "OK")
+
+	case "prune":
+		removed, err := backup.Prune(cfg)
+		for _, s := range removed {
+			fmt.Println("removed", s.Name())
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "restore":
+		snapshot, err := pick(cfg, name, at)
+		if err != nil {
+			log.Fatal(err)
+		}
+		suffix, err := backup.Restore(cfg, snapshot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("restored %s, the previous files were kept with the suffix %s\n", snapshot.Name(), suffix)
+
+	default:
+		usage()
+	}
+}
+
+// pick returns the snapshot called name, the newest one taken at or before
+// at, or the newest one.
+func pick(cfg backup.Config, name, at string) (*backup.Snapshot, error) {
+	if name != "" && at != "" {
+		return nil, fmt.Errorf("use either -snapshot or -at")
+	}
+	if name != "" {
+		return backup.Open(filepath.Join(cfg.Dir, name))
+	}
+
+	t := time.Now()
+	if at != "" {
+		var err error
+		t, err = time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, fmt.Errorf("-at must be an RFC 3339 time such as 2024-01-02T15:04:05+02:00: %w", err)
+		}
+	}
+	return backup.Find(cfg.Dir, t)
+}
+
+func usage() {
+	log.Fatal("usage: backup create|list|verify|prune|restore [flags]")
+}
@@ -0,0 +1,76 @@
+// Command seed creates a SQLite database filled with a synthetic social
+// network for development. Run it from the back-end folder:
+//
+//	go run ./cmd/seed [-seed N] [-users N] [-force]
+//
+// then start the server on the result with -sqlite-file ./database/seed.db.
+// Every seeded user logs in as userN@example.com with the password "password".
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"social-network/database/seed"
+	"social-network/database/sqlite"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	cfg := seed.DefaultConfig()
+	var dbPath, imagesDir, migrationsDir string
+	var force bool
+	flag.StringVar(&dbPath, "db", "./database/seed.db", "SQLite database file to create")
+	flag.StringVar(&imagesDir, "images", "./database/images", "Images directory")
+	flag.StringVar(&migrationsDir, "migrations", "./database/migrations", "Migrations directory")
+	flag.Int64Var(&cfg.Seed, "seed", cfg.Seed, "Random seed, the same seed gives the same data")
+	flag.IntVar(&cfg.Users, "users", cfg.Users, "Number of users")
+	flag.IntVar(&cfg.PostsPerUser, "posts", cfg.PostsPerUser, "Average number of posts per user")
+	flag.IntVar(&cfg.Groups, "groups", cfg.Groups, "Number of groups")
+	flag.IntVar(&cfg.EventsPerGroup, "events", cfg.EventsPerGroup, "Average number of events per group")
+	flag.IntVar(&cfg.MessagesPerUser, "messages", cfg.MessagesPerUser, "Average number of chat messages per user")
+	flag.IntVar(&cfg.Images, "image-count", cfg.Images, "Number of generated images")
+	flag.BoolVar(&force, "force", false, "Replace the database file if it exists")
+	flag.Parse()
+
+	if _, err := os.Stat(dbPath); err == nil {
+		if !force {
+			log.Fatalf("%s already exists, use -force to replace it", dbPath)
+		}
+		for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	db, err := sqlite.OpenWriter(dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	err = sqlite.Migrate(db, migrationsDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stats, err := seed.Run(db, imagesDir, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tables := make([]string, 0, len(stats))
+	for table := range stats {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Printf("%-20s %d\n", table, stats[table])
+	}
+	fmt.Printf("seeded %s with seed %d, log in as user1@example.com / %s\n", dbPath, cfg.Seed, seed.Password)
+}
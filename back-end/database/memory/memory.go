@@ -0,0 +1,2590 @@
+// Package memory is an in-process implementation of database.Store. It keeps
+// the same semantics as the SQL backends, including their visibility rules and
+// sql.ErrNoRows for missing rows, so handlers can be tested without a database.
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"social-network/database"
+	"social-network/entities"
+	"social-network/models"
+
+	"github.com/gofrs/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type user struct {
+	models.UserData
+	hash  []byte
+	quota *int64
+}
+
+type post struct {
+	id, userID, groupID int
+	content, privacy    string
+	image               string
+	date                time.Time
+	editedAt            *time.Time
+	audience            []int
+}
+
+type revision struct {
+	id, postID       int
+	content, privacy string
+	audience         []int
+	date             time.Time
+}
+
+type comment struct {
+	id, postID, userID int
+	parentID, depth    int
+	comment, image     string
+	date               time.Time
+	editedAt           *time.Time
+	deleted            bool
+}
+
+type follow struct {
+	follower, following int
+	pending             bool
+}
+
+type group struct {
+	id, userID         int
+	title, description string
+	invitees           []int
+}
+
+type member struct {
+	groupID, memberID                 int
+	requestPending, invitationPending bool
+}
+
+type event struct {
+	id, userID, groupID      int
+	title, description, time string
+}
+
+type notification struct {
+	eventID, memberID, groupID int
+}
+
+type participant struct {
+	eventID, userID int
+	going           bool
+}
+
+type message struct {
+	id, sender, recipient, groupID int
+	message                        string
+	date                           time.Time
+	read                           bool
+}
+
+// attachment belongs to at most one of a post, comment, message or post
+// revision; with none it waits to be sent with a message.
+type attachment struct {
+	models.Attachment
+	userID, postID, commentID, messageID int
+	revisionID                           int
+	position                             int
+	created                              time.Time
+}
+
+func (a *attachment) pending() bool {
+	return a.postID == 0 && a.commentID == 0 && a.messageID == 0 && a.revisionID == 0
+}
+
+// reaction belongs to exactly one of a post, comment or message.
+type reaction struct {
+	id, userID                   int
+	postID, commentID, messageID int
+	emoji                        string
+	date                         time.Time
+}
+
+type mention struct {
+	id, userID, authorID int
+	target               models.Target
+	position, length     int
+	seen                 bool
+	date                 time.Time
+}
+
+type hashtag struct {
+	id               int
+	target           models.Target
+	tag              string
+	position, length int
+	date             time.Time
+}
+
+// mediaFile is a recorded upload. What refers to it is counted when needed
+// rather than kept up to date like the SQL stores do.
+type mediaFile struct {
+	hash            string
+	size            int64
+	created, reused time.Time
+}
+
+// Store keeps every table in memory behind a single mutex.
+type Store struct {
+	mu sync.Mutex
+
+	users         map[int]*user
+	sessions      map[string]int
+	posts         map[int]*post
+	revisions     map[int]*revision
+	comments      map[int]*comment
+	follows       []*follow
+	groups        map[int]*group
+	members       []*member
+	events        map[int]*event
+	notifications []*notification
+	participants  []*participant
+	messages      map[int]*message
+	attachments   map[int]*attachment
+	mediaFiles    map[string]*mediaFile
+	reactions     map[int]*reaction
+	mentions      map[int]*mention
+	hashtags      map[int]*hashtag
+	tagFollows    map[int]map[string]bool
+
+	lastID map[string]int
+}
+
+var _ database.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		users:       make(map[int]*user),
+		sessions:    make(map[string]int),
+		posts:       make(map[int]*post),
+		revisions:   make(map[int]*revision),
+		comments:    make(map[int]*comment),
+		groups:      make(map[int]*group),
+		events:      make(map[int]*event),
+		messages:    make(map[int]*message),
+		attachments: make(map[int]*attachment),
+		mediaFiles:  make(map[string]*mediaFile),
+		reactions:   make(map[int]*reaction),
+		mentions:    make(map[int]*mention),
+		hashtags:    make(map[int]*hashtag),
+		tagFollows:  make(map[int]map[string]bool),
+		lastID:      make(map[string]int),
+	}
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+func (s *Store) nextID(table string) int {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// paginate emulates the keyset queries of the SQL stores: rows are walked in
+// key order (descending when desc is set, flipped for backward pages) from
+// just after the cursor, fetching one row past the page size.
+func paginate[T any](rows []T, p database.Page, key func(T) int, desc bool) ([]T, database.Cursors) {
+	ascending := desc == p.Backward
+	sort.Slice(rows, func(i, j int) bool {
+		if ascending {
+			return key(rows[i]) < key(rows[j])
+		}
+		return key(rows[i]) > key(rows[j])
+	})
+
+	var window []T
+	for _, row := range rows {
+		k := key(row)
+		if p.Cursor > 0 && ((ascending && k <= p.Cursor) || (!ascending && k >= p.Cursor)) {
+			continue
+		}
+		window = append(window, row)
+		if len(window) > p.Limit {
+			break
+		}
+	}
+
+	return database.Paginate(window, p, key)
+}
+
+func sortedIDs[T any](rows map[int]T) []int {
+	ids := make([]int, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func splitIDs(list string) ([]int, error) {
+	var ids []int
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q: %w", id, err)
+		}
+		ids = append(ids, n)
+	}
+	return ids, nil
+}
+
+func joinIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Users
+
+func (s *Store) userByEmail(email string) *user {
+	for _, id := range sortedIDs(s.users) {
+		if s.users[id].Email == email {
+			return s.users[id]
+		}
+	}
+	return nil
+}
+
+func (s *Store) name(userID int) (string, string) {
+	if u, ok := s.users[userID]; ok {
+		return u.FirstName, u.LastName
+	}
+	return "", ""
+}
+
+func (s *Store) Register(userData *models.UserData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userByEmail(userData.Email) != nil {
+		return fmt.Errorf("memory: email %q is already registered", userData.Email)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(userData.Password), bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+
+	u := &user{UserData: *userData, hash: hash}
+	u.UserID = s.nextID("users")
+	u.Password = ""
+	u.Public = true
+	u.CurrentUser = false
+	u.Online = false
+	s.users[u.UserID] = u
+
+	return nil
+}
+
+func (s *Store) CheckEmail(email string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userByEmail(email) != nil, nil
+}
+
+func (s *Store) Login(userData *models.UserData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByEmail(userData.Email)
+	if u == nil {
+		return sql.ErrNoRows
+	}
+	return bcrypt.CompareHashAndPassword(u.hash, []byte(userData.Password))
+}
+
+func (s *Store) DataFromUserData(userData *models.UserData) (int, string, string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByEmail(userData.Email)
+	if u == nil {
+		return 0, "", "", "", sql.ErrNoRows
+	}
+	return u.UserID, u.Email, u.FirstName, u.LastName, nil
+}
+
+func (s *Store) GetUserDataByEmail(email string) (*models.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByEmail(email)
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	userData := u.UserData
+	userData.UserID = 0
+	return &userData, nil
+}
+
+func (s *Store) GetUser(id int) (*models.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	userData := u.UserData
+	return &userData, nil
+}
+
+func (s *Store) UsersByIDs(userIDs []int) (map[int]*models.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make(map[int]*models.UserData, len(userIDs))
+	for _, id := range userIDs {
+		if u, ok := s.users[id]; ok {
+			users[id] = &models.UserData{UserID: id, FirstName: u.FirstName, LastName: u.LastName, Nickname: u.Nickname}
+		}
+	}
+	return users, nil
+}
+
+func (s *Store) UserIDByFirstName(firstName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range sortedIDs(s.users) {
+		if s.users[id].FirstName == firstName {
+			return id, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (s *Store) UpdateProfileType(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userID]; ok {
+		u.Public = !u.Public
+	}
+	return nil
+}
+
+func (s *Store) IsUserPublic(userID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	return u.Public, nil
+}
+
+func (s *Store) UserAvatars() (map[int]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	avatars := make(map[int]string)
+	for id, u := range s.users {
+		if u.Avatar != "" {
+			avatars[id] = u.Avatar
+		}
+	}
+	return avatars, nil
+}
+
+func (s *Store) SetAvatar(userID int, avatar string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	previous := u.Avatar
+	u.Avatar = avatar
+	return previous, nil
+}
+
+// Sessions
+
+func (s *Store) Session(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.Cookie] = session.UserID
+	return nil
+}
+
+func (s *Store) DeleteSession(uuid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, uuid)
+	return nil
+}
+
+func (s *Store) DataFromSession(r *http.Request) (int, string, string, string, error) {
+	cookie, err := r.Cookie("sessionId")
+	if err != nil {
+		return 0, "", "", "", fmt.Errorf("%w: %v", database.ErrNoSession, err)
+	}
+
+	id, err := uuid.FromString(cookie.Value)
+	if err != nil {
+		return 0, "", "", "", fmt.Errorf("%w: %v", database.ErrNoSession, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, ok := s.sessions[id.String()]
+	if !ok {
+		return 0, "", "", "", database.ErrNoSession
+	}
+	u, ok := s.users[userID]
+	if !ok {
+		return 0, "", "", "", database.ErrNoSession
+	}
+	return u.UserID, u.Email, u.FirstName, u.LastName, nil
+}
+
+// Posts and comments
+
+func (s *Store) isFollowing(follower, following int) bool {
+	for _, f := range s.follows {
+		if f.follower == follower && f.following == following && !f.pending {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) isGroupMember(userID, groupID int) bool {
+	for _, m := range s.members {
+		if m.groupID == groupID && m.memberID == userID && !m.requestPending && !m.invitationPending {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) isGroupCreator(userID, groupID int) bool {
+	g, ok := s.groups[groupID]
+	return ok && g.userID == userID
+}
+
+// visible mirrors the visiblePost condition of the SQL stores.
+func (s *Store) visible(p *post, viewerID int) bool {
+	if p.groupID != 0 {
+		return s.isGroupMember(viewerID, p.groupID) || s.isGroupCreator(viewerID, p.groupID)
+	}
+	if p.privacy == "public" || p.userID == viewerID {
+		return true
+	}
+	switch p.privacy {
+	case "private":
+		return s.isFollowing(viewerID, p.userID)
+	case "for-selected-users":
+		for _, id := range p.audience {
+			if id == viewerID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Store) postModel(p *post) models.Post {
+	firstName, lastName := s.name(p.userID)
+	return models.Post{
+		PostID:         p.id,
+		UserID:         p.userID,
+		Content:        p.content,
+		FirstName:      firstName,
+		LastName:       lastName,
+		Privacy:        p.privacy,
+		SelectedUserID: joinIDs(p.audience),
+		Image:          p.image,
+		Date:           p.date,
+		EditedAt:       p.editedAt,
+		GroupID:        p.groupID,
+	}
+}
+
+func (s *Store) queryPosts(match func(p *post) bool, page database.Page) ([]models.Post, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var posts []models.Post
+	for _, id := range sortedIDs(s.posts) {
+		if p := s.posts[id]; match(p) {
+			posts = append(posts, s.postModel(p))
+		}
+	}
+
+	posts, cursors := paginate(posts, page, func(p models.Post) int { return p.PostID }, true)
+	return posts, cursors, nil
+}
+
+func (s *Store) CreatePost(p *models.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var audience []int
+	if p.Privacy == "for-selected-users" {
+		ids, err := splitIDs(p.SelectedUserID)
+		if err != nil {
+			return err
+		}
+		audience = ids
+	}
+
+	p.Date = time.Now()
+	p.PostID = s.nextID("posts")
+	s.posts[p.PostID] = &post{
+		id:       p.PostID,
+		userID:   p.UserID,
+		groupID:  p.GroupID,
+		content:  p.Content,
+		privacy:  p.Privacy,
+		image:    p.Image,
+		date:     p.Date,
+		audience: audience,
+	}
+	s.insertAttachments(p.UserID, p.PostID, 0, p.Attachments)
+	s.replaceMentions(models.Target{PostID: p.PostID}, p.UserID, p.Mentions)
+	s.replaceHashtags(models.Target{PostID: p.PostID}, p.Hashtags)
+	return nil
+}
+
+func (s *Store) insertAttachments(userID, postID, commentID int, attachments []models.Attachment) {
+	for i := range attachments {
+		s.insertAttachment(userID, postID, commentID, i, &attachments[i])
+	}
+}
+
+func (s *Store) insertAttachment(userID, postID, commentID, position int, a *models.Attachment) {
+	a.AttachmentID = s.nextID("attachments")
+	s.attachments[a.AttachmentID] = &attachment{
+		Attachment: *a,
+		userID:     userID,
+		postID:     postID,
+		commentID:  commentID,
+		position:   position,
+		created:    time.Now(),
+	}
+}
+
+func (s *Store) PostAuthor(postID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[postID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return p.userID, nil
+}
+
+func (s *Store) UpdatePost(updated *models.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[updated.PostID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	var audience []int
+	if updated.Privacy == "for-selected-users" {
+		ids, err := splitIDs(updated.SelectedUserID)
+		if err != nil {
+			return err
+		}
+		audience = ids
+	}
+	kept := make(map[int]bool)
+	for _, a := range updated.Attachments {
+		if a.AttachmentID != 0 {
+			if current, ok := s.attachments[a.AttachmentID]; !ok || current.postID != p.id {
+				return sql.ErrNoRows
+			}
+			kept[a.AttachmentID] = true
+		}
+	}
+
+	r := &revision{id: s.nextID("post_revisions"), postID: p.id, content: p.content, privacy: p.privacy, audience: p.audience, date: p.date}
+	if p.editedAt != nil {
+		r.date = *p.editedAt
+	}
+	s.revisions[r.id] = r
+	for _, id := range sortedIDs(s.attachments) {
+		a := s.attachments[id]
+		if a.postID != p.id {
+			continue
+		}
+		c := *a
+		c.AttachmentID = s.nextID("attachments")
+		c.postID, c.revisionID = 0, r.id
+		s.attachments[c.AttachmentID] = &c
+		if !kept[id] {
+			delete(s.attachments, id)
+		}
+	}
+
+	for i := range updated.Attachments {
+		a := &updated.Attachments[i]
+		if a.AttachmentID == 0 {
+			s.insertAttachment(updated.UserID, p.id, 0, i, a)
+			continue
+		}
+		current := s.attachments[a.AttachmentID]
+		current.position = i
+		current.AltText = a.AltText
+	}
+
+	editedAt := time.Now()
+	p.content, p.privacy, p.image, p.audience, p.editedAt = updated.Content, updated.Privacy, updated.Image, audience, &editedAt
+	updated.EditedAt = &editedAt
+	s.replaceMentions(models.Target{PostID: p.id}, updated.UserID, updated.Mentions)
+	s.replaceHashtags(models.Target{PostID: p.id}, updated.Hashtags)
+	return nil
+}
+
+func (s *Store) DeletePost(postID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[postID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	comments := make(map[int]bool)
+	for id, c := range s.comments {
+		if c.postID == postID {
+			comments[id] = true
+			delete(s.comments, id)
+		}
+	}
+	revisions := make(map[int]bool)
+	for id, r := range s.revisions {
+		if r.postID == postID {
+			revisions[id] = true
+			delete(s.revisions, id)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, id := range sortedIDs(s.attachments) {
+		a := s.attachments[id]
+		if a.postID == postID || comments[a.commentID] || revisions[a.revisionID] {
+			if !seen[a.Name] {
+				seen[a.Name] = true
+				names = append(names, a.Name)
+			}
+			delete(s.attachments, id)
+		}
+	}
+	s.deleteReactions(func(r *reaction) bool { return r.postID == postID || comments[r.commentID] })
+	s.deleteMentions(func(m *mention) bool { return m.target.PostID == postID || comments[m.target.CommentID] })
+	s.deleteHashtags(func(h *hashtag) bool { return h.target.PostID == postID || comments[h.target.CommentID] })
+	delete(s.posts, postID)
+	return names, nil
+}
+
+func (s *Store) PostRevisions(postID int) ([]models.PostRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var revisions []models.PostRevision
+	for _, id := range sortedIDs(s.revisions) {
+		if r := s.revisions[id]; r.postID == postID {
+			revisions = append(revisions, models.PostRevision{
+				RevisionID:     r.id,
+				PostID:         r.postID,
+				Content:        r.content,
+				Privacy:        r.privacy,
+				SelectedUserID: joinIDs(r.audience),
+				Date:           r.date,
+			})
+		}
+	}
+
+	attachments := s.attachmentsForLocked(func(a *attachment) int { return a.revisionID })
+	for i := range revisions {
+		revisions[i].Attachments = attachments[revisions[i].RevisionID]
+	}
+	return revisions, nil
+}
+
+func (s *Store) FeedPosts(viewerID int, page database.Page) ([]models.Post, database.Cursors, error) {
+	return s.queryPosts(func(p *post) bool {
+		return (p.groupID == 0 || s.carriesTag(p, func(tag string) bool { return s.tagFollows[viewerID][tag] })) && s.visible(p, viewerID)
+	}, page)
+}
+
+func (s *Store) UserPosts(viewerID, userID int, page database.Page) ([]models.Post, database.Cursors, error) {
+	return s.queryPosts(func(p *post) bool {
+		return p.userID == userID && p.groupID == 0 && s.visible(p, viewerID)
+	}, page)
+}
+
+func (s *Store) GroupPosts(viewerID, groupID int, page database.Page) ([]models.Post, database.Cursors, error) {
+	return s.queryPosts(func(p *post) bool {
+		return p.groupID == groupID && s.visible(p, viewerID)
+	}, page)
+}
+
+func (s *Store) ProfilePosts(userID int, page database.Page) ([]models.Post, database.Cursors, error) {
+	return s.queryPosts(func(p *post) bool {
+		return p.userID == userID
+	}, page)
+}
+
+// CanViewImage mirrors the imageVisible query of the SQL stores.
+func (s *Store) CanViewImage(viewerID int, name string) (bool, error) {
+	if name == "" {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Avatar == name {
+			return true, nil
+		}
+	}
+	for _, p := range s.posts {
+		if p.image == name && s.visible(p, viewerID) {
+			return true, nil
+		}
+	}
+	for _, c := range s.comments {
+		if p, ok := s.posts[c.postID]; ok && c.image == name && s.visible(p, viewerID) {
+			return true, nil
+		}
+	}
+	for _, a := range s.attachments {
+		if a.Name == name && s.attachmentVisible(a, viewerID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) attachmentVisible(a *attachment, viewerID int) bool {
+	switch {
+	case a.postID != 0:
+		p, ok := s.posts[a.postID]
+		return ok && s.visible(p, viewerID)
+	case a.commentID != 0:
+		c, ok := s.comments[a.commentID]
+		if !ok {
+			return false
+		}
+		p, ok := s.posts[c.postID]
+		return ok && s.visible(p, viewerID)
+	case a.messageID != 0:
+		m, ok := s.messages[a.messageID]
+		return ok && s.messageVisible(m, viewerID)
+	}
+	return a.userID == viewerID
+}
+
+func (s *Store) ImageInUse(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.imageInUse(name), nil
+}
+
+func (s *Store) imageInUse(name string) bool {
+	for _, p := range s.posts {
+		if p.image == name {
+			return true
+		}
+	}
+	for _, c := range s.comments {
+		if c.image == name {
+			return true
+		}
+	}
+	return s.mediaRefs(name) > 0
+}
+
+func (s *Store) commentModel(c *comment) models.Comment {
+	firstName, lastName := s.name(c.userID)
+	userID := c.userID
+	if c.deleted {
+		userID, firstName, lastName = 0, "", ""
+	}
+	replies := 0
+	for _, r := range s.comments {
+		if r.parentID == c.id {
+			replies++
+		}
+	}
+	return models.Comment{
+		CommentID:  c.id,
+		PostID:     c.postID,
+		UserID:     userID,
+		Comment:    c.comment,
+		FirstName:  firstName,
+		LastName:   lastName,
+		Image:      c.image,
+		Date:       c.date,
+		EditedAt:   c.editedAt,
+		ParentID:   c.parentID,
+		Depth:      c.depth,
+		Deleted:    c.deleted,
+		ReplyCount: replies,
+	}
+}
+
+func (s *Store) CreateComment(c *models.Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.Date = time.Now()
+	c.CommentID = s.nextID("comments")
+	s.comments[c.CommentID] = &comment{
+		id:       c.CommentID,
+		postID:   c.PostID,
+		userID:   c.UserID,
+		parentID: c.ParentID,
+		depth:    c.Depth,
+		comment:  c.Comment,
+		image:    c.Image,
+		date:     c.Date,
+	}
+	s.insertAttachments(c.UserID, 0, c.CommentID, c.Attachments)
+	s.replaceMentions(models.Target{CommentID: c.CommentID}, c.UserID, c.Mentions)
+	s.replaceHashtags(models.Target{CommentID: c.CommentID}, c.Hashtags)
+	return nil
+}
+
+func (s *Store) GetComment(commentID int) (models.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	if !ok {
+		return models.Comment{}, sql.ErrNoRows
+	}
+	return s.commentModel(c), nil
+}
+
+func (s *Store) UpdateComment(updated *models.Comment) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[updated.CommentID]
+	if !ok || c.deleted {
+		return nil, sql.ErrNoRows
+	}
+	kept := make(map[int]bool)
+	for _, a := range updated.Attachments {
+		if a.AttachmentID != 0 {
+			if current, ok := s.attachments[a.AttachmentID]; !ok || current.commentID != c.id {
+				return nil, sql.ErrNoRows
+			}
+			kept[a.AttachmentID] = true
+		}
+	}
+
+	removed := s.deleteCommentAttachments(c.id, kept)
+	for i := range updated.Attachments {
+		a := &updated.Attachments[i]
+		if a.AttachmentID == 0 {
+			s.insertAttachment(updated.UserID, 0, c.id, i, a)
+			continue
+		}
+		current := s.attachments[a.AttachmentID]
+		current.position = i
+		current.AltText = a.AltText
+	}
+
+	editedAt := time.Now()
+	c.comment, c.image, c.editedAt = updated.Comment, updated.Image, &editedAt
+	updated.EditedAt = &editedAt
+	s.replaceMentions(models.Target{CommentID: c.id}, updated.UserID, updated.Mentions)
+	s.replaceHashtags(models.Target{CommentID: c.id}, updated.Hashtags)
+	return removed, nil
+}
+
+// deleteCommentAttachments deletes the attachments of a comment other than
+// those in kept and returns the names of their files.
+func (s *Store) deleteCommentAttachments(commentID int, kept map[int]bool) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, id := range sortedIDs(s.attachments) {
+		a := s.attachments[id]
+		if a.commentID != commentID || kept[id] {
+			continue
+		}
+		if !seen[a.Name] {
+			seen[a.Name] = true
+			names = append(names, a.Name)
+		}
+		delete(s.attachments, id)
+	}
+	return names
+}
+
+func (s *Store) hasReplies(commentID int) bool {
+	for _, c := range s.comments {
+		if c.parentID == commentID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) DeleteComment(commentID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	names := s.deleteCommentAttachments(c.id, nil)
+	if s.hasReplies(c.id) {
+		c.comment, c.image, c.deleted = "", "", true
+		s.deleteMentions(func(m *mention) bool { return m.target.CommentID == c.id })
+		s.deleteHashtags(func(h *hashtag) bool { return h.target.CommentID == c.id })
+		return names, nil
+	}
+
+	delete(s.comments, c.id)
+	removed := map[int]bool{c.id: true}
+	for parent, ok := s.comments[c.parentID]; ok && parent.deleted && !s.hasReplies(parent.id); parent, ok = s.comments[parent.parentID] {
+		delete(s.comments, parent.id)
+		removed[parent.id] = true
+	}
+	s.deleteReactions(func(r *reaction) bool { return removed[r.commentID] })
+	s.deleteMentions(func(m *mention) bool { return removed[m.target.CommentID] })
+	s.deleteHashtags(func(h *hashtag) bool { return removed[h.target.CommentID] })
+	return names, nil
+}
+
+func (s *Store) CommentsForPosts(postIDs []int) (map[int][]models.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int]bool, len(postIDs))
+	for _, id := range postIDs {
+		wanted[id] = true
+	}
+
+	comments := make(map[int][]models.Comment, len(postIDs))
+	for _, id := range sortedIDs(s.comments) {
+		if c := s.comments[id]; wanted[c.postID] {
+			comments[c.postID] = append(comments[c.postID], s.commentModel(c))
+		}
+	}
+	return comments, nil
+}
+
+func (s *Store) PostComments(postID, parentID int, page database.Page) ([]models.Comment, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var comments []models.Comment
+	for _, id := range sortedIDs(s.comments) {
+		if c := s.comments[id]; c.postID == postID && c.parentID == parentID {
+			comments = append(comments, s.commentModel(c))
+		}
+	}
+
+	comments, cursors := paginate(comments, page, func(c models.Comment) int { return c.CommentID }, false)
+	return comments, cursors, nil
+}
+
+func (s *Store) CreateAttachments(userID int, attachments []models.Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insertAttachments(userID, 0, 0, attachments)
+	return nil
+}
+
+func (s *Store) AttachmentsForPosts(postIDs []int) (map[int][]models.Attachment, error) {
+	return s.attachmentsFor(postIDs, func(a *attachment) int { return a.postID })
+}
+
+func (s *Store) AttachmentsForComments(commentIDs []int) (map[int][]models.Attachment, error) {
+	return s.attachmentsFor(commentIDs, func(a *attachment) int { return a.commentID })
+}
+
+func (s *Store) AttachmentsForMessages(messageIDs []int) (map[int][]models.Attachment, error) {
+	return s.attachmentsFor(messageIDs, func(a *attachment) int { return a.messageID })
+}
+
+func (s *Store) attachmentsFor(ids []int, owner func(a *attachment) int) (map[int][]models.Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	return s.attachmentsForLocked(func(a *attachment) int {
+		if wanted[owner(a)] {
+			return owner(a)
+		}
+		return 0
+	}), nil
+}
+
+func (s *Store) attachmentsForLocked(owner func(a *attachment) int) map[int][]models.Attachment {
+	var matched []*attachment
+	for _, id := range sortedIDs(s.attachments) {
+		if a := s.attachments[id]; owner(a) != 0 {
+			matched = append(matched, a)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].position < matched[j].position })
+
+	attachments := make(map[int][]models.Attachment)
+	for _, a := range matched {
+		attachments[owner(a)] = append(attachments[owner(a)], a.Attachment)
+	}
+	return attachments
+}
+
+func (s *Store) DeletePendingAttachments(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id, a := range s.attachments {
+		if a.pending() && a.created.Before(before) {
+			delete(s.attachments, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Media files
+
+func (s *Store) mediaRefs(name string) int {
+	refs := 0
+	for _, u := range s.users {
+		if u.Avatar == name {
+			refs++
+		}
+	}
+	for _, a := range s.attachments {
+		if a.Name == name {
+			refs++
+		}
+	}
+	return refs
+}
+
+func (s *Store) mediaFileByHash(hash string) (string, bool) {
+	for name, f := range s.mediaFiles {
+		if f.hash == hash {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (s *Store) MediaFileByHash(hash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name, ok := s.mediaFileByHash(hash)
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	s.mediaFiles[name].reused = time.Now()
+	return name, nil
+}
+
+func (s *Store) AddMediaFile(file models.MediaFile) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if file.Hash != "" {
+		if name, ok := s.mediaFileByHash(file.Hash); ok {
+			if name != file.Name {
+				s.mediaFiles[name].reused = time.Now()
+			}
+			return name, nil
+		}
+	}
+	if _, ok := s.mediaFiles[file.Name]; !ok {
+		s.mediaFiles[file.Name] = &mediaFile{hash: file.Hash, size: file.Size, created: time.Now()}
+	}
+	return file.Name, nil
+}
+
+func (s *Store) MediaFileSizes() (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sizes := make(map[string]int64, len(s.mediaFiles))
+	for name, f := range s.mediaFiles {
+		sizes[name] = f.size
+	}
+	return sizes, nil
+}
+
+func (s *Store) SetMediaFileSize(name string, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.mediaFiles[name]; ok {
+		f.size = size
+	}
+	return nil
+}
+
+func (s *Store) UnusedMediaFiles(before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for name, f := range s.mediaFiles {
+		if f.created.Before(before) && f.reused.Before(before) && s.mediaRefs(name) == 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return s.mediaFiles[names[i]].created.Before(s.mediaFiles[names[j]].created) })
+	return names, nil
+}
+
+func (s *Store) DeleteMediaFile(name string, reusedBefore time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mediaRefs(name) > 0 {
+		return false, nil
+	}
+	f, ok := s.mediaFiles[name]
+	if !ok {
+		return !s.imageInUse(name), nil
+	}
+	if !f.reused.Before(reusedBefore) {
+		return false, nil
+	}
+	delete(s.mediaFiles, name)
+	return true, nil
+}
+
+// mediaUsage adds up the recorded files the user's attachments and avatar
+// refer to, counting each file once.
+func (s *Store) mediaUsage(u *user) models.MediaUsage {
+	usage := models.MediaUsage{
+		UserID:    u.UserID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		Quota:     u.quota,
+	}
+	names := make(map[string]bool)
+	if u.Avatar != "" {
+		names[u.Avatar] = true
+	}
+	for _, a := range s.attachments {
+		if a.userID == u.UserID {
+			names[a.Name] = true
+		}
+	}
+	for name := range names {
+		if f, ok := s.mediaFiles[name]; ok {
+			usage.Files++
+			usage.Bytes += f.size
+		}
+	}
+	return usage
+}
+
+func (s *Store) MediaUsage(userID int) (models.MediaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return models.MediaUsage{}, sql.ErrNoRows
+	}
+	return s.mediaUsage(u), nil
+}
+
+func (s *Store) MediaUsageReport() ([]models.MediaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var report []models.MediaUsage
+	for _, id := range sortedIDs(s.users) {
+		report = append(report, s.mediaUsage(s.users[id]))
+	}
+	sort.SliceStable(report, func(i, j int) bool { return report[i].Bytes > report[j].Bytes })
+	return report, nil
+}
+
+func (s *Store) SetMediaQuota(userID int, quota *int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	u.quota = quota
+	return nil
+}
+
+// Followers
+
+// removeFollows deletes the follows matching match and reports how many there
+// were.
+func (s *Store) removeFollows(match func(f *follow) bool) int {
+	kept := s.follows[:0]
+	for _, f := range s.follows {
+		if !match(f) {
+			kept = append(kept, f)
+		}
+	}
+	removed := len(s.follows) - len(kept)
+	s.follows = kept
+	return removed
+}
+
+func (s *Store) ToggleFollow(followerID, followingID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.removeFollows(func(f *follow) bool { return f.follower == followerID && f.following == followingID }) > 0 {
+		return nil
+	}
+
+	u, ok := s.users[followingID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	s.follows = append(s.follows, &follow{follower: followerID, following: followingID, pending: !u.Public})
+	return nil
+}
+
+func (s *Store) IsFollowing(userID, followingID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isFollowing(userID, followingID), nil
+}
+
+func (s *Store) IsPending(userID, followingID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.follows {
+		if f.follower == userID && f.following == followingID {
+			return f.pending, nil
+		}
+	}
+	return false, nil
+}
+
+// related lists the users on the other end of follow rows matching match, as
+// the SQL stores do by joining users.
+func (s *Store) related(match func(f *follow) (int, bool)) []models.UserData {
+	var users []models.UserData
+	for _, f := range s.follows {
+		id, ok := match(f)
+		if !ok {
+			continue
+		}
+		if u, exists := s.users[id]; exists {
+			users = append(users, models.UserData{UserID: id, FirstName: u.FirstName, LastName: u.LastName, Public: u.Public})
+		}
+	}
+	return users
+}
+
+func (s *Store) following(userID int) []models.UserData {
+	return s.related(func(f *follow) (int, bool) { return f.following, f.follower == userID && !f.pending })
+}
+
+func (s *Store) followers(userID int) []models.UserData {
+	return s.related(func(f *follow) (int, bool) { return f.follower, f.following == userID && !f.pending })
+}
+
+func (s *Store) Following(userID int) ([]models.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := s.following(userID)
+	for i := range users {
+		users[i].Public = false
+	}
+	return users, nil
+}
+
+func (s *Store) Followers(userID int) ([]models.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.followers(userID), nil
+}
+
+func (s *Store) FollowingPage(userID int, page database.Page) ([]models.UserData, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, cursors := paginate(s.following(userID), page, func(u models.UserData) int { return u.UserID }, false)
+	return users, cursors, nil
+}
+
+func (s *Store) FollowersPage(userID int, page database.Page) ([]models.UserData, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, cursors := paginate(s.followers(userID), page, func(u models.UserData) int { return u.UserID }, false)
+	return users, cursors, nil
+}
+
+func (s *Store) FollowRequests(userID int) ([]models.FollowRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requests []models.FollowRequest
+	for _, f := range s.follows {
+		if f.following == userID && f.pending {
+			// The SQL stores return the requesting user in FollowingID.
+			requests = append(requests, models.FollowRequest{FollowingID: f.follower, RequestPending: true})
+		}
+	}
+	return requests, nil
+}
+
+func (s *Store) AcceptFollower(userID, followerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.follows {
+		if f.following == userID && f.follower == followerID {
+			f.pending = false
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeclineFollower(userID, followerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeFollows(func(f *follow) bool { return f.following == userID && f.follower == followerID })
+	return nil
+}
+
+// Groups
+
+func (s *Store) groupModel(g *group) models.Group {
+	firstName, lastName := s.name(g.userID)
+	return models.Group{
+		GroupID:        g.id,
+		Title:          g.title,
+		Description:    g.description,
+		UserID:         g.userID,
+		FirstName:      firstName,
+		LastName:       lastName,
+		SelectedUserID: joinIDs(g.invitees),
+	}
+}
+
+func (s *Store) CreateGroup(g *models.Group) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitees, err := splitIDs(g.SelectedUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	g.GroupID = s.nextID("groups")
+	s.groups[g.GroupID] = &group{id: g.GroupID, userID: g.UserID, title: g.Title, description: g.Description, invitees: invitees}
+	for _, id := range invitees {
+		s.addMember(&member{groupID: g.GroupID, memberID: id, invitationPending: true})
+	}
+	return g.GroupID, nil
+}
+
+func (s *Store) AllGroups(page database.Page) ([]models.Group, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var groups []models.Group
+	for _, id := range sortedIDs(s.groups) {
+		groups = append(groups, s.groupModel(s.groups[id]))
+	}
+
+	groups, cursors := paginate(groups, page, func(g models.Group) int { return g.GroupID }, false)
+	return groups, cursors, nil
+}
+
+func (s *Store) GetGroup(id int) (*models.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	group := s.groupModel(g)
+	return &group, nil
+}
+
+func (s *Store) GroupIDByTitle(title string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range sortedIDs(s.groups) {
+		if s.groups[id].title == title {
+			return id, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (s *Store) GetGroupCreator(groupID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[groupID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return g.userID, nil
+}
+
+func (s *Store) GetGroupMembers(groupID int) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int
+	for _, m := range s.members {
+		if m.groupID == groupID && !m.requestPending && !m.invitationPending {
+			ids = append(ids, m.memberID)
+		}
+	}
+	return ids, nil
+}
+
+func (s *Store) GroupMemberList(groupID int, page database.Page) ([]models.UserData, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []models.UserData
+	for _, m := range s.members {
+		if m.groupID != groupID || m.requestPending || m.invitationPending {
+			continue
+		}
+		if u, ok := s.users[m.memberID]; ok {
+			users = append(users, models.UserData{UserID: u.UserID, FirstName: u.FirstName, LastName: u.LastName, Public: u.Public})
+		}
+	}
+
+	users, cursors := paginate(users, page, func(u models.UserData) int { return u.UserID }, false)
+	return users, cursors, nil
+}
+
+func (s *Store) findMember(match func(m *member) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.members {
+		if match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) IsMember(userID, groupID int) (bool, error) {
+	return s.findMember(func(m *member) bool { return m.memberID == userID && m.groupID == groupID }), nil
+}
+
+func (s *Store) CheckMembership(userID, groupID int) (bool, error) {
+	return s.IsMember(userID, groupID)
+}
+
+func (s *Store) CheckPending(userID, groupID int) (bool, error) {
+	return s.findMember(func(m *member) bool { return m.memberID == userID && m.groupID == groupID && m.requestPending }), nil
+}
+
+func (s *Store) CheckCreator(userID, groupID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isGroupCreator(userID, groupID), nil
+}
+
+// addMember adds m unless the user already has a membership row for the group,
+// like the unique index on groupmembers.
+func (s *Store) addMember(m *member) {
+	for _, existing := range s.members {
+		if existing.groupID == m.groupID && existing.memberID == m.memberID {
+			return
+		}
+	}
+	s.members = append(s.members, m)
+}
+
+func (s *Store) JoinGroup(userID, groupID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addMember(&member{groupID: groupID, memberID: userID, requestPending: true})
+	return nil
+}
+
+func (s *Store) InviteNewMember(groupMember *models.GroupMembers) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addMember(&member{groupID: groupMember.GroupID, memberID: groupMember.MemberID, invitationPending: true})
+	return nil
+}
+
+func (s *Store) removeMembers(groupID, memberID int) {
+	kept := s.members[:0]
+	for _, m := range s.members {
+		if m.groupID != groupID || m.memberID != memberID {
+			kept = append(kept, m)
+		}
+	}
+	s.members = kept
+}
+
+func (s *Store) LeaveGroup(userID, groupID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeMembers(groupID, userID)
+	return nil
+}
+
+// pendingMembers lists membership rows matching match together with their
+// group, in the shape the SQL stores return from groupmembers joined with groups.
+func (s *Store) pendingMembers(match func(m *member, g *group) bool, pending func(m *member) bool) []models.GroupMembers {
+	var rows []models.GroupMembers
+	for _, m := range s.members {
+		g, ok := s.groups[m.groupID]
+		if !ok || !match(m, g) {
+			continue
+		}
+		rows = append(rows, models.GroupMembers{
+			GroupID:        g.id,
+			GroupTitle:     g.title,
+			GroupCreatorID: g.userID,
+			MemberID:       m.memberID,
+			RequestPending: pending(m),
+		})
+	}
+	return rows
+}
+
+func (s *Store) GroupInvitations(userID int) ([]models.GroupMembers, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pendingMembers(
+		func(m *member, g *group) bool { return m.memberID == userID && m.invitationPending },
+		func(m *member) bool { return m.invitationPending },
+	), nil
+}
+
+func (s *Store) GroupRequests(userID int) ([]models.GroupMembers, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pendingMembers(
+		func(m *member, g *group) bool { return g.userID == userID && m.requestPending },
+		func(m *member) bool { return m.requestPending },
+	), nil
+}
+
+func (s *Store) updateMembers(groupID, memberID int, update func(m *member)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.members {
+		if m.groupID == groupID && m.memberID == memberID {
+			update(m)
+		}
+	}
+}
+
+func (s *Store) AcceptGroupInvitation(groupID, memberID int) error {
+	s.updateMembers(groupID, memberID, func(m *member) { m.invitationPending = false })
+	return nil
+}
+
+func (s *Store) AcceptGroupRequest(groupID, memberID int) error {
+	s.updateMembers(groupID, memberID, func(m *member) { m.requestPending = false })
+	return nil
+}
+
+func (s *Store) DeclineGroupInvitation(groupID, memberID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeMembers(groupID, memberID)
+	return nil
+}
+
+func (s *Store) DeclineGroupRequest(groupID, memberID int) error {
+	return s.DeclineGroupInvitation(groupID, memberID)
+}
+
+// Events
+
+func (s *Store) eventModel(e *event) models.Event {
+	firstName, lastName := s.name(e.userID)
+	return models.Event{
+		EventID:     e.id,
+		Title:       e.title,
+		Description: e.description,
+		UserID:      e.userID,
+		FirstName:   firstName,
+		LastName:    lastName,
+		Time:        e.time,
+		GroupID:     e.groupID,
+	}
+}
+
+func (s *Store) CreateEvent(e *models.Event) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.EventID = s.nextID("events")
+	s.events[e.EventID] = &event{id: e.EventID, userID: e.UserID, groupID: e.GroupID, title: e.Title, description: e.Description, time: e.Time}
+
+	// Accepted members and the group's creator are notified, once each.
+	notified := map[int]bool{}
+	notify := func(userID int) {
+		if !notified[userID] {
+			notified[userID] = true
+			s.notifications = append(s.notifications, &notification{eventID: e.EventID, memberID: userID, groupID: e.GroupID})
+		}
+	}
+	for _, m := range s.members {
+		if m.groupID == e.GroupID && !m.requestPending && !m.invitationPending {
+			notify(m.memberID)
+		}
+	}
+	if g, ok := s.groups[e.GroupID]; ok {
+		notify(g.userID)
+	}
+	return e.EventID, nil
+}
+
+func (s *Store) GetEvent(id int) (*models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.events[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	event := s.eventModel(e)
+	return &event, nil
+}
+
+func (s *Store) GroupEvents(viewerID, groupID int, page database.Page) ([]models.Event, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []models.Event
+	if s.isGroupMember(viewerID, groupID) || s.isGroupCreator(viewerID, groupID) {
+		for _, id := range sortedIDs(s.events) {
+			if e := s.events[id]; e.groupID == groupID {
+				events = append(events, s.eventModel(e))
+			}
+		}
+	}
+
+	events, cursors := paginate(events, page, func(e models.Event) int { return e.EventID }, false)
+	return events, cursors, nil
+}
+
+func (s *Store) GetEventNotifications(userID int) ([]models.EventNotifications, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notifications []models.EventNotifications
+	for _, n := range s.notifications {
+		if n.memberID == userID {
+			notifications = append(notifications, models.EventNotifications{EventID: n.eventID, GroupID: n.groupID})
+		}
+	}
+	return notifications, nil
+}
+
+func (s *Store) DeleteFromEventNotifications(eventID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.notifications[:0]
+	for _, n := range s.notifications {
+		if n.eventID != eventID || n.memberID != userID {
+			kept = append(kept, n)
+		}
+	}
+	s.notifications = kept
+	return nil
+}
+
+func (s *Store) GetParticipants(id int) ([]models.EventParticipants, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var participants []models.EventParticipants
+	for _, p := range s.participants {
+		if p.eventID != id {
+			continue
+		}
+		firstName, lastName := s.name(p.userID)
+		participants = append(participants, models.EventParticipants{
+			EventID:       p.eventID,
+			ParticipantID: p.userID,
+			FirstName:     firstName,
+			LastName:      lastName,
+			Going:         p.going,
+		})
+	}
+	return participants, nil
+}
+
+func (s *Store) RespondToEvent(userID, eventID int, going bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.participants {
+		if p.eventID == eventID && p.userID == userID {
+			p.going = going
+			return nil
+		}
+	}
+	s.participants = append(s.participants, &participant{eventID: eventID, userID: userID, going: going})
+	return nil
+}
+
+func (s *Store) hasAnswer(userID, eventID int, going bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.participants {
+		if p.eventID == eventID && p.userID == userID && p.going == going {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) IsGoing(userID, eventID int) (bool, error) {
+	return s.hasAnswer(userID, eventID, true), nil
+}
+
+func (s *Store) IsNotGoing(userID, eventID int) (bool, error) {
+	return s.hasAnswer(userID, eventID, false), nil
+}
+
+// Messages
+
+func (s *Store) messageModel(m *message) models.Message {
+	firstNameFrom, _ := s.name(m.sender)
+	firstNameTo, _ := s.name(m.recipient)
+	if g, ok := s.groups[m.groupID]; ok {
+		firstNameTo = g.title
+	}
+	return models.Message{
+		MessageID:     m.id,
+		Message:       m.message,
+		UserIDFrom:    m.sender,
+		UserIDTo:      m.recipient,
+		GroupID:       m.groupID,
+		FirstNameFrom: firstNameFrom,
+		FirstNameTo:   firstNameTo,
+		Date:          m.date,
+	}
+}
+
+func (s *Store) AddMessage(msg *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if (msg.UserIDTo == 0) == (msg.GroupID == 0) {
+		return fmt.Errorf("memory: a message needs exactly one of a recipient or a group")
+	}
+
+	pending := make(map[int]bool, len(msg.AttachmentIDs))
+	for _, id := range msg.AttachmentIDs {
+		a, ok := s.attachments[id]
+		if !ok || pending[id] || a.userID != msg.UserIDFrom || !a.pending() {
+			return sql.ErrNoRows
+		}
+		pending[id] = true
+	}
+
+	msg.MessageID = s.nextID("messages")
+	for i, id := range msg.AttachmentIDs {
+		s.attachments[id].messageID = msg.MessageID
+		s.attachments[id].position = i
+	}
+	s.messages[msg.MessageID] = &message{
+		id:        msg.MessageID,
+		sender:    msg.UserIDFrom,
+		recipient: msg.UserIDTo,
+		groupID:   msg.GroupID,
+		message:   msg.Message,
+		date:      msg.Date,
+	}
+	s.replaceMentions(models.Target{MessageID: msg.MessageID}, msg.UserIDFrom, msg.Mentions)
+	return nil
+}
+
+func (s *Store) GetMessage(messageID int) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.messages[messageID]
+	if !ok {
+		return models.Message{}, sql.ErrNoRows
+	}
+	return s.messageModel(m), nil
+}
+
+func (s *Store) queryMessages(match func(m *message) bool, page database.Page) ([]models.Message, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []models.Message
+	for _, id := range sortedIDs(s.messages) {
+		if m := s.messages[id]; match(m) {
+			messages = append(messages, s.messageModel(m))
+		}
+	}
+
+	// Pages run newest first but each page reads oldest first.
+	messages, cursors := paginate(messages, page, func(m models.Message) int { return m.MessageID }, true)
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, cursors, nil
+}
+
+func (s *Store) GetMessages(userID, otherID int, page database.Page) ([]models.Message, database.Cursors, error) {
+	return s.queryMessages(func(m *message) bool {
+		return (m.sender == userID && m.recipient == otherID) || (m.sender == otherID && m.recipient == userID)
+	}, page)
+}
+
+func (s *Store) GetGroupMessages(groupID int, page database.Page) ([]models.Message, database.Cursors, error) {
+	return s.queryMessages(func(m *message) bool {
+		return m.groupID == groupID
+	}, page)
+}
+
+func (s *Store) GetUnreadMessages(userID int) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []models.Message
+	for _, id := range sortedIDs(s.messages) {
+		if m := s.messages[id]; !m.read && m.recipient == userID {
+			messages = append(messages, s.messageModel(m))
+		}
+	}
+	return messages, nil
+}
+
+func (s *Store) MarkMessagesAsRead(userID, senderID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range s.messages {
+		if m.recipient == userID && m.sender == senderID {
+			m.read = true
+		}
+	}
+	return nil
+}
+
+func (s *Store) deleteReactions(match func(r *reaction) bool) {
+	for id, r := range s.reactions {
+		if match(r) {
+			delete(s.reactions, id)
+		}
+	}
+}
+
+// messageVisible mirrors the messageVisible condition of the SQL stores.
+func (s *Store) messageVisible(m *message, userID int) bool {
+	if m.groupID != 0 {
+		return m.sender == userID || s.isGroupMember(userID, m.groupID) || s.isGroupCreator(userID, m.groupID)
+	}
+	return m.sender == userID || m.recipient == userID
+}
+
+// reactionMatch returns whether a reaction is to the target.
+func reactionMatch(target models.Target) func(r *reaction) bool {
+	return func(r *reaction) bool {
+		switch {
+		case target.PostID != 0:
+			return r.postID == target.PostID
+		case target.CommentID != 0:
+			return r.commentID == target.CommentID
+		}
+		return r.messageID == target.MessageID
+	}
+}
+
+func (s *Store) CanReact(userID int, target models.Target) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.targetVisible(target, userID), nil
+}
+
+func (s *Store) WhoCanReact(userIDs []int, target models.Target) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var viewers []int
+	for _, userID := range userIDs {
+		if _, ok := s.users[userID]; ok && s.targetVisible(target, userID) {
+			viewers = append(viewers, userID)
+		}
+	}
+	return viewers, nil
+}
+
+// targetVisible reports whether the user may see the post, comment or
+// message the target names.
+func (s *Store) targetVisible(target models.Target, userID int) bool {
+	switch {
+	case target.PostID != 0:
+		p, ok := s.posts[target.PostID]
+		return ok && s.visible(p, userID)
+	case target.CommentID != 0:
+		c, ok := s.comments[target.CommentID]
+		if !ok || c.deleted {
+			return false
+		}
+		p, ok := s.posts[c.postID]
+		return ok && s.visible(p, userID)
+	}
+	m, ok := s.messages[target.MessageID]
+	return ok && s.messageVisible(m, userID)
+}
+
+func (s *Store) SetReaction(r *models.Reaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match := reactionMatch(r.Target)
+	s.deleteReactions(func(existing *reaction) bool { return existing.userID == r.UserID && match(existing) })
+
+	r.Date = time.Now()
+	if r.Emoji == "" {
+		return nil
+	}
+	r.ReactionID = s.nextID("reactions")
+	s.reactions[r.ReactionID] = &reaction{
+		id:        r.ReactionID,
+		userID:    r.UserID,
+		postID:    r.PostID,
+		commentID: r.CommentID,
+		messageID: r.MessageID,
+		emoji:     r.Emoji,
+		date:      r.Date,
+	}
+	return nil
+}
+
+func (s *Store) ReactionsForPosts(viewerID int, postIDs []int) (map[int]models.Reactions, error) {
+	return s.reactionsFor(viewerID, postIDs, func(r *reaction) int { return r.postID })
+}
+
+func (s *Store) ReactionsForComments(viewerID int, commentIDs []int) (map[int]models.Reactions, error) {
+	return s.reactionsFor(viewerID, commentIDs, func(r *reaction) int { return r.commentID })
+}
+
+func (s *Store) ReactionsForMessages(viewerID int, messageIDs []int) (map[int]models.Reactions, error) {
+	return s.reactionsFor(viewerID, messageIDs, func(r *reaction) int { return r.messageID })
+}
+
+func (s *Store) reactionsFor(viewerID int, ids []int, target func(r *reaction) int) (map[int]models.Reactions, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	reactions := make(map[int]models.Reactions, len(ids))
+	for _, r := range s.reactions {
+		id := target(r)
+		if id == 0 || !wanted[id] {
+			continue
+		}
+		summary := reactions[id]
+		if summary.Counts == nil {
+			summary.Counts = map[string]int{}
+		}
+		summary.Counts[r.emoji]++
+		if r.userID == viewerID {
+			summary.Mine = r.emoji
+		}
+		reactions[id] = summary
+	}
+	return reactions, nil
+}
+
+func (s *Store) Reactors(target models.Target, page database.Page) ([]models.Reaction, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match := reactionMatch(target)
+	var reactions []models.Reaction
+	for _, r := range s.reactions {
+		if !match(r) {
+			continue
+		}
+		reaction := models.Reaction{Target: target, ReactionID: r.id, UserID: r.userID, Emoji: r.emoji, Date: r.date}
+		reaction.FirstName, reaction.LastName = s.name(r.userID)
+		reactions = append(reactions, reaction)
+	}
+
+	reactions, cursors := paginate(reactions, page, func(r models.Reaction) int { return r.ReactionID }, true)
+	return reactions, cursors, nil
+}
+
+func (s *Store) deleteMentions(match func(m *mention) bool) {
+	for id, m := range s.mentions {
+		if match(m) {
+			delete(s.mentions, id)
+		}
+	}
+}
+
+func (s *Store) mentionModel(m *mention) models.Mention {
+	u := s.users[m.userID]
+	return models.Mention{
+		MentionID: m.id,
+		UserID:    m.userID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Nickname:  u.Nickname,
+		Offset:    m.position,
+		Length:    m.length,
+		Date:      m.date,
+	}
+}
+
+func (s *Store) UsersByNicknames(nicknames []string) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]bool, len(nicknames))
+	for _, nickname := range nicknames {
+		wanted[strings.ToLower(nickname)] = true
+	}
+
+	users := make(map[string]int, len(nicknames))
+	for _, id := range sortedIDs(s.users) {
+		nickname := strings.ToLower(s.users[id].Nickname)
+		if _, ok := users[nickname]; nickname != "" && wanted[nickname] && !ok {
+			users[nickname] = id
+		}
+	}
+	return users, nil
+}
+
+// replaceMentions replaces the mentions in the target, written by authorID,
+// keeping those the user has seen marked as seen.
+func (s *Store) replaceMentions(target models.Target, authorID int, mentions []models.Mention) {
+	seen := make(map[int]bool)
+	s.deleteMentions(func(m *mention) bool {
+		if m.target != target {
+			return false
+		}
+		seen[m.userID] = seen[m.userID] || m.seen
+		return true
+	})
+
+	date := time.Now()
+	for i := range mentions {
+		mn := &mentions[i]
+		mn.MentionID, mn.Date = s.nextID("mentions"), date
+		s.mentions[mn.MentionID] = &mention{
+			id:       mn.MentionID,
+			userID:   mn.UserID,
+			authorID: authorID,
+			target:   target,
+			position: mn.Offset,
+			length:   mn.Length,
+			seen:     seen[mn.UserID],
+			date:     date,
+		}
+	}
+}
+
+func (s *Store) MentionsForPosts(postIDs []int) (map[int][]models.Mention, error) {
+	return s.mentionsFor(postIDs, func(m *mention) int { return m.target.PostID })
+}
+
+func (s *Store) MentionsForComments(commentIDs []int) (map[int][]models.Mention, error) {
+	return s.mentionsFor(commentIDs, func(m *mention) int { return m.target.CommentID })
+}
+
+func (s *Store) MentionsForMessages(messageIDs []int) (map[int][]models.Mention, error) {
+	return s.mentionsFor(messageIDs, func(m *mention) int { return m.target.MessageID })
+}
+
+func (s *Store) mentionsFor(ids []int, target func(m *mention) int) (map[int][]models.Mention, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	mentions := make(map[int][]models.Mention, len(ids))
+	for _, mid := range sortedIDs(s.mentions) {
+		m := s.mentions[mid]
+		if id := target(m); id != 0 && wanted[id] {
+			mentions[id] = append(mentions[id], s.mentionModel(m))
+		}
+	}
+	for _, list := range mentions {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Offset < list[j].Offset })
+	}
+	return mentions, nil
+}
+
+func (s *Store) UserMentions(userID int, page database.Page) ([]models.Mention, database.Cursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var mentions []models.Mention
+	for _, m := range s.mentions {
+		if m.userID != userID || m.authorID == userID || !s.targetVisible(m.target, userID) {
+			continue
+		}
+		mention := s.mentionModel(m)
+		mention.Target, mention.Seen = m.target, m.seen
+		mention.AuthorID = m.authorID
+		mention.AuthorFirstName, mention.AuthorLastName = s.name(m.authorID)
+		mentions = append(mentions, mention)
+	}
+
+	mentions, cursors := paginate(mentions, page, func(m models.Mention) int { return m.MentionID }, true)
+	return mentions, cursors, nil
+}
+
+func (s *Store) MarkMentionSeen(userID, mentionID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.mentions[mentionID]
+	if !ok || m.userID != userID {
+		return sql.ErrNoRows
+	}
+	m.seen = true
+	return nil
+}
+
+func (s *Store) deleteHashtags(match func(h *hashtag) bool) {
+	for id, h := range s.hashtags {
+		if match(h) {
+			delete(s.hashtags, id)
+		}
+	}
+}
+
+// carriesTag mirrors the carriesTag condition of the SQL stores.
+func (s *Store) carriesTag(p *post, match func(tag string) bool) bool {
+	for _, h := range s.hashtags {
+		if !match(h.tag) {
+			continue
+		}
+		if h.target.PostID == p.id {
+			return true
+		}
+		if c, ok := s.comments[h.target.CommentID]; ok && c.postID == p.id {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceHashtags replaces the hashtags in a post or comment, keeping the date
+// tags it already had were first used in it.
+func (s *Store) replaceHashtags(target models.Target, hashtags []models.Hashtag) {
+	firstUsed := make(map[string]time.Time)
+	s.deleteHashtags(func(h *hashtag) bool {
+		if h.target != target {
+			return false
+		}
+		if used, ok := firstUsed[h.tag]; !ok || h.date.Before(used) {
+			firstUsed[h.tag] = h.date
+		}
+		return true
+	})
+
+	now := time.Now()
+	for _, h := range hashtags {
+		date, ok := firstUsed[h.Tag]
+		if !ok {
+			date = now
+		}
+		id := s.nextID("hashtags")
+		s.hashtags[id] = &hashtag{id: id, target: target, tag: h.Tag, position: h.Offset, length: h.Length, date: date}
+	}
+}
+
+func (s *Store) HashtagsForPosts(postIDs []int) (map[int][]models.Hashtag, error) {
+	return s.hashtagsFor(postIDs, func(h *hashtag) int { return h.target.PostID })
+}
+
+func (s *Store) HashtagsForComments(commentIDs []int) (map[int][]models.Hashtag, error) {
+	return s.hashtagsFor(commentIDs, func(h *hashtag) int { return h.target.CommentID })
+}
+
+func (s *Store) hashtagsFor(ids []int, target func(h *hashtag) int) (map[int][]models.Hashtag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	hashtags := make(map[int][]models.Hashtag, len(ids))
+	for _, hid := range sortedIDs(s.hashtags) {
+		h := s.hashtags[hid]
+		if id := target(h); id != 0 && wanted[id] {
+			hashtags[id] = append(hashtags[id], models.Hashtag{Tag: h.tag, Offset: h.position, Length: h.length})
+		}
+	}
+	for _, list := range hashtags {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Offset < list[j].Offset })
+	}
+	return hashtags, nil
+}
+
+func (s *Store) TagPosts(viewerID int, tag string, page database.Page) ([]models.Post, database.Cursors, error) {
+	return s.queryPosts(func(p *post) bool {
+		return s.carriesTag(p, func(t string) bool { return t == tag }) && s.visible(p, viewerID)
+	}, page)
+}
+
+func (s *Store) TrendingTags(viewerID int, since time.Time, limit int) ([]models.TrendingTag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type use struct {
+		target models.Target
+		tag    string
+	}
+	counted := make(map[use]bool)
+	users := make(map[string]map[int]bool)
+	counts := make(map[string]int)
+	for _, h := range s.hashtags {
+		if h.date.Before(since) || counted[use{h.target, h.tag}] {
+			continue
+		}
+		var p *post
+		var userID int
+		if c, ok := s.comments[h.target.CommentID]; ok {
+			p, userID = s.posts[c.postID], c.userID
+		} else if p = s.posts[h.target.PostID]; p != nil {
+			userID = p.userID
+		}
+		if p == nil || !s.visible(p, viewerID) {
+			continue
+		}
+		counted[use{h.target, h.tag}] = true
+		counts[h.tag]++
+		if users[h.tag] == nil {
+			users[h.tag] = make(map[int]bool)
+		}
+		users[h.tag][userID] = true
+	}
+
+	tags := make([]models.TrendingTag, 0, len(counts))
+	for tag, n := range counts {
+		tags = append(tags, models.TrendingTag{Tag: tag, Uses: n, Users: len(users[tag])})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Uses != tags[j].Uses {
+			return tags[i].Uses > tags[j].Uses
+		}
+		if tags[i].Users != tags[j].Users {
+			return tags[i].Users > tags[j].Users
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+func (s *Store) SetHashtagFollow(userID int, tag string, following bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !following {
+		delete(s.tagFollows[userID], tag)
+		return nil
+	}
+	if s.tagFollows[userID] == nil {
+		s.tagFollows[userID] = make(map[string]bool)
+	}
+	s.tagFollows[userID][tag] = true
+	return nil
+}
+
+func (s *Store) FollowedHashtags(userID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tags []string
+	for tag := range s.tagFollows[userID] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// Search
+
+// searchField is a column of a row being searched, with how much its matches
+// count for, like the bm25 weights of the SQL stores.
+type searchField struct {
+	text   string
+	weight float64
+}
+
+type searchWord struct {
+	start, end int
+	match      bool
+}
+
+// searchFields matches the terms against the fields of a row the way the
+// full-text indexes do: every term must start a word in one of them. The
+// snippet is cut from the field with the most matches.
+func searchFields(terms []string, fields ...searchField) (string, float64, bool) {
+	matched := make(map[string]bool)
+	var snippet string
+	var rank float64
+	best := 0
+	for _, field := range fields {
+		words, hits := searchWords(field.text, terms, matched)
+		rank += float64(hits) * field.weight
+		if snippet == "" || hits > best {
+			snippet, best = cutSnippet(field.text, words), hits
+		}
+	}
+	return snippet, rank, len(matched) == len(terms)
+}
+
+func searchWords(text string, terms []string, matched map[string]bool) ([]searchWord, int) {
+	var words []searchWord
+	hits, start := 0, -1
+	end := func(i int) {
+		word := searchWord{start: start, end: i}
+		lower := strings.ToLower(text[start:i])
+		for _, term := range terms {
+			if strings.HasPrefix(lower, term) {
+				word.match = true
+				matched[term] = true
+			}
+		}
+		if word.match {
+			hits++
+		}
+		words = append(words, word)
+		start = -1
+	}
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			end(i)
+		}
+	}
+	if start >= 0 {
+		end(len(text))
+	}
+	return words, hits
+}
+
+// cutSnippet marks the matching words of text, keeping at most 16 words
+// around the first one like the snippets of the SQL stores.
+func cutSnippet(text string, words []searchWord) string {
+	const size = 16
+	if len(words) == 0 {
+		return text
+	}
+
+	first, last := 0, len(words)
+	if len(words) > size {
+		for i, w := range words {
+			if w.match {
+				first = i - size/4
+				break
+			}
+		}
+		if first < 0 {
+			first = 0
+		}
+		if first > len(words)-size {
+			first = len(words) - size
+		}
+		last = first + size
+	}
+
+	var b strings.Builder
+	from := 0
+	if first > 0 {
+		b.WriteString("…")
+		from = words[first].start
+	}
+	for _, w := range words[first:last] {
+		b.WriteString(text[from:w.start])
+		if w.match {
+			b.WriteString(entities.HighlightStart + text[w.start:w.end] + entities.HighlightEnd)
+		} else {
+			b.WriteString(text[w.start:w.end])
+		}
+		from = w.end
+	}
+	if last < len(words) {
+		b.WriteString("…")
+	} else {
+		b.WriteString(text[from:])
+	}
+	return b.String()
+}
+
+// searchFilters mirrors the filters of the SQL stores. A type without an
+// author, group or date has 0 or nil for it, which no filter matches.
+func searchFilters(q models.SearchQuery, kind string, author, group int, date *time.Time) bool {
+	if !database.Searches(q, kind) {
+		return false
+	}
+	if (q.AuthorID != 0 && author != q.AuthorID) || (q.GroupID != 0 && group != q.GroupID) {
+		return false
+	}
+	if !q.From.IsZero() && (date == nil || date.Before(q.From)) {
+		return false
+	}
+	if !q.To.IsZero() && (date == nil || !date.Before(q.To)) {
+		return false
+	}
+	return true
+}
+
+func (s *Store) Search(viewerID int, q models.SearchQuery, page database.SearchPage) ([]models.SearchResult, database.SearchCursors, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(q.Terms) == 0 {
+		return nil, database.SearchCursors{}, nil
+	}
+
+	var results []models.SearchResult
+	add := func(result models.SearchResult, fields ...searchField) {
+		snippet, rank, ok := searchFields(q.Terms, fields...)
+		if ok {
+			result.Snippet, result.Rank = snippet, rank
+			results = append(results, result)
+		}
+	}
+
+	for _, id := range sortedIDs(s.users) {
+		u := s.users[id]
+		if !searchFilters(q, models.SearchUser, 0, 0, nil) {
+			continue
+		}
+		fields := []searchField{{u.FirstName + " " + u.LastName + " " + u.Nickname, 4}}
+		if u.Public || id == viewerID || s.isFollowing(viewerID, id) {
+			fields = append(fields, searchField{u.AboutMe, 1})
+		}
+		add(models.SearchResult{Type: models.SearchUser, ID: id, UserID: id, FirstName: u.FirstName, LastName: u.LastName}, fields...)
+	}
+
+	for _, id := range sortedIDs(s.posts) {
+		p := s.posts[id]
+		date := p.date
+		if !searchFilters(q, models.SearchPost, p.userID, p.groupID, &date) || !s.visible(p, viewerID) {
+			continue
+		}
+		firstName, lastName := s.name(p.userID)
+		add(models.SearchResult{Type: models.SearchPost, ID: id, UserID: p.userID, FirstName: firstName, LastName: lastName, GroupID: p.groupID, Date: &date},
+			searchField{p.content, 1})
+	}
+
+	for _, id := range sortedIDs(s.comments) {
+		c := s.comments[id]
+		p, ok := s.posts[c.postID]
+		date := c.date
+		if !ok || c.deleted || !searchFilters(q, models.SearchComment, c.userID, p.groupID, &date) || !s.visible(p, viewerID) {
+			continue
+		}
+		firstName, lastName := s.name(c.userID)
+		add(models.SearchResult{Type: models.SearchComment, ID: id, UserID: c.userID, FirstName: firstName, LastName: lastName, PostID: c.postID, GroupID: p.groupID, Date: &date},
+			searchField{c.comment, 1})
+	}
+
+	for _, id := range sortedIDs(s.groups) {
+		g := s.groups[id]
+		if !searchFilters(q, models.SearchGroup, g.userID, 0, nil) {
+			continue
+		}
+		firstName, lastName := s.name(g.userID)
+		add(models.SearchResult{Type: models.SearchGroup, ID: id, UserID: g.userID, FirstName: firstName, LastName: lastName, Title: g.title, GroupID: id},
+			searchField{g.title, 4}, searchField{g.description, 1})
+	}
+
+	for _, id := range sortedIDs(s.events) {
+		e := s.events[id]
+		if !searchFilters(q, models.SearchEvent, e.userID, e.groupID, nil) || !(s.isGroupMember(viewerID, e.groupID) || s.isGroupCreator(viewerID, e.groupID)) {
+			continue
+		}
+		firstName, lastName := s.name(e.userID)
+		add(models.SearchResult{Type: models.SearchEvent, ID: id, UserID: e.userID, FirstName: firstName, LastName: lastName, Title: e.title, GroupID: e.groupID},
+			searchField{e.title, 4}, searchField{e.description, 1})
+	}
+
+	results, cursors := database.RankResults(results, page)
+	return results, cursors, nil
+}
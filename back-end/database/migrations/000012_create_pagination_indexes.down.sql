@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS `idx_posts_user_id`;
+DROP INDEX IF EXISTS `idx_posts_group_id`;
+DROP INDEX IF EXISTS `idx_comments_post_id`;
+DROP INDEX IF EXISTS `idx_followers_following_id`;
+DROP INDEX IF EXISTS `idx_followers_follower_id`;
+DROP INDEX IF EXISTS `idx_groupmembers_group_id`;
+DROP INDEX IF EXISTS `idx_events_group_id`;
+DROP INDEX IF EXISTS `idx_messages_from_to`;
+DROP INDEX IF EXISTS `idx_messages_to`;
@@ -0,0 +1,9 @@
+CREATE INDEX IF NOT EXISTS `idx_posts_user_id` ON `posts` (`user_id`, `post_id`);
+CREATE INDEX IF NOT EXISTS `idx_posts_group_id` ON `posts` (`group_id`, `post_id`);
+CREATE INDEX IF NOT EXISTS `idx_comments_post_id` ON `comments` (`post_id`, `comment_id`);
+CREATE INDEX IF NOT EXISTS `idx_followers_following_id` ON `followers` (`following_id`, `follower_id`);
+CREATE INDEX IF NOT EXISTS `idx_followers_follower_id` ON `followers` (`follower_id`, `following_id`);
+CREATE INDEX IF NOT EXISTS `idx_groupmembers_group_id` ON `groupmembers` (`group_id`, `member_id`);
+CREATE INDEX IF NOT EXISTS `idx_events_group_id` ON `events` (`group_id`, `event_id`);
+CREATE INDEX IF NOT EXISTS `idx_messages_from_to` ON `messages` (`first_name_from`, `first_name_to`, `messageID`);
+CREATE INDEX IF NOT EXISTS `idx_messages_to` ON `messages` (`first_name_to`, `messageID`);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS `idx_groups_user_id`;
+DROP INDEX IF EXISTS `idx_groupmembers_member_id`;
+DROP TABLE IF EXISTS `post_audience`;
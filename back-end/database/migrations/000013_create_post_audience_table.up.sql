@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS `post_audience` (
+    `post_id`       INTEGER NOT NULL,
+    `user_id`       INTEGER NOT NULL,
+    PRIMARY KEY (`post_id`, `user_id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_post_audience_user_id` ON `post_audience` (`user_id`, `post_id`);
+CREATE INDEX IF NOT EXISTS `idx_groupmembers_member_id` ON `groupmembers` (`member_id`, `group_id`);
+CREATE INDEX IF NOT EXISTS `idx_groups_user_id` ON `groups` (`user_id`);
+
+WITH RECURSIVE `split` (`post_id`, `user_id`, `rest`) AS (
+    SELECT `post_id`, '', `selected_user_id` || ',' FROM `posts`
+    WHERE `privacy` = 'for-selected-users' AND `selected_user_id` <> ''
+    UNION ALL
+    SELECT `post_id`, trim(substr(`rest`, 1, instr(`rest`, ',') - 1)), substr(`rest`, instr(`rest`, ',') + 1) FROM `split`
+    WHERE `rest` <> ''
+)
+INSERT OR IGNORE INTO `post_audience` (`post_id`, `user_id`)
+SELECT `post_id`, CAST(`user_id` AS INTEGER) FROM `split` WHERE `user_id` <> '';
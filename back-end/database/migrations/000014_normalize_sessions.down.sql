@@ -0,0 +1,14 @@
+CREATE TABLE `sessions_old` (
+    `user_id` 			INTEGER,
+    `email` 			TEXT NOT NULL,
+    `first_name` 		TEXT NOT NULL,
+    `last_name` 		TEXT NOT NULL,
+    `cookie`			TEXT NOT NULL
+);
+
+INSERT INTO `sessions_old` (`user_id`, `email`, `first_name`, `last_name`, `cookie`)
+SELECT s.`user_id`, u.`email`, u.`first_name`, u.`last_name`, s.`cookie`
+FROM `sessions` s JOIN `users` u ON u.`user_id` = s.`user_id`;
+
+DROP TABLE `sessions`;
+ALTER TABLE `sessions_old` RENAME TO `sessions`;
@@ -0,0 +1,16 @@
+-- Sessions only need to point at a user; names and email are read from users.
+CREATE TABLE `sessions_new` (
+    `session_id`    INTEGER PRIMARY KEY AUTOINCREMENT,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `cookie`        TEXT NOT NULL
+);
+
+INSERT INTO `sessions_new` (`user_id`, `cookie`)
+SELECT `user_id`, `cookie` FROM `sessions`
+WHERE `user_id` IN (SELECT `user_id` FROM `users`);
+
+DROP TABLE `sessions`;
+ALTER TABLE `sessions_new` RENAME TO `sessions`;
+
+CREATE INDEX `idx_sessions_cookie` ON `sessions` (`cookie`);
+CREATE INDEX `idx_sessions_user_id` ON `sessions` (`user_id`);
@@ -0,0 +1,41 @@
+CREATE TABLE `groups_old` (
+    `group_id`		INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+    `title`		    TEXT NOT NULL,
+    `description`	TEXT NOT NULL,
+    `user_id` 		INTEGER,
+	`first_name` 	TEXT NOT NULL,
+	`last_name` 	TEXT NOT NULL,
+    `selected_user_id` 	    TEXT
+);
+
+INSERT INTO `groups_old` (`group_id`, `title`, `description`, `user_id`, `first_name`, `last_name`, `selected_user_id`)
+SELECT g.`group_id`, g.`title`, g.`description`, g.`user_id`, u.`first_name`, u.`last_name`,
+    COALESCE((SELECT group_concat(i.`user_id`) FROM `group_invitees` i WHERE i.`group_id` = g.`group_id`), '')
+FROM `groups` g JOIN `users` u ON u.`user_id` = g.`user_id`;
+
+CREATE TABLE `groupmembers_old` (
+    `id`                INTEGER PRIMARY KEY AUTOINCREMENT,
+	`group_id`		INTEGER,
+    `group_title`		TEXT,
+    `group_creator_id`		INTEGER,
+    `member_id`		INTEGER,
+    `request_pending`   BOOLEAN NOT NULL,
+    `invitation_pending`   BOOLEAN NOT NULL
+);
+
+INSERT INTO `groupmembers_old` (`id`, `group_id`, `group_title`, `group_creator_id`, `member_id`, `request_pending`, `invitation_pending`)
+SELECT gm.`id`, gm.`group_id`, g.`title`, g.`user_id`, gm.`member_id`, gm.`request_pending`, gm.`invitation_pending`
+FROM `groupmembers` gm JOIN `groups` g ON g.`group_id` = gm.`group_id`;
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'groups') WHERE `name` = 'groups_old';
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'groupmembers') WHERE `name` = 'groupmembers_old';
+
+DROP TABLE `groupmembers`;
+DROP TABLE `group_invitees`;
+DROP TABLE `groups`;
+ALTER TABLE `groups_old` RENAME TO `groups`;
+ALTER TABLE `groupmembers_old` RENAME TO `groupmembers`;
+
+CREATE INDEX `idx_groups_user_id` ON `groups` (`user_id`);
+CREATE INDEX `idx_groupmembers_group_id` ON `groupmembers` (`group_id`, `member_id`);
+CREATE INDEX `idx_groupmembers_member_id` ON `groupmembers` (`member_id`, `group_id`);
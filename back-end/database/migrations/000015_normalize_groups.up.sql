@@ -0,0 +1,59 @@
+-- Groups reference their creator by ID only, and the invitees picked when the
+-- group was created move from comma-separated text into group_invitees.
+-- groupmembers drops its copies of the group title and creator.
+CREATE TABLE `groups_new` (
+    `group_id`      INTEGER PRIMARY KEY AUTOINCREMENT,
+    `title`         TEXT NOT NULL,
+    `description`   TEXT NOT NULL,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE
+);
+
+INSERT INTO `groups_new` (`group_id`, `title`, `description`, `user_id`)
+SELECT `group_id`, `title`, `description`, `user_id` FROM `groups`
+WHERE `user_id` IN (SELECT `user_id` FROM `users`);
+
+CREATE TABLE `group_invitees` (
+    `group_id`      INTEGER NOT NULL REFERENCES `groups_new` (`group_id`) ON DELETE CASCADE,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    PRIMARY KEY (`group_id`, `user_id`)
+);
+
+WITH RECURSIVE `split` (`group_id`, `user_id`, `rest`) AS (
+    SELECT `group_id`, '', `selected_user_id` || ',' FROM `groups`
+    WHERE `selected_user_id` <> ''
+    UNION ALL
+    SELECT `group_id`, trim(substr(`rest`, 1, instr(`rest`, ',') - 1)), substr(`rest`, instr(`rest`, ',') + 1) FROM `split`
+    WHERE `rest` <> ''
+)
+INSERT OR IGNORE INTO `group_invitees` (`group_id`, `user_id`)
+SELECT `group_id`, CAST(`user_id` AS INTEGER) FROM `split`
+WHERE `user_id` <> ''
+    AND `group_id` IN (SELECT `group_id` FROM `groups_new`)
+    AND CAST(`user_id` AS INTEGER) IN (SELECT `user_id` FROM `users`);
+
+CREATE TABLE `groupmembers_new` (
+    `id`                    INTEGER PRIMARY KEY AUTOINCREMENT,
+    `group_id`              INTEGER NOT NULL REFERENCES `groups_new` (`group_id`) ON DELETE CASCADE,
+    `member_id`             INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `request_pending`       BOOLEAN NOT NULL,
+    `invitation_pending`    BOOLEAN NOT NULL
+);
+
+INSERT INTO `groupmembers_new` (`id`, `group_id`, `member_id`, `request_pending`, `invitation_pending`)
+SELECT `id`, `group_id`, `member_id`, `request_pending`, `invitation_pending` FROM `groupmembers`
+WHERE `group_id` IN (SELECT `group_id` FROM `groups_new`)
+    AND `member_id` IN (SELECT `user_id` FROM `users`);
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'groups') WHERE `name` = 'groups_new';
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'groupmembers') WHERE `name` = 'groupmembers_new';
+
+DROP TABLE `groupmembers`;
+DROP TABLE `groups`;
+ALTER TABLE `groups_new` RENAME TO `groups`;
+ALTER TABLE `groupmembers_new` RENAME TO `groupmembers`;
+
+CREATE INDEX `idx_groups_user_id` ON `groups` (`user_id`);
+CREATE INDEX `idx_groups_title` ON `groups` (`title`);
+CREATE INDEX `idx_group_invitees_user_id` ON `group_invitees` (`user_id`);
+CREATE INDEX `idx_groupmembers_group_id` ON `groupmembers` (`group_id`, `member_id`);
+CREATE INDEX `idx_groupmembers_member_id` ON `groupmembers` (`member_id`, `group_id`);
@@ -0,0 +1,56 @@
+CREATE TABLE `posts_old` (
+    `post_id`		INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+    `user_id` 		INTEGER,
+    `content`		TEXT NOT NULL,
+	`first_name` 	TEXT NOT NULL,
+	`last_name` 	TEXT NOT NULL,
+    `privacy` 	    TEXT NOT NULL,
+    `selected_user_id` 	    TEXT,
+    `image` 	    TEXT,
+    `date` 	        DATETIME,
+    `group_id` 	    INTEGER
+);
+
+INSERT INTO `posts_old` (`post_id`, `user_id`, `content`, `first_name`, `last_name`, `privacy`, `selected_user_id`, `image`, `date`, `group_id`)
+SELECT p.`post_id`, p.`user_id`, p.`content`, u.`first_name`, u.`last_name`, p.`privacy`,
+    COALESCE((SELECT group_concat(a.`user_id`) FROM `post_audience` a WHERE a.`post_id` = p.`post_id`), ''),
+    p.`image`, p.`date`, COALESCE(p.`group_id`, 0)
+FROM `posts` p JOIN `users` u ON u.`user_id` = p.`user_id`;
+
+CREATE TABLE `post_audience_old` (
+    `post_id`       INTEGER NOT NULL,
+    `user_id`       INTEGER NOT NULL,
+    PRIMARY KEY (`post_id`, `user_id`)
+);
+
+INSERT INTO `post_audience_old` (`post_id`, `user_id`) SELECT `post_id`, `user_id` FROM `post_audience`;
+
+CREATE TABLE `comments_old` (
+    `comment_id`	INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+    `post_id` 		INTEGER,
+    `user_id` 		INTEGER,
+    `comment`		TEXT NOT NULL,
+	`first_name` 	TEXT NOT NULL,
+	`last_name` 	TEXT NOT NULL,
+    `image` 	    TEXT,
+    `date` 	        DATETIME
+);
+
+INSERT INTO `comments_old` (`comment_id`, `post_id`, `user_id`, `comment`, `first_name`, `last_name`, `image`, `date`)
+SELECT c.`comment_id`, c.`post_id`, c.`user_id`, c.`comment`, u.`first_name`, u.`last_name`, c.`image`, c.`date`
+FROM `comments` c JOIN `users` u ON u.`user_id` = c.`user_id`;
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'posts') WHERE `name` = 'posts_old';
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'comments') WHERE `name` = 'comments_old';
+
+DROP TABLE `comments`;
+DROP TABLE `post_audience`;
+DROP TABLE `posts`;
+ALTER TABLE `posts_old` RENAME TO `posts`;
+ALTER TABLE `post_audience_old` RENAME TO `post_audience`;
+ALTER TABLE `comments_old` RENAME TO `comments`;
+
+CREATE INDEX `idx_posts_user_id` ON `posts` (`user_id`, `post_id`);
+CREATE INDEX `idx_posts_group_id` ON `posts` (`group_id`, `post_id`);
+CREATE INDEX `idx_post_audience_user_id` ON `post_audience` (`user_id`, `post_id`);
+CREATE INDEX `idx_comments_post_id` ON `comments` (`post_id`, `comment_id`);
@@ -0,0 +1,58 @@
+-- Posts and comments reference their author by ID only. Ungrouped posts get a
+-- NULL group_id instead of 0 so group_id can be a foreign key, and the
+-- audience of for-selected-users posts lives only in post_audience.
+CREATE TABLE `posts_new` (
+    `post_id`       INTEGER PRIMARY KEY AUTOINCREMENT,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `content`       TEXT NOT NULL,
+    `privacy`       TEXT NOT NULL,
+    `image`         TEXT,
+    `date`          DATETIME,
+    `group_id`      INTEGER REFERENCES `groups` (`group_id`) ON DELETE CASCADE
+);
+
+INSERT INTO `posts_new` (`post_id`, `user_id`, `content`, `privacy`, `image`, `date`, `group_id`)
+SELECT `post_id`, `user_id`, `content`, `privacy`, `image`, `date`, NULLIF(`group_id`, 0) FROM `posts`
+WHERE `user_id` IN (SELECT `user_id` FROM `users`)
+    AND (COALESCE(`group_id`, 0) = 0 OR `group_id` IN (SELECT `group_id` FROM `groups`));
+
+CREATE TABLE `post_audience_new` (
+    `post_id`       INTEGER NOT NULL REFERENCES `posts_new` (`post_id`) ON DELETE CASCADE,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    PRIMARY KEY (`post_id`, `user_id`)
+);
+
+INSERT INTO `post_audience_new` (`post_id`, `user_id`)
+SELECT `post_id`, `user_id` FROM `post_audience`
+WHERE `post_id` IN (SELECT `post_id` FROM `posts_new`)
+    AND `user_id` IN (SELECT `user_id` FROM `users`);
+
+CREATE TABLE `comments_new` (
+    `comment_id`    INTEGER PRIMARY KEY AUTOINCREMENT,
+    `post_id`       INTEGER NOT NULL REFERENCES `posts_new` (`post_id`) ON DELETE CASCADE,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `comment`       TEXT NOT NULL,
+    `image`         TEXT,
+    `date`          DATETIME
+);
+
+INSERT INTO `comments_new` (`comment_id`, `post_id`, `user_id`, `comment`, `image`, `date`)
+SELECT `comment_id`, `post_id`, `user_id`, `comment`, `image`, `date` FROM `comments`
+WHERE `post_id` IN (SELECT `post_id` FROM `posts_new`)
+    AND `user_id` IN (SELECT `user_id` FROM `users`);
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'posts') WHERE `name` = 'posts_new';
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'comments') WHERE `name` = 'comments_new';
+
+DROP TABLE `comments`;
+DROP TABLE `post_audience`;
+DROP TABLE `posts`;
+ALTER TABLE `posts_new` RENAME TO `posts`;
+ALTER TABLE `post_audience_new` RENAME TO `post_audience`;
+ALTER TABLE `comments_new` RENAME TO `comments`;
+
+CREATE INDEX `idx_posts_user_id` ON `posts` (`user_id`, `post_id`);
+CREATE INDEX `idx_posts_group_id` ON `posts` (`group_id`, `post_id`);
+CREATE INDEX `idx_post_audience_user_id` ON `post_audience` (`user_id`, `post_id`);
+CREATE INDEX `idx_comments_post_id` ON `comments` (`post_id`, `comment_id`);
+CREATE INDEX `idx_comments_user_id` ON `comments` (`user_id`);
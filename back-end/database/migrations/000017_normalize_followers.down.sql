@@ -0,0 +1,17 @@
+CREATE TABLE `followers_old` (
+    `id`                INTEGER PRIMARY KEY AUTOINCREMENT,
+	`follower_id`		INTEGER,
+    `following_id`		INTEGER,
+    `request_pending`   BOOLEAN NOT NULL
+);
+
+INSERT INTO `followers_old` (`id`, `follower_id`, `following_id`, `request_pending`)
+SELECT `id`, `follower_id`, `following_id`, `request_pending` FROM `followers`;
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'followers') WHERE `name` = 'followers_old';
+
+DROP TABLE `followers`;
+ALTER TABLE `followers_old` RENAME TO `followers`;
+
+CREATE INDEX `idx_followers_following_id` ON `followers` (`following_id`, `follower_id`);
+CREATE INDEX `idx_followers_follower_id` ON `followers` (`follower_id`, `following_id`);
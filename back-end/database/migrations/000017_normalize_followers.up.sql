@@ -0,0 +1,19 @@
+CREATE TABLE `followers_new` (
+    `id`                INTEGER PRIMARY KEY AUTOINCREMENT,
+    `follower_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `following_id`      INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `request_pending`   BOOLEAN NOT NULL
+);
+
+INSERT INTO `followers_new` (`id`, `follower_id`, `following_id`, `request_pending`)
+SELECT `id`, `follower_id`, `following_id`, `request_pending` FROM `followers`
+WHERE `follower_id` IN (SELECT `user_id` FROM `users`)
+    AND `following_id` IN (SELECT `user_id` FROM `users`);
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'followers') WHERE `name` = 'followers_new';
+
+DROP TABLE `followers`;
+ALTER TABLE `followers_new` RENAME TO `followers`;
+
+CREATE INDEX `idx_followers_following_id` ON `followers` (`following_id`, `follower_id`);
+CREATE INDEX `idx_followers_follower_id` ON `followers` (`follower_id`, `following_id`);
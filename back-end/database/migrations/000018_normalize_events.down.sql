@@ -0,0 +1,50 @@
+CREATE TABLE `events_old` (
+    `event_id`          INTEGER PRIMARY KEY AUTOINCREMENT,
+    `title`		        TEXT,
+    `description`		TEXT,
+    `user_id` 		    INTEGER,
+	`first_name` 	    TEXT NOT NULL,
+	`last_name` 	    TEXT NOT NULL,
+    `time`		        TEXT NOT NULL,
+    `group_id`		    INTEGER
+);
+
+INSERT INTO `events_old` (`event_id`, `title`, `description`, `user_id`, `first_name`, `last_name`, `time`, `group_id`)
+SELECT e.`event_id`, e.`title`, e.`description`, e.`user_id`, u.`first_name`, u.`last_name`, e.`time`, e.`group_id`
+FROM `events` e JOIN `users` u ON u.`user_id` = e.`user_id`;
+
+CREATE TABLE `eventparticipants_old` (
+    `id`                INTEGER PRIMARY KEY AUTOINCREMENT,
+	`event_id`		    INTEGER,
+    `participant_id`	INTEGER,
+    `first_name` 	    TEXT NOT NULL,
+	`last_name` 	    TEXT NOT NULL,
+    `going`             BOOLEAN NOT NULL
+);
+
+INSERT INTO `eventparticipants_old` (`id`, `event_id`, `participant_id`, `first_name`, `last_name`, `going`)
+SELECT p.`id`, p.`event_id`, p.`participant_id`, u.`first_name`, u.`last_name`, p.`going`
+FROM `eventparticipants` p JOIN `users` u ON u.`user_id` = p.`participant_id`;
+
+CREATE TABLE `eventnotifications_old` (
+    `id`                INTEGER PRIMARY KEY AUTOINCREMENT,
+	`event_id`		    INTEGER,
+    `member_id`	        INTEGER,
+    `group_id`	        INTEGER
+);
+
+INSERT INTO `eventnotifications_old` (`id`, `event_id`, `member_id`, `group_id`)
+SELECT `id`, `event_id`, `member_id`, `group_id` FROM `eventnotifications`;
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'events') WHERE `name` = 'events_old';
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'eventparticipants') WHERE `name` = 'eventparticipants_old';
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'eventnotifications') WHERE `name` = 'eventnotifications_old';
+
+DROP TABLE `eventnotifications`;
+DROP TABLE `eventparticipants`;
+DROP TABLE `events`;
+ALTER TABLE `events_old` RENAME TO `events`;
+ALTER TABLE `eventparticipants_old` RENAME TO `eventparticipants`;
+ALTER TABLE `eventnotifications_old` RENAME TO `eventnotifications`;
+
+CREATE INDEX `idx_events_group_id` ON `events` (`group_id`, `event_id`);
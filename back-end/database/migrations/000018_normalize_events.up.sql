@@ -0,0 +1,58 @@
+-- Events and their participants reference people by ID only.
+CREATE TABLE `events_new` (
+    `event_id`      INTEGER PRIMARY KEY AUTOINCREMENT,
+    `title`         TEXT,
+    `description`   TEXT,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `time`          TEXT NOT NULL,
+    `group_id`      INTEGER NOT NULL REFERENCES `groups` (`group_id`) ON DELETE CASCADE
+);
+
+INSERT INTO `events_new` (`event_id`, `title`, `description`, `user_id`, `time`, `group_id`)
+SELECT `event_id`, `title`, `description`, `user_id`, `time`, `group_id` FROM `events`
+WHERE `user_id` IN (SELECT `user_id` FROM `users`)
+    AND `group_id` IN (SELECT `group_id` FROM `groups`);
+
+CREATE TABLE `eventparticipants_new` (
+    `id`                INTEGER PRIMARY KEY AUTOINCREMENT,
+    `event_id`          INTEGER NOT NULL REFERENCES `events_new` (`event_id`) ON DELETE CASCADE,
+    `participant_id`    INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `going`             BOOLEAN NOT NULL
+);
+
+INSERT INTO `eventparticipants_new` (`id`, `event_id`, `participant_id`, `going`)
+SELECT `id`, `event_id`, `participant_id`, `going` FROM `eventparticipants`
+WHERE `event_id` IN (SELECT `event_id` FROM `events_new`)
+    AND `participant_id` IN (SELECT `user_id` FROM `users`);
+
+CREATE TABLE `eventnotifications_new` (
+    `id`            INTEGER PRIMARY KEY AUTOINCREMENT,
+    `event_id`      INTEGER NOT NULL REFERENCES `events_new` (`event_id`) ON DELETE CASCADE,
+    `member_id`     INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `group_id`      INTEGER NOT NULL REFERENCES `groups` (`group_id`) ON DELETE CASCADE
+);
+
+INSERT INTO `eventnotifications_new` (`id`, `event_id`, `member_id`, `group_id`)
+SELECT `id`, `event_id`, `member_id`, `group_id` FROM `eventnotifications`
+WHERE `event_id` IN (SELECT `event_id` FROM `events_new`)
+    AND `member_id` IN (SELECT `user_id` FROM `users`)
+    AND `group_id` IN (SELECT `group_id` FROM `groups`);
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'events') WHERE `name` = 'events_new';
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'eventparticipants') WHERE `name` = 'eventparticipants_new';
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'eventnotifications') WHERE `name` = 'eventnotifications_new';
+
+DROP TABLE `eventnotifications`;
+DROP TABLE `eventparticipants`;
+DROP TABLE `events`;
+ALTER TABLE `events_new` RENAME TO `events`;
+ALTER TABLE `eventparticipants_new` RENAME TO `eventparticipants`;
+ALTER TABLE `eventnotifications_new` RENAME TO `eventnotifications`;
+
+CREATE INDEX `idx_events_group_id` ON `events` (`group_id`, `event_id`);
+CREATE INDEX `idx_events_user_id` ON `events` (`user_id`);
+CREATE INDEX `idx_eventparticipants_event_id` ON `eventparticipants` (`event_id`, `participant_id`);
+CREATE INDEX `idx_eventparticipants_participant_id` ON `eventparticipants` (`participant_id`);
+CREATE INDEX `idx_eventnotifications_member_id` ON `eventnotifications` (`member_id`, `event_id`);
+CREATE INDEX `idx_eventnotifications_event_id` ON `eventnotifications` (`event_id`);
+CREATE INDEX `idx_eventnotifications_group_id` ON `eventnotifications` (`group_id`);
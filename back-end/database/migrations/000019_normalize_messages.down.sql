@@ -0,0 +1,25 @@
+DROP INDEX IF EXISTS `idx_users_first_name`;
+
+CREATE TABLE `messages_old` (
+    `messageID`				INTEGER PRIMARY KEY AUTOINCREMENT UNIQUE,
+    `message`			    TEXT,
+    `first_name_from`	    TEXT,
+    `first_name_to`			TEXT,
+    `date`       			DATETIME,
+    `read`          		INTEGER DEFAULT 0
+);
+
+INSERT INTO `messages_old` (`messageID`, `message`, `first_name_from`, `first_name_to`, `date`, `read`)
+SELECT m.`message_id`, m.`message`, s.`first_name`, COALESCE(r.`first_name`, g.`title`), m.`date`, m.`read`
+FROM `messages` m
+JOIN `users` s ON s.`user_id` = m.`sender_id`
+LEFT JOIN `users` r ON r.`user_id` = m.`recipient_id`
+LEFT JOIN `groups` g ON g.`group_id` = m.`group_id`;
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'messages') WHERE `name` = 'messages_old';
+
+DROP TABLE `messages`;
+ALTER TABLE `messages_old` RENAME TO `messages`;
+
+CREATE INDEX `idx_messages_from_to` ON `messages` (`first_name_from`, `first_name_to`, `messageID`);
+CREATE INDEX `idx_messages_to` ON `messages` (`first_name_to`, `messageID`);
@@ -0,0 +1,37 @@
+-- Messages used to name both ends by first name, with group chats using the
+-- group title as the recipient. They now reference a sender and either a
+-- recipient user or a group by ID. Existing rows are matched by name, taking
+-- the oldest account or group when names repeat; a recipient name matching a
+-- group title is treated as a group message. Rows whose sender or recipient
+-- cannot be found are dropped.
+CREATE TABLE `messages_new` (
+    `message_id`    INTEGER PRIMARY KEY AUTOINCREMENT,
+    `sender_id`     INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `recipient_id`  INTEGER REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `group_id`      INTEGER REFERENCES `groups` (`group_id`) ON DELETE CASCADE,
+    `message`       TEXT NOT NULL,
+    `date`          DATETIME,
+    `read`          INTEGER NOT NULL DEFAULT 0,
+    CHECK ((`recipient_id` IS NULL) <> (`group_id` IS NULL))
+);
+
+INSERT INTO `messages_new` (`message_id`, `sender_id`, `recipient_id`, `group_id`, `message`, `date`, `read`)
+SELECT `messageID`, `sender_id`, CASE WHEN `to_group_id` IS NULL THEN `to_user_id` END, `to_group_id`, COALESCE(`message`, ''), `date`, COALESCE(`read`, 0)
+FROM (
+    SELECT m.*,
+        (SELECT MIN(`user_id`) FROM `users` WHERE `first_name` = m.`first_name_from`) AS `sender_id`,
+        (SELECT MIN(`user_id`) FROM `users` WHERE `first_name` = m.`first_name_to`) AS `to_user_id`,
+        (SELECT MIN(`group_id`) FROM `groups` WHERE `title` = m.`first_name_to`) AS `to_group_id`
+    FROM `messages` m
+)
+WHERE `sender_id` IS NOT NULL AND (`to_user_id` IS NOT NULL OR `to_group_id` IS NOT NULL);
+
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'messages') WHERE `name` = 'messages_new';
+
+DROP TABLE `messages`;
+ALTER TABLE `messages_new` RENAME TO `messages`;
+
+CREATE INDEX `idx_messages_sender_recipient` ON `messages` (`sender_id`, `recipient_id`, `message_id`);
+CREATE INDEX `idx_messages_recipient` ON `messages` (`recipient_id`, `read`);
+CREATE INDEX `idx_messages_group_id` ON `messages` (`group_id`, `message_id`);
+CREATE INDEX `idx_users_first_name` ON `users` (`first_name`);
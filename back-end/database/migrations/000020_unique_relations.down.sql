@@ -0,0 +1,8 @@
+DROP INDEX `idx_followers_follower_id`;
+CREATE INDEX `idx_followers_follower_id` ON `followers` (`follower_id`, `following_id`);
+
+DROP INDEX `idx_groupmembers_group_id`;
+CREATE INDEX `idx_groupmembers_group_id` ON `groupmembers` (`group_id`, `member_id`);
+
+DROP INDEX `idx_eventparticipants_event_id`;
+CREATE INDEX `idx_eventparticipants_event_id` ON `eventparticipants` (`event_id`, `participant_id`);
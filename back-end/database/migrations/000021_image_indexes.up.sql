@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS `idx_users_avatar` ON `users` (`avatar`);
+CREATE INDEX IF NOT EXISTS `idx_posts_image` ON `posts` (`image`);
+CREATE INDEX IF NOT EXISTS `idx_comments_image` ON `comments` (`image`);
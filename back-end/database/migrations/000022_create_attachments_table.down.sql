@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS `idx_attachments_post_id`;
+DROP INDEX IF EXISTS `idx_attachments_comment_id`;
+DROP INDEX IF EXISTS `idx_attachments_message_id`;
+DROP INDEX IF EXISTS `idx_attachments_name`;
+DROP INDEX IF EXISTS `idx_attachments_user_id`;
+DROP TABLE IF EXISTS `attachments`;
@@ -0,0 +1,53 @@
+-- Posts, comments and chat messages carry any number of ordered files. A file
+-- belongs to at most one of them; files with no owner yet were uploaded for a
+-- chat message that has not been sent. The single image of existing posts and
+-- comments becomes their first attachment, and the image columns keep the
+-- first image for older clients.
+CREATE TABLE IF NOT EXISTS `attachments` (
+    `attachment_id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `post_id`       INTEGER REFERENCES `posts` (`post_id`) ON DELETE CASCADE,
+    `comment_id`    INTEGER REFERENCES `comments` (`comment_id`) ON DELETE CASCADE,
+    `message_id`    INTEGER REFERENCES `messages` (`message_id`) ON DELETE CASCADE,
+    `position`      INTEGER NOT NULL DEFAULT 0,
+    `name`          TEXT NOT NULL,
+    `mime_type`     TEXT NOT NULL,
+    `alt_text`      TEXT NOT NULL DEFAULT '',
+    `width`         INTEGER NOT NULL DEFAULT 0,
+    `height`        INTEGER NOT NULL DEFAULT 0,
+    `size`          INTEGER NOT NULL DEFAULT 0,
+    `created_at`    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((`post_id` IS NOT NULL) + (`comment_id` IS NOT NULL) + (`message_id` IS NOT NULL) <= 1)
+);
+
+CREATE INDEX IF NOT EXISTS `idx_attachments_post_id` ON `attachments` (`post_id`, `position`);
+CREATE INDEX IF NOT EXISTS `idx_attachments_comment_id` ON `attachments` (`comment_id`, `position`);
+CREATE INDEX IF NOT EXISTS `idx_attachments_message_id` ON `attachments` (`message_id`, `position`);
+CREATE INDEX IF NOT EXISTS `idx_attachments_name` ON `attachments` (`name`);
+CREATE INDEX IF NOT EXISTS `idx_attachments_user_id` ON `attachments` (`user_id`);
+
+INSERT INTO `attachments` (`user_id`, `post_id`, `name`, `mime_type`, `created_at`)
+SELECT `user_id`, `post_id`, `image`,
+    CASE
+        WHEN `image` LIKE '%.png' THEN 'image/png'
+        WHEN `image` LIKE '%.gif' THEN 'image/gif'
+        WHEN `image` LIKE '%.webp' THEN 'image/webp'
+        ELSE 'image/jpeg'
+    END,
+    COALESCE(`date`, CURRENT_TIMESTAMP)
+FROM `posts`
+WHERE COALESCE(`image`, '') <> ''
+ORDER BY `post_id`;
+
+INSERT INTO `attachments` (`user_id`, `comment_id`, `name`, `mime_type`, `created_at`)
+SELECT `user_id`, `comment_id`, `image`,
+    CASE
+        WHEN `image` LIKE '%.png' THEN 'image/png'
+        WHEN `image` LIKE '%.gif' THEN 'image/gif'
+        WHEN `image` LIKE '%.webp' THEN 'image/webp'
+        ELSE 'image/jpeg'
+    END,
+    COALESCE(`date`, CURRENT_TIMESTAMP)
+FROM `comments`
+WHERE COALESCE(`image`, '') <> ''
+ORDER BY `comment_id`;
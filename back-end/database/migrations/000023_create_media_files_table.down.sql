@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS `media_avatar_delete`;
+DROP TRIGGER IF EXISTS `media_avatar_update`;
+DROP TRIGGER IF EXISTS `media_avatar_insert`;
+DROP TRIGGER IF EXISTS `media_attachment_delete`;
+DROP TRIGGER IF EXISTS `media_attachment_insert`;
+ALTER TABLE `users` DROP COLUMN `media_quota`;
+DROP INDEX IF EXISTS `idx_media_files_unused`;
+DROP TABLE IF EXISTS `media_files`;
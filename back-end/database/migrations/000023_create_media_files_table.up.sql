@@ -0,0 +1,59 @@
+-- Every stored upload, with the SHA-256 of its contents so the same file is
+-- stored once, its size including variants, and how many attachments and
+-- avatars refer to it. The triggers keep refs up to date; files no longer
+-- referred to are removed by the media garbage collector. reused_at is set
+-- when an upload turns out to be a copy of the file, which keeps it from being
+-- collected before the new reference is written. Files stored before this
+-- migration get a row without a hash; their size is filled in by the
+-- collector.
+CREATE TABLE IF NOT EXISTS `media_files` (
+    `name`       TEXT PRIMARY KEY,
+    `hash`       TEXT UNIQUE,
+    `size`       INTEGER NOT NULL DEFAULT 0,
+    `refs`       INTEGER NOT NULL DEFAULT 0,
+    `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `reused_at`  DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS `idx_media_files_unused` ON `media_files` (`created_at`) WHERE `refs` <= 0;
+
+-- A quota in bytes; NULL uses the server default and 0 means no limit.
+ALTER TABLE `users` ADD COLUMN `media_quota` INTEGER;
+
+INSERT INTO `media_files` (`name`, `refs`)
+SELECT `name`, COUNT(*)
+FROM (
+    SELECT `name` FROM `attachments`
+    UNION ALL
+    SELECT `avatar` FROM `users` WHERE COALESCE(`avatar`, '') <> ''
+)
+GROUP BY `name`;
+
+CREATE TRIGGER IF NOT EXISTS `media_attachment_insert` AFTER INSERT ON `attachments`
+BEGIN
+    UPDATE `media_files` SET `refs` = `refs` + 1 WHERE `name` = NEW.`name`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `media_attachment_delete` AFTER DELETE ON `attachments`
+BEGIN
+    UPDATE `media_files` SET `refs` = `refs` - 1 WHERE `name` = OLD.`name`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `media_avatar_insert` AFTER INSERT ON `users`
+WHEN COALESCE(NEW.`avatar`, '') <> ''
+BEGIN
+    UPDATE `media_files` SET `refs` = `refs` + 1 WHERE `name` = NEW.`avatar`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `media_avatar_update` AFTER UPDATE OF `avatar` ON `users`
+WHEN OLD.`avatar` IS NOT NEW.`avatar`
+BEGIN
+    UPDATE `media_files` SET `refs` = `refs` - 1 WHERE `name` = OLD.`avatar`;
+    UPDATE `media_files` SET `refs` = `refs` + 1 WHERE `name` = NEW.`avatar`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `media_avatar_delete` AFTER DELETE ON `users`
+WHEN COALESCE(OLD.`avatar`, '') <> ''
+BEGIN
+    UPDATE `media_files` SET `refs` = `refs` - 1 WHERE `name` = OLD.`avatar`;
+END;
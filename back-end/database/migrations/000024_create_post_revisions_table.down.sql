@@ -0,0 +1,5 @@
+DELETE FROM `attachments` WHERE `revision_id` IS NOT NULL;
+DROP INDEX IF EXISTS `idx_attachments_revision_id`;
+ALTER TABLE `attachments` DROP COLUMN `revision_id`;
+ALTER TABLE `posts` DROP COLUMN `edited_at`;
+DROP TABLE IF EXISTS `post_revisions`;
@@ -0,0 +1,19 @@
+-- Each edit of a post keeps the version it replaced. The attachments of that
+-- version are copied to it, so their files are kept while the revision is.
+-- Revisions go with their post, and edited_at marks posts that were edited.
+CREATE TABLE IF NOT EXISTS `post_revisions` (
+    `revision_id`      INTEGER PRIMARY KEY AUTOINCREMENT,
+    `post_id`          INTEGER NOT NULL REFERENCES `posts` (`post_id`) ON DELETE CASCADE,
+    `content`          TEXT NOT NULL,
+    `privacy`          TEXT NOT NULL,
+    `selected_user_id` TEXT NOT NULL DEFAULT '',
+    `date`             DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS `idx_post_revisions_post_id` ON `post_revisions` (`post_id`, `revision_id`);
+
+ALTER TABLE `posts` ADD COLUMN `edited_at` DATETIME;
+
+ALTER TABLE `attachments` ADD COLUMN `revision_id` INTEGER REFERENCES `post_revisions` (`revision_id`) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS `idx_attachments_revision_id` ON `attachments` (`revision_id`, `position`);
@@ -0,0 +1,7 @@
+UPDATE `comments` SET `parent_id` = NULL;
+DELETE FROM `comments` WHERE `deleted_at` IS NOT NULL;
+DROP INDEX IF EXISTS `idx_comments_parent_id`;
+ALTER TABLE `comments` DROP COLUMN `deleted_at`;
+ALTER TABLE `comments` DROP COLUMN `edited_at`;
+ALTER TABLE `comments` DROP COLUMN `depth`;
+ALTER TABLE `comments` DROP COLUMN `parent_id`;
@@ -0,0 +1,9 @@
+-- Replies point at the comment they answer and depth counts the comments
+-- above them; top-level comments have no parent. A deleted comment that still
+-- has replies is kept, emptied, with deleted_at set.
+ALTER TABLE `comments` ADD COLUMN `parent_id` INTEGER REFERENCES `comments` (`comment_id`) ON DELETE CASCADE;
+ALTER TABLE `comments` ADD COLUMN `depth` INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE `comments` ADD COLUMN `edited_at` DATETIME;
+ALTER TABLE `comments` ADD COLUMN `deleted_at` DATETIME;
+
+CREATE INDEX IF NOT EXISTS `idx_comments_parent_id` ON `comments` (`parent_id`, `comment_id`);
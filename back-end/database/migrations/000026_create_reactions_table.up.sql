@@ -0,0 +1,16 @@
+-- Each user can react to a post, comment or chat message with one emoji.
+CREATE TABLE IF NOT EXISTS `reactions` (
+    `reaction_id`   INTEGER PRIMARY KEY AUTOINCREMENT,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `post_id`       INTEGER REFERENCES `posts` (`post_id`) ON DELETE CASCADE,
+    `comment_id`    INTEGER REFERENCES `comments` (`comment_id`) ON DELETE CASCADE,
+    `message_id`    INTEGER REFERENCES `messages` (`message_id`) ON DELETE CASCADE,
+    `emoji`         TEXT NOT NULL,
+    `date`          DATETIME NOT NULL,
+    CHECK ((`post_id` IS NOT NULL) + (`comment_id` IS NOT NULL) + (`message_id` IS NOT NULL) = 1)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_reactions_post_id` ON `reactions` (`post_id`, `user_id`) WHERE `post_id` IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_reactions_comment_id` ON `reactions` (`comment_id`, `user_id`) WHERE `comment_id` IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_reactions_message_id` ON `reactions` (`message_id`, `user_id`) WHERE `message_id` IS NOT NULL;
+CREATE INDEX IF NOT EXISTS `idx_reactions_user_id` ON `reactions` (`user_id`);
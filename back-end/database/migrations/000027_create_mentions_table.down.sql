@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS `idx_users_nickname`;
+DROP TABLE IF EXISTS `mentions`;
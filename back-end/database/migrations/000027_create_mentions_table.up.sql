@@ -0,0 +1,21 @@
+-- Users mentioned in posts, comments and chat messages, with where the
+-- mention is in the text and whether the user has seen it.
+CREATE TABLE IF NOT EXISTS `mentions` (
+    `mention_id`    INTEGER PRIMARY KEY AUTOINCREMENT,
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `author_id`     INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `post_id`       INTEGER REFERENCES `posts` (`post_id`) ON DELETE CASCADE,
+    `comment_id`    INTEGER REFERENCES `comments` (`comment_id`) ON DELETE CASCADE,
+    `message_id`    INTEGER REFERENCES `messages` (`message_id`) ON DELETE CASCADE,
+    `position`      INTEGER NOT NULL,
+    `length`        INTEGER NOT NULL,
+    `seen`          BOOLEAN NOT NULL DEFAULT FALSE,
+    `date`          DATETIME NOT NULL,
+    CHECK ((`post_id` IS NOT NULL) + (`comment_id` IS NOT NULL) + (`message_id` IS NOT NULL) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS `idx_mentions_user_id` ON `mentions` (`user_id`, `mention_id`);
+CREATE INDEX IF NOT EXISTS `idx_mentions_post_id` ON `mentions` (`post_id`) WHERE `post_id` IS NOT NULL;
+CREATE INDEX IF NOT EXISTS `idx_mentions_comment_id` ON `mentions` (`comment_id`) WHERE `comment_id` IS NOT NULL;
+CREATE INDEX IF NOT EXISTS `idx_mentions_message_id` ON `mentions` (`message_id`) WHERE `message_id` IS NOT NULL;
+CREATE INDEX IF NOT EXISTS `idx_users_nickname` ON `users` (lower(`nickname`));
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `hashtag_follows`;
+DROP TABLE IF EXISTS `hashtags`;
@@ -0,0 +1,25 @@
+-- Hashtags in posts and comments, in lower case without the #, with where
+-- they are in the text, and the tags users follow. date is when the tag was
+-- first used in the post or comment, which trending tags are counted by.
+CREATE TABLE IF NOT EXISTS `hashtags` (
+    `hashtag_id`    INTEGER PRIMARY KEY AUTOINCREMENT,
+    `tag`           TEXT NOT NULL,
+    `post_id`       INTEGER REFERENCES `posts` (`post_id`) ON DELETE CASCADE,
+    `comment_id`    INTEGER REFERENCES `comments` (`comment_id`) ON DELETE CASCADE,
+    `position`      INTEGER NOT NULL,
+    `length`        INTEGER NOT NULL,
+    `date`          DATETIME NOT NULL,
+    CHECK ((`post_id` IS NOT NULL) + (`comment_id` IS NOT NULL) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS `idx_hashtags_tag` ON `hashtags` (`tag`);
+CREATE INDEX IF NOT EXISTS `idx_hashtags_date` ON `hashtags` (`date`);
+CREATE INDEX IF NOT EXISTS `idx_hashtags_post_id` ON `hashtags` (`post_id`) WHERE `post_id` IS NOT NULL;
+CREATE INDEX IF NOT EXISTS `idx_hashtags_comment_id` ON `hashtags` (`comment_id`) WHERE `comment_id` IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS `hashtag_follows` (
+    `user_id`       INTEGER NOT NULL REFERENCES `users` (`user_id`) ON DELETE CASCADE,
+    `tag`           TEXT NOT NULL,
+    `date`          DATETIME NOT NULL,
+    PRIMARY KEY (`user_id`, `tag`)
+);
@@ -0,0 +1,24 @@
+DROP TRIGGER IF EXISTS `events_search_delete`;
+DROP TRIGGER IF EXISTS `events_search_update`;
+DROP TRIGGER IF EXISTS `events_search_insert`;
+DROP TABLE IF EXISTS `events_search`;
+
+DROP TRIGGER IF EXISTS `groups_search_delete`;
+DROP TRIGGER IF EXISTS `groups_search_update`;
+DROP TRIGGER IF EXISTS `groups_search_insert`;
+DROP TABLE IF EXISTS `groups_search`;
+
+DROP TRIGGER IF EXISTS `comments_search_delete`;
+DROP TRIGGER IF EXISTS `comments_search_update`;
+DROP TRIGGER IF EXISTS `comments_search_insert`;
+DROP TABLE IF EXISTS `comments_search`;
+
+DROP TRIGGER IF EXISTS `posts_search_delete`;
+DROP TRIGGER IF EXISTS `posts_search_update`;
+DROP TRIGGER IF EXISTS `posts_search_insert`;
+DROP TABLE IF EXISTS `posts_search`;
+
+DROP TRIGGER IF EXISTS `users_search_delete`;
+DROP TRIGGER IF EXISTS `users_search_update`;
+DROP TRIGGER IF EXISTS `users_search_insert`;
+DROP TABLE IF EXISTS `users_search`;
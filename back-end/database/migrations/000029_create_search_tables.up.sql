@@ -0,0 +1,104 @@
+-- Full-text indexes of users, posts, comments, groups and events, keyed by
+-- the rowid of the row they index. users_search holds the names and nickname
+-- of a user in name, apart from their about me, which private profiles only
+-- show to followers. The triggers keep them in step with the tables.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS `users_search` USING fts5(`name`, `about`, tokenize = 'unicode61 remove_diacritics 2');
+
+INSERT INTO `users_search` (`rowid`, `name`, `about`)
+SELECT `user_id`, `first_name` || ' ' || `last_name` || ' ' || COALESCE(`nickname`, ''), COALESCE(`about_me`, '') FROM `users`;
+
+CREATE TRIGGER IF NOT EXISTS `users_search_insert` AFTER INSERT ON `users`
+BEGIN
+    INSERT INTO `users_search` (`rowid`, `name`, `about`) VALUES (NEW.`user_id`, NEW.`first_name` || ' ' || NEW.`last_name` || ' ' || COALESCE(NEW.`nickname`, ''), COALESCE(NEW.`about_me`, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS `users_search_update` AFTER UPDATE OF `first_name`, `last_name`, `nickname`, `about_me` ON `users`
+BEGIN
+    UPDATE `users_search` SET `name` = NEW.`first_name` || ' ' || NEW.`last_name` || ' ' || COALESCE(NEW.`nickname`, ''), `about` = COALESCE(NEW.`about_me`, '') WHERE `rowid` = NEW.`user_id`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `users_search_delete` AFTER DELETE ON `users`
+BEGIN
+    DELETE FROM `users_search` WHERE `rowid` = OLD.`user_id`;
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS `posts_search` USING fts5(`content`, tokenize = 'unicode61 remove_diacritics 2');
+
+INSERT INTO `posts_search` (`rowid`, `content`)
+SELECT `post_id`, `content` FROM `posts`;
+
+CREATE TRIGGER IF NOT EXISTS `posts_search_insert` AFTER INSERT ON `posts`
+BEGIN
+    INSERT INTO `posts_search` (`rowid`, `content`) VALUES (NEW.`post_id`, NEW.`content`);
+END;
+
+CREATE TRIGGER IF NOT EXISTS `posts_search_update` AFTER UPDATE OF `content` ON `posts`
+BEGIN
+    UPDATE `posts_search` SET `content` = NEW.`content` WHERE `rowid` = NEW.`post_id`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `posts_search_delete` AFTER DELETE ON `posts`
+BEGIN
+    DELETE FROM `posts_search` WHERE `rowid` = OLD.`post_id`;
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS `comments_search` USING fts5(`comment`, tokenize = 'unicode61 remove_diacritics 2');
+
+INSERT INTO `comments_search` (`rowid`, `comment`)
+SELECT `comment_id`, `comment` FROM `comments`;
+
+CREATE TRIGGER IF NOT EXISTS `comments_search_insert` AFTER INSERT ON `comments`
+BEGIN
+    INSERT INTO `comments_search` (`rowid`, `comment`) VALUES (NEW.`comment_id`, NEW.`comment`);
+END;
+
+CREATE TRIGGER IF NOT EXISTS `comments_search_update` AFTER UPDATE OF `comment` ON `comments`
+BEGIN
+    UPDATE `comments_search` SET `comment` = NEW.`comment` WHERE `rowid` = NEW.`comment_id`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `comments_search_delete` AFTER DELETE ON `comments`
+BEGIN
+    DELETE FROM `comments_search` WHERE `rowid` = OLD.`comment_id`;
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS `groups_search` USING fts5(`title`, `description`, tokenize = 'unicode61 remove_diacritics 2');
+
+INSERT INTO `groups_search` (`rowid`, `title`, `description`)
+SELECT `group_id`, `title`, `description` FROM `groups`;
+
+CREATE TRIGGER IF NOT EXISTS `groups_search_insert` AFTER INSERT ON `groups`
+BEGIN
+    INSERT INTO `groups_search` (`rowid`, `title`, `description`) VALUES (NEW.`group_id`, NEW.`title`, NEW.`description`);
+END;
+
+CREATE TRIGGER IF NOT EXISTS `groups_search_update` AFTER UPDATE OF `title`, `description` ON `groups`
+BEGIN
+    UPDATE `groups_search` SET `title` = NEW.`title`, `description` = NEW.`description` WHERE `rowid` = NEW.`group_id`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `groups_search_delete` AFTER DELETE ON `groups`
+BEGIN
+    DELETE FROM `groups_search` WHERE `rowid` = OLD.`group_id`;
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS `events_search` USING fts5(`title`, `description`, tokenize = 'unicode61 remove_diacritics 2');
+
+INSERT INTO `events_search` (`rowid`, `title`, `description`)
+SELECT `event_id`, COALESCE(`title`, ''), COALESCE(`description`, '') FROM `events`;
+
+CREATE TRIGGER IF NOT EXISTS `events_search_insert` AFTER INSERT ON `events`
+BEGIN
+    INSERT INTO `events_search` (`rowid`, `title`, `description`) VALUES (NEW.`event_id`, COALESCE(NEW.`title`, ''), COALESCE(NEW.`description`, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS `events_search_update` AFTER UPDATE OF `title`, `description` ON `events`
+BEGIN
+    UPDATE `events_search` SET `title` = COALESCE(NEW.`title`, ''), `description` = COALESCE(NEW.`description`, '') WHERE `rowid` = NEW.`event_id`;
+END;
+
+CREATE TRIGGER IF NOT EXISTS `events_search_delete` AFTER DELETE ON `events`
+BEGIN
+    DELETE FROM `events_search` WHERE `rowid` = OLD.`event_id`;
+END;
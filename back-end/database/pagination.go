@@ -0,0 +1,57 @@
+package database
+
+// Page selects a window of a list by keyset rather than by offset, so the
+// cost of a page does not grow with how deep into the list it is.
+type Page struct {
+	// Cursor is the key of the row the page starts after. Zero means the
+	// start of the list (or the end, when Backward is set).
+	Cursor int
+	// Backward walks towards the start of the list instead of the end.
+	Backward bool
+	Limit    int
+}
+
+// Cursors holds the keys to continue from in either direction. A zero value
+// means there is no page on that side.
+type Cursors struct {
+	Next int
+	Prev int
+}
+
+// Paginate trims rows fetched one past the page size, in the order of the
+// walk, to the page size, puts them in list order and works out the cursors
+// for the neighbouring pages.
+func Paginate[T any](rows []T, p Page, key func(T) int) ([]T, Cursors) {
+	more := len(rows) > p.Limit
+	if more {
+		rows = rows[:p.Limit]
+	}
+
+	if p.Backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	var cursors Cursors
+	if len(rows) == 0 {
+		return rows, cursors
+	}
+
+	first, last := key(rows[0]), key(rows[len(rows)-1])
+	if p.Backward {
+		cursors.Next = last
+		if more {
+			cursors.Prev = first
+		}
+	} else {
+		if more {
+			cursors.Next = last
+		}
+		if p.Cursor > 0 {
+			cursors.Prev = first
+		}
+	}
+
+	return rows, cursors
+}
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS eventnotifications;
+DROP TABLE IF EXISTS eventparticipants;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS followers;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS post_audience;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS groupmembers;
+DROP TABLE IF EXISTS group_invitees;
+DROP TABLE IF EXISTS groups;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
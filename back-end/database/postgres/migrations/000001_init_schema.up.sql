@@ -0,0 +1,145 @@
+-- Postgres starts from the schema the SQLite migrations arrive at in 000019.
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id         INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    email           TEXT UNIQUE NOT NULL,
+    password        TEXT NOT NULL,
+    first_name      TEXT NOT NULL,
+    last_name       TEXT NOT NULL,
+    date_of_birth   TEXT NOT NULL,
+    avatar          TEXT NOT NULL DEFAULT '',
+    nickname        TEXT NOT NULL DEFAULT '',
+    about_me        TEXT NOT NULL DEFAULT '',
+    public          BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_first_name ON users (first_name);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    cookie          TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_cookie ON sessions (cookie);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS groups (
+    group_id        INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    title           TEXT NOT NULL,
+    description     TEXT NOT NULL,
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_groups_user_id ON groups (user_id);
+CREATE INDEX IF NOT EXISTS idx_groups_title ON groups (title);
+
+CREATE TABLE IF NOT EXISTS group_invitees (
+    group_id        INTEGER NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_invitees_user_id ON group_invitees (user_id);
+
+CREATE TABLE IF NOT EXISTS groupmembers (
+    id                  INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    group_id            INTEGER NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE,
+    member_id           INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    request_pending     BOOLEAN NOT NULL,
+    invitation_pending  BOOLEAN NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_groupmembers_group_id ON groupmembers (group_id, member_id);
+CREATE INDEX IF NOT EXISTS idx_groupmembers_member_id ON groupmembers (member_id, group_id);
+
+CREATE TABLE IF NOT EXISTS posts (
+    post_id         INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    content         TEXT NOT NULL,
+    privacy         TEXT NOT NULL,
+    image           TEXT NOT NULL DEFAULT '',
+    date            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    group_id        INTEGER REFERENCES groups (group_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts (user_id, post_id);
+CREATE INDEX IF NOT EXISTS idx_posts_group_id ON posts (group_id, post_id);
+
+CREATE TABLE IF NOT EXISTS post_audience (
+    post_id         INTEGER NOT NULL REFERENCES posts (post_id) ON DELETE CASCADE,
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_audience_user_id ON post_audience (user_id, post_id);
+
+CREATE TABLE IF NOT EXISTS comments (
+    comment_id      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    post_id         INTEGER NOT NULL REFERENCES posts (post_id) ON DELETE CASCADE,
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    comment         TEXT NOT NULL,
+    image           TEXT NOT NULL DEFAULT '',
+    date            TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id, comment_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments (user_id);
+
+CREATE TABLE IF NOT EXISTS followers (
+    id              INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    follower_id     INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    following_id    INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    request_pending BOOLEAN NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_followers_following_id ON followers (following_id, follower_id);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id, following_id);
+
+CREATE TABLE IF NOT EXISTS events (
+    event_id        INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    title           TEXT NOT NULL DEFAULT '',
+    description     TEXT NOT NULL DEFAULT '',
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    time            TEXT NOT NULL,
+    group_id        INTEGER NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_group_id ON events (group_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_events_user_id ON events (user_id);
+
+CREATE TABLE IF NOT EXISTS eventparticipants (
+    id              INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    event_id        INTEGER NOT NULL REFERENCES events (event_id) ON DELETE CASCADE,
+    participant_id  INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    going           BOOLEAN NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_eventparticipants_event_id ON eventparticipants (event_id, participant_id);
+CREATE INDEX IF NOT EXISTS idx_eventparticipants_participant_id ON eventparticipants (participant_id);
+
+CREATE TABLE IF NOT EXISTS eventnotifications (
+    id              INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    event_id        INTEGER NOT NULL REFERENCES events (event_id) ON DELETE CASCADE,
+    member_id       INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    group_id        INTEGER NOT NULL REFERENCES groups (group_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_eventnotifications_member_id ON eventnotifications (member_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_eventnotifications_event_id ON eventnotifications (event_id);
+CREATE INDEX IF NOT EXISTS idx_eventnotifications_group_id ON eventnotifications (group_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+    message_id      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    sender_id       INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    recipient_id    INTEGER REFERENCES users (user_id) ON DELETE CASCADE,
+    group_id        INTEGER REFERENCES groups (group_id) ON DELETE CASCADE,
+    message         TEXT NOT NULL,
+    date            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    read            BOOLEAN NOT NULL DEFAULT FALSE,
+    CHECK ((recipient_id IS NULL) <> (group_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_sender_recipient ON messages (sender_id, recipient_id, message_id);
+CREATE INDEX IF NOT EXISTS idx_messages_recipient ON messages (recipient_id, read);
+CREATE INDEX IF NOT EXISTS idx_messages_group_id ON messages (group_id, message_id);
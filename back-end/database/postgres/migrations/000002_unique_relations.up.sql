@@ -0,0 +1,29 @@
+-- A user can follow, belong to a group or answer an event only once. Existing
+-- duplicates are collapsed first: the accepted follow or membership is kept
+-- over a pending one, and the latest answer to an event wins.
+DELETE FROM followers WHERE id NOT IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY follower_id, following_id ORDER BY request_pending, id) AS n
+        FROM followers
+    ) ranked WHERE n = 1
+);
+
+DELETE FROM groupmembers WHERE id NOT IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY group_id, member_id ORDER BY request_pending::int + invitation_pending::int, id) AS n
+        FROM groupmembers
+    ) ranked WHERE n = 1
+);
+
+DELETE FROM eventparticipants WHERE id NOT IN (
+    SELECT MAX(id) FROM eventparticipants GROUP BY event_id, participant_id
+);
+
+DROP INDEX IF EXISTS idx_followers_follower_id;
+CREATE UNIQUE INDEX idx_followers_follower_id ON followers (follower_id, following_id);
+
+DROP INDEX IF EXISTS idx_groupmembers_group_id;
+CREATE UNIQUE INDEX idx_groupmembers_group_id ON groupmembers (group_id, member_id);
+
+DROP INDEX IF EXISTS idx_eventparticipants_event_id;
+CREATE UNIQUE INDEX idx_eventparticipants_event_id ON eventparticipants (event_id, participant_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_avatar;
+DROP INDEX IF EXISTS idx_posts_image;
+DROP INDEX IF EXISTS idx_comments_image;
@@ -0,0 +1,49 @@
+-- See 000022_create_attachments_table in the SQLite migrations.
+CREATE TABLE IF NOT EXISTS attachments (
+    attachment_id   INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    post_id         INTEGER REFERENCES posts (post_id) ON DELETE CASCADE,
+    comment_id      INTEGER REFERENCES comments (comment_id) ON DELETE CASCADE,
+    message_id      INTEGER REFERENCES messages (message_id) ON DELETE CASCADE,
+    position        INTEGER NOT NULL DEFAULT 0,
+    name            TEXT NOT NULL,
+    mime_type       TEXT NOT NULL,
+    alt_text        TEXT NOT NULL DEFAULT '',
+    width           INTEGER NOT NULL DEFAULT 0,
+    height          INTEGER NOT NULL DEFAULT 0,
+    size            BIGINT NOT NULL DEFAULT 0,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (num_nonnulls(post_id, comment_id, message_id) <= 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments (post_id, position);
+CREATE INDEX IF NOT EXISTS idx_attachments_comment_id ON attachments (comment_id, position);
+CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments (message_id, position);
+CREATE INDEX IF NOT EXISTS idx_attachments_name ON attachments (name);
+CREATE INDEX IF NOT EXISTS idx_attachments_user_id ON attachments (user_id);
+
+INSERT INTO attachments (user_id, post_id, name, mime_type, created_at)
+SELECT user_id, post_id, image,
+    CASE
+        WHEN image ILIKE '%.png' THEN 'image/png'
+        WHEN image ILIKE '%.gif' THEN 'image/gif'
+        WHEN image ILIKE '%.webp' THEN 'image/webp'
+        ELSE 'image/jpeg'
+    END,
+    date
+FROM posts
+WHERE image <> ''
+ORDER BY post_id;
+
+INSERT INTO attachments (user_id, comment_id, name, mime_type, created_at)
+SELECT user_id, comment_id, image,
+    CASE
+        WHEN image ILIKE '%.png' THEN 'image/png'
+        WHEN image ILIKE '%.gif' THEN 'image/gif'
+        WHEN image ILIKE '%.webp' THEN 'image/webp'
+        ELSE 'image/jpeg'
+    END,
+    date
+FROM comments
+WHERE image <> ''
+ORDER BY comment_id;
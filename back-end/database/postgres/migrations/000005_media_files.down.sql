@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS media_avatar_refs ON users;
+DROP TRIGGER IF EXISTS media_attachment_refs ON attachments;
+DROP FUNCTION IF EXISTS media_avatar_refs();
+DROP FUNCTION IF EXISTS media_attachment_refs();
+ALTER TABLE users DROP COLUMN IF EXISTS media_quota;
+DROP TABLE IF EXISTS media_files;
@@ -0,0 +1,53 @@
+-- See 000023_create_media_files_table in the SQLite migrations.
+CREATE TABLE IF NOT EXISTS media_files (
+    name        TEXT PRIMARY KEY,
+    hash        TEXT UNIQUE,
+    size        BIGINT NOT NULL DEFAULT 0,
+    refs        INTEGER NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    reused_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_files_unused ON media_files (created_at) WHERE refs <= 0;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS media_quota BIGINT;
+
+INSERT INTO media_files (name, refs)
+SELECT name, COUNT(*)
+FROM (
+    SELECT name FROM attachments
+    UNION ALL
+    SELECT avatar FROM users WHERE avatar <> ''
+) refs
+GROUP BY name;
+
+CREATE OR REPLACE FUNCTION media_attachment_refs() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE media_files SET refs = refs - 1 WHERE name = OLD.name;
+    ELSE
+        UPDATE media_files SET refs = refs + 1 WHERE name = NEW.name;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION media_avatar_refs() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE media_files SET refs = refs - 1 WHERE name = OLD.avatar;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE media_files SET refs = refs + 1 WHERE name = NEW.avatar;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS media_attachment_refs ON attachments;
+CREATE TRIGGER media_attachment_refs AFTER INSERT OR DELETE ON attachments
+FOR EACH ROW EXECUTE FUNCTION media_attachment_refs();
+
+DROP TRIGGER IF EXISTS media_avatar_refs ON users;
+CREATE TRIGGER media_avatar_refs AFTER INSERT OR DELETE OR UPDATE OF avatar ON users
+FOR EACH ROW EXECUTE FUNCTION media_avatar_refs();
@@ -0,0 +1,4 @@
+DELETE FROM attachments WHERE revision_id IS NOT NULL;
+ALTER TABLE attachments DROP COLUMN IF EXISTS revision_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS edited_at;
+DROP TABLE IF EXISTS post_revisions;
@@ -0,0 +1,17 @@
+-- See 000024_create_post_revisions_table in the SQLite migrations.
+CREATE TABLE IF NOT EXISTS post_revisions (
+    revision_id      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    post_id          INTEGER NOT NULL REFERENCES posts (post_id) ON DELETE CASCADE,
+    content          TEXT NOT NULL,
+    privacy          TEXT NOT NULL,
+    selected_user_id TEXT NOT NULL DEFAULT '',
+    date             TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post_id ON post_revisions (post_id, revision_id);
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS revision_id INTEGER REFERENCES post_revisions (revision_id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_attachments_revision_id ON attachments (revision_id, position);
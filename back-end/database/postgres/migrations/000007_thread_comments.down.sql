@@ -0,0 +1,6 @@
+UPDATE comments SET parent_id = NULL;
+DELETE FROM comments WHERE deleted_at IS NOT NULL;
+ALTER TABLE comments DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS edited_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS depth;
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,20 @@
+-- See 000027_create_mentions_table in the SQLite migrations.
+CREATE TABLE IF NOT EXISTS mentions (
+    mention_id      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    author_id       INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    post_id         INTEGER REFERENCES posts (post_id) ON DELETE CASCADE,
+    comment_id      INTEGER REFERENCES comments (comment_id) ON DELETE CASCADE,
+    message_id      INTEGER REFERENCES messages (message_id) ON DELETE CASCADE,
+    position        INTEGER NOT NULL,
+    length          INTEGER NOT NULL,
+    seen            BOOLEAN NOT NULL DEFAULT FALSE,
+    date            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (num_nonnulls(post_id, comment_id, message_id) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions (user_id, mention_id);
+CREATE INDEX IF NOT EXISTS idx_mentions_post_id ON mentions (post_id) WHERE post_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_mentions_comment_id ON mentions (comment_id) WHERE comment_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_mentions_message_id ON mentions (message_id) WHERE message_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_users_nickname ON users (lower(nickname));
@@ -0,0 +1,23 @@
+-- See 000028_create_hashtags_table in the SQLite migrations.
+CREATE TABLE IF NOT EXISTS hashtags (
+    hashtag_id      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    tag             TEXT NOT NULL,
+    post_id         INTEGER REFERENCES posts (post_id) ON DELETE CASCADE,
+    comment_id      INTEGER REFERENCES comments (comment_id) ON DELETE CASCADE,
+    position        INTEGER NOT NULL,
+    length          INTEGER NOT NULL,
+    date            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (num_nonnulls(post_id, comment_id) = 1)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hashtags_tag ON hashtags (tag);
+CREATE INDEX IF NOT EXISTS idx_hashtags_date ON hashtags (date);
+CREATE INDEX IF NOT EXISTS idx_hashtags_post_id ON hashtags (post_id) WHERE post_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_hashtags_comment_id ON hashtags (comment_id) WHERE comment_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS hashtag_follows (
+    user_id         INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+    tag             TEXT NOT NULL,
+    date            TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, tag)
+);
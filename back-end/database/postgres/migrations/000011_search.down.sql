@@ -0,0 +1,5 @@
+ALTER TABLE events DROP COLUMN IF EXISTS search;
+ALTER TABLE groups DROP COLUMN IF EXISTS search;
+ALTER TABLE comments DROP COLUMN IF EXISTS search;
+ALTER TABLE posts DROP COLUMN IF EXISTS search;
+ALTER TABLE users DROP COLUMN IF EXISTS search, DROP COLUMN IF EXISTS search_name;
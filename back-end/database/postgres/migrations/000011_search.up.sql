@@ -0,0 +1,35 @@
+-- See 000029_create_search_tables in the SQLite migrations. Here the text
+-- search vectors are generated columns, so they follow every write, with
+-- names and titles weighted A and the text under them D. users.search_name
+-- leaves out about_me, which private profiles only show to followers.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS search_name TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple', first_name || ' ' || last_name || ' ' || nickname)
+    ) STORED,
+    ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', first_name || ' ' || last_name || ' ' || nickname), 'A')
+        || setweight(to_tsvector('simple', about_me), 'D')
+    ) STORED;
+
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', comment)) STORED;
+
+ALTER TABLE groups
+    ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', description), 'D')
+    ) STORED;
+
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', description), 'D')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_search_name ON users USING GIN (search_name);
+CREATE INDEX IF NOT EXISTS idx_users_search ON users USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_comments_search ON comments USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_groups_search ON groups USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_events_search ON events USING GIN (search);
@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"fmt"
+
+	"social-network/database"
+	"social-network/models"
+)
+
+// keyset returns the WHERE condition and ORDER BY/LIMIT tail for walking a
+// list ordered by column, descending when desc is set. One extra row is
+// requested so database.Paginate can tell whether another page follows.
+func keyset(p database.Page, column string, desc bool) (string, string, []interface{}) {
+	// Walking backward through a descending list is walking forward through
+	// an ascending one, and vice versa.
+	ascending := desc == p.Backward
+
+	cond, order := ">", "ASC"
+	if !ascending {
+		cond, order = "<", "DESC"
+	}
+
+	where := "1 = 1"
+	var args []interface{}
+	if p.Cursor > 0 {
+		where = fmt.Sprintf("%s %s ?", column, cond)
+		args = append(args, p.Cursor)
+	}
+
+	return where, fmt.Sprintf("ORDER BY %s %s LIMIT %d", column, order, p.Limit+1), args
+}
+
+func postKey(p models.Post) int         { return p.PostID }
+func userKey(u models.UserData) int     { return u.UserID }
+func messageKey(m models.Message) int   { return m.MessageID }
+func reactionKey(r models.Reaction) int { return r.ReactionID }
+func mentionKey(m models.Mention) int   { return m.MentionID }
+
+func reverseMessages(messages []models.Message) {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// rebind rewrites the ? placeholders the queries are written with into the
+// numbered $1, $2, ... form Postgres expects, in order of appearance.
+func rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// intArray binds a list of IDs as one array parameter, for use with ANY(?).
+func intArray(ids []int) interface{} {
+	arr := make(pq.Int64Array, len(ids))
+	for i, id := range ids {
+		arr[i] = int64(id)
+	}
+	return arr
+}
+
+// splitIDs parses a comma-separated list of user IDs as sent by clients.
+func splitIDs(list string) ([]int, error) {
+	var ids []int
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q: %w", id, err)
+		}
+		ids = append(ids, n)
+	}
+	return ids, nil
+}
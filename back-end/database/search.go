@@ -0,0 +1,118 @@
+package database
+
+import (
+	"sort"
+
+	"social-network/models"
+)
+
+// Searches reports whether the query looks for results of the given type.
+func Searches(q models.SearchQuery, kind string) bool {
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if t == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchKey is the place of a result in the ranked order: by rank, best
+// first, then by type and, newest first, by ID, since IDs repeat across
+// types.
+type SearchKey struct {
+	Rank float64
+	Type string
+	ID   int
+}
+
+// Key returns the place of the result in the ranked order.
+func Key(result models.SearchResult) SearchKey {
+	return SearchKey{Rank: result.Rank, Type: result.Type, ID: result.ID}
+}
+
+// Before reports whether k comes before other in the ranked order.
+func (k SearchKey) Before(other SearchKey) bool {
+	if k.Rank != other.Rank {
+		return k.Rank > other.Rank
+	}
+	if k.Type != other.Type {
+		return k.Type < other.Type
+	}
+	return k.ID > other.ID
+}
+
+// SearchPage is a Page of ranked results, which have no single row key to
+// continue from.
+type SearchPage struct {
+	// Cursor is the result the page starts after. Nil means the start of
+	// the results (or the end, when Backward is set).
+	Cursor   *SearchKey
+	Backward bool
+	Limit    int
+}
+
+// SearchCursors holds the results to continue from in either direction. Nil
+// means there is no page on that side.
+type SearchCursors struct {
+	Next *SearchKey
+	Prev *SearchKey
+}
+
+// RankResults puts results gathered from several searches in order, best
+// first, and cuts the page asked for out of them, like Paginate. Each search
+// only has to return, in the order of the walk, up to one result more than
+// the page size from past the cursor.
+func RankResults(results []models.SearchResult, p SearchPage) ([]models.SearchResult, SearchCursors) {
+	if p.Cursor != nil {
+		kept := results[:0]
+		for _, result := range results {
+			if p.Backward && Key(result).Before(*p.Cursor) || !p.Backward && p.Cursor.Before(Key(result)) {
+				kept = append(kept, result)
+			}
+		}
+		results = kept
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if p.Backward {
+			return Key(results[j]).Before(Key(results[i]))
+		}
+		return Key(results[i]).Before(Key(results[j]))
+	})
+
+	more := len(results) > p.Limit
+	if more {
+		results = results[:p.Limit]
+	}
+
+	if p.Backward {
+		for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+			results[i], results[j] = results[j], results[i]
+		}
+	}
+
+	var cursors SearchCursors
+	if len(results) == 0 {
+		return results, cursors
+	}
+
+	first, last := Key(results[0]), Key(results[len(results)-1])
+	if p.Backward {
+		cursors.Next = &last
+		if more {
+			cursors.Prev = &first
+		}
+	} else {
+		if more {
+			cursors.Next = &last
+		}
+		if p.Cursor != nil {
+			cursors.Prev = &first
+		}
+	}
+
+	return results, cursors
+}
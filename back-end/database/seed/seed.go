@@ -0,0 +1,539 @@
+// Package seed fills an empty SQLite database with a synthetic social network
+// for development and load testing: users with public and private profiles,
+// follows and follow requests, posts in every privacy mode with comments and
+// images, groups with invitations and join requests, events with answers, and
+// private and group chats.
+//
+// Everything is drawn from a random source seeded with Config.Seed and dated
+// from Config.Start, so the same Config always produces the same rows and the
+// same image files.
+package seed
+
+import (
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Password is the password of every seeded user. passwordHash is its bcrypt
+// hash, fixed so that seeding stays reproducible and fast.
+const (
+	Password     = "password"
+	passwordHash = "$2a$10$kgT1lWc5Ql3dpjvmcZ5vHuXe9gvGkyoufo2jkdUpSXVkqK2pFFs2O"
+)
+
+type Config struct {
+	Seed int64
+	// Start is the time of the first post and message. Later ones follow at
+	// random intervals.
+	Start time.Time
+
+	Users int
+	// PostsPerUser, EventsPerGroup and MessagesPerUser are averages.
+	PostsPerUser    int
+	Groups          int
+	EventsPerGroup  int
+	MessagesPerUser int
+	// Images is the number of distinct pictures generated and shared
+	// between avatars, posts and comments.
+	Images int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Seed:            1,
+		Start:           time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		Users:           200,
+		PostsPerUser:    5,
+		Groups:          20,
+		EventsPerGroup:  3,
+		MessagesPerUser: 10,
+		Images:          12,
+	}
+}
+
+// Stats counts the rows inserted per table.
+type Stats map[string]int
+
+type user struct {
+	id     int
+	public bool
+	// followers holds the accepted followers.
+	followers []int
+}
+
+type group struct {
+	id, creator int
+	// members holds the accepted members and the creator.
+	members []int
+}
+
+type generator struct {
+	cfg    Config
+	rng    *rand.Rand
+	tx     *sql.Tx
+	stats  Stats
+	images []string
+	users  []*user
+	groups []*group
+	clock  time.Time
+}
+
+// Run seeds db, which must be migrated and hold no users, and writes the
+// generated images to imagesDir. All rows are inserted in one transaction.
+func Run(db *sql.DB, imagesDir string, cfg Config) (Stats, error) {
+	if cfg.Users < 2 {
+		return nil, fmt.Errorf("at least 2 users are needed, got %d", cfg.Users)
+	}
+
+	var existing int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&existing)
+	if err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("the database already has %d users, seed an empty one", existing)
+	}
+
+	g := &generator{
+		cfg:   cfg,
+		rng:   rand.New(rand.NewSource(cfg.Seed)),
+		stats: Stats{},
+		clock: cfg.Start,
+	}
+
+	err = g.writeImages(imagesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	g.tx, err = db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer g.tx.Rollback()
+
+	for _, step := range []func() error{g.seedUsers, g.seedFollows, g.seedPosts, g.seedGroups, g.seedEvents, g.seedMessages} {
+		err := step()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return g.stats, g.tx.Commit()
+}
+
+func (g *generator) insert(table, query string, args ...interface{}) (int, error) {
+	result, err := g.tx.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("seeding %s: %w", table, err)
+	}
+	g.stats[table]++
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// tick advances the clock by up to an hour and returns it.
+func (g *generator) tick() time.Time {
+	g.clock = g.clock.Add(time.Duration(g.rng.Intn(60)+1) * time.Minute)
+	return g.clock
+}
+
+func (g *generator) chance(p float64) bool {
+	return g.rng.Float64() < p
+}
+
+// around returns a count averaging n.
+func (g *generator) around(n int) int {
+	return g.rng.Intn(2*n + 1)
+}
+
+func (g *generator) pick(words []string) string {
+	return words[g.rng.Intn(len(words))]
+}
+
+func (g *generator) image() string {
+	if len(g.images) == 0 {
+		return ""
+	}
+	return g.images[g.rng.Intn(len(g.images))]
+}
+
+// otherUsers returns up to n distinct user IDs other than except, in the
+// order they were drawn.
+func (g *generator) otherUsers(n, except int) []int {
+	if n > len(g.users)-1 {
+		n = len(g.users) - 1
+	}
+	seen := map[int]bool{except: true}
+	var ids []int
+	for len(ids) < n {
+		id := g.users[g.rng.Intn(len(g.users))].id
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// sentence returns a sentence of random words no longer than max bytes.
+func (g *generator) sentence(max int) string {
+	first := g.pick(vocabulary)
+	words := []string{strings.ToUpper(first[:1]) + first[1:]}
+	length := len(words[0]) + 1
+	for n := g.rng.Intn(10) + 3; len(words) < n; {
+		word := g.pick(vocabulary)
+		if length+len(word)+1 > max {
+			break
+		}
+		words = append(words, word)
+		length += len(word) + 1
+	}
+	return strings.Join(words, " ") + "."
+}
+
+// imageSize is the width and height of the generated pictures.
+const imageSize = 128
+
+func (g *generator) writeImages(dir string) error {
+	if g.cfg.Images == 0 {
+		return nil
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= g.cfg.Images; i++ {
+		from := color.RGBA{uint8(g.rng.Intn(256)), uint8(g.rng.Intn(256)), uint8(g.rng.Intn(256)), 255}
+		to := color.RGBA{uint8(g.rng.Intn(256)), uint8(g.rng.Intn(256)), uint8(g.rng.Intn(256)), 255}
+
+		img := image.NewRGBA(image.Rect(0, 0, imageSize, imageSize))
+		for y := 0; y < imageSize; y++ {
+			for x := 0; x < imageSize; x++ {
+				t := float64(x+y) / (2 * imageSize)
+				img.Set(x, y, color.RGBA{
+					R: uint8(float64(from.R)*(1-t) + float64(to.R)*t),
+					G: uint8(float64(from.G)*(1-t) + float64(to.G)*t),
+					B: uint8(float64(from.B)*(1-t) + float64(to.B)*t),
+					A: 255,
+				})
+			}
+		}
+
+		name := fmt.Sprintf("seed-%d-%02d.jpg", g.cfg.Seed, i)
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		err = jpeg.Encode(f, img, nil)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+		g.images = append(g.images, name)
+	}
+
+	return nil
+}
+
+// seedUsers creates the users, about 60% of them public. They all log in with
+// userN@example.com and Password.
+func (g *generator) seedUsers() error {
+	birthStart := time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= g.cfg.Users; i++ {
+		firstName := g.pick(firstNames)
+		lastName := g.pick(lastNames)
+		public := g.chance(0.6)
+
+		avatar := ""
+		if g.chance(0.5) {
+			avatar = g.image()
+		}
+
+		id, err := g.insert("users", `INSERT INTO users (email, password, first_name, last_name, date_of_birth, avatar, nickname, about_me, public) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			fmt.Sprintf("user%d@example.com", i), []byte(passwordHash), firstName, lastName,
+			birthStart.AddDate(0, 0, g.rng.Intn(45*365)).Format("2006-01-02"), avatar,
+			fmt.Sprintf("%s%d", strings.ToLower(firstName), g.rng.Intn(100)), g.sentence(80), public)
+		if err != nil {
+			return err
+		}
+		g.users = append(g.users, &user{id: id, public: public})
+	}
+
+	return nil
+}
+
+// seedFollows has every user follow up to 15 others. Follows of private
+// profiles are left pending 40% of the time.
+func (g *generator) seedFollows() error {
+	byID := map[int]*user{}
+	for _, u := range g.users {
+		byID[u.id] = u
+	}
+
+	for _, u := range g.users {
+		for _, followingID := range g.otherUsers(g.rng.Intn(16), u.id) {
+			pending := !byID[followingID].public && g.chance(0.4)
+
+			_, err := g.insert("followers", `INSERT INTO followers (follower_id, following_id, request_pending) VALUES (?, ?, ?)`, u.id, followingID, pending)
+			if err != nil {
+				return err
+			}
+			if !pending {
+				byID[followingID].followers = append(byID[followingID].followers, u.id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *generator) seedPosts() error {
+	privacies := []string{"public", "public", "public", "public", "public", "private", "private", "private", "for-selected-users", "for-selected-users"}
+
+	for i := 0; i < g.cfg.Users*g.cfg.PostsPerUser; i++ {
+		author := g.users[g.rng.Intn(len(g.users))]
+		privacy := g.pick(privacies)
+
+		var audience []int
+		if privacy == "for-selected-users" {
+			audience = author.followers
+			if len(audience) == 0 {
+				audience = g.otherUsers(3, author.id)
+			}
+			n := g.rng.Intn(3) + 1
+			if n < len(audience) {
+				start := g.rng.Intn(len(audience) - n + 1)
+				audience = audience[start : start+n]
+			}
+		}
+
+		err := g.post(author.id, privacy, 0, audience)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// post adds a post, a quarter of them with an image, and up to four comments.
+func (g *generator) post(authorID int, privacy string, groupID int, audience []int) error {
+	image := ""
+	if g.chance(0.25) {
+		image = g.image()
+	}
+	date := g.tick()
+
+	var group interface{}
+	if groupID != 0 {
+		group = groupID
+	}
+
+	postID, err := g.insert("posts", `INSERT INTO posts (user_id, content, privacy, image, date, group_id) VALUES (?, ?, ?, ?, ?, ?)`,
+		authorID, g.sentence(100), privacy, image, date, group)
+	if err != nil {
+		return err
+	}
+	err = g.attachment(authorID, "post_id", postID, image, date)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range audience {
+		_, err := g.insert("post_audience", `INSERT INTO post_audience (post_id, user_id) VALUES (?, ?)`, postID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for n := g.rng.Intn(5); n > 0; n-- {
+		image := ""
+		if g.chance(0.1) {
+			image = g.image()
+		}
+		commenter := g.users[g.rng.Intn(len(g.users))].id
+		date = date.Add(time.Duration(g.rng.Intn(120)+1) * time.Minute)
+
+		commentID, err := g.insert("comments", `INSERT INTO comments (post_id, user_id, comment, image, date) VALUES (?, ?, ?, ?, ?)`,
+			postID, commenter, g.sentence(100), image, date)
+		if err != nil {
+			return err
+		}
+		err = g.attachment(commenter, "comment_id", commentID, image, date)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attachment records the image of a post or comment, if it has one, as its
+// first attachment. owner is the column linking it.
+func (g *generator) attachment(userID int, owner string, ownerID int, image string, date time.Time) error {
+	if image == "" {
+		return nil
+	}
+	_, err := g.insert("attachments", `INSERT INTO attachments (user_id, `+owner+`, name, mime_type, width, height, created_at) VALUES (?, ?, ?, 'image/jpeg', ?, ?, ?)`,
+		userID, ownerID, image, imageSize, imageSize, date)
+	return err
+}
+
+// seedGroups creates groups with up to 20 other users each: 70% accepted
+// members, 15% asking to join and 15% invited. Accepted members post in the
+// group.
+func (g *generator) seedGroups() error {
+	for i := 1; i <= g.cfg.Groups; i++ {
+		creator := g.users[g.rng.Intn(len(g.users))].id
+
+		title := fmt.Sprintf("%s %d", g.pick(groupNames), i)
+		if len(title) > 10 {
+			title = fmt.Sprintf("Group %d", i)
+		}
+
+		groupID, err := g.insert("groups", `INSERT INTO groups (title, description, user_id) VALUES (?, ?, ?)`, title, g.sentence(100), creator)
+		if err != nil {
+			return err
+		}
+		grp := &group{id: groupID, creator: creator, members: []int{creator}}
+
+		for _, memberID := range g.otherUsers(g.rng.Intn(20)+1, creator) {
+			requested, invited := false, false
+			switch r := g.rng.Float64(); {
+			case r < 0.15:
+				requested = true
+			case r < 0.3:
+				invited = true
+			}
+
+			if invited {
+				_, err := g.insert("group_invitees", `INSERT INTO group_invitees (group_id, user_id) VALUES (?, ?)`, groupID, memberID)
+				if err != nil {
+					return err
+				}
+			}
+			_, err := g.insert("groupmembers", `INSERT INTO groupmembers (group_id, member_id, request_pending, invitation_pending) VALUES (?, ?, ?, ?)`,
+				groupID, memberID, requested, invited)
+			if err != nil {
+				return err
+			}
+			if !requested && !invited {
+				grp.members = append(grp.members, memberID)
+			}
+		}
+		g.groups = append(g.groups, grp)
+
+		for n := g.rng.Intn(6); n > 0; n-- {
+			err := g.post(grp.members[g.rng.Intn(len(grp.members))], "public", groupID, nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// seedEvents adds events to every group. Like creating one through the API,
+// each notifies the members, though half of them have seen it already, and
+// about 60% of the members answer.
+func (g *generator) seedEvents() error {
+	for _, grp := range g.groups {
+		for n := g.around(g.cfg.EventsPerGroup); n > 0; n-- {
+			organizer := grp.members[g.rng.Intn(len(grp.members))]
+			day := g.cfg.Start.AddDate(0, 0, g.rng.Intn(90)).Format("2006-01-02")
+
+			eventID, err := g.insert("events", `INSERT INTO events (title, description, user_id, time, group_id) VALUES (?, ?, ?, ?, ?)`,
+				g.pick(eventNames), g.sentence(100), organizer, day, grp.id)
+			if err != nil {
+				return err
+			}
+
+			for _, memberID := range grp.members {
+				if g.chance(0.5) {
+					_, err := g.insert("eventnotifications", `INSERT INTO eventnotifications (event_id, member_id, group_id) VALUES (?, ?, ?)`, eventID, memberID, grp.id)
+					if err != nil {
+						return err
+					}
+				}
+				if g.chance(0.6) {
+					_, err := g.insert("eventparticipants", `INSERT INTO eventparticipants (event_id, participant_id, going) VALUES (?, ?, ?)`, eventID, memberID, g.chance(0.7))
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// seedMessages writes chats between users, mostly with people following them,
+// and in groups. The latest fifth of the private messages is unread.
+func (g *generator) seedMessages() error {
+	g.clock = g.cfg.Start
+
+	total := g.cfg.Users * g.cfg.MessagesPerUser
+	for i := 0; i < total; i++ {
+		sender := g.users[g.rng.Intn(len(g.users))]
+
+		var recipient int
+		if len(sender.followers) > 0 && g.chance(0.8) {
+			recipient = sender.followers[g.rng.Intn(len(sender.followers))]
+		} else {
+			recipient = g.otherUsers(1, sender.id)[0]
+		}
+
+		_, err := g.insert("messages", `INSERT INTO messages (sender_id, recipient_id, message, date, read) VALUES (?, ?, ?, ?, ?)`,
+			sender.id, recipient, g.sentence(200), g.tick(), i < total*4/5)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, grp := range g.groups {
+		for n := g.around(2 * len(grp.members)); n > 0; n-- {
+			sender := grp.members[g.rng.Intn(len(grp.members))]
+
+			_, err := g.insert("messages", `INSERT INTO messages (sender_id, group_id, message, date, read) VALUES (?, ?, ?, ?, ?)`,
+				sender, grp.id, g.sentence(200), g.tick(), true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	firstNames = []string{"Anna", "Mart", "Liis", "Karl", "Mari", "Jaan", "Kati", "Peeter", "Elina", "Mia", "Oskar", "Laura", "Rasmus", "Sofia", "Henri", "Emma", "Markus", "Grete", "Robin", "Kristi", "Tanel", "Helen", "Siim", "Eva"}
+	lastNames  = []string{"Tamm", "Saar", "Sepp", "Mägi", "Kask", "Kukk", "Rebane", "Ilves", "Pärn", "Koppel", "Lepik", "Tomson", "Luna", "Kuusk", "Oja", "Raud", "Vaher", "Lill"}
+	groupNames = []string{"Hikers", "Chess", "Bakers", "Runners", "Coders", "Gamers", "Readers", "Movies", "Music", "Garden", "Yoga", "Photo", "Travel"}
+	eventNames = []string{"Meetup", "Picnic", "Workshop", "Party", "Hike", "Quiz", "Dinner", "Concert", "Cleanup", "Movie"}
+	vocabulary = []string{
+		"today", "we", "went", "to", "the", "sea", "and", "it", "was", "lovely", "coffee", "with", "friends",
+		"new", "photo", "from", "my", "trip", "who", "wants", "join", "next", "weekend", "great", "book",
+		"finally", "finished", "project", "rain", "again", "sunny", "morning", "walk", "in", "park", "dog",
+		"cat", "baked", "bread", "tried", "recipe", "music", "concert", "tonight", "city", "forest", "lake",
+		"running", "training", "code", "review", "bug", "fixed", "deploy", "tea", "snow", "summer", "winter",
+		"happy", "tired", "busy", "excited", "thanks", "everyone", "see", "you", "soon", "maybe", "later",
+	}
+)
@@ -0,0 +1,159 @@
+package seed
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"social-network/database"
+	"social-network/database/sqlite"
+)
+
+var tables = []string{"users", "followers", "posts", "post_audience", "comments", "groups", "groupmembers", "group_invitees", "events", "eventnotifications", "eventparticipants", "messages"}
+
+func smallConfig(seed int64) Config {
+	cfg := DefaultConfig()
+	cfg.Seed = seed
+	cfg.Users = 30
+	cfg.Groups = 4
+	cfg.Images = 3
+	return cfg
+}
+
+// seeded returns a migrated and seeded store and its images folder.
+func seeded(t *testing.T, cfg Config) (*sqlite.SqliteDB, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	store, err := sqlite.Open(filepath.Join(dir, "seed.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if err := sqlite.Migrate(store.DB, "../migrations"); err != nil {
+		t.Fatal(err)
+	}
+	images := filepath.Join(dir, "images")
+	if _, err := Run(store.DB, images, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return store, images
+}
+
+// dump renders every seeded table as text.
+func dump(t *testing.T, db *sql.DB) string {
+	t.Helper()
+
+	var b strings.Builder
+	for _, table := range tables {
+		rows, err := db.Query(`SELECT * FROM ` + table + ` ORDER BY 1`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(pointers...); err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintln(&b, table, values)
+		}
+		rows.Close()
+	}
+	return b.String()
+}
+
+func count(t *testing.T, db *sql.DB, query string) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRunIsReproducible(t *testing.T) {
+	first, firstImages := seeded(t, smallConfig(7))
+	second, secondImages := seeded(t, smallConfig(7))
+	other, _ := seeded(t, smallConfig(8))
+
+	want := dump(t, first.DB)
+	if got := dump(t, second.DB); got != want {
+		t.Fatal("the same seed produced different rows")
+	}
+	if got := dump(t, other.DB); got == want {
+		t.Fatal("a different seed produced the same rows")
+	}
+
+	names, err := os.ReadDir(firstImages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Fatalf("wrote %d images, want 3", len(names))
+	}
+	for _, name := range names {
+		a, err := os.ReadFile(filepath.Join(firstImages, name.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(filepath.Join(secondImages, name.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Fatalf("image %s differs between runs", name.Name())
+		}
+	}
+}
+
+func TestRunCoversEveryState(t *testing.T) {
+	store, _ := seeded(t, smallConfig(1))
+
+	checks := map[string]string{
+		"public profiles":      `SELECT COUNT(*) FROM users WHERE public = 1`,
+		"private profiles":     `SELECT COUNT(*) FROM users WHERE public = 0`,
+		"follow requests":      `SELECT COUNT(*) FROM followers WHERE request_pending = 1`,
+		"public posts":         `SELECT COUNT(*) FROM posts WHERE privacy = 'public' AND group_id IS NULL`,
+		"private posts":        `SELECT COUNT(*) FROM posts WHERE privacy = 'private'`,
+		"selected-users posts": `SELECT COUNT(*) FROM post_audience`,
+		"group posts":          `SELECT COUNT(*) FROM posts WHERE group_id IS NOT NULL`,
+		"images":               `SELECT COUNT(*) FROM posts WHERE image != ''`,
+		"attachments":          `SELECT COUNT(*) FROM attachments a JOIN posts p ON p.post_id = a.post_id AND p.image = a.name`,
+		"join requests":        `SELECT COUNT(*) FROM groupmembers WHERE request_pending = 1`,
+		"invitations":          `SELECT COUNT(*) FROM group_invitees`,
+		"event answers":        `SELECT COUNT(*) FROM eventparticipants`,
+		"unread messages":      "SELECT COUNT(*) FROM messages WHERE `read` = 0 AND recipient_id IS NOT NULL",
+		"group messages":       `SELECT COUNT(*) FROM messages WHERE group_id IS NOT NULL`,
+	}
+	for name, query := range checks {
+		if count(t, store.DB, query) == 0 {
+			t.Errorf("no %s were seeded", name)
+		}
+	}
+
+	posts, _, err := store.FeedPosts(1, database.Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) == 0 {
+		t.Fatal("the seeded feed is empty")
+	}
+
+	if _, err := Run(store.DB, t.TempDir(), smallConfig(1)); err == nil {
+		t.Fatal("Run seeded a database that already has users")
+	}
+}
@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxBatchSize keeps IN lists well below SQLite's bound parameter limit.
+const maxBatchSize = 500
+
+func chunkIDs(ids []int) [][]int {
+	var chunks [][]int
+	for len(ids) > maxBatchSize {
+		chunks = append(chunks, ids[:maxBatchSize])
+		ids = ids[maxBatchSize:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func intArgs(ids []int) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// splitIDs parses a comma-separated list of user IDs as sent by clients.
+func splitIDs(list string) ([]int, error) {
+	var ids []int
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user ID %q: %w", id, err)
+		}
+		ids = append(ids, n)
+	}
+	return ids, nil
+}
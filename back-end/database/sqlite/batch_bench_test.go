@@ -0,0 +1,189 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	benchUsers = 500
+	benchPosts = 5000
+)
+
+var (
+	benchOnce sync.Once
+	benchDB   *SqliteDB
+	benchErr  error
+	benchDir  string
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchDB != nil {
+		benchDB.Close()
+	}
+	if benchDir != "" {
+		os.RemoveAll(benchDir)
+	}
+	os.Exit(code)
+}
+
+// seededBenchDB builds a migrated database with benchUsers users and
+// benchPosts posts carrying 0-4 comments each. It is built once per run.
+func seededBenchDB(b *testing.B) *SqliteDB {
+	b.Helper()
+
+	benchOnce.Do(func() {
+		benchDir, benchErr = os.MkdirTemp("", "sqlite-bench")
+		if benchErr != nil {
+			return
+		}
+
+		benchDB, benchErr = Open(filepath.Join(benchDir, "bench.db"))
+		if benchErr != nil {
+			return
+		}
+
+		if benchErr = Migrate(benchDB.DB, "../migrations"); benchErr != nil {
+			return
+		}
+
+		benchErr = seed(benchDB.DB)
+	})
+
+	if benchErr != nil {
+		b.Fatal(benchErr)
+	}
+	return benchDB
+}
+
+func seed(db *sql.DB) error {
+	rng := rand.New(rand.NewSource(1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := 1; i <= benchUsers; i++ {
+		_, err := tx.Exec(`INSERT INTO users (email, password, first_name, last_name, date_of_birth) VALUES (?, 'x', ?, ?, '1990-01-01')`,
+			fmt.Sprintf("user%d@example.com", i), fmt.Sprintf("First%d", i), fmt.Sprintf("Last%d", i))
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for i := 1; i <= benchPosts; i++ {
+		userID := rng.Intn(benchUsers) + 1
+		res, err := tx.Exec(`INSERT INTO posts (user_id, content, privacy, image, date) VALUES (?, ?, 'public', '', ?)`,
+			userID, fmt.Sprintf("post %d", i), now)
+		if err != nil {
+			return err
+		}
+		postID, _ := res.LastInsertId()
+
+		for c := rng.Intn(5); c > 0; c-- {
+			_, err := tx.Exec(`INSERT INTO comments (post_id, user_id, comment, image, date) VALUES (?, ?, 'nice', '', ?)`,
+				postID, rng.Intn(benchUsers)+1, now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func benchPostIDs(b *testing.B, db *SqliteDB, n int) []int {
+	b.Helper()
+
+	rows, err := db.DB.Query(`SELECT post_id FROM posts ORDER BY post_id DESC LIMIT ?`, n)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			b.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func BenchmarkCommentsPerPost(b *testing.B) {
+	db := seededBenchDB(b)
+
+	for _, n := range []int{50, 500, benchPosts} {
+		ids := benchPostIDs(b, db, n)
+		b.Run(fmt.Sprintf("posts=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, id := range ids {
+					if _, err := db.GetCommentsByPostID(id); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCommentsForPosts(b *testing.B) {
+	db := seededBenchDB(b)
+
+	for _, n := range []int{50, 500, benchPosts} {
+		ids := benchPostIDs(b, db, n)
+		b.Run(fmt.Sprintf("posts=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.CommentsForPosts(ids); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUserPerID(b *testing.B) {
+	db := seededBenchDB(b)
+
+	for _, n := range []int{10, 100, benchUsers} {
+		b.Run(fmt.Sprintf("users=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for id := 1; id <= n; id++ {
+					if _, err := db.GetUserByID(id); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkUsersByIDs(b *testing.B) {
+	db := seededBenchDB(b)
+
+	for _, n := range []int{10, 100, benchUsers} {
+		ids := make([]int, n)
+		for i := range ids {
+			ids[i] = i + 1
+		}
+		b.Run(fmt.Sprintf("users=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.UsersByIDs(ids); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
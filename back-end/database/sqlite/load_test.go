@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"social-network/database"
+	"social-network/models"
+)
+
+// The load test approximates a busy instance: loadClients users at once
+// chatting, posting, commenting, following and reading their feeds.
+const (
+	loadClients = 64
+	loadOps     = 50
+	loadUsers   = 20
+)
+
+func TestConcurrentLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping load test in short mode")
+	}
+
+	store, err := Open(filepath.Join(t.TempDir(), "load.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := Migrate(store.DB, "../migrations"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= loadUsers; i++ {
+		_, err := store.DB.Exec(`INSERT INTO users (email, password, first_name, last_name, date_of_birth, public) VALUES (?, 'x', ?, 'Load', '1990-01-01', ?)`,
+			fmt.Sprintf("load%d@example.com", i), fmt.Sprintf("Load%d", i), i%2)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errors []error
+	)
+	page := database.Page{Limit: 20}
+
+	for c := 0; c < loadClients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+
+			rng := rand.New(rand.NewSource(int64(c)))
+			userID := c%loadUsers + 1
+			for i := 0; i < loadOps; i++ {
+				otherID := rng.Intn(loadUsers) + 1
+
+				var err error
+				switch rng.Intn(6) {
+				case 0:
+					err = store.AddMessage(&models.Message{Message: "hi", UserIDFrom: userID, UserIDTo: otherID})
+				case 1:
+					_, _, err = store.GetMessages(userID, otherID, page)
+				case 2:
+					err = store.CreatePost(&models.Post{UserID: userID, Content: "load", Privacy: "public"})
+				case 3:
+					var posts []models.Post
+					posts, _, err = store.FeedPosts(userID, page)
+					if err == nil && len(posts) > 0 {
+						err = store.CreateComment(&models.Comment{PostID: posts[0].PostID, UserID: userID, Comment: "load"})
+					}
+				case 4:
+					if otherID != userID {
+						err = store.ToggleFollow(userID, otherID)
+					}
+				case 5:
+					_, err = store.GetUnreadMessages(userID)
+				}
+				if err != nil {
+					mu.Lock()
+					errors = append(errors, err)
+					mu.Unlock()
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	for _, err := range errors {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"database/sql"
+	"runtime"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite allows a single writer at a time. Writes therefore share one
+// connection and queue in Go instead of failing with "database is locked",
+// while WAL lets a separate pool of read-only connections run alongside them.
+// busy_timeout covers the remaining contention, such as checkpoints and other
+// processes using the file, and _txlock=immediate takes the write lock when a
+// transaction begins rather than failing when it first writes.
+const (
+	writeOptions = "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate"
+	readOptions  = "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=query_only(1)"
+)
+
+// readConns is the size of the read pool.
+var readConns = func() int {
+	if n := runtime.NumCPU(); n > 4 {
+		return n
+	}
+	return 4
+}()
+
+// Open opens the database file at path with a write and a read pool.
+func Open(path string) (*SqliteDB, error) {
+	writer, err := OpenWriter(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := openPool(path+readOptions, readConns)
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+
+	return &SqliteDB{DB: writer, ReadDB: reader}, nil
+}
+
+// OpenWriter opens the single-connection handle used for writes. It is also
+// what migrations run on.
+func OpenWriter(path string) (*sql.DB, error) {
+	return openPool(path+writeOptions, 1)
+}
+
+func openPool(dsn string, conns int) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(conns)
+	db.SetMaxIdleConns(conns)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
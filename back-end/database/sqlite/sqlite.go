@@ -5,23 +5,127 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"social-network/database"
+	"social-network/entities"
 	"social-network/models"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// SqliteDB sends writes to DB and reads to ReadDB, falling back to DB when
+// ReadDB is nil. See Open for how the two pools are set up.
 type SqliteDB struct {
-	DB *sql.DB
+	DB     *sql.DB
+	ReadDB *sql.DB
+
+	mu         sync.Mutex
+	writeStmts map[string]*sql.Stmt
+	readStmts  map[string]*sql.Stmt
 }
 
+var _ database.Store = (*SqliteDB)(nil)
+
 const dbTimeout = time.Second * 3
 
 func (m *SqliteDB) Connection() *sql.DB {
 	return m.DB
 }
 
+func (m *SqliteDB) Close() error {
+	m.mu.Lock()
+	for _, stmts := range []map[string]*sql.Stmt{m.writeStmts, m.readStmts} {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}
+	m.writeStmts, m.readStmts = nil, nil
+	m.mu.Unlock()
+
+	if m.ReadDB != nil {
+		m.ReadDB.Close()
+	}
+	return m.DB.Close()
+}
+
+// prepared returns the cached statement for query on the write or read pool,
+// preparing it on first use.
+func (m *SqliteDB) prepared(ctx context.Context, query string, write bool) (*sql.Stmt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	db, cache := m.DB, &m.writeStmts
+	if !write && m.ReadDB != nil {
+		db, cache = m.ReadDB, &m.readStmts
+	}
+
+	if stmt, ok := (*cache)[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if *cache == nil {
+		*cache = make(map[string]*sql.Stmt)
+	}
+	(*cache)[query] = stmt
+	return stmt, nil
+}
+
+func (m *SqliteDB) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := m.prepared(ctx, query, true)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (m *SqliteDB) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := m.prepared(ctx, query, false)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (m *SqliteDB) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	stmt, err := m.prepared(ctx, query, false)
+	if err != nil {
+		// Running the query unprepared reports the error through the Row.
+		return m.readDB().QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+func (m *SqliteDB) readDB() *sql.DB {
+	if m.ReadDB != nil {
+		return m.ReadDB
+	}
+	return m.DB
+}
+
+// withTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise.
+func (m *SqliteDB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (m *SqliteDB) Register(userData *models.UserData) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
@@ -33,7 +137,7 @@ func (m *SqliteDB) Register(userData *models.UserData) error {
 
 	stmt := `INSERT INTO users (email, password, first_name, last_name, date_of_birth, avatar, nickname, about_me) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err = m.DB.ExecContext(ctx, stmt, userData.Email, hash, userData.FirstName, userData.LastName, userData.DateOfBirth, userData.Avatar, userData.Nickname, userData.AboutMe)
+	_, err = m.exec(ctx, stmt, userData.Email, hash, userData.FirstName, userData.LastName, userData.DateOfBirth, userData.Avatar, userData.Nickname, userData.AboutMe)
 	if err != nil {
 		return err
 	}
@@ -48,7 +152,7 @@ func (m *SqliteDB) CheckEmail(email string) (bool, error) {
 	stmt := `SELECT EXISTS ( SELECT email FROM users WHERE email = $1)`
 
 	var emailNotTaken bool
-	row := m.DB.QueryRowContext(ctx, stmt, email)
+	row := m.queryRow(ctx, stmt, email)
 	err := row.Scan(&emailNotTaken)
 	if err != nil {
 		return false, err
@@ -62,7 +166,7 @@ func (m *SqliteDB) Login(userData *models.UserData) error {
 	defer cancel()
 
 	stmt := `SELECT password FROM users WHERE email = ?`
-	row := m.DB.QueryRowContext(ctx, stmt, userData.Email)
+	row := m.queryRow(ctx, stmt, userData.Email)
 	var hash string
 	err := row.Scan(&hash)
 	if err != nil {
@@ -81,7 +185,7 @@ func (m *SqliteDB) DataFromUserData(userData *models.UserData) (int, string, str
 	defer cancel()
 
 	stmt := `SELECT user_id, email, first_name, last_name FROM users WHERE email = ?`
-	row := m.DB.QueryRowContext(ctx, stmt, userData.Email)
+	row := m.queryRow(ctx, stmt, userData.Email)
 
 	var userId int
 	var email, firstName, lastName string
@@ -97,9 +201,9 @@ func (m *SqliteDB) Session(session *models.Session) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO sessions (user_id, email, first_name, last_name, cookie) VALUES (?, ?, ?, ?, ?)`
+	stmt := `INSERT INTO sessions (user_id, cookie) VALUES (?, ?)`
 
-	_, err := m.DB.ExecContext(ctx, stmt, session.UserID, session.Email, session.FirstName, session.LastName, session.Cookie)
+	_, err := m.exec(ctx, stmt, session.UserID, session.Cookie)
 	if err != nil {
 		return err
 	}
@@ -112,7 +216,7 @@ func (m *SqliteDB) DeleteSession(uuid string) error {
 
 	stmt := `DELETE FROM sessions WHERE cookie = ?`
 
-	_, err := m.DB.ExecContext(ctx, stmt, uuid)
+	_, err := m.exec(ctx, stmt, uuid)
 	if err != nil {
 		return err
 	}
@@ -125,19 +229,22 @@ func (m *SqliteDB) DataFromSession(r *http.Request) (int, string, string, string
 
 	cookie, err := r.Cookie("sessionId")
 	if err != nil {
-		return 0, "", "", "", err
+		return 0, "", "", "", fmt.Errorf("%w: %v", database.ErrNoSession, err)
 	}
 
 	uuid, err := uuid.FromString(cookie.Value)
 	if err != nil {
-		return 0, "", "", "", err
+		return 0, "", "", "", fmt.Errorf("%w: %v", database.ErrNoSession, err)
 	}
 
-	stmt := `SELECT user_id, email, first_name, last_name FROM sessions WHERE cookie = ?`
-	row := m.DB.QueryRowContext(ctx, stmt, uuid.String())
+	stmt := `SELECT s.user_id, u.email, u.first_name, u.last_name FROM sessions s JOIN users u ON u.user_id = s.user_id WHERE s.cookie = ?`
+	row := m.queryRow(ctx, stmt, uuid.String())
 	var userId int
 	var email, firstName, lastName string
 	err = row.Scan(&userId, &email, &firstName, &lastName)
+	if err == sql.ErrNoRows {
+		return 0, "", "", "", database.ErrNoSession
+	}
 	if err != nil {
 		return 0, "", "", "", err
 	}
@@ -150,7 +257,7 @@ func (m *SqliteDB) GetUserDataByEmail(email string) (*models.UserData, error) {
 
 	stmt := `SELECT email, first_name, last_name, date_of_birth, avatar, nickname, about_me, public FROM users WHERE email = $1 LIMIT 1`
 
-	row := m.DB.QueryRowContext(ctx, stmt, email)
+	row := m.queryRow(ctx, stmt, email)
 	userData := &models.UserData{}
 	err := row.Scan(&userData.Email, &userData.FirstName, &userData.LastName, &userData.DateOfBirth, &userData.Avatar, &userData.Nickname, &userData.AboutMe, &userData.Public)
 	if err != nil {
@@ -160,37 +267,13 @@ func (m *SqliteDB) GetUserDataByEmail(email string) (*models.UserData, error) {
 	return userData, nil
 }
 
-func (m *SqliteDB) SearchUsers(query string) ([]models.UserData, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `SELECT user_id, first_name, last_name FROM users WHERE first_name LIKE ? OR last_name LIKE ?`
-
-	rows, err := m.DB.QueryContext(ctx, stmt, "%"+query+"%", "%"+query+"%")
-	if err != nil {
-		return nil, err
-	}
-
-	var users []models.UserData
-	for rows.Next() {
-		var userData models.UserData
-		err := rows.Scan(&userData.UserID, &userData.FirstName, &userData.LastName)
-		if err != nil {
-			return nil, err
-		}
-
-		users = append(users, userData)
-	}
-	return users, nil
-}
-
 func (m *SqliteDB) GetUser(id int) (*models.UserData, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	stmt := `SELECT user_id, email, first_name, last_name, date_of_birth, avatar, nickname, about_me, public FROM users WHERE user_id = $1`
 
-	row := m.DB.QueryRowContext(ctx, stmt, id)
+	row := m.queryRow(ctx, stmt, id)
 
 	var user models.UserData
 
@@ -211,7 +294,7 @@ func (m *SqliteDB) GetUserByID(userID int) (*models.UserData, error) {
 
 	stmt := `SELECT user_id, first_name, last_name FROM users WHERE user_id = $1`
 
-	row := m.DB.QueryRowContext(ctx, stmt, userID)
+	row := m.queryRow(ctx, stmt, userID)
 
 	var user models.UserData
 
@@ -226,269 +309,1234 @@ func (m *SqliteDB) GetUserByID(userID int) (*models.UserData, error) {
 	return &user, nil
 }
 
-func (m *SqliteDB) CreatePost(post *models.Post) error {
+// UsersByIDs loads several users in one round trip, keyed by user ID. IDs
+// that do not exist are missing from the map.
+func (m *SqliteDB) UsersByIDs(userIDs []int) (map[int]*models.UserData, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	post.Date = time.Now()
+	users := make(map[int]*models.UserData, len(userIDs))
+	for _, chunk := range chunkIDs(userIDs) {
+		stmt := `SELECT user_id, first_name, last_name, COALESCE(nickname, '') FROM users WHERE user_id IN (` + placeholders(len(chunk)) + `)`
 
-	stmt := `INSERT INTO posts (user_id, content, first_name, last_name, privacy, selected_user_id, image, date, group_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		rows, err := m.query(ctx, stmt, intArgs(chunk)...)
+		if err != nil {
+			return nil, err
+		}
 
-	_, err := m.DB.ExecContext(ctx, stmt, post.UserID, post.Content, post.FirstName, post.LastName, post.Privacy, post.SelectedUserID, post.Image, post.Date, post.GroupID)
-	if err != nil {
-		return err
+		for rows.Next() {
+			var user models.UserData
+			if err := rows.Scan(&user.UserID, &user.FirstName, &user.LastName, &user.Nickname); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			users[user.UserID] = &user
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	return users, nil
 }
 
-func (m *SqliteDB) AllPosts() ([]models.Post, error) {
+func (m *SqliteDB) CreatePost(post *models.Post) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT post_id, user_id, content, first_name, last_name, privacy, selected_user_id, image, date, group_id FROM posts`
-
-	rows, err := m.DB.QueryContext(ctx, stmt)
-	if err != nil {
-		return nil, err
+	var userIDs []int
+	if post.Privacy == "for-selected-users" {
+		var err error
+		userIDs, err = splitIDs(post.SelectedUserID)
+		if err != nil {
+			return err
+		}
 	}
 
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.PostID, &post.UserID, &post.Content, &post.FirstName, &post.LastName, &post.Privacy, &post.SelectedUserID, &post.Image, &post.Date, &post.GroupID)
+	post.Date = time.Now()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		stmt := `INSERT INTO posts (user_id, content, privacy, image, date, group_id) VALUES (?, ?, ?, ?, ?, NULLIF(?, 0))`
+
+		result, err := tx.ExecContext(ctx, stmt, post.UserID, post.Content, post.Privacy, post.Image, post.Date, post.GroupID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		posts = append(posts, post)
-	}
-	return posts, nil
+
+		postID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		post.PostID = int(postID)
+
+		for _, userID := range userIDs {
+			_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO post_audience (post_id, user_id) VALUES (?, ?)`, post.PostID, userID)
+			if err != nil {
+				return err
+			}
+		}
+		err = insertAttachments(ctx, tx, post.UserID, post.PostID, 0, post.Attachments)
+		if err != nil {
+			return err
+		}
+		return replaceTextEntities(ctx, tx, models.Target{PostID: post.PostID}, post.UserID, post.Mentions, post.Hashtags)
+	})
 }
 
-func (m *SqliteDB) GetPublicPosts() ([]models.Post, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+// insertAttachments stores attachments in order, for the post or comment
+// with the given ID or, if both are 0, to be sent with a message later.
+func insertAttachments(ctx context.Context, tx *sql.Tx, userID, postID, commentID int, attachments []models.Attachment) error {
+	for i := range attachments {
+		err := insertAttachment(ctx, tx, userID, postID, commentID, i, &attachments[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	stmt := `SELECT post_id, user_id, content, first_name, last_name, image, date, group_id FROM posts WHERE privacy = 'public'`
+// insertAttachment stores one attachment at the given position and sets its
+// ID.
+func insertAttachment(ctx context.Context, tx *sql.Tx, userID, postID, commentID, position int, a *models.Attachment) error {
+	stmt := `INSERT INTO attachments (user_id, post_id, comment_id, position, name, mime_type, alt_text, width, height, size) VALUES (?, NULLIF(?, 0), NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?)`
 
-	rows, err := m.DB.QueryContext(ctx, stmt)
+	result, err := tx.ExecContext(ctx, stmt, userID, postID, commentID, position, a.Name, a.MimeType, a.AltText, a.Width, a.Height, a.Size)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var publicPosts []models.Post
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.PostID, &post.UserID, &post.Content, &post.FirstName, &post.LastName, &post.Image, &post.Date, &post.GroupID)
-		if err != nil {
-			return nil, err
-		}
-		publicPosts = append(publicPosts, post)
+	attachmentID, err := result.LastInsertId()
+	if err != nil {
+		return err
 	}
-
-	return publicPosts, nil
+	a.AttachmentID = int(attachmentID)
+	return nil
 }
 
-func (m *SqliteDB) ProfilePosts(userID int) ([]models.Post, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+// replaceAttachments makes attachments the list of the post or comment with
+// the given ID, see UpdatePost, and returns the names of the files of those
+// it removed.
+func replaceAttachments(ctx context.Context, tx *sql.Tx, userID, postID, commentID int, attachments []models.Attachment) ([]string, error) {
+	column, ownerID := "post_id", postID
+	if commentID != 0 {
+		column, ownerID = "comment_id", commentID
+	}
 
-	stmt := `SELECT post_id, user_id, content, first_name, last_name,  privacy, selected_user_id, image, date, group_id FROM posts WHERE user_id = ?`
+	cond := column + ` = ?`
+	args := []interface{}{ownerID}
+	var kept []int
+	for _, a := range attachments {
+		if a.AttachmentID != 0 {
+			kept = append(kept, a.AttachmentID)
+		}
+	}
+	if len(kept) > 0 {
+		cond += ` AND attachment_id NOT IN (` + placeholders(len(kept)) + `)`
+		args = append(args, intArgs(kept)...)
+	}
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT name FROM attachments WHERE `+cond, args...)
 	if err != nil {
 		return nil, err
 	}
-
-	var posts []models.Post
+	var removed []string
 	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.PostID, &post.UserID, &post.Content, &post.FirstName, &post.LastName, &post.Privacy, &post.SelectedUserID, &post.Image, &post.Date, &post.GroupID)
+		var name string
+		err := rows.Scan(&name)
 		if err != nil {
+			rows.Close()
 			return nil, err
 		}
-		posts = append(posts, post)
+		removed = append(removed, name)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
 	}
-	return posts, nil
-}
-
-func (m *SqliteDB) GetPostsByUserID(userID int) ([]models.Post, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `SELECT post_id, user_id, content, first_name, last_name, privacy, image, date, group_id FROM posts WHERE user_id = ?`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	_, err = tx.ExecContext(ctx, `DELETE FROM attachments WHERE `+cond, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.PostID, &post.UserID, &post.Content, &post.FirstName, &post.LastName, &post.Privacy, &post.Image, &post.Date, &post.GroupID)
+	for i := range attachments {
+		a := &attachments[i]
+		if a.AttachmentID == 0 {
+			err = insertAttachment(ctx, tx, userID, postID, commentID, i, a)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		result, err := tx.ExecContext(ctx, `UPDATE attachments SET position = ?, alt_text = ? WHERE attachment_id = ? AND `+column+` = ?`, i, a.AltText, a.AttachmentID, ownerID)
 		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, post)
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n != 1 {
+			return nil, sql.ErrNoRows
+		}
 	}
-
-	return posts, nil
+	return removed, nil
 }
 
-func (m *SqliteDB) CreateComment(comment *models.Comment) error {
+func (m *SqliteDB) PostAuthor(postID int) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	comment.Date = time.Now()
-
-	stmt := `INSERT INTO comments (post_id, user_id, comment, first_name, last_name, image, date) VALUES (?, ?, ?, ?, ?, ?, ?)`
-
-	_, err := m.DB.ExecContext(ctx, stmt, comment.PostID, comment.UserID, comment.Comment, comment.FirstName, comment.LastName, comment.Image, comment.Date)
+	var userID int
+	err := m.queryRow(ctx, `SELECT user_id FROM posts WHERE post_id = ?`, postID).Scan(&userID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return userID, nil
 }
 
-func (m *SqliteDB) GetCommentsByPostID(postID int) ([]models.Comment, error) {
+func (m *SqliteDB) UpdatePost(post *models.Post) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT comment_id, user_id, comment, first_name, last_name, image, date FROM comments WHERE post_id = ?`
-
-	rows, err := m.DB.QueryContext(ctx, stmt, postID)
-	if err != nil {
-		return nil, err
+	var userIDs []int
+	if post.Privacy == "for-selected-users" {
+		var err error
+		userIDs, err = splitIDs(post.SelectedUserID)
+		if err != nil {
+			return err
+		}
 	}
 
-	var comments []models.Comment
+	editedAt := time.Now()
 
-	for rows.Next() {
-		var comment models.Comment
-		err := rows.Scan(&comment.CommentID, &comment.UserID, &comment.Comment, &comment.FirstName, &comment.LastName, &comment.Image, &comment.Date)
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		err := keepRevision(ctx, tx, post.PostID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		comments = append(comments, comment)
-	}
 
-	return comments, nil
-}
+		_, err = replaceAttachments(ctx, tx, post.UserID, post.PostID, 0, post.Attachments)
+		if err != nil {
+			return err
+		}
 
-func (m *SqliteDB) UpdateProfileType(userID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+		stmt := `UPDATE posts SET content = ?, privacy = ?, image = ?, edited_at = ? WHERE post_id = ?`
+		_, err = tx.ExecContext(ctx, stmt, post.Content, post.Privacy, post.Image, editedAt, post.PostID)
+		if err != nil {
+			return err
+		}
 
-	stmt := `UPDATE users SET public = NOT public WHERE user_id = ?`
-	_, err := m.DB.ExecContext(ctx, stmt, userID)
+		_, err = tx.ExecContext(ctx, `DELETE FROM post_audience WHERE post_id = ?`, post.PostID)
+		if err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO post_audience (post_id, user_id) VALUES (?, ?)`, post.PostID, userID)
+			if err != nil {
+				return err
+			}
+		}
+		return replaceTextEntities(ctx, tx, models.Target{PostID: post.PostID}, post.UserID, post.Mentions, post.Hashtags)
+	})
 	if err != nil {
 		return err
 	}
 
+	post.EditedAt = &editedAt
 	return nil
 }
 
-func (m *SqliteDB) FollowUser(followerID, followingID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `INSERT INTO followers (follower_id, following_id, request_pending) VALUES (?, ?, 0)`
-
-	_, err := m.DB.ExecContext(ctx, stmt, followerID, followingID)
+// keepRevision copies the post as it is, attachments included, to a new
+// revision. It returns sql.ErrNoRows if the post does not exist.
+func keepRevision(ctx context.Context, tx *sql.Tx, postID int) error {
+	stmt := `INSERT INTO post_revisions (post_id, content, privacy, selected_user_id, date)
+		SELECT p.post_id, p.content, p.privacy,
+			COALESCE((SELECT group_concat(a.user_id) FROM post_audience a WHERE a.post_id = p.post_id), ''),
+			COALESCE(p.edited_at, p.date)
+		FROM posts p WHERE p.post_id = ?`
+	result, err := tx.ExecContext(ctx, stmt, postID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	revisionID, err := result.LastInsertId()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	stmt = `INSERT INTO attachments (user_id, revision_id, position, name, mime_type, alt_text, width, height, size, created_at)
+		SELECT user_id, ?, position, name, mime_type, alt_text, width, height, size, created_at FROM attachments WHERE post_id = ?`
+	_, err = tx.ExecContext(ctx, stmt, revisionID, postID)
+	return err
 }
 
-func (m *SqliteDB) IsFollowing(userID, followingID int) (bool, error) {
+// postFiles lists the files of a post, its comments and its revisions. It
+// binds the post ID three times.
+const postFiles = `SELECT DISTINCT name FROM attachments
+	WHERE post_id = ?
+	OR comment_id IN (SELECT comment_id FROM comments WHERE post_id = ?)
+	OR revision_id IN (SELECT revision_id FROM post_revisions WHERE post_id = ?)`
+
+func (m *SqliteDB) DeletePost(postID int) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT EXISTS ( SELECT 1 FROM followers WHERE follower_id = $1 AND following_id = $2 AND request_pending = false)`
+	var names []string
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, postFiles, postID, postID, postID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name string
+			err := rows.Scan(&name)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			names = append(names, name)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
 
-	var isFollowing bool
-	row := m.DB.QueryRowContext(ctx, stmt, userID, followingID)
-	err := row.Scan(&isFollowing)
+		// Comments, revisions and attachments go with the post.
+		result, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE post_id = ?`, postID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return isFollowing, nil
+	return names, nil
 }
 
-func (m *SqliteDB) IsPending(userID, followingID int) (bool, error) {
+func (m *SqliteDB) PostRevisions(postID int) ([]models.PostRevision, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT request_pending FROM followers WHERE follower_id = $1 AND following_id = $2 LIMIT 1`
-
-	var isPending bool
-	row := m.DB.QueryRowContext(ctx, stmt, userID, followingID)
-	err := row.Scan(&isPending)
+	stmt := `SELECT revision_id, post_id, content, privacy, selected_user_id, date FROM post_revisions WHERE post_id = ? ORDER BY revision_id`
+	rows, err := m.query(ctx, stmt, postID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
-		}
-		return false, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return isPending, nil
-}
-
-func (m *SqliteDB) FollowNotPublicUser(followerID, followingID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `INSERT INTO followers (follower_id, following_id, request_pending) VALUES (?, ?, 1)`
+	var revisions []models.PostRevision
+	for rows.Next() {
+		var r models.PostRevision
+		err := rows.Scan(&r.RevisionID, &r.PostID, &r.Content, &r.Privacy, &r.SelectedUserID, &r.Date)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	_, err := m.DB.ExecContext(ctx, stmt, followerID, followingID)
+	revisionIDs := make([]int, len(revisions))
+	for i := range revisions {
+		revisionIDs[i] = revisions[i].RevisionID
+	}
+	attachments, err := m.attachmentsFor("revision_id", revisionIDs)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for i := range revisions {
+		revisions[i].Attachments = attachments[revisions[i].RevisionID]
 	}
 
-	return nil
+	return revisions, nil
 }
 
-func (m *SqliteDB) UnfollowUser(followerID, followingID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `DELETE FROM followers WHERE follower_id = ? AND following_id = ?`
+// visiblePost is the condition for posts a viewer may see: ungrouped posts
+// that are public, their own, from someone they follow (private) or shared
+// with them (for-selected-users), and posts in groups they belong to or
+// created. It binds the viewer's ID five times; see visibleArgs.
+const visiblePost = `(
+	(p.group_id IS NULL AND (
+		p.privacy = 'public'
+		OR p.user_id = ?
+		OR (p.privacy = 'private' AND EXISTS (SELECT 1 FROM followers f WHERE f.follower_id = ? AND f.following_id = p.user_id AND f.request_pending = false))
+		OR (p.privacy = 'for-selected-users' AND EXISTS (SELECT 1 FROM post_audience a WHERE a.post_id = p.post_id AND a.user_id = ?))
+	))
+	OR (p.group_id IS NOT NULL AND (
+		EXISTS (SELECT 1 FROM groupmembers gm WHERE gm.group_id = p.group_id AND gm.member_id = ? AND gm.request_pending = false AND gm.invitation_pending = false)
+		OR EXISTS (SELECT 1 FROM groups g WHERE g.group_id = p.group_id AND g.user_id = ?)
+	))
+)`
 
-	_, err := m.DB.ExecContext(ctx, stmt, followerID, followingID)
-	if err != nil {
-		return err
-	}
-	return nil
+func visibleArgs(viewerID int) []interface{} {
+	return []interface{}{viewerID, viewerID, viewerID, viewerID, viewerID}
 }
 
-func (m *SqliteDB) IsUserPublic(userID int) (bool, error) {
+// postColumns selects a models.Post from posts p joined with its author u. The
+// audience of for-selected-users posts is folded back into selected_user_id.
+const postColumns = `p.post_id, p.user_id, p.content, u.first_name, u.last_name, p.privacy,
+	COALESCE((SELECT group_concat(a.user_id) FROM post_audience a WHERE a.post_id = p.post_id), ''),
+	p.image, p.date, p.edited_at, COALESCE(p.group_id, 0)`
+
+// queryPosts runs a posts query whose WHERE clause ends in cond, adding the
+// keyset condition for page.
+func (m *SqliteDB) queryPosts(cond string, args []interface{}, page database.Page) ([]models.Post, database.Cursors, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT public FROM users WHERE user_id = ?`
+	where, tail, pageArgs := keyset(page, "p.post_id", true)
+	stmt := `SELECT ` + postColumns + ` FROM posts p JOIN users u ON u.user_id = p.user_id WHERE ` + cond + ` AND ` + where + ` ` + tail
 
-	var isPublic bool
-	row := m.DB.QueryRowContext(ctx, stmt, userID)
-	err := row.Scan(&isPublic)
+	rows, err := m.query(ctx, stmt, append(args, pageArgs...)...)
 	if err != nil {
-		return false, err
+		return nil, database.Cursors{}, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(&post.PostID, &post.UserID, &post.Content, &post.FirstName, &post.LastName, &post.Privacy, &post.SelectedUserID, &post.Image, &post.Date, &post.EditedAt, &post.GroupID)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Cursors{}, err
+	}
+
+	posts, cursors := database.Paginate(posts, page, postKey)
+	return posts, cursors, nil
+}
+
+// FeedPosts returns the home feed: every ungrouped post the viewer may see.
+func (m *SqliteDB) FeedPosts(viewerID int, page database.Page) ([]models.Post, database.Cursors, error) {
+	cond := `(p.group_id IS NULL OR ` + carriesTag(`h.tag IN (SELECT tag FROM hashtag_follows WHERE user_id = ?)`) + `) AND ` + visiblePost
+	args := append([]interface{}{viewerID, viewerID}, visibleArgs(viewerID)...)
+	return m.queryPosts(cond, args, page)
+}
+
+// UserPosts returns the ungrouped posts by userID that the viewer may see.
+func (m *SqliteDB) UserPosts(viewerID, userID int, page database.Page) ([]models.Post, database.Cursors, error) {
+	args := append([]interface{}{userID}, visibleArgs(viewerID)...)
+	return m.queryPosts(`p.user_id = ? AND p.group_id IS NULL AND `+visiblePost, args, page)
+}
+
+// GroupPosts returns the posts in a group, or none if the viewer is not a
+// member.
+func (m *SqliteDB) GroupPosts(viewerID, groupID int, page database.Page) ([]models.Post, database.Cursors, error) {
+	args := append([]interface{}{groupID}, visibleArgs(viewerID)...)
+	return m.queryPosts(`p.group_id = ? AND `+visiblePost, args, page)
+}
+
+// ProfilePosts returns all of the user's own posts.
+func (m *SqliteDB) ProfilePosts(userID int, page database.Page) ([]models.Post, database.Cursors, error) {
+	return m.queryPosts(`p.user_id = ?`, []interface{}{userID}, page)
+}
+
+// imageVisible is the condition for CanViewImage. It binds the file name,
+// then the name and visibleArgs for the images and attachments of posts and
+// comments, then the name and the viewer's ID four times for messages and
+// once more for attachments not sent yet; see imageArgs.
+const imageVisible = `SELECT EXISTS (SELECT 1 FROM users WHERE avatar = ?)
+	OR EXISTS (SELECT 1 FROM posts p WHERE p.image = ? AND ` + visiblePost + `)
+	OR EXISTS (SELECT 1 FROM comments c JOIN posts p ON p.post_id = c.post_id WHERE c.image = ? AND ` + visiblePost + `)
+	OR EXISTS (SELECT 1 FROM attachments a JOIN posts p ON p.post_id = a.post_id WHERE a.name = ? AND ` + visiblePost + `)
+	OR EXISTS (SELECT 1 FROM attachments a JOIN comments c ON c.comment_id = a.comment_id JOIN posts p ON p.post_id = c.post_id WHERE a.name = ? AND ` + visiblePost + `)
+	OR EXISTS (SELECT 1 FROM attachments a JOIN messages m ON m.message_id = a.message_id WHERE a.name = ? AND (
+		m.sender_id = ? OR m.recipient_id = ?
+		OR EXISTS (SELECT 1 FROM groupmembers gm WHERE gm.group_id = m.group_id AND gm.member_id = ? AND gm.request_pending = false AND gm.invitation_pending = false)
+		OR EXISTS (SELECT 1 FROM groups g WHERE g.group_id = m.group_id AND g.user_id = ?)
+	))
+	OR EXISTS (SELECT 1 FROM attachments a WHERE a.name = ? AND a.user_id = ? AND a.post_id IS NULL AND a.comment_id IS NULL AND a.message_id IS NULL AND a.revision_id IS NULL)`
+
+func imageArgs(viewerID int, name string) []interface{} {
+	args := []interface{}{name}
+	for i := 0; i < 4; i++ {
+		args = append(append(args, name), visibleArgs(viewerID)...)
+	}
+	args = append(args, name, viewerID, viewerID, viewerID, viewerID)
+	return append(args, name, viewerID)
+}
+
+func (m *SqliteDB) CanViewImage(viewerID int, name string) (bool, error) {
+	if name == "" {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var visible bool
+	err := m.queryRow(ctx, imageVisible, imageArgs(viewerID, name)...).Scan(&visible)
+	if err != nil {
+		return false, err
+	}
+
+	return visible, nil
+}
+
+const imageUsed = `SELECT EXISTS (SELECT 1 FROM users WHERE avatar = ?)
+	OR EXISTS (SELECT 1 FROM posts WHERE image = ?)
+	OR EXISTS (SELECT 1 FROM comments WHERE image = ?)
+	OR EXISTS (SELECT 1 FROM attachments WHERE name = ?)`
+
+func (m *SqliteDB) ImageInUse(name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var used bool
+	err := m.queryRow(ctx, imageUsed, name, name, name, name).Scan(&used)
+	if err != nil {
+		return false, err
+	}
+
+	return used, nil
+}
+
+func (m *SqliteDB) GetPublicPosts() ([]models.Post, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT p.post_id, p.user_id, p.content, u.first_name, u.last_name, p.image, p.date, COALESCE(p.group_id, 0) FROM posts p JOIN users u ON u.user_id = p.user_id WHERE p.privacy = 'public'`
+
+	rows, err := m.query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	var publicPosts []models.Post
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(&post.PostID, &post.UserID, &post.Content, &post.FirstName, &post.LastName, &post.Image, &post.Date, &post.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		publicPosts = append(publicPosts, post)
+	}
+
+	return publicPosts, nil
+}
+
+func (m *SqliteDB) CreateComment(comment *models.Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	comment.Date = time.Now()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		stmt := `INSERT INTO comments (post_id, user_id, comment, image, date, parent_id, depth) VALUES (?, ?, ?, ?, ?, NULLIF(?, 0), ?)`
+
+		result, err := tx.ExecContext(ctx, stmt, comment.PostID, comment.UserID, comment.Comment, comment.Image, comment.Date, comment.ParentID, comment.Depth)
+		if err != nil {
+			return err
+		}
+
+		commentID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		comment.CommentID = int(commentID)
+
+		err = insertAttachments(ctx, tx, comment.UserID, 0, comment.CommentID, comment.Attachments)
+		if err != nil {
+			return err
+		}
+		return replaceTextEntities(ctx, tx, models.Target{CommentID: comment.CommentID}, comment.UserID, comment.Mentions, comment.Hashtags)
+	})
+}
+
+// commentColumns selects a models.Comment from comments c joined with its
+// author u, see scanComment.
+const commentColumns = `c.comment_id, c.post_id, c.user_id, c.comment, u.first_name, u.last_name, c.image, c.date,
+	c.edited_at, COALESCE(c.parent_id, 0), c.depth, c.deleted_at IS NOT NULL,
+	(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.comment_id)`
+
+// scanComment reads a row of commentColumns. Deleted comments do not name
+// their author.
+func scanComment(row interface{ Scan(...interface{}) error }) (models.Comment, error) {
+	var c models.Comment
+	err := row.Scan(&c.CommentID, &c.PostID, &c.UserID, &c.Comment, &c.FirstName, &c.LastName, &c.Image, &c.Date,
+		&c.EditedAt, &c.ParentID, &c.Depth, &c.Deleted, &c.ReplyCount)
+	if c.Deleted {
+		c.UserID, c.FirstName, c.LastName = 0, "", ""
+	}
+	return c, err
+}
+
+func (m *SqliteDB) GetComment(commentID int) (models.Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT ` + commentColumns + ` FROM comments c JOIN users u ON u.user_id = c.user_id WHERE c.comment_id = ?`
+	return scanComment(m.queryRow(ctx, stmt, commentID))
+}
+
+func (m *SqliteDB) UpdateComment(comment *models.Comment) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	editedAt := time.Now()
+
+	var removed []string
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		stmt := `UPDATE comments SET comment = ?, image = ?, edited_at = ? WHERE comment_id = ? AND deleted_at IS NULL`
+		result, err := tx.ExecContext(ctx, stmt, comment.Comment, comment.Image, editedAt, comment.CommentID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+
+		removed, err = replaceAttachments(ctx, tx, comment.UserID, 0, comment.CommentID, comment.Attachments)
+		if err != nil {
+			return err
+		}
+		return replaceTextEntities(ctx, tx, models.Target{CommentID: comment.CommentID}, comment.UserID, comment.Mentions, comment.Hashtags)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	comment.EditedAt = &editedAt
+	return removed, nil
+}
+
+func (m *SqliteDB) DeleteComment(commentID int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var names []string
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		var parentID int
+		var replied bool
+		stmt := `SELECT COALESCE(parent_id, 0), EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.comment_id) FROM comments c WHERE comment_id = ?`
+		err := tx.QueryRowContext(ctx, stmt, commentID).Scan(&parentID, &replied)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT DISTINCT name FROM attachments WHERE comment_id = ?`, commentID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name string
+			err := rows.Scan(&name)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			names = append(names, name)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		if replied {
+			_, err = tx.ExecContext(ctx, `UPDATE comments SET comment = '', image = '', deleted_at = ? WHERE comment_id = ?`, time.Now(), commentID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `DELETE FROM attachments WHERE comment_id = ?`, commentID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `DELETE FROM mentions WHERE comment_id = ?`, commentID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `DELETE FROM hashtags WHERE comment_id = ?`, commentID)
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM comments WHERE comment_id = ?`, commentID)
+		if err != nil {
+			return err
+		}
+
+		// Deleted comments left without replies go too.
+		for parentID != 0 {
+			var grandparentID int
+			stmt := `SELECT COALESCE(parent_id, 0) FROM comments c WHERE comment_id = ? AND deleted_at IS NOT NULL
+				AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.comment_id)`
+			err := tx.QueryRowContext(ctx, stmt, parentID).Scan(&grandparentID)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `DELETE FROM comments WHERE comment_id = ?`, parentID)
+			if err != nil {
+				return err
+			}
+			parentID = grandparentID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func (m *SqliteDB) GetCommentsByPostID(postID int) ([]models.Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT ` + commentColumns + ` FROM comments c JOIN users u ON u.user_id = c.user_id WHERE c.post_id = ? ORDER BY c.comment_id`
+
+	rows, err := m.query(ctx, stmt, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// CommentsForPosts loads the comments of several posts in one round trip,
+// keyed by post ID and in the order they were written.
+func (m *SqliteDB) CommentsForPosts(postIDs []int) (map[int][]models.Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	comments := make(map[int][]models.Comment, len(postIDs))
+	for _, chunk := range chunkIDs(postIDs) {
+		stmt := `SELECT ` + commentColumns + ` FROM comments c JOIN users u ON u.user_id = c.user_id WHERE c.post_id IN (` + placeholders(len(chunk)) + `) ORDER BY c.comment_id`
+
+		rows, err := m.query(ctx, stmt, intArgs(chunk)...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			comment, err := scanComment(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			comments[comment.PostID] = append(comments[comment.PostID], comment)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return comments, nil
+}
+
+func (m *SqliteDB) PostComments(postID, parentID int, page database.Page) ([]models.Comment, database.Cursors, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	cond, condArgs := `c.post_id = ? AND c.parent_id IS NULL`, []interface{}{postID}
+	if parentID != 0 {
+		cond, condArgs = `c.post_id = ? AND c.parent_id = ?`, []interface{}{postID, parentID}
+	}
+	where, tail, args := keyset(page, "c.comment_id", false)
+	stmt := `SELECT ` + commentColumns + ` FROM comments c JOIN users u ON u.user_id = c.user_id WHERE ` + cond + ` AND ` + where + ` ` + tail
+
+	rows, err := m.query(ctx, stmt, append(condArgs, args...)...)
+	if err != nil {
+		return nil, database.Cursors{}, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		comments = append(comments, comment)
+	}
+
+	comments, cursors := database.Paginate(comments, page, func(c models.Comment) int { return c.CommentID })
+	return comments, cursors, nil
+}
+
+func (m *SqliteDB) CreateAttachments(userID int, attachments []models.Attachment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		return insertAttachments(ctx, tx, userID, 0, 0, attachments)
+	})
+}
+
+func (m *SqliteDB) AttachmentsForPosts(postIDs []int) (map[int][]models.Attachment, error) {
+	return m.attachmentsFor("post_id", postIDs)
+}
+
+func (m *SqliteDB) AttachmentsForComments(commentIDs []int) (map[int][]models.Attachment, error) {
+	return m.attachmentsFor("comment_id", commentIDs)
+}
+
+func (m *SqliteDB) AttachmentsForMessages(messageIDs []int) (map[int][]models.Attachment, error) {
+	return m.attachmentsFor("message_id", messageIDs)
+}
+
+// attachmentsFor loads the attachments of several posts, comments or
+// messages in one round trip, keyed by the ID in the owner column.
+func (m *SqliteDB) attachmentsFor(owner string, ids []int) (map[int][]models.Attachment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	attachments := make(map[int][]models.Attachment, len(ids))
+	for _, chunk := range chunkIDs(ids) {
+		stmt := `SELECT ` + owner + `, attachment_id, name, mime_type, alt_text, width, height, size FROM attachments WHERE ` + owner + ` IN (` + placeholders(len(chunk)) + `) ORDER BY position, attachment_id`
+
+		rows, err := m.query(ctx, stmt, intArgs(chunk)...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var ownerID int
+			var a models.Attachment
+			err := rows.Scan(&ownerID, &a.AttachmentID, &a.Name, &a.MimeType, &a.AltText, &a.Width, &a.Height, &a.Size)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			attachments[ownerID] = append(attachments[ownerID], a)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return attachments, nil
+}
+
+func (m *SqliteDB) DeletePendingAttachments(before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `DELETE FROM attachments WHERE post_id IS NULL AND comment_id IS NULL AND message_id IS NULL AND revision_id IS NULL AND created_at < ?`
+	result, err := m.exec(ctx, stmt, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (m *SqliteDB) MediaFileByHash(hash string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var name string
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `SELECT name FROM media_files WHERE hash = ?`, hash).Scan(&name)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE media_files SET reused_at = CURRENT_TIMESTAMP WHERE name = ?`, name)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// mediaRefs counts what refers to a file when its row is added, which is
+// only more than 0 for files stored before they were recorded. The triggers
+// keep the count from then on.
+const mediaRefs = `(SELECT COUNT(*) FROM attachments WHERE name = ?) + (SELECT COUNT(*) FROM users WHERE avatar = ?)`
+
+func (m *SqliteDB) AddMediaFile(file models.MediaFile) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stored := file.Name
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		stmt := `INSERT INTO media_files (name, hash, size, refs) VALUES (?, NULLIF(?, ''), ?, ` + mediaRefs + `) ON CONFLICT DO NOTHING`
+		_, err := tx.ExecContext(ctx, stmt, file.Name, file.Hash, file.Size, file.Name, file.Name)
+		if err != nil || file.Hash == "" {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `SELECT name FROM media_files WHERE hash = ?`, file.Hash).Scan(&stored)
+		if err != nil || stored == file.Name {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE media_files SET reused_at = CURRENT_TIMESTAMP WHERE name = ?`, stored)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return stored, nil
+}
+
+func (m *SqliteDB) MediaFileSizes() (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := m.query(ctx, `SELECT name, size FROM media_files`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var size int64
+		err := rows.Scan(&name, &size)
+		if err != nil {
+			return nil, err
+		}
+		sizes[name] = size
+	}
+
+	return sizes, rows.Err()
+}
+
+func (m *SqliteDB) SetMediaFileSize(name string, size int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := m.exec(ctx, `UPDATE media_files SET size = ? WHERE name = ?`, size, name)
+	return err
+}
+
+func (m *SqliteDB) UnusedMediaFiles(before time.Time) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT name FROM media_files WHERE refs <= 0 AND created_at < ? AND (reused_at IS NULL OR reused_at < ?) ORDER BY created_at`
+	rows, err := m.query(ctx, stmt, before.UTC(), before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+func (m *SqliteDB) DeleteMediaFile(name string, reusedBefore time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	removable := false
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		stmt := `DELETE FROM media_files WHERE name = ? AND refs <= 0 AND (reused_at IS NULL OR reused_at < ?)`
+		result, err := tx.ExecContext(ctx, stmt, name, reusedBefore.UTC())
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil || n > 0 {
+			removable = n > 0
+			return err
+		}
+
+		var recorded bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM media_files WHERE name = ?)`, name).Scan(&recorded)
+		if err != nil || recorded {
+			return err
+		}
+		var used bool
+		err = tx.QueryRowContext(ctx, imageUsed, name, name, name, name).Scan(&used)
+		removable = !used
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return removable, nil
+}
+
+// mediaUsage adds up the recorded files each user's attachments and avatar
+// refer to, counting a file once however often they use it. The %s is the
+// list of (user_id, name) pairs to count.
+const mediaUsage = `SELECT u.user_id, u.first_name, u.last_name, u.email, u.media_quota, COUNT(f.name), COALESCE(SUM(f.size), 0) AS bytes
+	FROM users u
+	LEFT JOIN (%s) r ON r.user_id = u.user_id
+	LEFT JOIN media_files f ON f.name = r.name`
+
+const userMediaRefs = `SELECT user_id, name FROM attachments WHERE user_id = ?
+	UNION SELECT user_id, avatar FROM users WHERE user_id = ? AND COALESCE(avatar, '') <> ''`
+
+const allMediaRefs = `SELECT user_id, name FROM attachments
+	UNION SELECT user_id, avatar FROM users WHERE COALESCE(avatar, '') <> ''`
+
+func scanMediaUsage(row interface{ Scan(...interface{}) error }) (models.MediaUsage, error) {
+	var usage models.MediaUsage
+	var quota sql.NullInt64
+	err := row.Scan(&usage.UserID, &usage.FirstName, &usage.LastName, &usage.Email, &quota, &usage.Files, &usage.Bytes)
+	if quota.Valid {
+		usage.Quota = &quota.Int64
+	}
+	return usage, err
+}
+
+func (m *SqliteDB) MediaUsage(userID int) (models.MediaUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := fmt.Sprintf(mediaUsage, userMediaRefs) + ` WHERE u.user_id = ? GROUP BY u.user_id`
+	return scanMediaUsage(m.queryRow(ctx, stmt, userID, userID, userID))
+}
+
+func (m *SqliteDB) MediaUsageReport() ([]models.MediaUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := fmt.Sprintf(mediaUsage, allMediaRefs) + ` GROUP BY u.user_id ORDER BY bytes DESC, u.user_id`
+	rows, err := m.query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report []models.MediaUsage
+	for rows.Next() {
+		usage, err := scanMediaUsage(rows)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, usage)
+	}
+
+	return report, rows.Err()
+}
+
+func (m *SqliteDB) SetMediaQuota(userID int, quota *int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := m.exec(ctx, `UPDATE users SET media_quota = ? WHERE user_id = ?`, quota, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+func (m *SqliteDB) UpdateProfileType(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `UPDATE users SET public = NOT public WHERE user_id = ?`
+	_, err := m.exec(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToggleFollow removes the follow, or the pending follow request, from
+// followerID to followingID if there is one and creates it otherwise. Following
+// a private profile creates a pending request. It returns sql.ErrNoRows if
+// followingID does not exist.
+func (m *SqliteDB) ToggleFollow(followerID, followingID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM followers WHERE follower_id = ? AND following_id = ?`, followerID, followingID)
+		if err != nil {
+			return err
+		}
+
+		removed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			return nil
+		}
+
+		var isPublic bool
+		err = tx.QueryRowContext(ctx, `SELECT public FROM users WHERE user_id = ?`, followingID).Scan(&isPublic)
+		if err != nil {
+			return err
+		}
+
+		stmt := `INSERT OR IGNORE INTO followers (follower_id, following_id, request_pending) VALUES (?, ?, ?)`
+		_, err = tx.ExecContext(ctx, stmt, followerID, followingID, !isPublic)
+		return err
+	})
+}
+
+func (m *SqliteDB) IsFollowing(userID, followingID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT EXISTS ( SELECT 1 FROM followers WHERE follower_id = $1 AND following_id = $2 AND request_pending = false)`
+
+	var isFollowing bool
+	row := m.queryRow(ctx, stmt, userID, followingID)
+	err := row.Scan(&isFollowing)
+	if err != nil {
+		return false, err
+	}
+
+	return isFollowing, nil
+}
+
+func (m *SqliteDB) IsPending(userID, followingID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT request_pending FROM followers WHERE follower_id = $1 AND following_id = $2 LIMIT 1`
+
+	var isPending bool
+	row := m.queryRow(ctx, stmt, userID, followingID)
+	err := row.Scan(&isPending)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return isPending, nil
+}
+
+func (m *SqliteDB) IsUserPublic(userID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT public FROM users WHERE user_id = ?`
+
+	var isPublic bool
+	row := m.queryRow(ctx, stmt, userID)
+	err := row.Scan(&isPublic)
+	if err != nil {
+		return false, err
 	}
 
 	return isPublic, nil
 }
 
+// UserAvatars skips users without an avatar.
+func (m *SqliteDB) UserAvatars() (map[int]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	rows, err := m.query(ctx, `SELECT user_id, avatar FROM users WHERE avatar IS NOT NULL AND avatar != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	avatars := make(map[int]string)
+	for rows.Next() {
+		var userID int
+		var avatar string
+		err := rows.Scan(&userID, &avatar)
+		if err != nil {
+			return nil, err
+		}
+		avatars[userID] = avatar
+	}
+
+	return avatars, rows.Err()
+}
+
+func (m *SqliteDB) SetAvatar(userID int, avatar string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var previous string
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `SELECT COALESCE(avatar, '') FROM users WHERE user_id = ?`, userID).Scan(&previous)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE users SET avatar = ? WHERE user_id = ?`, avatar, userID)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return previous, nil
+}
+
 func (m *SqliteDB) Following(userID int) ([]models.UserData, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	stmt := `SELECT user_id, first_name, last_name FROM users JOIN followers ON user_id = following_id WHERE follower_id = $1 AND request_pending = false`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	rows, err := m.query(ctx, stmt, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -513,7 +1561,7 @@ func (m *SqliteDB) Followers(userID int) ([]models.UserData, error) {
 
 	stmt := `SELECT user_id, first_name, last_name, public FROM users JOIN followers ON user_id = follower_id WHERE following_id = $1 AND request_pending = false`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	rows, err := m.query(ctx, stmt, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -532,13 +1580,67 @@ func (m *SqliteDB) Followers(userID int) ([]models.UserData, error) {
 	return followers, nil
 }
 
+func (m *SqliteDB) FollowingPage(userID int, page database.Page) ([]models.UserData, database.Cursors, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	where, tail, args := keyset(page, "user_id", false)
+	stmt := `SELECT user_id, first_name, last_name, public FROM users JOIN followers ON user_id = following_id WHERE follower_id = ? AND request_pending = false AND ` + where + ` ` + tail
+
+	rows, err := m.query(ctx, stmt, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, database.Cursors{}, err
+	}
+	defer rows.Close()
+
+	var following []models.UserData
+	for rows.Next() {
+		var user models.UserData
+		err := rows.Scan(&user.UserID, &user.FirstName, &user.LastName, &user.Public)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		following = append(following, user)
+	}
+
+	following, cursors := database.Paginate(following, page, userKey)
+	return following, cursors, nil
+}
+
+func (m *SqliteDB) FollowersPage(userID int, page database.Page) ([]models.UserData, database.Cursors, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	where, tail, args := keyset(page, "user_id", false)
+	stmt := `SELECT user_id, first_name, last_name, public FROM users JOIN followers ON user_id = follower_id WHERE following_id = ? AND request_pending = false AND ` + where + ` ` + tail
+
+	rows, err := m.query(ctx, stmt, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, database.Cursors{}, err
+	}
+	defer rows.Close()
+
+	var followers []models.UserData
+	for rows.Next() {
+		var user models.UserData
+		err := rows.Scan(&user.UserID, &user.FirstName, &user.LastName, &user.Public)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		followers = append(followers, user)
+	}
+
+	followers, cursors := database.Paginate(followers, page, userKey)
+	return followers, cursors, nil
+}
+
 func (m *SqliteDB) PendingFollowers(userID int) ([]models.UserData, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	stmt := `SELECT user_id, first_name, last_name, public FROM users JOIN followers ON user_id = follower_id WHERE following_id = $1 AND request_pending = true`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	rows, err := m.query(ctx, stmt, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -554,41 +1656,300 @@ func (m *SqliteDB) PendingFollowers(userID int) ([]models.UserData, error) {
 		followers = append(followers, user)
 	}
 
-	return followers, nil
+	return followers, nil
+}
+
+func (m *SqliteDB) FollowRequests(userID int) ([]models.FollowRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT follower_id, request_pending FROM followers WHERE following_id = ? AND request_pending = true`
+
+	rows, err := m.query(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var followRequests []models.FollowRequest
+
+	for rows.Next() {
+		var followRequest models.FollowRequest
+		err := rows.Scan(&followRequest.FollowingID, &followRequest.RequestPending)
+		if err != nil {
+			return nil, err
+		}
+		followRequests = append(followRequests, followRequest)
+	}
+
+	return followRequests, nil
+}
+
+func (m *SqliteDB) AcceptFollower(userID, followerID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `UPDATE followers SET request_pending = false WHERE (following_id = ? AND follower_id = ?)`
+
+	_, err := m.exec(ctx, stmt, userID, followerID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *SqliteDB) DeclineFollower(userID, followerID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `DELETE FROM followers WHERE (following_id = ? AND follower_id = ?)`
+
+	_, err := m.exec(ctx, stmt, userID, followerID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *SqliteDB) CreateGroup(group *models.Group) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	userIDs, err := splitIDs(group.SelectedUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.withTx(ctx, func(tx *sql.Tx) error {
+		stmt := `INSERT INTO groups (title, description, user_id) VALUES (?, ?, ?)`
+
+		result, err := tx.ExecContext(ctx, stmt, group.Title, group.Description, group.UserID)
+		if err != nil {
+			return err
+		}
+
+		groupID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		group.GroupID = int(groupID)
+
+		// The users picked when creating the group are recorded and invited.
+		for _, userID := range userIDs {
+			_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO group_invitees (group_id, user_id) VALUES (?, ?)`, groupID, userID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO groupmembers (group_id, member_id, request_pending, invitation_pending) VALUES (?, ?, 0, 1)`, groupID, userID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return group.GroupID, nil
+}
+
+// groupColumns selects a models.Group from groups g joined with its creator u.
+const groupColumns = `g.group_id, g.title, g.description, g.user_id, u.first_name, u.last_name,
+	COALESCE((SELECT group_concat(i.user_id) FROM group_invitees i WHERE i.group_id = g.group_id), '')`
+
+func (m *SqliteDB) AllGroups(page database.Page) ([]models.Group, database.Cursors, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	where, tail, args := keyset(page, "g.group_id", false)
+	stmt := `SELECT ` + groupColumns + ` FROM groups g JOIN users u ON u.user_id = g.user_id WHERE ` + where + ` ` + tail
+
+	rows, err := m.query(ctx, stmt, args...)
+	if err != nil {
+		return nil, database.Cursors{}, err
+	}
+	defer rows.Close()
+
+	var groups []models.Group
+	for rows.Next() {
+		var group models.Group
+		err := rows.Scan(&group.GroupID, &group.Title, &group.Description, &group.UserID, &group.FirstName, &group.LastName, &group.SelectedUserID)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		groups = append(groups, group)
+	}
+
+	groups, cursors := database.Paginate(groups, page, func(g models.Group) int { return g.GroupID })
+	return groups, cursors, nil
+}
+
+func (m *SqliteDB) GetGroup(id int) (*models.Group, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT ` + groupColumns + ` FROM groups g JOIN users u ON u.user_id = g.user_id WHERE g.group_id = $1`
+
+	row := m.queryRow(ctx, stmt, id)
+
+	var group models.Group
+
+	err := row.Scan(
+		&group.GroupID, &group.Title, &group.Description, &group.UserID, &group.FirstName, &group.LastName, &group.SelectedUserID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+func (m *SqliteDB) GetGroupMembers(groupID int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT member_id FROM groupmembers WHERE group_id = $1 AND request_pending = false AND invitation_pending = false`
+
+	rows, err := m.query(ctx, stmt, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var groupMembers []int
+
+	for rows.Next() {
+		var memberID int
+		if err := rows.Scan(&memberID); err != nil {
+			return nil, err
+		}
+		groupMembers = append(groupMembers, memberID)
+	}
+
+	return groupMembers, nil
+}
+
+func (m *SqliteDB) GroupMemberList(groupID int, page database.Page) ([]models.UserData, database.Cursors, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	where, tail, args := keyset(page, "user_id", false)
+	stmt := `SELECT user_id, first_name, last_name, public FROM users JOIN groupmembers ON user_id = member_id WHERE group_id = ? AND request_pending = false AND invitation_pending = false AND ` + where + ` ` + tail
+
+	rows, err := m.query(ctx, stmt, append([]interface{}{groupID}, args...)...)
+	if err != nil {
+		return nil, database.Cursors{}, err
+	}
+	defer rows.Close()
+
+	var members []models.UserData
+	for rows.Next() {
+		var user models.UserData
+		err := rows.Scan(&user.UserID, &user.FirstName, &user.LastName, &user.Public)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		members = append(members, user)
+	}
+
+	members, cursors := database.Paginate(members, page, userKey)
+	return members, cursors, nil
+}
+func (m *SqliteDB) GetGroupCreator(groupID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT user_id FROM groups WHERE group_id = $1`
+
+	row := m.queryRow(ctx, stmt, groupID)
+
+	var creatorID int
+	err := row.Scan(&creatorID)
+	if err != nil {
+		return 0, err
+	}
+
+	return creatorID, nil
+}
+
+func (m *SqliteDB) GroupInvitations(userID int) ([]models.GroupMembers, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT gm.group_id, g.title, g.user_id, gm.member_id, gm.invitation_pending FROM groupmembers gm JOIN groups g ON g.group_id = gm.group_id WHERE gm.member_id = ? AND gm.invitation_pending = true`
+
+	rows, err := m.query(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var groupInvitations []models.GroupMembers
+
+	for rows.Next() {
+		var groupInvitation models.GroupMembers
+		err := rows.Scan(&groupInvitation.GroupID, &groupInvitation.GroupTitle, &groupInvitation.GroupCreatorID, &groupInvitation.MemberID, &groupInvitation.RequestPending)
+		if err != nil {
+			return nil, err
+		}
+		groupInvitations = append(groupInvitations, groupInvitation)
+	}
+
+	return groupInvitations, nil
+}
+
+func (m *SqliteDB) AcceptGroupInvitation(groupID, memberID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `UPDATE groupmembers SET invitation_pending = false WHERE (group_id = ? AND member_id = ?)`
+
+	_, err := m.exec(ctx, stmt, groupID, memberID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *SqliteDB) DeclineGroupInvitation(groupID, memberID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `DELETE FROM groupmembers WHERE (group_id = ? AND member_id = ?)`
+
+	_, err := m.exec(ctx, stmt, groupID, memberID)
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
-func (m *SqliteDB) FollowRequests(userID int) ([]models.FollowRequest, error) {
+func (m *SqliteDB) IsMember(userID, groupID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT follower_id, request_pending FROM followers WHERE following_id = ? AND request_pending = true`
+	stmt := `SELECT EXISTS ( SELECT 1 FROM groupmembers WHERE member_id = $1 AND group_id = $2)`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	var isMember bool
+	row := m.queryRow(ctx, stmt, userID, groupID)
+	err := row.Scan(&isMember)
 	if err != nil {
-		return nil, err
-	}
-
-	var followRequests []models.FollowRequest
-
-	for rows.Next() {
-		var followRequest models.FollowRequest
-		err := rows.Scan(&followRequest.FollowingID, &followRequest.RequestPending)
-		if err != nil {
-			return nil, err
-		}
-		followRequests = append(followRequests, followRequest)
+		return false, err
 	}
 
-	return followRequests, nil
+	return isMember, nil
 }
 
-func (m *SqliteDB) AcceptFollower(userID, followerID int) error {
+func (m *SqliteDB) JoinGroup(userID, groupID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `UPDATE followers SET request_pending = false WHERE (following_id = ? AND follower_id = ?)`
+	stmt := `INSERT OR IGNORE INTO groupmembers (group_id, member_id, request_pending, invitation_pending) VALUES (?, ?, 1, 0)`
 
-	_, err := m.DB.ExecContext(ctx, stmt, userID, followerID)
+	_, err := m.exec(ctx, stmt, groupID, userID)
 	if err != nil {
 		return err
 	}
@@ -596,13 +1957,13 @@ func (m *SqliteDB) AcceptFollower(userID, followerID int) error {
 	return nil
 }
 
-func (m *SqliteDB) DeclineFollower(userID, followerID int) error {
+func (m *SqliteDB) InviteNewMember(groupMember *models.GroupMembers) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `DELETE FROM followers WHERE (following_id = ? AND follower_id = ?)`
+	stmt := `INSERT OR IGNORE INTO groupmembers (group_id, member_id, request_pending, invitation_pending) VALUES (?, ?, 0, 1)`
 
-	_, err := m.DB.ExecContext(ctx, stmt, userID, followerID)
+	_, err := m.exec(ctx, stmt, groupMember.GroupID, groupMember.MemberID)
 	if err != nil {
 		return err
 	}
@@ -610,173 +1971,221 @@ func (m *SqliteDB) DeclineFollower(userID, followerID int) error {
 	return nil
 }
 
-func (m *SqliteDB) CreateGroup(group *models.Group) (int, error) {
+func (m *SqliteDB) LeaveGroup(userID, groupID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO groups (title, description, user_id, first_name, last_name, selected_user_id) VALUES (?, ?, ?, ?, ?, ?)`
-
-	result, err := m.DB.ExecContext(ctx, stmt, group.Title, group.Description, group.UserID, group.FirstName, group.LastName, group.SelectedUserID)
-	if err != nil {
-		return 0, err
-	}
+	stmt := `DELETE FROM groupmembers WHERE group_id = ? AND member_id = ?`
 
-	// Retrieve the last inserted ID
-	groupID, err := result.LastInsertId()
+	_, err := m.exec(ctx, stmt, groupID, userID)
 	if err != nil {
-		return 0, err
+		return err
 	}
-
-	// Return the generated GroupID
-	return int(groupID), nil
+	return nil
 }
 
-func (m *SqliteDB) AllGroups() ([]models.Group, error) {
+func (m *SqliteDB) GroupRequests(userID int) ([]models.GroupMembers, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT group_id, title, description, user_id, first_name, last_name, selected_user_id FROM groups`
+	stmt := `SELECT gm.group_id, g.title, g.user_id, gm.member_id, gm.request_pending FROM groupmembers gm JOIN groups g ON g.group_id = gm.group_id WHERE g.user_id = ? AND gm.request_pending = true`
 
-	rows, err := m.DB.QueryContext(ctx, stmt)
+	rows, err := m.query(ctx, stmt, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	var groups []models.Group
+	var groupRequests []models.GroupMembers
+
 	for rows.Next() {
-		var group models.Group
-		err := rows.Scan(&group.GroupID, &group.Title, &group.Description, &group.UserID, &group.FirstName, &group.LastName, &group.SelectedUserID)
+		var groupRequest models.GroupMembers
+		err := rows.Scan(&groupRequest.GroupID, &groupRequest.GroupTitle, &groupRequest.GroupCreatorID, &groupRequest.MemberID, &groupRequest.RequestPending)
 		if err != nil {
 			return nil, err
 		}
-		groups = append(groups, group)
+		groupRequests = append(groupRequests, groupRequest)
 	}
-	return groups, nil
+
+	return groupRequests, nil
 }
 
-func (m *SqliteDB) GetGroup(id int) (*models.Group, error) {
+func (m *SqliteDB) CheckPending(userID, groupID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT group_id, title, description, user_id, first_name, last_name, selected_user_id FROM groups WHERE group_id = $1`
-
-	row := m.DB.QueryRowContext(ctx, stmt, id)
-
-	var group models.Group
-
-	err := row.Scan(
-		&group.GroupID, &group.Title, &group.Description, &group.UserID, &group.FirstName, &group.LastName, &group.SelectedUserID,
-	)
+	stmt := `SELECT EXISTS ( SELECT 1 FROM groupmembers WHERE group_id = $1 AND member_id = $2 AND request_pending = true)`
 
+	var isPending bool
+	row := m.queryRow(ctx, stmt, groupID, userID)
+	err := row.Scan(&isPending)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	return &group, nil
+	return isPending, nil
 }
 
-func (m *SqliteDB) GetGroupMembers(groupID int) ([]int, error) {
+func (m *SqliteDB) AcceptGroupRequest(groupID, memberID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT member_id FROM groupmembers WHERE group_id = $1 AND request_pending = false AND invitation_pending = false`
+	stmt := `UPDATE groupmembers SET request_pending = false WHERE (group_id = ? AND member_id = ?)`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, groupID)
+	_, err := m.exec(ctx, stmt, groupID, memberID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var groupMembers []int
+	return nil
+}
 
-	for rows.Next() {
-		var memberID int
-		if err := rows.Scan(&memberID); err != nil {
-			return nil, err
-		}
-		groupMembers = append(groupMembers, memberID)
+func (m *SqliteDB) DeclineGroupRequest(groupID, memberID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `DELETE FROM groupmembers WHERE (group_id = ? AND member_id = ?)`
+
+	_, err := m.exec(ctx, stmt, groupID, memberID)
+	if err != nil {
+		return err
 	}
 
-	return groupMembers, nil
+	return nil
 }
 
-func (m *SqliteDB) GetGroupCreator(groupID int) (int, error) {
+// CreateEvent adds an event and notifies the group's members and its creator
+// about it, all in one transaction.
+func (m *SqliteDB) CreateEvent(event *models.Event) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT user_id FROM groups WHERE group_id = $1`
+	err := m.withTx(ctx, func(tx *sql.Tx) error {
+		stmt := `INSERT INTO events (title, description, user_id, time, group_id) VALUES (?, ?, ?, ?, ?)`
 
-	row := m.DB.QueryRowContext(ctx, stmt, groupID)
+		result, err := tx.ExecContext(ctx, stmt, event.Title, event.Description, event.UserID, event.Time, event.GroupID)
+		if err != nil {
+			return err
+		}
 
-	var creatorID int
-	err := row.Scan(&creatorID)
+		eventID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		event.EventID = int(eventID)
+
+		stmt = `INSERT INTO eventnotifications (event_id, member_id, group_id)
+			SELECT ?, member_id, group_id FROM groupmembers WHERE group_id = ? AND request_pending = false AND invitation_pending = false
+			UNION
+			SELECT ?, user_id, group_id FROM groups WHERE group_id = ?`
+
+		_, err = tx.ExecContext(ctx, stmt, event.EventID, event.GroupID, event.EventID, event.GroupID)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	return creatorID, nil
+	return event.EventID, nil
 }
 
-func (m *SqliteDB) GroupInvitations(userID int) ([]models.GroupMembers, error) {
+func (m *SqliteDB) GetEventNotifications(userID int) ([]models.EventNotifications, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT group_id, group_title, group_creator_id, member_id, invitation_pending FROM groupmembers WHERE member_id = ? AND invitation_pending = true`
+	stmt := `SELECT event_id, group_id FROM eventnotifications WHERE member_id = ?`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	rows, err := m.query(ctx, stmt, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	var groupInvitations []models.GroupMembers
+	var eventNotifications []models.EventNotifications
 
 	for rows.Next() {
-		var groupInvitation models.GroupMembers
-		err := rows.Scan(&groupInvitation.GroupID, &groupInvitation.GroupTitle, &groupInvitation.GroupCreatorID, &groupInvitation.MemberID, &groupInvitation.RequestPending)
+		var eventNotification models.EventNotifications
+		err := rows.Scan(&eventNotification.EventID, &eventNotification.GroupID)
 		if err != nil {
 			return nil, err
 		}
-		groupInvitations = append(groupInvitations, groupInvitation)
+		eventNotifications = append(eventNotifications, eventNotification)
 	}
 
-	return groupInvitations, nil
+	return eventNotifications, nil
 }
 
-func (m *SqliteDB) AcceptGroupInvitation(groupID, memberID int) error {
+func (m *SqliteDB) DeleteFromEventNotifications(eventID, userID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `UPDATE groupmembers SET invitation_pending = false WHERE (group_id = ? AND member_id = ?)`
+	stmt := `DELETE FROM eventnotifications WHERE event_id = ? AND member_id = ?`
 
-	_, err := m.DB.ExecContext(ctx, stmt, groupID, memberID)
+	_, err := m.exec(ctx, stmt, eventID, userID)
 	if err != nil {
 		return err
 	}
-
 	return nil
 }
 
-func (m *SqliteDB) DeclineGroupInvitation(groupID, memberID int) error {
+// GroupEvents returns the events of a group, or none if the viewer is not a
+// member.
+func (m *SqliteDB) GroupEvents(viewerID, groupID int, page database.Page) ([]models.Event, database.Cursors, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `DELETE FROM groupmembers WHERE (group_id = ? AND member_id = ?)`
+	where, tail, args := keyset(page, "e.event_id", false)
+	stmt := `SELECT e.event_id, e.title, e.description, e.user_id, u.first_name, u.last_name, e.time, e.group_id FROM events e
+		JOIN users u ON u.user_id = e.user_id
+		WHERE e.group_id = ? AND (
+			EXISTS (SELECT 1 FROM groupmembers gm WHERE gm.group_id = e.group_id AND gm.member_id = ? AND gm.request_pending = false AND gm.invitation_pending = false)
+			OR EXISTS (SELECT 1 FROM groups g WHERE g.group_id = e.group_id AND g.user_id = ?)
+		) AND ` + where + ` ` + tail
 
-	_, err := m.DB.ExecContext(ctx, stmt, groupID, memberID)
+	rows, err := m.query(ctx, stmt, append([]interface{}{groupID, viewerID, viewerID}, args...)...)
 	if err != nil {
-		return err
+		return nil, database.Cursors{}, err
 	}
+	defer rows.Close()
 
-	return nil
+	var events []models.Event
+	for rows.Next() {
+		var event models.Event
+		err := rows.Scan(&event.EventID, &event.Title, &event.Description, &event.UserID, &event.FirstName, &event.LastName, &event.Time, &event.GroupID)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		events = append(events, event)
+	}
+
+	events, cursors := database.Paginate(events, page, func(e models.Event) int { return e.EventID })
+	return events, cursors, nil
 }
+func (m *SqliteDB) GetEvent(id int) (*models.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
 
-func (m *SqliteDB) IsMember(userID, groupID int) (bool, error) {
+	stmt := `SELECT e.event_id, e.title, e.description, e.user_id, u.first_name, u.last_name, e.time, e.group_id FROM events e JOIN users u ON u.user_id = e.user_id WHERE e.event_id = $1`
+
+	row := m.queryRow(ctx, stmt, id)
+
+	var event models.Event
+
+	err := row.Scan(&event.EventID, &event.Title, &event.Description, &event.UserID, &event.FirstName, &event.LastName, &event.Time, &event.GroupID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+func (m *SqliteDB) CheckMembership(userID, groupID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT EXISTS ( SELECT 1 FROM groupmembers WHERE member_id = $1 AND group_id = $2)`
+	stmt := `SELECT EXISTS ( SELECT 1 FROM groupmembers WHERE group_id = $1 AND member_id = $2)`
 
 	var isMember bool
-	row := m.DB.QueryRowContext(ctx, stmt, userID, groupID)
+	row := m.queryRow(ctx, stmt, groupID, userID)
 	err := row.Scan(&isMember)
 	if err != nil {
 		return false, err
@@ -785,41 +2194,55 @@ func (m *SqliteDB) IsMember(userID, groupID int) (bool, error) {
 	return isMember, nil
 }
 
-func (m *SqliteDB) JoinGroup(userID, groupID int, groupTitle string, groupCreatorID int) error {
+func (m *SqliteDB) CheckCreator(userID, groupID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO groupmembers (group_id, group_title, group_creator_id, member_id, request_pending, invitation_pending) VALUES (?, ?, ?, ?, 1, 0)`
+	stmt := `SELECT EXISTS ( SELECT 1 FROM groups WHERE group_id = $1 AND user_id = $2)`
 
-	_, err := m.DB.ExecContext(ctx, stmt, groupID, groupTitle, groupCreatorID, userID)
+	var isCreator bool
+	row := m.queryRow(ctx, stmt, groupID, userID)
+	err := row.Scan(&isCreator)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return isCreator, nil
 }
 
-func (m *SqliteDB) AddGroupMembers(groupMember *models.GroupMembers) error {
+func (m *SqliteDB) GetParticipants(id int) ([]models.EventParticipants, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO groupmembers (group_id, group_title, group_creator_id, member_id, request_pending, invitation_pending) VALUES (?, ?, ?, ?, 0, 1)`
+	stmt := `SELECT p.event_id, p.participant_id, u.first_name, u.last_name, p.going FROM eventparticipants p JOIN users u ON u.user_id = p.participant_id WHERE p.event_id = $1`
 
-	_, err := m.DB.ExecContext(ctx, stmt, groupMember.GroupID, groupMember.GroupTitle, groupMember.GroupCreatorID, groupMember.MemberID)
+	rows, err := m.query(ctx, stmt, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	var participants []models.EventParticipants
+	for rows.Next() {
+		var participant models.EventParticipants
+		err := rows.Scan(&participant.EventID, &participant.ParticipantID, &participant.FirstName, &participant.LastName, &participant.Going)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, participant)
+	}
+	return participants, nil
 }
 
-func (m *SqliteDB) InviteNewMember(groupMember *models.GroupMembers) error {
+// RespondToEvent records whether the user is going to the event, replacing
+// any earlier answer.
+func (m *SqliteDB) RespondToEvent(userID, eventID int, going bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO groupmembers (group_id, group_title, group_creator_id, member_id, request_pending, invitation_pending) VALUES (?, ?, ?, ?, 0, 1)`
+	stmt := `INSERT INTO eventparticipants (event_id, participant_id, going) VALUES (?, ?, ?)
+		ON CONFLICT (event_id, participant_id) DO UPDATE SET going = excluded.going`
 
-	_, err := m.DB.ExecContext(ctx, stmt, groupMember.GroupID, groupMember.GroupTitle, groupMember.GroupCreatorID, groupMember.MemberID)
+	_, err := m.exec(ctx, stmt, eventID, userID, going)
 	if err != nil {
 		return err
 	}
@@ -827,441 +2250,1049 @@ func (m *SqliteDB) InviteNewMember(groupMember *models.GroupMembers) error {
 	return nil
 }
 
-func (m *SqliteDB) LeaveGroup(userID, groupID int) error {
+func (m *SqliteDB) IsGoing(userID, eventID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `DELETE FROM groupmembers WHERE group_id = ? AND member_id = ?`
+	stmt := `SELECT EXISTS ( SELECT 1 FROM eventparticipants WHERE event_id = $1 AND participant_id = $2 AND going = true)`
 
-	_, err := m.DB.ExecContext(ctx, stmt, groupID, userID)
+	var isGoing bool
+	row := m.queryRow(ctx, stmt, eventID, userID)
+	err := row.Scan(&isGoing)
 	if err != nil {
-		return err
+		return false, err
 	}
-	return nil
+
+	return isGoing, nil
 }
 
-func (m *SqliteDB) GroupRequests(userID int) ([]models.GroupMembers, error) {
+func (m *SqliteDB) IsNotGoing(userID, eventID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT group_id, group_title, group_creator_id, member_id, request_pending FROM groupmembers WHERE group_creator_id = ? AND request_pending = true`
+	stmt := `SELECT EXISTS ( SELECT 1 FROM eventparticipants WHERE event_id = $1 AND participant_id = $2 AND going = false)`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	var NotGoing bool
+	row := m.queryRow(ctx, stmt, eventID, userID)
+	err := row.Scan(&NotGoing)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	var groupRequests []models.GroupMembers
+	return NotGoing, nil
+}
+
+func (m *SqliteDB) AddMessage(message *models.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		stmt := `INSERT INTO messages (sender_id, recipient_id, group_id, message, date) VALUES (?, NULLIF(?, 0), NULLIF(?, 0), ?, ?)`
+
+		result, err := tx.ExecContext(ctx, stmt, message.UserIDFrom, message.UserIDTo, message.GroupID, message.Message, message.Date)
+		if err != nil {
+			return err
+		}
+
+		messageID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		message.MessageID = int(messageID)
+
+		err = attachToMessage(ctx, tx, message)
+		if err != nil {
+			return err
+		}
+		return replaceMentions(ctx, tx, models.Target{MessageID: message.MessageID}, message.UserIDFrom, message.Mentions)
+	})
+}
+
+// attachToMessage moves the attachments named by the message's
+// AttachmentIDs to it, in order.
+func attachToMessage(ctx context.Context, tx *sql.Tx, message *models.Message) error {
+	stmt := `UPDATE attachments SET message_id = ?, position = ?
+		WHERE attachment_id = ? AND user_id = ? AND post_id IS NULL AND comment_id IS NULL AND message_id IS NULL AND revision_id IS NULL`
+
+	for i, attachmentID := range message.AttachmentIDs {
+		result, err := tx.ExecContext(ctx, stmt, message.MessageID, i, attachmentID, message.UserIDFrom)
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+// messageColumns selects a models.Message from messages m. The recipient's
+// first name is the group title for group messages, as clients expect.
+const messageColumns = `m.message_id, m.message, m.sender_id, COALESCE(m.recipient_id, 0), COALESCE(m.group_id, 0), s.first_name, COALESCE(r.first_name, g.title), m.date
+	FROM messages m
+	JOIN users s ON s.user_id = m.sender_id
+	LEFT JOIN users r ON r.user_id = m.recipient_id
+	LEFT JOIN groups g ON g.group_id = m.group_id`
 
+func scanMessages(rows *sql.Rows) ([]models.Message, error) {
+	var messages []models.Message
 	for rows.Next() {
-		var groupRequest models.GroupMembers
-		err := rows.Scan(&groupRequest.GroupID, &groupRequest.GroupTitle, &groupRequest.GroupCreatorID, &groupRequest.MemberID, &groupRequest.RequestPending)
+		var msg models.Message
+		err := rows.Scan(&msg.MessageID, &msg.Message, &msg.UserIDFrom, &msg.UserIDTo, &msg.GroupID, &msg.FirstNameFrom, &msg.FirstNameTo, &msg.Date)
 		if err != nil {
 			return nil, err
 		}
-		groupRequests = append(groupRequests, groupRequest)
+		messages = append(messages, msg)
 	}
+	return messages, rows.Err()
+}
 
-	return groupRequests, nil
+func (m *SqliteDB) GetMessage(messageID int) (models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `SELECT ` + messageColumns + ` WHERE m.message_id = ?`
+
+	rows, err := m.query(ctx, stmt, messageID)
+	if err != nil {
+		return models.Message{}, err
+	}
+	defer rows.Close()
+
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if len(messages) == 0 {
+		return models.Message{}, sql.ErrNoRows
+	}
+
+	return messages[0], nil
 }
 
-func (m *SqliteDB) CheckPending(userID, groupID int) (bool, error) {
+// GetMessages pages through the conversation between two users from the
+// newest message back, but returns each page in chronological order.
+func (m *SqliteDB) GetMessages(userID, otherID int, page database.Page) ([]models.Message, database.Cursors, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT EXISTS ( SELECT 1 FROM groupmembers WHERE group_id = $1 AND member_id = $2 AND request_pending = true)`
+	where, tail, args := keyset(page, "m.message_id", true)
+	stmt := `SELECT ` + messageColumns + ` WHERE ((m.sender_id = ? AND m.recipient_id = ?) OR (m.sender_id = ? AND m.recipient_id = ?)) AND ` + where + ` ` + tail
 
-	var isPending bool
-	row := m.DB.QueryRowContext(ctx, stmt, groupID, userID)
-	err := row.Scan(&isPending)
+	rows, err := m.query(ctx, stmt, append([]interface{}{userID, otherID, otherID, userID}, args...)...)
 	if err != nil {
-		return false, err
+		return nil, database.Cursors{}, err
 	}
+	defer rows.Close()
 
-	return isPending, nil
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, database.Cursors{}, err
+	}
+
+	messages, cursors := database.Paginate(messages, page, messageKey)
+	reverseMessages(messages)
+	return messages, cursors, nil
 }
 
-func (m *SqliteDB) AcceptGroupRequest(groupID, memberID int) error {
+// GetGroupMessages pages through a group chat like GetMessages.
+func (m *SqliteDB) GetGroupMessages(groupID int, page database.Page) ([]models.Message, database.Cursors, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `UPDATE groupmembers SET request_pending = false WHERE (group_id = ? AND member_id = ?)`
+	where, tail, args := keyset(page, "m.message_id", true)
+	stmt := `SELECT ` + messageColumns + ` WHERE m.group_id = ? AND ` + where + ` ` + tail
+
+	rows, err := m.query(ctx, stmt, append([]interface{}{groupID}, args...)...)
+	if err != nil {
+		return nil, database.Cursors{}, err
+	}
+	defer rows.Close()
 
-	_, err := m.DB.ExecContext(ctx, stmt, groupID, memberID)
+	messages, err := scanMessages(rows)
 	if err != nil {
-		return err
+		return nil, database.Cursors{}, err
 	}
 
-	return nil
+	messages, cursors := database.Paginate(messages, page, messageKey)
+	reverseMessages(messages)
+	return messages, cursors, nil
 }
 
-func (m *SqliteDB) DeclineGroupRequest(groupID, memberID int) error {
+func (m *SqliteDB) GetUnreadMessages(userID int) ([]models.Message, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `DELETE FROM groupmembers WHERE (group_id = ? AND member_id = ?)`
+	stmt := `SELECT ` + messageColumns + ` WHERE m.read = 0 AND m.recipient_id = ?`
 
-	_, err := m.DB.ExecContext(ctx, stmt, groupID, memberID)
+	rows, err := m.query(ctx, stmt, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	return scanMessages(rows)
 }
 
-func (m *SqliteDB) CreateEvent(event *models.Event) (int, error) {
+func (m *SqliteDB) MarkMessagesAsRead(userID, senderID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO events (title, description, user_id, first_name, last_name, time, group_id) VALUES (?, ?, ?, ?, ?, ?, ?)`
-
-	result, err := m.DB.ExecContext(ctx, stmt, event.Title, event.Description, event.UserID, event.FirstName, event.LastName, event.Time, event.GroupID)
-	if err != nil {
-		return 0, err
-	}
+	stmt := `UPDATE messages SET read = 1 WHERE recipient_id = ? AND sender_id = ? AND read = 0`
 
-	eventID, err := result.LastInsertId()
+	_, err := m.exec(ctx, stmt, userID, senderID)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return int(eventID), nil
+	return nil
 }
 
-func (m *SqliteDB) EventNotifications(eventID, memberID, groupID int) error {
+// UserIDByFirstName finds the oldest account with the given first name, for
+// clients that still address chat messages by name.
+func (m *SqliteDB) UserIDByFirstName(firstName string) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO eventnotifications (event_id, member_id, group_id) VALUES (?, ?, ?)`
+	stmt := `SELECT user_id FROM users WHERE first_name = ? ORDER BY user_id LIMIT 1`
 
-	_, err := m.DB.ExecContext(ctx, stmt, eventID, memberID, groupID)
+	var userID int
+	err := m.queryRow(ctx, stmt, firstName).Scan(&userID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return userID, nil
 }
 
-func (m *SqliteDB) GetEventNotifications(userID int) ([]models.EventNotifications, error) {
+// GroupIDByTitle finds the oldest group with the given title, for clients that
+// still address group chats by title.
+func (m *SqliteDB) GroupIDByTitle(title string) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT event_id, group_id FROM eventnotifications WHERE member_id = ?`
+	stmt := `SELECT group_id FROM groups WHERE title = ? ORDER BY group_id LIMIT 1`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	var groupID int
+	err := m.queryRow(ctx, stmt, title).Scan(&groupID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	var eventNotifications []models.EventNotifications
+	return groupID, nil
+}
 
-	for rows.Next() {
-		var eventNotification models.EventNotifications
-		err := rows.Scan(&eventNotification.EventID, &eventNotification.GroupID)
-		if err != nil {
-			return nil, err
-		}
-		eventNotifications = append(eventNotifications, eventNotification)
+// targetColumn returns the column of the reactions and mentions tables
+// naming the target's kind, and the ID of the target.
+func targetColumn(target models.Target) (string, int) {
+	switch {
+	case target.PostID != 0:
+		return "post_id", target.PostID
+	case target.CommentID != 0:
+		return "comment_id", target.CommentID
+	default:
+		return "message_id", target.MessageID
 	}
-
-	return eventNotifications, nil
 }
 
-func (m *SqliteDB) DeleteFromEventNotifications(eventID, userID int) error {
+// messageVisible is the condition for chat messages m a user may see: ones
+// they sent or received, and ones in groups they belong to or created. It
+// binds the user's ID four times.
+const messageVisible = `(
+	m.sender_id = ? OR m.recipient_id = ?
+	OR EXISTS (SELECT 1 FROM groupmembers gm WHERE gm.group_id = m.group_id AND gm.member_id = ? AND gm.request_pending = false AND gm.invitation_pending = false)
+	OR EXISTS (SELECT 1 FROM groups g WHERE g.group_id = m.group_id AND g.user_id = ?)
+)`
+
+func (m *SqliteDB) CanReact(userID int, target models.Target) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `DELETE FROM eventnotifications WHERE event_id = ? AND member_id = ?`
+	var stmt string
+	args := []interface{}{}
+	switch column, id := targetColumn(target); column {
+	case "post_id":
+		stmt = `SELECT EXISTS (SELECT 1 FROM posts p WHERE p.post_id = ? AND ` + visiblePost + `)`
+		args = append(append(args, id), visibleArgs(userID)...)
+	case "comment_id":
+		stmt = `SELECT EXISTS (SELECT 1 FROM comments c JOIN posts p ON p.post_id = c.post_id WHERE c.comment_id = ? AND c.deleted_at IS NULL AND ` + visiblePost + `)`
+		args = append(append(args, id), visibleArgs(userID)...)
+	default:
+		stmt = `SELECT EXISTS (SELECT 1 FROM messages m WHERE m.message_id = ? AND ` + messageVisible + `)`
+		args = append(args, id, userID, userID, userID, userID)
+	}
 
-	_, err := m.DB.ExecContext(ctx, stmt, eventID, userID)
+	var visible bool
+	err := m.queryRow(ctx, stmt, args...).Scan(&visible)
 	if err != nil {
-		return err
+		return false, err
 	}
-	return nil
+
+	return visible, nil
 }
 
-func (m *SqliteDB) AllEvents() ([]models.Event, error) {
+// WhoCanReact is CanReact for several users at once: it returns those of
+// userIDs who may see the target, in one query.
+func (m *SqliteDB) WhoCanReact(userIDs []int, target models.Target) ([]int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT event_id, title, description, user_id, first_name, last_name, time, group_id FROM events`
-
-	rows, err := m.DB.QueryContext(ctx, stmt)
-	if err != nil {
-		return nil, err
+	// The conditions of CanReact, with each user u as the viewer.
+	var cond string
+	column, id := targetColumn(target)
+	switch column {
+	case "post_id":
+		cond = `EXISTS (SELECT 1 FROM posts p WHERE p.post_id = ? AND ` + visibleTo(visiblePost) + `)`
+	case "comment_id":
+		cond = `EXISTS (SELECT 1 FROM comments c JOIN posts p ON p.post_id = c.post_id WHERE c.comment_id = ? AND c.deleted_at IS NULL AND ` + visibleTo(visiblePost) + `)`
+	default:
+		cond = `EXISTS (SELECT 1 FROM messages m WHERE m.message_id = ? AND ` + visibleTo(messageVisible) + `)`
 	}
 
-	var events []models.Event
-	for rows.Next() {
-		var event models.Event
-		err := rows.Scan(&event.EventID, &event.Title, &event.Description, &event.UserID, &event.FirstName, &event.LastName, &event.Time, &event.GroupID)
+	var viewers []int
+	for _, chunk := range chunkIDs(userIDs) {
+		stmt := `SELECT u.user_id FROM users u WHERE u.user_id IN (` + placeholders(len(chunk)) + `) AND ` + cond
+
+		rows, err := m.query(ctx, stmt, append(intArgs(chunk), id)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var userID int
+			if err := rows.Scan(&userID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			viewers = append(viewers, userID)
+		}
+		err = rows.Err()
+		rows.Close()
 		if err != nil {
 			return nil, err
 		}
-		events = append(events, event)
 	}
-	return events, nil
+
+	return viewers, nil
 }
 
-func (m *SqliteDB) GetEvent(id int) (*models.Event, error) {
+// visibleTo turns a condition that binds the viewer's ID, such as
+// visiblePost, into one on the users u of the query it is used in.
+func visibleTo(cond string) string {
+	return strings.ReplaceAll(cond, "?", "u.user_id")
+}
+
+// SetReaction deletes the user's reaction before storing the new one, so a
+// changed reaction counts as the newest in Reactors.
+func (m *SqliteDB) SetReaction(reaction *models.Reaction) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT event_id, title, description, user_id, first_name, last_name, time, group_id FROM events WHERE event_id = $1`
+	column, id := targetColumn(reaction.Target)
+	reaction.Date = time.Now()
+
+	return m.withTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM reactions WHERE `+column+` = ? AND user_id = ?`, id, reaction.UserID)
+		if err != nil || reaction.Emoji == "" {
+			return err
+		}
 
-	row := m.DB.QueryRowContext(ctx, stmt, id)
+		stmt := `INSERT INTO reactions (user_id, ` + column + `, emoji, date) VALUES (?, ?, ?, ?)`
 
-	var event models.Event
+		result, err := tx.ExecContext(ctx, stmt, reaction.UserID, id, reaction.Emoji, reaction.Date)
+		if err != nil {
+			return err
+		}
 
-	err := row.Scan(&event.GroupID, &event.Title, &event.Description, &event.UserID, &event.FirstName, &event.LastName, &event.Time, &event.GroupID)
+		reactionID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		reaction.ReactionID = int(reactionID)
+		return nil
+	})
+}
 
-	if err != nil {
-		return nil, err
-	}
+func (m *SqliteDB) ReactionsForPosts(viewerID int, postIDs []int) (map[int]models.Reactions, error) {
+	return m.reactionsFor("post_id", viewerID, postIDs)
+}
 
-	return &event, nil
+func (m *SqliteDB) ReactionsForComments(viewerID int, commentIDs []int) (map[int]models.Reactions, error) {
+	return m.reactionsFor("comment_id", viewerID, commentIDs)
 }
 
-func (m *SqliteDB) CheckMembership(userID, groupID int) (bool, error) {
+func (m *SqliteDB) ReactionsForMessages(viewerID int, messageIDs []int) (map[int]models.Reactions, error) {
+	return m.reactionsFor("message_id", viewerID, messageIDs)
+}
+
+// reactionsFor counts the reactions to several targets of one kind in one
+// round trip, like attachmentsFor.
+func (m *SqliteDB) reactionsFor(column string, viewerID int, ids []int) (map[int]models.Reactions, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT EXISTS ( SELECT 1 FROM groupmembers WHERE group_id = $1 AND member_id = $2)`
+	reactions := make(map[int]models.Reactions, len(ids))
+	for _, chunk := range chunkIDs(ids) {
+		stmt := `SELECT ` + column + `, emoji, COUNT(*), MAX(user_id = ?) FROM reactions WHERE ` + column + ` IN (` + placeholders(len(chunk)) + `) GROUP BY ` + column + `, emoji`
 
-	var isMember bool
-	row := m.DB.QueryRowContext(ctx, stmt, groupID, userID)
-	err := row.Scan(&isMember)
-	if err != nil {
-		return false, err
+		rows, err := m.query(ctx, stmt, append([]interface{}{viewerID}, intArgs(chunk)...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var id, count int
+			var emoji string
+			var mine bool
+			err := rows.Scan(&id, &emoji, &count, &mine)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			summary := reactions[id]
+			if summary.Counts == nil {
+				summary.Counts = map[string]int{}
+			}
+			summary.Counts[emoji] = count
+			if mine {
+				summary.Mine = emoji
+			}
+			reactions[id] = summary
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return isMember, nil
+	return reactions, nil
 }
 
-func (m *SqliteDB) CheckCreator(userID, groupID int) (bool, error) {
+func (m *SqliteDB) Reactors(target models.Target, page database.Page) ([]models.Reaction, database.Cursors, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT EXISTS ( SELECT 1 FROM groups WHERE group_id = $1 AND user_id = $2)`
+	column, id := targetColumn(target)
+	where, tail, args := keyset(page, "r.reaction_id", true)
+	stmt := `SELECT r.reaction_id, r.user_id, u.first_name, u.last_name, r.emoji, r.date
+		FROM reactions r JOIN users u ON u.user_id = r.user_id
+		WHERE r.` + column + ` = ? AND ` + where + ` ` + tail
 
-	var isCreator bool
-	row := m.DB.QueryRowContext(ctx, stmt, groupID, userID)
-	err := row.Scan(&isCreator)
+	rows, err := m.query(ctx, stmt, append([]interface{}{id}, args...)...)
 	if err != nil {
-		return false, err
+		return nil, database.Cursors{}, err
 	}
+	defer rows.Close()
 
-	return isCreator, nil
+	var reactions []models.Reaction
+	for rows.Next() {
+		reaction := models.Reaction{Target: target}
+		err := rows.Scan(&reaction.ReactionID, &reaction.UserID, &reaction.FirstName, &reaction.LastName, &reaction.Emoji, &reaction.Date)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		reactions = append(reactions, reaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Cursors{}, err
+	}
+
+	reactions, cursors := database.Paginate(reactions, page, reactionKey)
+	return reactions, cursors, nil
 }
 
-func (m *SqliteDB) GetParticipants(id int) ([]models.EventParticipants, error) {
+func (m *SqliteDB) UsersByNicknames(nicknames []string) (map[string]int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT event_id, participant_id, first_name, last_name, going FROM eventparticipants WHERE event_id = $1`
+	users := make(map[string]int, len(nicknames))
+	if len(nicknames) == 0 {
+		return users, nil
+	}
+
+	args := make([]interface{}, len(nicknames))
+	conds := make([]string, len(nicknames))
+	for i, nickname := range nicknames {
+		args[i] = nickname
+		conds[i] = "lower(?)"
+	}
+	stmt := `SELECT user_id, nickname FROM users WHERE lower(nickname) IN (` + strings.Join(conds, ", ") + `) ORDER BY user_id`
 
-	rows, err := m.DB.QueryContext(ctx, stmt, id)
+	rows, err := m.query(ctx, stmt, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var participants []models.EventParticipants
 	for rows.Next() {
-		var participant models.EventParticipants
-		err := rows.Scan(&participant.EventID, &participant.ParticipantID, &participant.FirstName, &participant.LastName, &participant.Going)
+		var userID int
+		var nickname string
+		err := rows.Scan(&userID, &nickname)
 		if err != nil {
 			return nil, err
 		}
-		participants = append(participants, participant)
+		if _, ok := users[strings.ToLower(nickname)]; !ok {
+			users[strings.ToLower(nickname)] = userID
+		}
 	}
-	return participants, nil
+
+	return users, rows.Err()
 }
 
-func (m *SqliteDB) GoingToEvent(userID, eventID int, firstName string, lastName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+// replaceMentions replaces the mentions in the target, written by authorID,
+// and sets their IDs. Mentions the user has seen stay marked as seen when the
+// target is edited and still mentions them.
+func replaceMentions(ctx context.Context, tx *sql.Tx, target models.Target, authorID int, mentions []models.Mention) error {
+	column, id := targetColumn(target)
+	date := time.Now()
 
-	stmt := `INSERT INTO eventparticipants (event_id, participant_id, first_name, last_name, going) VALUES (?, ?, ?, ?, 1)`
+	rows, err := tx.QueryContext(ctx, `SELECT user_id, seen FROM mentions WHERE `+column+` = ?`, id)
+	if err != nil {
+		return err
+	}
+	seen := make(map[int]bool)
+	for rows.Next() {
+		var userID int
+		var wasSeen bool
+		if err := rows.Scan(&userID, &wasSeen); err != nil {
+			rows.Close()
+			return err
+		}
+		seen[userID] = seen[userID] || wasSeen
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.ExecContext(ctx, stmt, eventID, userID, firstName, lastName)
+	_, err = tx.ExecContext(ctx, `DELETE FROM mentions WHERE `+column+` = ?`, id)
 	if err != nil {
 		return err
 	}
 
+	stmt := `INSERT INTO mentions (user_id, author_id, ` + column + `, position, length, seen, date) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	for i := range mentions {
+		mention := &mentions[i]
+		result, err := tx.ExecContext(ctx, stmt, mention.UserID, authorID, id, mention.Offset, mention.Length, seen[mention.UserID], date)
+		if err != nil {
+			return err
+		}
+		mentionID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		mention.MentionID, mention.Date = int(mentionID), date
+	}
 	return nil
 }
 
-func (m *SqliteDB) IsGoing(userID, eventID int) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `SELECT EXISTS ( SELECT 1 FROM eventparticipants WHERE event_id = $1 AND participant_id = $2 AND going = true)`
+func (m *SqliteDB) MentionsForPosts(postIDs []int) (map[int][]models.Mention, error) {
+	return m.mentionsFor("post_id", postIDs)
+}
 
-	var isGoing bool
-	row := m.DB.QueryRowContext(ctx, stmt, eventID, userID)
-	err := row.Scan(&isGoing)
-	if err != nil {
-		return false, err
-	}
+func (m *SqliteDB) MentionsForComments(commentIDs []int) (map[int][]models.Mention, error) {
+	return m.mentionsFor("comment_id", commentIDs)
+}
 
-	return isGoing, nil
+func (m *SqliteDB) MentionsForMessages(messageIDs []int) (map[int][]models.Mention, error) {
+	return m.mentionsFor("message_id", messageIDs)
 }
 
-func (m *SqliteDB) GoingToNotGoingEvent(userID, eventID int) error {
+// mentionsFor loads the mentions in several targets of one kind in one
+// round trip, like attachmentsFor.
+func (m *SqliteDB) mentionsFor(column string, ids []int) (map[int][]models.Mention, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `UPDATE eventparticipants SET going = false WHERE (event_id = ? AND participant_id = ?)`
+	mentions := make(map[int][]models.Mention, len(ids))
+	for _, chunk := range chunkIDs(ids) {
+		stmt := `SELECT mn.` + column + `, mn.mention_id, mn.user_id, u.first_name, u.last_name, COALESCE(u.nickname, ''), mn.position, mn.length, mn.date
+			FROM mentions mn JOIN users u ON u.user_id = mn.user_id
+			WHERE mn.` + column + ` IN (` + placeholders(len(chunk)) + `) ORDER BY mn.position`
 
-	_, err := m.DB.ExecContext(ctx, stmt, eventID, userID)
-	if err != nil {
-		return err
+		rows, err := m.query(ctx, stmt, intArgs(chunk)...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var id int
+			var mention models.Mention
+			err := rows.Scan(&id, &mention.MentionID, &mention.UserID, &mention.FirstName, &mention.LastName, &mention.Nickname, &mention.Offset, &mention.Length, &mention.Date)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			mentions[id] = append(mentions[id], mention)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	return mentions, nil
+}
+
+// mentionVisible is the condition for mentions mn in a post, comment or
+// message the mentioned user may see. It binds visibleArgs twice, then the
+// user's ID four times; see mentionArgs.
+const mentionVisible = `(
+	EXISTS (SELECT 1 FROM posts p WHERE p.post_id = mn.post_id AND ` + visiblePost + `)
+	OR EXISTS (SELECT 1 FROM comments c JOIN posts p ON p.post_id = c.post_id WHERE c.comment_id = mn.comment_id AND c.deleted_at IS NULL AND ` + visiblePost + `)
+	OR EXISTS (SELECT 1 FROM messages m WHERE m.message_id = mn.message_id AND ` + messageVisible + `)
+)`
+
+func mentionArgs(userID int) []interface{} {
+	args := append(visibleArgs(userID), visibleArgs(userID)...)
+	return append(args, userID, userID, userID, userID)
 }
 
-func (m *SqliteDB) NotGoingToEvent(userID, eventID int, firstName string, lastName string) error {
+func (m *SqliteDB) UserMentions(userID int, page database.Page) ([]models.Mention, database.Cursors, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `INSERT INTO eventparticipants (event_id, participant_id, first_name, last_name, going) VALUES (?, ?, ?, ?, 0)`
+	where, tail, pageArgs := keyset(page, "mn.mention_id", true)
+	stmt := `SELECT mn.mention_id, COALESCE(mn.post_id, 0), COALESCE(mn.comment_id, 0), COALESCE(mn.message_id, 0),
+			mn.user_id, u.first_name, u.last_name, COALESCE(u.nickname, ''), mn.position, mn.length,
+			mn.author_id, a.first_name, a.last_name, mn.seen, mn.date
+		FROM mentions mn
+		JOIN users u ON u.user_id = mn.user_id
+		JOIN users a ON a.user_id = mn.author_id
+		WHERE mn.user_id = ? AND mn.author_id <> mn.user_id AND ` + mentionVisible + ` AND ` + where + ` ` + tail
 
-	_, err := m.DB.ExecContext(ctx, stmt, eventID, userID, firstName, lastName)
+	args := append([]interface{}{userID}, mentionArgs(userID)...)
+	rows, err := m.query(ctx, stmt, append(args, pageArgs...)...)
 	if err != nil {
-		return err
+		return nil, database.Cursors{}, err
 	}
+	defer rows.Close()
 
-	return nil
+	var mentions []models.Mention
+	for rows.Next() {
+		var mn models.Mention
+		err := rows.Scan(&mn.MentionID, &mn.PostID, &mn.CommentID, &mn.MessageID, &mn.UserID, &mn.FirstName, &mn.LastName, &mn.Nickname,
+			&mn.Offset, &mn.Length, &mn.AuthorID, &mn.AuthorFirstName, &mn.AuthorLastName, &mn.Seen, &mn.Date)
+		if err != nil {
+			return nil, database.Cursors{}, err
+		}
+		mentions = append(mentions, mn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.Cursors{}, err
+	}
+
+	mentions, cursors := database.Paginate(mentions, page, mentionKey)
+	return mentions, cursors, nil
 }
 
-func (m *SqliteDB) IsNotGoing(userID, eventID int) (bool, error) {
+func (m *SqliteDB) MarkMentionSeen(userID, mentionID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT EXISTS ( SELECT 1 FROM eventparticipants WHERE event_id = $1 AND participant_id = $2 AND going = false)`
-
-	var NotGoing bool
-	row := m.DB.QueryRowContext(ctx, stmt, eventID, userID)
-	err := row.Scan(&NotGoing)
+	result, err := m.exec(ctx, `UPDATE mentions SET seen = true WHERE mention_id = ? AND user_id = ?`, mentionID, userID)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	return NotGoing, nil
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (m *SqliteDB) NotGoingToGoingEvent(userID, eventID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `UPDATE eventparticipants SET going = true WHERE (event_id = ? AND participant_id = ?)`
+// carriesTag returns the condition for posts p that carry a tag matching
+// tagCond, which tests h.tag, themselves or in one of their comments. The
+// arguments of tagCond are bound twice.
+func carriesTag(tagCond string) string {
+	return `(EXISTS (SELECT 1 FROM hashtags h WHERE h.post_id = p.post_id AND ` + tagCond + `)
+		OR EXISTS (SELECT 1 FROM hashtags h JOIN comments c ON c.comment_id = h.comment_id WHERE c.post_id = p.post_id AND ` + tagCond + `))`
+}
 
-	_, err := m.DB.ExecContext(ctx, stmt, eventID, userID)
+// replaceTextEntities replaces the mentions and hashtags in a post or comment
+// written by authorID.
+func replaceTextEntities(ctx context.Context, tx *sql.Tx, target models.Target, authorID int, mentions []models.Mention, hashtags []models.Hashtag) error {
+	err := replaceMentions(ctx, tx, target, authorID, mentions)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return replaceHashtags(ctx, tx, target, hashtags)
 }
 
-func (m *SqliteDB) AddMessage(message, firstNameFrom, firstNameTo string, date time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+// replaceHashtags replaces the hashtags in a post or comment. Tags it already
+// had keep the date they were first used in it.
+func replaceHashtags(ctx context.Context, tx *sql.Tx, target models.Target, hashtags []models.Hashtag) error {
+	column, id := targetColumn(target)
+	now := time.Now().UTC()
 
-	stmt := `INSERT INTO messages (message, first_name_from, first_name_to, date) VALUES (?, ?, ?, ?)`
+	rows, err := tx.QueryContext(ctx, `SELECT tag, date FROM hashtags WHERE `+column+` = ?`, id)
+	if err != nil {
+		return err
+	}
+	firstUsed := make(map[string]time.Time)
+	for rows.Next() {
+		var tag string
+		var date time.Time
+		if err := rows.Scan(&tag, &date); err != nil {
+			rows.Close()
+			return err
+		}
+		if used, ok := firstUsed[tag]; !ok || date.Before(used) {
+			firstUsed[tag] = date
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.ExecContext(ctx, stmt, message, firstNameFrom, firstNameTo, date)
+	_, err = tx.ExecContext(ctx, `DELETE FROM hashtags WHERE `+column+` = ?`, id)
 	if err != nil {
-		fmt.Println("Error inserting message:", err)
 		return err
 	}
 
+	stmt := `INSERT INTO hashtags (tag, ` + column + `, position, length, date) VALUES (?, ?, ?, ?, ?)`
+	for _, hashtag := range hashtags {
+		date, ok := firstUsed[hashtag.Tag]
+		if !ok {
+			date = now
+		}
+		_, err := tx.ExecContext(ctx, stmt, hashtag.Tag, id, hashtag.Offset, hashtag.Length, date)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (m *SqliteDB) GetMessages(firstNameFrom, firstNameTo string) ([]models.Message, error) {
+func (m *SqliteDB) HashtagsForPosts(postIDs []int) (map[int][]models.Hashtag, error) {
+	return m.hashtagsFor("post_id", postIDs)
+}
+
+func (m *SqliteDB) HashtagsForComments(commentIDs []int) (map[int][]models.Hashtag, error) {
+	return m.hashtagsFor("comment_id", commentIDs)
+}
+
+func (m *SqliteDB) hashtagsFor(column string, ids []int) (map[int][]models.Hashtag, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT message, first_name_from, first_name_to, date FROM messages WHERE (first_name_to = $1 AND first_name_from = $2) OR (first_name_from = $1 AND first_name_to = $2)`
-
-	rows, err := m.DB.QueryContext(ctx, stmt, firstNameTo, firstNameFrom)
-	if err != nil {
-		return nil, err
-	}
+	hashtags := make(map[int][]models.Hashtag, len(ids))
+	for _, chunk := range chunkIDs(ids) {
+		stmt := `SELECT ` + column + `, tag, position, length FROM hashtags WHERE ` + column + ` IN (` + placeholders(len(chunk)) + `) ORDER BY position`
 
-	var messages []models.Message
-	for rows.Next() {
-		var msg models.Message
-		err := rows.Scan(&msg.Message, &msg.FirstNameFrom, &msg.FirstNameTo, &msg.Date)
+		rows, err := m.query(ctx, stmt, intArgs(chunk)...)
 		if err != nil {
 			return nil, err
 		}
 
-		messages = append(messages, msg)
+		for rows.Next() {
+			var id int
+			var hashtag models.Hashtag
+			err := rows.Scan(&id, &hashtag.Tag, &hashtag.Offset, &hashtag.Length)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			hashtags[id] = append(hashtags[id], hashtag)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
 	}
-	return messages, nil
+
+	return hashtags, nil
+}
+
+func (m *SqliteDB) TagPosts(viewerID int, tag string, page database.Page) ([]models.Post, database.Cursors, error) {
+	args := append([]interface{}{tag, tag}, visibleArgs(viewerID)...)
+	return m.queryPosts(carriesTag(`h.tag = ?`)+` AND `+visiblePost, args, page)
 }
 
-func (m *SqliteDB) GetGroupMessages(groupName string) ([]models.Message, error) {
+// trendingTags counts each tag once per post or comment that uses it. It
+// binds the start of the window and visibleArgs twice, then the limit.
+const trendingTags = `SELECT t.tag, COUNT(*), COUNT(DISTINCT t.user_id) FROM (
+		SELECT DISTINCT h.tag, p.post_id AS id, p.user_id FROM hashtags h JOIN posts p ON p.post_id = h.post_id
+		WHERE h.date >= ? AND ` + visiblePost + `
+		UNION ALL
+		SELECT DISTINCT h.tag, c.comment_id, c.user_id FROM hashtags h JOIN comments c ON c.comment_id = h.comment_id JOIN posts p ON p.post_id = c.post_id
+		WHERE h.date >= ? AND ` + visiblePost + `
+	) t
+	GROUP BY t.tag ORDER BY COUNT(*) DESC, COUNT(DISTINCT t.user_id) DESC, t.tag LIMIT ?`
+
+func (m *SqliteDB) TrendingTags(viewerID int, since time.Time, limit int) ([]models.TrendingTag, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT message, first_name_from, first_name_to, date FROM messages WHERE first_name_to = $1`
+	args := append([]interface{}{since.UTC()}, visibleArgs(viewerID)...)
+	args = append(append(args, since.UTC()), visibleArgs(viewerID)...)
 
-	rows, err := m.DB.QueryContext(ctx, stmt, groupName)
+	rows, err := m.query(ctx, trendingTags, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var messages []models.Message
+	var tags []models.TrendingTag
 	for rows.Next() {
-		var msg models.Message
-		err := rows.Scan(&msg.Message, &msg.FirstNameFrom, &msg.FirstNameTo, &msg.Date)
+		var tag models.TrendingTag
+		err := rows.Scan(&tag.Tag, &tag.Uses, &tag.Users)
 		if err != nil {
 			return nil, err
 		}
-
-		messages = append(messages, msg)
+		tags = append(tags, tag)
 	}
-	return messages, nil
+
+	return tags, rows.Err()
 }
 
-func (m *SqliteDB) GetUnreadMessages(firstNameTo string) ([]models.Message, error) {
+func (m *SqliteDB) SetHashtagFollow(userID int, tag string, following bool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	stmt := `SELECT message, first_name_from, first_name_to, date FROM messages WHERE read = 0 AND first_name_to = ?`
+	if !following {
+		_, err := m.exec(ctx, `DELETE FROM hashtag_follows WHERE user_id = ? AND tag = ?`, userID, tag)
+		return err
+	}
+	_, err := m.exec(ctx, `INSERT INTO hashtag_follows (user_id, tag, date) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`, userID, tag, time.Now().UTC())
+	return err
+}
+
+func (m *SqliteDB) FollowedHashtags(userID int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, stmt, firstNameTo)
+	rows, err := m.query(ctx, `SELECT tag FROM hashtag_follows WHERE user_id = ? ORDER BY tag`, userID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var unreadMessages []models.Message
+	var tags []string
 	for rows.Next() {
-		var msg models.Message
-		err := rows.Scan(&msg.Message, &msg.FirstNameFrom, &msg.FirstNameTo, &msg.Date)
-		if err != nil {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
 			return nil, err
 		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// aboutVisible is the condition for users u whose about me the viewer may
+// search: public profiles, their own and those they follow. It binds the
+// viewer's ID twice.
+const aboutVisible = `(u.public = true OR u.user_id = ?
+	OR EXISTS (SELECT 1 FROM followers f WHERE f.follower_id = ? AND f.following_id = u.user_id AND f.request_pending = false))`
+
+// searchSource is the query for one type of search result. Its columns are
+// those of a models.SearchResult from ID to Rank, and its WHERE clause is
+// left open for the filters, which compare the author, group and date
+// columns. A filter on a column the source lacks leaves it out.
+type searchSource struct {
+	kind                string
+	stmt                string
+	args                []interface{}
+	author, group, date string
+}
+
+// searchMatch turns search terms into an FTS5 query for words starting with
+// each of them, in column when it is set.
+func searchMatch(terms []string, column string) string {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term + `"*`
+	}
+	match := strings.Join(phrases, " ")
+	if column != "" {
+		match = column + " : (" + match + ")"
+	}
+	return match
+}
+
+// Search runs a query for each type searched and merges their results. Ranks
+// are the negated bm25 scores of FTS5, so higher is better, with names and
+// titles weighing more than the text under them.
+func (m *SqliteDB) Search(viewerID int, q models.SearchQuery, page database.SearchPage) ([]models.SearchResult, database.SearchCursors, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	if len(q.Terms) == 0 {
+		return nil, database.SearchCursors{}, nil
+	}
+
+	match := searchMatch(q.Terms, "")
+	snippet := func(table string, column int) string {
+		return fmt.Sprintf(`snippet(%s, %d, ?, ?, '…', 16)`, table, column)
+	}
+	marks := []interface{}{entities.HighlightStart, entities.HighlightEnd}
+	withMarks := func(args ...interface{}) []interface{} {
+		return append(append([]interface{}{}, marks...), args...)
+	}
+
+	userColumns := `u.user_id AS id, u.user_id, u.first_name, u.last_name, '', 0, 0, `
+	sources := []searchSource{
+		{
+			kind: models.SearchUser,
+			stmt: `SELECT ` + userColumns + snippet("users_search", -1) + `, NULL, -bm25(users_search, 4.0, 1.0) AS score
+				FROM users_search JOIN users u ON u.user_id = users_search.rowid
+				WHERE users_search MATCH ? AND ` + aboutVisible,
+			args: withMarks(match, viewerID, viewerID),
+		},
+		{
+			kind: models.SearchUser,
+			stmt: `SELECT ` + userColumns + snippet("users_search", 0) + `, NULL, -bm25(users_search, 4.0, 1.0) AS score
+				FROM users_search JOIN users u ON u.user_id = users_search.rowid
+				WHERE users_search MATCH ? AND NOT ` + aboutVisible,
+			args: withMarks(searchMatch(q.Terms, "name"), viewerID, viewerID),
+		},
+		{
+			kind: models.SearchPost,
+			stmt: `SELECT p.post_id AS id, p.user_id, u.first_name, u.last_name, '', 0, COALESCE(p.group_id, 0), ` + snippet("posts_search", 0) + `, p.date, -bm25(posts_search) AS score
+				FROM posts_search JOIN posts p ON p.post_id = posts_search.rowid JOIN users u ON u.user_id = p.user_id
+				WHERE posts_search MATCH ? AND ` + visiblePost,
+			args:   append(withMarks(match), visibleArgs(viewerID)...),
+			author: "p.user_id", group: "p.group_id", date: "p.date",
+		},
+		{
+			kind: models.SearchComment,
+			stmt: `SELECT c.comment_id AS id, c.user_id, u.first_name, u.last_name, '', c.post_id, COALESCE(p.group_id, 0), ` + snippet("comments_search", 0) + `, c.date, -bm25(comments_search) AS score
+				FROM comments_search JOIN comments c ON c.comment_id = comments_search.rowid
+				JOIN posts p ON p.post_id = c.post_id JOIN users u ON u.user_id = c.user_id
+				WHERE comments_search MATCH ? AND c.deleted_at IS NULL AND ` + visiblePost,
+			args:   append(withMarks(match), visibleArgs(viewerID)...),
+			author: "c.user_id", group: "p.group_id", date: "c.date",
+		},
+		{
+			kind: models.SearchGroup,
+			stmt: `SELECT g.group_id AS id, g.user_id, u.first_name, u.last_name, g.title, 0, g.group_id, ` + snippet("groups_search", -1) + `, NULL, -bm25(groups_search, 4.0, 1.0) AS score
+				FROM groups_search JOIN groups g ON g.group_id = groups_search.rowid JOIN users u ON u.user_id = g.user_id
+				WHERE groups_search MATCH ?`,
+			args:   withMarks(match),
+			author: "g.user_id",
+		},
+		{
+			kind: models.SearchEvent,
+			stmt: `SELECT e.event_id AS id, e.user_id, u.first_name, u.last_name, COALESCE(e.title, ''), 0, e.group_id, ` + snippet("events_search", -1) + `, NULL, -bm25(events_search, 4.0, 1.0) AS score
+				FROM events_search JOIN events e ON e.event_id = events_search.rowid JOIN users u ON u.user_id = e.user_id
+				WHERE events_search MATCH ? AND (
+					EXISTS (SELECT 1 FROM groupmembers gm WHERE gm.group_id = e.group_id AND gm.member_id = ? AND gm.request_pending = false AND gm.invitation_pending = false)
+					OR EXISTS (SELECT 1 FROM groups g WHERE g.group_id = e.group_id AND g.user_id = ?)
+				)`,
+			args:   withMarks(match, viewerID, viewerID),
+			author: "e.user_id", group: "e.group_id",
+		},
+	}
+
+	var results []models.SearchResult
+	for _, source := range sources {
+		stmt, args, ok := source.filter(q)
+		if !ok {
+			continue
+		}
 
-		unreadMessages = append(unreadMessages, msg)
+		stmt, args = source.page(stmt, args, page)
+		rows, err := m.query(ctx, stmt, args...)
+		if err != nil {
+			return nil, database.SearchCursors{}, err
+		}
+		for rows.Next() {
+			result := models.SearchResult{Type: source.kind}
+			var date sql.NullTime
+			err := rows.Scan(&result.ID, &result.UserID, &result.FirstName, &result.LastName, &result.Title, &result.PostID, &result.GroupID, &result.Snippet, &date, &result.Rank)
+			if err != nil {
+				rows.Close()
+				return nil, database.SearchCursors{}, err
+			}
+			if date.Valid {
+				result.Date = &date.Time
+			}
+			results = append(results, result)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, database.SearchCursors{}, err
+		}
 	}
-	return unreadMessages, nil
+
+	results, cursors := database.RankResults(results, page)
+	return results, cursors, nil
 }
 
-func (m *SqliteDB) MarkMessagesAsRead(firstNameTo, firstNameFrom string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+// page wraps a filtered statement to return, in the order of the walk, up
+// to one result more than the page size from past the cursor. The source's
+// results of a type ranked after the cursor's come after it on a tie.
+func (s searchSource) page(stmt string, args []interface{}, page database.SearchPage) (string, []interface{}) {
+	stmt = `SELECT * FROM (` + stmt + `) s`
+	if c := page.Cursor; c != nil {
+		past := "<"
+		if page.Backward {
+			past = ">"
+		}
+		switch {
+		case s.kind == c.Type:
+			stmt += ` WHERE score ` + past + ` ? OR (score = ? AND id ` + past + ` ?)`
+			args = append(args, c.Rank, c.Rank, c.ID)
+		case (s.kind > c.Type) != page.Backward:
+			stmt += ` WHERE score ` + past + `= ?`
+			args = append(args, c.Rank)
+		default:
+			stmt += ` WHERE score ` + past + ` ?`
+			args = append(args, c.Rank)
+		}
+	}
 
-	stmt := `UPDATE messages SET read = 1 WHERE first_name_to = ? AND first_name_from = ? AND read = 0`
+	if page.Backward {
+		stmt += ` ORDER BY score, id`
+	} else {
+		stmt += ` ORDER BY score DESC, id DESC`
+	}
+	return stmt + ` LIMIT ?`, append(args, page.Limit+1)
+}
 
-	_, err := m.DB.ExecContext(ctx, stmt, firstNameTo, firstNameFrom)
-	if err != nil {
-		return err
+// filter adds the query's filters to the source, or reports that it has
+// nothing to compare one of them to.
+func (s searchSource) filter(q models.SearchQuery) (string, []interface{}, bool) {
+	if !database.Searches(q, s.kind) {
+		return "", nil, false
 	}
 
-	return nil
+	stmt, args := s.stmt, append([]interface{}{}, s.args...)
+	add := func(column, cond string, arg interface{}) bool {
+		if column == "" {
+			return false
+		}
+		stmt += ` AND ` + column + cond
+		args = append(args, arg)
+		return true
+	}
+
+	if q.AuthorID != 0 && !add(s.author, ` = ?`, q.AuthorID) {
+		return "", nil, false
+	}
+	if q.GroupID != 0 && !add(s.group, ` = ?`, q.GroupID) {
+		return "", nil, false
+	}
+	if !q.From.IsZero() && !add(s.date, ` >= ?`, q.From.UTC()) {
+		return "", nil, false
+	}
+	if !q.To.IsZero() && !add(s.date, ` < ?`, q.To.UTC()) {
+		return "", nil, false
+	}
+	return stmt, args, true
 }
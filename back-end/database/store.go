@@ -0,0 +1,300 @@
+// Package database defines the storage the API depends on, split by domain.
+// The sqlite and postgres packages implement it on those databases; memory
+// keeps everything in process so handlers can be tested without a database.
+//
+// Lookups of a single row return sql.ErrNoRows when it does not exist, which
+// handlers turn into 404 responses.
+package database
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"social-network/models"
+)
+
+// ErrNoSession is returned when the request carries no cookie, a malformed one,
+// or one that does not match a stored session.
+var ErrNoSession = errors.New("no valid session")
+
+type UserStore interface {
+	Register(userData *models.UserData) error
+	CheckEmail(email string) (bool, error)
+	Login(userData *models.UserData) error
+	DataFromUserData(userData *models.UserData) (int, string, string, string, error)
+	GetUserDataByEmail(email string) (*models.UserData, error)
+	GetUser(id int) (*models.UserData, error)
+	UsersByIDs(userIDs []int) (map[int]*models.UserData, error)
+	UserIDByFirstName(firstName string) (int, error)
+	UpdateProfileType(userID int) error
+	IsUserPublic(userID int) (bool, error)
+	// UserAvatars returns the avatar of every user who has one, by user ID.
+	UserAvatars() (map[int]string, error)
+	// SetAvatar replaces the user's avatar, "" for none, and returns the one
+	// it replaced. It returns sql.ErrNoRows if the user does not exist.
+	SetAvatar(userID int, avatar string) (string, error)
+}
+
+type SessionStore interface {
+	Session(session *models.Session) error
+	DeleteSession(uuid string) error
+	DataFromSession(r *http.Request) (int, string, string, string, error)
+}
+
+// PostStore holds posts and their comments. CreatePost and CreateComment
+// also store the attachments of the new post or comment, in order, and its
+// Mentions and Hashtags, in the same transaction.
+type PostStore interface {
+	CreatePost(post *models.Post) error
+	// PostAuthor returns the ID of the user who wrote the post. It returns
+	// sql.ErrNoRows if the post does not exist.
+	PostAuthor(postID int) (int, error)
+	// UpdatePost replaces the content, privacy, audience, image,
+	// attachments, mentions and hashtags of the post, keeping the version it
+	// replaces as a revision, and sets its EditedAt. Attachments with an ID
+	// must be ones of the post; they are kept with their new position and
+	// alt text. The others are stored as new ones. Mentions the user has
+	// seen stay seen, and tags keep the date they were first used in the
+	// post. It returns sql.ErrNoRows if the post does not exist.
+	UpdatePost(post *models.Post) error
+	// DeletePost deletes the post with its comments, revisions and all their
+	// attachments, and returns the names of the files those referred to. It
+	// returns sql.ErrNoRows if the post does not exist.
+	DeletePost(postID int) ([]string, error)
+	// PostRevisions returns the earlier versions of the post, oldest first.
+	PostRevisions(postID int) ([]models.PostRevision, error)
+	// FeedPosts returns the posts outside groups that the viewer may see,
+	// and the ones in their groups that carry a hashtag they follow.
+	FeedPosts(viewerID int, page Page) ([]models.Post, Cursors, error)
+	UserPosts(viewerID, userID int, page Page) ([]models.Post, Cursors, error)
+	GroupPosts(viewerID, groupID int, page Page) ([]models.Post, Cursors, error)
+	ProfilePosts(userID int, page Page) ([]models.Post, Cursors, error)
+	// CreateComment stores a comment, or a reply to ParentID at Depth.
+	CreateComment(comment *models.Comment) error
+	// GetComment returns a comment without its attachments, or
+	// sql.ErrNoRows.
+	GetComment(commentID int) (models.Comment, error)
+	// UpdateComment replaces the text, image, attachments, mentions and
+	// hashtags of a comment, like UpdatePost but without keeping a revision,
+	// and sets its EditedAt.
+	// It returns the names of the files of the attachments it removed, or
+	// sql.ErrNoRows if the comment does not exist or was deleted.
+	UpdateComment(comment *models.Comment) ([]string, error)
+	// DeleteComment deletes a comment and its attachments and returns the
+	// names of their files. A comment with replies is emptied and marked
+	// deleted instead; deleted comments are removed once their last reply
+	// is. It returns sql.ErrNoRows if the comment does not exist.
+	DeleteComment(commentID int) ([]string, error)
+	// CommentsForPosts returns every comment of the posts, replies included,
+	// in the order they were written.
+	CommentsForPosts(postIDs []int) (map[int][]models.Comment, error)
+	// PostComments returns a page of the replies to parentID, or of the
+	// top-level comments of the post if it is 0.
+	PostComments(postID, parentID int, page Page) ([]models.Comment, Cursors, error)
+	// CanViewImage reports whether the viewer may see an uploaded file: an
+	// avatar, the image or an attachment of a post or comment on a post they
+	// may see, an attachment of a chat message they sent or received, or an
+	// attachment they uploaded and have not sent yet.
+	CanViewImage(viewerID int, name string) (bool, error)
+	// ImageInUse reports whether any user, post, comment or attachment
+	// refers to the uploaded file.
+	ImageInUse(name string) (bool, error)
+}
+
+// AttachmentStore holds the files attached to posts, comments and chat
+// messages. Each list comes in the order the files were attached.
+type AttachmentStore interface {
+	// CreateAttachments stores files the user uploaded to send with a chat
+	// message later, setting their IDs. AddMessage attaches them.
+	CreateAttachments(userID int, attachments []models.Attachment) error
+	AttachmentsForPosts(postIDs []int) (map[int][]models.Attachment, error)
+	AttachmentsForComments(commentIDs []int) (map[int][]models.Attachment, error)
+	AttachmentsForMessages(messageIDs []int) (map[int][]models.Attachment, error)
+	// DeletePendingAttachments removes attachments uploaded before the
+	// given time and never sent, returning how many there were.
+	DeletePendingAttachments(before time.Time) (int, error)
+}
+
+// MediaStore records the stored files, how many attachments and avatars
+// refer to each, and how much storage each user takes up.
+type MediaStore interface {
+	// MediaFileByHash returns the name of the file with the given content
+	// hash and marks it as reused, so it is not deleted before the upload
+	// that reused it refers to it. It returns sql.ErrNoRows if there is none.
+	MediaFileByHash(hash string) (string, error)
+	// AddMediaFile records a stored file and returns its name or, if a file
+	// with the same hash was recorded first, the name of that one.
+	AddMediaFile(file models.MediaFile) (string, error)
+	// MediaFileSizes returns the size of every recorded file by name, 0 if
+	// it is not known yet.
+	MediaFileSizes() (map[string]int64, error)
+	SetMediaFileSize(name string, size int64) error
+	// UnusedMediaFiles returns the files nothing refers to that were stored,
+	// and last reused, before the given time.
+	UnusedMediaFiles(before time.Time) ([]string, error)
+	// DeleteMediaFile forgets the file called name if nothing refers to it
+	// and it was not reused since the given time, and reports whether it
+	// can be removed from storage. Files that were never recorded can be
+	// removed if nothing refers to them.
+	DeleteMediaFile(name string, reusedBefore time.Time) (bool, error)
+	// MediaUsage returns the storage used by one user. It returns
+	// sql.ErrNoRows if the user does not exist.
+	MediaUsage(userID int) (models.MediaUsage, error)
+	// MediaUsageReport returns the storage used by every user, most first.
+	MediaUsageReport() ([]models.MediaUsage, error)
+	// SetMediaQuota sets the user's quota, nil for the default. It returns
+	// sql.ErrNoRows if the user does not exist.
+	SetMediaQuota(userID int, quota *int64) error
+}
+
+// ReactionStore holds the reactions of users to posts, comments and chat
+// messages, at most one per user and target.
+type ReactionStore interface {
+	// CanReact reports whether the user may see the target, and so react to
+	// it and see who did. Targets that do not exist and deleted comments
+	// cannot be reacted to.
+	CanReact(userID int, target models.Target) (bool, error)
+	// WhoCanReact returns those of userIDs who may see the target, checked
+	// together rather than one CanReact each.
+	WhoCanReact(userIDs []int, target models.Target) ([]int, error)
+	// SetReaction replaces the user's reaction to the target with the one
+	// given, or removes it if Emoji is empty.
+	SetReaction(reaction *models.Reaction) error
+	// ReactionsForPosts counts the reactions to each post, with viewerID's
+	// own in Mine. Posts without reactions are left out.
+	ReactionsForPosts(viewerID int, postIDs []int) (map[int]models.Reactions, error)
+	ReactionsForComments(viewerID int, commentIDs []int) (map[int]models.Reactions, error)
+	ReactionsForMessages(viewerID int, messageIDs []int) (map[int]models.Reactions, error)
+	// Reactors returns a page of the reactions to the target, newest first.
+	Reactors(target models.Target, page Page) ([]models.Reaction, Cursors, error)
+}
+
+// MentionStore holds the users mentioned in posts, comments and chat
+// messages.
+type MentionStore interface {
+	// UsersByNicknames looks up users by nickname, ignoring case. It returns
+	// the oldest user for nicknames that several users share, keyed by the
+	// nickname in lower case.
+	UsersByNicknames(nicknames []string) (map[string]int, error)
+	// MentionsForPosts returns the mentions in each post, in order.
+	MentionsForPosts(postIDs []int) (map[int][]models.Mention, error)
+	MentionsForComments(commentIDs []int) (map[int][]models.Mention, error)
+	MentionsForMessages(messageIDs []int) (map[int][]models.Mention, error)
+	// UserMentions returns a page of the mentions of the user, newest first,
+	// leaving out their own and those in posts, comments and messages they may
+	// not see.
+	UserMentions(userID int, page Page) ([]models.Mention, Cursors, error)
+	// MarkMentionSeen marks a mention of the user as seen. It returns
+	// sql.ErrNoRows if the user has no such mention.
+	MarkMentionSeen(userID, mentionID int) error
+}
+
+// HashtagStore holds the hashtags in posts and comments and the tags users
+// follow. Tags are stored as entities.NormalizeTag returns them.
+type HashtagStore interface {
+	// HashtagsForPosts returns the hashtags in each post, in order.
+	HashtagsForPosts(postIDs []int) (map[int][]models.Hashtag, error)
+	HashtagsForComments(commentIDs []int) (map[int][]models.Hashtag, error)
+	// TagPosts returns the posts the viewer may see that carry the tag
+	// themselves or in one of their comments, newest first.
+	TagPosts(viewerID int, tag string, page Page) ([]models.Post, Cursors, error)
+	// TrendingTags returns the tags used most since the given time in posts
+	// and comments the viewer may see, most used first.
+	TrendingTags(viewerID int, since time.Time, limit int) ([]models.TrendingTag, error)
+	// SetHashtagFollow makes the user follow the tag or stop following it.
+	SetHashtagFollow(userID int, tag string, following bool) error
+	// FollowedHashtags returns the tags the user follows, in order.
+	FollowedHashtags(userID int) ([]string, error)
+}
+
+// SearchStore finds users, posts, comments, groups and events by the words
+// in them, keeping to what the viewer may see: about me texts of private
+// profiles only for their followers, and events only in the viewer's groups.
+type SearchStore interface {
+	// Search returns a page of the best matches first, cutting their
+	// snippets with the matching words marked by entities.HighlightStart and
+	// HighlightEnd.
+	Search(viewerID int, query models.SearchQuery, page SearchPage) ([]models.SearchResult, SearchCursors, error)
+}
+
+// SocialStore holds who follows whom, including pending follow requests.
+type SocialStore interface {
+	ToggleFollow(followerID, followingID int) error
+	IsFollowing(userID, followingID int) (bool, error)
+	IsPending(userID, followingID int) (bool, error)
+	Following(userID int) ([]models.UserData, error)
+	Followers(userID int) ([]models.UserData, error)
+	FollowingPage(userID int, page Page) ([]models.UserData, Cursors, error)
+	FollowersPage(userID int, page Page) ([]models.UserData, Cursors, error)
+	FollowRequests(userID int) ([]models.FollowRequest, error)
+	AcceptFollower(userID, followerID int) error
+	DeclineFollower(userID, followerID int) error
+}
+
+type GroupStore interface {
+	CreateGroup(group *models.Group) (int, error)
+	AllGroups(page Page) ([]models.Group, Cursors, error)
+	GetGroup(id int) (*models.Group, error)
+	GroupIDByTitle(title string) (int, error)
+	GetGroupCreator(groupID int) (int, error)
+	GetGroupMembers(groupID int) ([]int, error)
+	GroupMemberList(groupID int, page Page) ([]models.UserData, Cursors, error)
+	IsMember(userID, groupID int) (bool, error)
+	CheckMembership(userID, groupID int) (bool, error)
+	CheckCreator(userID, groupID int) (bool, error)
+	CheckPending(userID, groupID int) (bool, error)
+	JoinGroup(userID, groupID int) error
+	LeaveGroup(userID, groupID int) error
+	InviteNewMember(groupMember *models.GroupMembers) error
+	GroupInvitations(userID int) ([]models.GroupMembers, error)
+	AcceptGroupInvitation(groupID, memberID int) error
+	DeclineGroupInvitation(groupID, memberID int) error
+	GroupRequests(userID int) ([]models.GroupMembers, error)
+	AcceptGroupRequest(groupID, memberID int) error
+	DeclineGroupRequest(groupID, memberID int) error
+}
+
+type EventStore interface {
+	CreateEvent(event *models.Event) (int, error)
+	GetEvent(id int) (*models.Event, error)
+	GroupEvents(viewerID, groupID int, page Page) ([]models.Event, Cursors, error)
+	GetEventNotifications(userID int) ([]models.EventNotifications, error)
+	DeleteFromEventNotifications(eventID, userID int) error
+	GetParticipants(id int) ([]models.EventParticipants, error)
+	RespondToEvent(userID, eventID int, going bool) error
+	IsGoing(userID, eventID int) (bool, error)
+	IsNotGoing(userID, eventID int) (bool, error)
+}
+
+type MessageStore interface {
+	// AddMessage stores the message with its Mentions and the attachments
+	// named by its AttachmentIDs. These must have been uploaded by the sender
+	// and not been sent yet, or it returns sql.ErrNoRows and stores nothing.
+	AddMessage(message *models.Message) error
+	// GetMessage returns a message without its attachments, or
+	// sql.ErrNoRows.
+	GetMessage(messageID int) (models.Message, error)
+	GetMessages(userID, otherID int, page Page) ([]models.Message, Cursors, error)
+	GetGroupMessages(groupID int, page Page) ([]models.Message, Cursors, error)
+	GetUnreadMessages(userID int) ([]models.Message, error)
+	MarkMessagesAsRead(userID, senderID int) error
+}
+
+// Store is everything the API needs from a storage backend.
+type Store interface {
+	UserStore
+	SessionStore
+	PostStore
+	SocialStore
+	GroupStore
+	EventStore
+	MessageStore
+	AttachmentStore
+	MediaStore
+	ReactionStore
+	MentionStore
+	HashtagStore
+	SearchStore
+	Close() error
+}
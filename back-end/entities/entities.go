@@ -0,0 +1,187 @@
+// Package entities finds the parts of user-written text that refer to
+// something else, such as @mentions of other users and #hashtags, and the
+// words in it that a search matched.
+//
+// Offsets and lengths are counted in UTF-16 code units, the way JavaScript
+// indexes strings, so clients can cut the text at them directly.
+package entities
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Mention is an @mention in a text. It names a user either by nickname, as
+// in "@ann", or by ID in the "@[user:12]" form clients insert when a user is
+// picked from a list.
+type Mention struct {
+	Nickname string
+	UserID   int
+	Offset   int
+	Length   int
+}
+
+var mentionPattern = regexp.MustCompile(`@\[user:([0-9]+)\]|@([\p{L}\p{N}_.]+)`)
+
+// Mentions returns the mentions in text, in order. An @ right after a
+// letter, digit or underscore is part of a word, such as an email address,
+// and does not start a mention. Dots that end a nickname are taken to end
+// the sentence instead.
+func Mentions(text string) []Mention {
+	var mentions []Mention
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[0], m[1]
+		if r, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWordRune(r) {
+			continue
+		}
+
+		mention := Mention{}
+		if m[2] >= 0 {
+			id, err := strconv.Atoi(text[m[2]:m[3]])
+			if err != nil || id <= 0 {
+				continue
+			}
+			mention.UserID = id
+		} else {
+			mention.Nickname = strings.TrimRight(text[m[4]:m[5]], ".")
+			if mention.Nickname == "" {
+				continue
+			}
+			end = m[4] + len(mention.Nickname)
+		}
+
+		mention.Offset = utf16Len(text[:start])
+		mention.Length = utf16Len(text[start:end])
+		mentions = append(mentions, mention)
+	}
+	return mentions
+}
+
+// Hashtag is a #hashtag in a text. Tag is the hashtag without the # and in
+// lower case, so "#Go" and "#go" are the same tag.
+type Hashtag struct {
+	Tag    string
+	Offset int
+	Length int
+}
+
+// MaxTagLength is the longest tag, in runes, that Hashtags and NormalizeTag
+// accept.
+const MaxTagLength = 64
+
+var hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+// Hashtags returns the hashtags in text, in order. Like an @mention, a # right
+// after a letter or digit, as in "C#5", does not start one, and neither does
+// one after & so HTML entities such as "&#39;" are left alone.
+func Hashtags(text string) []Hashtag {
+	var hashtags []Hashtag
+	for _, m := range hashtagPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[0], m[1]
+		if r, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && (isWordRune(r) || r == '&') {
+			continue
+		}
+		tag, ok := NormalizeTag(text[m[2]:m[3]])
+		if !ok {
+			continue
+		}
+		hashtags = append(hashtags, Hashtag{
+			Tag:    tag,
+			Offset: utf16Len(text[:start]),
+			Length: utf16Len(text[start:end]),
+		})
+	}
+	return hashtags
+}
+
+// NormalizeTag returns tag, with or without its #, in the form Hashtags
+// stores it, and whether it is a valid tag: up to MaxTagLength letters, digits
+// and underscores, at least one of them a letter.
+func NormalizeTag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if n := utf8.RuneCountInString(tag); n == 0 || n > MaxTagLength {
+		return "", false
+	}
+	letter := false
+	for _, r := range tag {
+		if !isWordRune(r) {
+			return "", false
+		}
+		letter = letter || unicode.IsLetter(r)
+	}
+	return tag, letter
+}
+
+// MaxSearchTerms is the most words of a search query SearchTerms keeps.
+const MaxSearchTerms = 8
+
+// SearchTerms returns the distinct words of a search query in lower case.
+// Anything other than letters and digits separates words, so the terms can
+// be put in a full-text query without escaping.
+func SearchTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !unicode.IsMark(r)
+	}) {
+		if seen[word] || len(terms) == MaxSearchTerms {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// HighlightStart and HighlightEnd mark the matching words in the snippets
+// the stores cut from search results. They are private use characters, which
+// user-written text is not expected to contain.
+const (
+	HighlightStart = "\ue000"
+	HighlightEnd   = "\ue001"
+)
+
+// Highlight is a matching word in a search snippet.
+type Highlight struct {
+	Offset int
+	Length int
+}
+
+// Highlights removes the highlight marks from a snippet and returns it with
+// where the marked words are in it.
+func Highlights(snippet string) (string, []Highlight) {
+	var text strings.Builder
+	var highlights []Highlight
+	offset, start := 0, -1
+	for _, r := range snippet {
+		switch string(r) {
+		case HighlightStart:
+			start = offset
+		case HighlightEnd:
+			if start >= 0 && offset > start {
+				highlights = append(highlights, Highlight{Offset: start, Length: offset - start})
+			}
+			start = -1
+		default:
+			text.WriteRune(r)
+			offset += utf16.RuneLen(r)
+		}
+	}
+	return text.String(), highlights
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,68 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Mention
+	}{
+		{"hi @ann and @[user:12]!", []Mention{
+			{Nickname: "ann", Offset: 3, Length: 4},
+			{UserID: 12, Offset: 12, Length: 10},
+		}},
+		{"ask @bob.", []Mention{{Nickname: "bob", Offset: 4, Length: 4}}},
+		{"mail ann@example.com", nil},
+		{"@[user:0] @ @.", nil},
+		// 😀 takes two UTF-16 code units.
+		{"😀 @Élise", []Mention{{Nickname: "Élise", Offset: 3, Length: 6}}},
+	}
+
+	for _, test := range tests {
+		if got := Mentions(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Mentions(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestHashtags(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Hashtag
+	}{
+		{"#Go and #golang_1.", []Hashtag{
+			{Tag: "go", Offset: 0, Length: 3},
+			{Tag: "golang_1", Offset: 8, Length: 9},
+		}},
+		{"C#5 &#39; #123 #", nil},
+		{"😀 #Été", []Hashtag{{Tag: "été", Offset: 3, Length: 4}}},
+	}
+
+	for _, test := range tests {
+		if got := Hashtags(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Hashtags(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestSearchTerms(t *testing.T) {
+	got := SearchTerms(`Café "go-lang" go_lang; AND café`)
+	want := []string{"café", "go", "lang", "and"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchTerms = %q, want %q", got, want)
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	text, highlights := Highlights("😀 " + HighlightStart + "café" + HighlightEnd + " and " + HighlightStart + "go" + HighlightEnd + HighlightEnd)
+	if text != "😀 café and go" {
+		t.Errorf("text = %q", text)
+	}
+	want := []Highlight{{Offset: 3, Length: 4}, {Offset: 12, Length: 2}}
+	if !reflect.DeepEqual(highlights, want) {
+		t.Errorf("highlights = %+v, want %+v", highlights, want)
+	}
+}
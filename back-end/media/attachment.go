@@ -0,0 +1,120 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrUnsupportedFile is returned for attachments that are not a
+	// supported image, an MP4 or WebM video or a PDF document.
+	ErrUnsupportedFile = errors.New("media: unsupported file type")
+	// ErrFileTooLarge is returned for videos and documents over the
+	// AttachmentLimits.
+	ErrFileTooLarge = errors.New("media: file is too large")
+	// ErrVideoTooLong is returned for videos that play for longer than
+	// AttachmentLimits.MaxVideoLength.
+	ErrVideoTooLong = errors.New("media: video is too long")
+)
+
+func init() {
+	// Not every system's MIME table knows these, and stores derive the
+	// content type of what they serve from the extension.
+	_ = mime.AddExtensionType(".mp4", "video/mp4")
+	_ = mime.AddExtensionType(".webm", "video/webm")
+	_ = mime.AddExtensionType(".pdf", "application/pdf")
+}
+
+// AttachmentLimits bounds the files ProcessAttachment accepts, by kind.
+type AttachmentLimits struct {
+	Image            ImageLimits
+	MaxVideoBytes    int64
+	MaxVideoLength   time.Duration
+	MaxDocumentBytes int64
+}
+
+// DefaultAttachmentLimits allows short clips and ordinary documents.
+var DefaultAttachmentLimits = AttachmentLimits{
+	Image:            DefaultImageLimits,
+	MaxVideoBytes:    50 << 20,
+	MaxVideoLength:   time.Minute,
+	MaxDocumentBytes: 10 << 20,
+}
+
+// MaxBytes returns the size of the largest file of any kind the limits
+// allow.
+func (l AttachmentLimits) MaxBytes() int64 {
+	max := l.Image.MaxBytes
+	if l.MaxVideoBytes > max {
+		max = l.MaxVideoBytes
+	}
+	if l.MaxDocumentBytes > max {
+		max = l.MaxDocumentBytes
+	}
+	return max
+}
+
+// ProcessAttachment reads an upload and checks it by its content, never by
+// its name or declared type. Images go through ProcessImage. MP4 and WebM
+// videos must declare how long they play, within the limit, and PDFs are
+// recognised by their header. Videos and documents are kept as they are,
+// without variants.
+func ProcessAttachment(r io.Reader, limits AttachmentLimits) (*Upload, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	r = io.MultiReader(bytes.NewReader(head), r)
+
+	contentType := http.DetectContentType(head)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return ProcessImage(r, limits.Image)
+
+	case "video/mp4", "video/webm":
+		data, err := readAtMost(r, limits.MaxVideoBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		probe, ext := probeMP4, ".mp4"
+		if contentType == "video/webm" {
+			probe, ext = probeWebM, ".webm"
+		}
+		video, ok := probe(data)
+		if !ok || video.width <= 0 || video.height <= 0 || video.duration <= 0 {
+			return nil, ErrUnsupportedFile
+		}
+		if video.duration > limits.MaxVideoLength {
+			return nil, ErrVideoTooLong
+		}
+		return &Upload{Ext: ext, ContentType: contentType, Width: video.width, Height: video.height, Data: data}, nil
+
+	case "application/pdf":
+		data, err := readAtMost(r, limits.MaxDocumentBytes)
+		if err != nil {
+			return nil, err
+		}
+		return &Upload{Ext: ".pdf", ContentType: contentType, Data: data}, nil
+	}
+
+	return nil, ErrUnsupportedFile
+}
+
+// readAtMost reads all of r, failing with ErrFileTooLarge past max bytes.
+func readAtMost(r io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, ErrFileTooLarge
+	}
+	return data, nil
+}
@@ -0,0 +1,156 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func box(typ string, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	out := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(out, uint32(8+len(data)))
+	copy(out[4:], typ)
+	return append(out, data...)
+}
+
+// mp4 returns the headers of an MP4 file with one video track of w by h
+// pixels, turned a quarter if rotated, playing for d.
+func mp4(w, h int, d time.Duration, rotated bool) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(d/time.Millisecond))
+
+	tkhd := make([]byte, 84)
+	a, b := uint32(0x00010000), uint32(0)
+	if rotated {
+		a, b = 0, 0x00010000
+	}
+	binary.BigEndian.PutUint32(tkhd[40:], a)
+	binary.BigEndian.PutUint32(tkhd[44:], b)
+	binary.BigEndian.PutUint32(tkhd[76:], uint32(w)<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], uint32(h)<<16)
+
+	// An audio track first, which has no size.
+	audio := box("trak", box("tkhd", make([]byte, 84)))
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00isommp41"))
+	return bytes.Join([][]byte{ftyp, box("moov", box("mvhd", mvhd), audio, box("trak", box("tkhd", tkhd))), box("mdat", []byte("frames"))}, nil)
+}
+
+func element(id uint32, body ...[]byte) []byte {
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	data := bytes.Join(body, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	return append(append(out, size...), data...)
+}
+
+// webm returns the start of a WebM file, with its segment of unknown size as
+// live encoders write it. A zero d leaves out the duration.
+func webm(docType string, w, h int, d time.Duration) []byte {
+	info := [][]byte{element(webmTimestampScale, []byte{0x0F, 0x42, 0x40})}
+	if d > 0 {
+		f := make([]byte, 8)
+		binary.BigEndian.PutUint64(f, math.Float64bits(float64(d/time.Millisecond)))
+		info = append(info, element(webmDuration, f))
+	}
+	video := element(webmVideo, element(webmPixelWidth, []byte{byte(w >> 8), byte(w)}), element(webmPixelHeight, []byte{byte(h >> 8), byte(h)}))
+	segment := bytes.Join([][]byte{
+		element(webmInfo, info...),
+		element(webmTracks, element(webmTrackEntry, video)),
+		element(webmCluster, []byte("frames")),
+	}, nil)
+
+	header := element(ebmlHeader, element(ebmlDocType, []byte(docType)))
+	return append(append(header, 0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF), segment...)
+}
+
+func TestProcessAttachmentVideo(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data        []byte
+		ext         string
+		contentType string
+		w, h        int
+	}{
+		"mp4":         {mp4(640, 360, 30*time.Second, false), ".mp4", "video/mp4", 640, 360},
+		"rotated mp4": {mp4(1920, 1080, 10*time.Second, true), ".mp4", "video/mp4", 1080, 1920},
+		"webm":        {webm("webm", 640, 360, 12500*time.Millisecond), ".webm", "video/webm", 640, 360},
+	} {
+		upload, err := ProcessAttachment(bytes.NewReader(tc.data), DefaultAttachmentLimits)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if upload.Ext != tc.ext || upload.ContentType != tc.contentType || upload.Width != tc.w || upload.Height != tc.h {
+			t.Errorf("%s: got %s %s %dx%d", name, upload.Ext, upload.ContentType, upload.Width, upload.Height)
+		}
+		if !bytes.Equal(upload.Data, tc.data) || upload.Variants != nil {
+			t.Errorf("%s: video was changed", name)
+		}
+	}
+}
+
+func TestProcessAttachment(t *testing.T) {
+	pdf := []byte("%PDF-1.7\n1 0 obj\n<<>>\nendobj\n%%EOF\n")
+	upload, err := ProcessAttachment(bytes.NewReader(pdf), DefaultAttachmentLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Ext != ".pdf" || upload.ContentType != "application/pdf" || !bytes.Equal(upload.Data, pdf) {
+		t.Fatalf("got %s %s", upload.Ext, upload.ContentType)
+	}
+
+	photo := withExif(encodeJPEG(t, halves(40, 20)), 1)
+	upload, err = ProcessAttachment(bytes.NewReader(photo), DefaultAttachmentLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.ContentType != "image/jpeg" || bytes.Contains(upload.Data, []byte("GPS")) || len(upload.Variants) != len(Variants) {
+		t.Fatal("image attachment did not go through ProcessImage")
+	}
+
+	small := DefaultAttachmentLimits
+	small.MaxVideoBytes = 100
+	small.MaxDocumentBytes = 10
+	small.Image.MaxBytes = 100
+
+	for name, tc := range map[string]struct {
+		data   []byte
+		limits AttachmentLimits
+		want   error
+	}{
+		"empty":            {nil, DefaultAttachmentLimits, ErrUnsupportedFile},
+		"html":             {[]byte("<html><script>alert(1)</script></html>"), DefaultAttachmentLimits, ErrUnsupportedFile},
+		"zip":              {[]byte("PK\x03\x04" + strings.Repeat("\x00", 40)), DefaultAttachmentLimits, ErrUnsupportedFile},
+		"matroska":         {webm("matroska", 640, 360, time.Second), DefaultAttachmentLimits, ErrUnsupportedFile},
+		"no duration":      {webm("webm", 640, 360, 0), DefaultAttachmentLimits, ErrUnsupportedFile},
+		"no video track":   {mp4(0, 0, time.Second, false), DefaultAttachmentLimits, ErrUnsupportedFile},
+		"truncated mp4":    {mp4(640, 360, time.Second, false)[:60], DefaultAttachmentLimits, ErrUnsupportedFile},
+		"long mp4":         {mp4(640, 360, 61*time.Second, false), DefaultAttachmentLimits, ErrVideoTooLong},
+		"long webm":        {webm("webm", 640, 360, 2*time.Minute), DefaultAttachmentLimits, ErrVideoTooLong},
+		"large video":      {mp4(640, 360, time.Second, false), small, ErrFileTooLarge},
+		"large document":   {pdf, small, ErrFileTooLarge},
+		"large image":      {photo, small, ErrImageTooLarge},
+		"bad image":        {photo[:len(photo)/2], DefaultAttachmentLimits, ErrUnsupportedImage},
+		"unsupported type": {[]byte("BM" + strings.Repeat("\x00", 60)), DefaultAttachmentLimits, ErrUnsupportedFile},
+	} {
+		_, err := ProcessAttachment(bytes.NewReader(tc.data), tc.limits)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+
+	if got := small.MaxBytes(); got != 100 {
+		t.Errorf("MaxBytes = %d, want 100", got)
+	}
+}
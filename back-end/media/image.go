@@ -0,0 +1,500 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupportedImage is returned for uploads that are not a JPEG, PNG,
+	// GIF or WebP image.
+	ErrUnsupportedImage = errors.New("media: unsupported image format")
+	// ErrImageTooLarge is returned for uploads over the ImageLimits.
+	ErrImageTooLarge = errors.New("media: image is too large")
+)
+
+// ImageLimits bounds the uploads ProcessImage accepts. MaxPixels is checked
+// against the dimensions in the header, before anything is decoded.
+type ImageLimits struct {
+	MaxBytes  int64
+	MaxPixels int
+}
+
+// DefaultImageLimits allows photos straight from most phones and cameras.
+var DefaultImageLimits = ImageLimits{MaxBytes: 10 << 20, MaxPixels: 25_000_000}
+
+// Variant is a smaller copy of every uploaded image, no wider or taller than
+// Size pixels.
+type Variant struct {
+	Name string
+	Size int
+}
+
+// Variants lists the copies ProcessImage makes, from small to large.
+var Variants = []Variant{
+	{Name: "small", Size: 160},
+	{Name: "medium", Size: 640},
+	{Name: "large", Size: 1280},
+}
+
+// IsVariant reports whether name is one of the Variants.
+func IsVariant(name string) bool {
+	for _, v := range Variants {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// VariantName returns the file name of a variant of the image called name.
+// Variants of JPEG images are JPEGs; all others are PNGs, which keep
+// transparency. An animated GIF gets still variants of its first frame.
+func VariantName(name, variant string) string {
+	ext := path.Ext(name)
+	variantExt := ".png"
+	if ext == ".jpg" {
+		variantExt = ".jpg"
+	}
+	return strings.TrimSuffix(name, ext) + "-" + variant + variantExt
+}
+
+// imageFormats maps the formats accepted for upload, as named by
+// image.DecodeConfig, to their file extension and metadata stripper.
+var imageFormats = map[string]struct {
+	ext   string
+	strip func([]byte) ([]byte, error)
+}{
+	"jpeg": {".jpg", stripJPEG},
+	"png":  {".png", stripPNG},
+	"gif":  {".gif", stripGIF},
+	"webp": {".webp", stripWebP},
+}
+
+// Upload is a checked file ready to be stored. For images, Data is the
+// original without its metadata and Variants holds the encoded variants by
+// name; other files have no variants.
+type Upload struct {
+	Ext         string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+	Variants    map[string][]byte
+}
+
+// ProcessImage reads an upload, checks that it is a supported image within
+// limits and removes metadata such as EXIF and GPS tags from it. A JPEG
+// turned by its EXIF orientation is re-encoded the right way up, since the
+// orientation goes with the rest of the metadata.
+func ProcessImage(r io.Reader, limits ImageLimits) (*Upload, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	cfg, formatName, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	format, ok := imageFormats[formatName]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > limits.MaxPixels/cfg.Height {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	clean, err := format.strip(data)
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	if formatName == "jpeg" {
+		if o := jpegOrientation(data); o != 1 {
+			img = orient(img, o)
+			var buf bytes.Buffer
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+			if err != nil {
+				return nil, err
+			}
+			clean = buf.Bytes()
+		}
+	}
+
+	bounds := img.Bounds()
+	result := &Upload{
+		Ext:         format.ext,
+		ContentType: mime.TypeByExtension(format.ext),
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Data:        clean,
+		Variants:    make(map[string][]byte, len(Variants)),
+	}
+
+	// Each variant is scaled from the next larger one, which is much
+	// quicker than starting from the original every time.
+	src := img
+	for i := len(Variants) - 1; i >= 0; i-- {
+		v := Variants[i]
+		src = fit(src, v.Size)
+
+		name := VariantName("image"+format.ext, v.Name)
+		if src == img && path.Ext(name) == format.ext {
+			result.Variants[v.Name] = clean
+			continue
+		}
+
+		var buf bytes.Buffer
+		if path.Ext(name) == ".jpg" {
+			err = jpeg.Encode(&buf, src, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, src)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Variants[v.Name] = buf.Bytes()
+	}
+
+	return result, nil
+}
+
+// fit scales img down so that neither side is longer than size. Smaller
+// images are returned as they are.
+func fit(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	if w >= h {
+		w, h = size, h*size/w
+	} else {
+		w, h = w*size/h, size
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orient turns img the way EXIF orientation o says it should be shown.
+func orient(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):])
+		}
+	}
+	return dst
+}
+
+var errCorruptImage = errors.New("media: corrupt image")
+
+// stripJPEG drops the APP segments other than JFIF, ICC profiles and Adobe
+// color information, comments, and anything after the end of the image.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errCorruptImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	i := 2
+	for i+2 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, errCorruptImage
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before a marker.
+			i++
+			continue
+		case marker == 0xD9:
+			return append(out, 0xFF, 0xD9), nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, errCorruptImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end < i+4 || end > len(data) {
+			return nil, errCorruptImage
+		}
+		if keepJPEGSegment(marker, data[i+4:end]) {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+
+		if marker == 0xDA {
+			// Scan data runs until a marker other than a stuffed 0xFF00 or
+			// a restart marker.
+			start := i
+			for i+1 < len(data) && (data[i] != 0xFF || data[i+1] == 0 || (data[i+1] >= 0xD0 && data[i+1] <= 0xD7)) {
+				i++
+			}
+			if i+1 >= len(data) {
+				return append(out, data[start:]...), nil
+			}
+			out = append(out, data[start:i]...)
+		}
+	}
+	return out, nil
+}
+
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == 0xE0, marker == 0xEE:
+		return true
+	case marker == 0xE2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker >= 0xE1 && marker <= 0xEF, marker == 0xFE:
+		return false
+	}
+	return true
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, or 1 when it has
+// none.
+func jpegOrientation(data []byte) int {
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF && data[i+1] != 0xDA {
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end < i+4 || end > len(data) {
+			break
+		}
+		if data[i+1] == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			return exifOrientation(data[i+10 : end])
+		}
+		i = end
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF
+// structure, the body of an EXIF segment.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int64(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > int64(len(tiff)) {
+		return 1
+	}
+	entries := tiff[ifd+2:]
+	for n := int(order.Uint16(tiff[ifd:])); n > 0 && len(entries) >= 12; n-- {
+		// A SHORT value is stored in the first bytes of the value field.
+		if order.Uint16(entries) == 0x0112 && order.Uint16(entries[2:]) == 3 {
+			o := int(order.Uint16(entries[8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+		entries = entries[12:]
+	}
+	return 1
+}
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// stripPNG drops text, EXIF and timestamp chunks.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, errCorruptImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	for i := len(pngSignature); i+12 <= len(data); {
+		end := int64(i) + 12 + int64(binary.BigEndian.Uint32(data[i:]))
+		if end > int64(len(data)) {
+			return nil, errCorruptImage
+		}
+		chunk := data[i:end]
+		switch string(chunk[4:8]) {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+		default:
+			out = append(out, chunk...)
+		}
+		if string(chunk[4:8]) == "IEND" {
+			return out, nil
+		}
+		i = int(end)
+	}
+	return nil, errCorruptImage
+}
+
+// stripGIF drops comments and application extensions other than the
+// animation loop count, and anything after the trailer.
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 {
+		return nil, errCorruptImage
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&7 + 1)
+	}
+	if i > len(data) {
+		return nil, errCorruptImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+	for i < len(data) {
+		start := i
+		keep := true
+		switch data[i] {
+		case 0x3B:
+			return append(out, 0x3B), nil
+		case 0x2C:
+			if i+11 > len(data) {
+				return nil, errCorruptImage
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&7 + 1)
+			}
+			// The LZW minimum code size comes before the data.
+			i++
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, errCorruptImage
+			}
+			switch data[i+1] {
+			case 0xF9, 0x01:
+			case 0xFF:
+				keep = i+14 <= len(data) && (string(data[i+2:i+14]) == "\x0bNETSCAPE2.0" || string(data[i+2:i+14]) == "\x0bANIMEXTS1.0")
+			default:
+				keep = false
+			}
+			i += 2
+		default:
+			return nil, errCorruptImage
+		}
+
+		// Both images and extensions end in a series of sub-blocks.
+		for {
+			if i >= len(data) {
+				return nil, errCorruptImage
+			}
+			n := int(data[i])
+			i += 1 + n
+			if n == 0 {
+				break
+			}
+		}
+		if i > len(data) {
+			return nil, errCorruptImage
+		}
+		if keep {
+			out = append(out, data[start:i]...)
+		}
+	}
+	return append(out, 0x3B), nil
+}
+
+// stripWebP drops the EXIF and XMP chunks and clears their flags.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errCorruptImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	for i := 12; i+8 <= len(data); {
+		size := int64(binary.LittleEndian.Uint32(data[i+4:]))
+		end := int64(i) + 8 + size + size&1
+		if end > int64(len(data)) {
+			return nil, errCorruptImage
+		}
+		chunk := data[i:end]
+		switch string(chunk[:4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			start := len(out)
+			out = append(out, chunk...)
+			if size > 0 {
+				out[start+8] &^= 0x08 | 0x04
+			}
+		default:
+			out = append(out, chunk...)
+		}
+		i = int(end)
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
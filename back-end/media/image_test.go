@@ -0,0 +1,247 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// halves returns a w by h image, red on the left and blue on the right.
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withExif adds an EXIF segment with the given orientation and a GPS
+// marker string right after the start of a JPEG.
+func withExif(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry, 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), "\x00\x00\x00\x00GPS 59.43N 24.75E"...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xC000 && b < 0x4000
+}
+
+func TestProcessImageJPEG(t *testing.T) {
+	data := withExif(encodeJPEG(t, halves(40, 20)), 6)
+	data = append(data, "trailing data"...)
+
+	img, err := ProcessImage(bytes.NewReader(data), DefaultImageLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Ext != ".jpg" || img.ContentType != "image/jpeg" {
+		t.Errorf("got %s %s, want .jpg image/jpeg", img.Ext, img.ContentType)
+	}
+	if bytes.Contains(img.Data, []byte("GPS")) || bytes.Contains(img.Data, []byte("Exif")) || bytes.Contains(img.Data, []byte("trailing")) {
+		t.Fatal("metadata left in the image")
+	}
+
+	// Orientation 6 turns the image a quarter clockwise: the red left half
+	// ends up on top.
+	decoded, err := jpeg.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := decoded.Bounds(); b.Dx() != 20 || b.Dy() != 40 || img.Width != 20 || img.Height != 40 {
+		t.Fatalf("image is %v, want 20x40", b)
+	}
+	if !isRed(decoded.At(10, 5)) || isRed(decoded.At(10, 35)) {
+		t.Fatal("image was not turned the right way")
+	}
+}
+
+func TestProcessImageKeepsUprightJPEG(t *testing.T) {
+	plain := encodeJPEG(t, halves(40, 20))
+
+	img, err := ProcessImage(bytes.NewReader(withExif(plain, 1)), DefaultImageLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Data, plain) {
+		t.Fatal("an upright JPEG was changed beyond removing its metadata")
+	}
+	for _, v := range Variants {
+		if !bytes.Equal(img.Variants[v.Name], plain) {
+			t.Errorf("%s variant of a small JPEG is not the image itself", v.Name)
+		}
+	}
+}
+
+func TestProcessImageVariants(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, halves(2000, 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := ProcessImage(&buf, DefaultImageLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Ext != ".png" || img.Width != 2000 || img.Height != 1000 {
+		t.Fatalf("got %s %dx%d", img.Ext, img.Width, img.Height)
+	}
+	for _, v := range Variants {
+		decoded, err := png.Decode(bytes.NewReader(img.Variants[v.Name]))
+		if err != nil {
+			t.Fatalf("%s variant: %v", v.Name, err)
+		}
+		if b := decoded.Bounds(); b.Dx() != v.Size || b.Dy() != v.Size/2 {
+			t.Errorf("%s variant is %v, want %dx%d", v.Name, b, v.Size, v.Size/2)
+		}
+		if !isRed(decoded.At(v.Size/8, v.Size/4)) || isRed(decoded.At(v.Size*7/8, v.Size/4)) {
+			t.Errorf("%s variant does not look like the original", v.Name)
+		}
+	}
+
+	if got := VariantName("3f9c.jpg", "small"); got != "3f9c-small.jpg" {
+		t.Errorf("VariantName of a JPEG = %q", got)
+	}
+	if got := VariantName("3f9c.webp", "large"); got != "3f9c-large.png" {
+		t.Errorf("VariantName of a WebP = %q", got)
+	}
+}
+
+func TestProcessImageStripsPNGAndGIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, halves(4, 4)); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	text := []byte("\x00\x00\x00\x0atEXtGPS\x0059.43N\x00\x00\x00\x00")
+	binary.BigEndian.PutUint32(text[18:], crc32.ChecksumIEEE(text[4:18]))
+	data := append(append(append([]byte{}, plain[:33]...), text...), plain[33:]...)
+
+	img, err := ProcessImage(bytes.NewReader(data), DefaultImageLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Data, plain) {
+		t.Fatal("text chunk left in the PNG")
+	}
+
+	anim := &gif.GIF{LoopCount: 0}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.Black, color.White})
+		frame.SetColorIndex(i, i, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	buf.Reset()
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	plain = buf.Bytes()
+	// A comment extension before the trailer.
+	data = append(append([]byte{}, plain[:len(plain)-1]...), "\x21\xfe\x0aGPS 59.43N\x00\x3b"...)
+
+	img, err = ProcessImage(bytes.NewReader(data), DefaultImageLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Data, plain) {
+		t.Fatal("comment left in the GIF")
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Image) != 3 {
+		t.Fatalf("GIF has %d frames, want 3", len(decoded.Image))
+	}
+}
+
+func TestProcessImageWebP(t *testing.T) {
+	// A 1x1 lossless image inside an extended container with EXIF.
+	vp8l := "VP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00"
+	vp8x := "VP8X\x0a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	exif := "EXIF\x0b\x00\x00\x00GPS 59.43N\x00\x00"
+	body := "WEBP" + vp8x + vp8l + exif
+	data := []byte("RIFF\x00\x00\x00\x00" + body)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(body)))
+
+	img, err := ProcessImage(bytes.NewReader(data), DefaultImageLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Ext != ".webp" || img.Width != 1 || img.Height != 1 {
+		t.Fatalf("got %s %dx%d", img.Ext, img.Width, img.Height)
+	}
+	if bytes.Contains(img.Data, []byte("GPS")) || img.Data[20]&0x08 != 0 {
+		t.Fatal("EXIF left in the WebP")
+	}
+	if int(binary.LittleEndian.Uint32(img.Data[4:])) != len(img.Data)-8 {
+		t.Fatal("RIFF size not updated")
+	}
+	if _, _, err := image.Decode(bytes.NewReader(img.Data)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(img.Variants["small"])); err != nil {
+		t.Fatalf("small variant: %v", err)
+	}
+}
+
+func TestProcessImageRejects(t *testing.T) {
+	big := encodeJPEG(t, halves(300, 200))
+
+	for name, tc := range map[string]struct {
+		data   []byte
+		limits ImageLimits
+		want   error
+	}{
+		"text":            {[]byte("not an image"), DefaultImageLimits, ErrUnsupportedImage},
+		"html":            {[]byte("<html><script>alert(1)</script></html>"), DefaultImageLimits, ErrUnsupportedImage},
+		"bmp":             {[]byte("BM" + strings.Repeat("\x00", 60)), DefaultImageLimits, ErrUnsupportedImage},
+		"truncated":       {big[:len(big)/2], DefaultImageLimits, ErrUnsupportedImage},
+		"too many bytes":  {big, ImageLimits{MaxBytes: 100, MaxPixels: 1 << 20}, ErrImageTooLarge},
+		"too many pixels": {big, ImageLimits{MaxBytes: 1 << 20, MaxPixels: 300*200 - 1}, ErrImageTooLarge},
+	} {
+		_, err := ProcessImage(bytes.NewReader(tc.data), tc.limits)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Local keeps files in a folder on disk.
+type Local struct {
+	Dir string
+}
+
+// NewLocal returns a store writing to dir, creating it if needed.
+func NewLocal(dir string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir}, nil
+}
+
+// Put writes to a temporary file first, so a failed upload never leaves a
+// truncated file behind under name.
+func (l *Local) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	err := checkName(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(l.Dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(f.Name(), 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(l.Dir, name))
+}
+
+func (l *Local) Open(ctx context.Context, name string) (*Object, error) {
+	if !ValidName(name) {
+		return nil, ErrNotFound
+	}
+
+	f, err := os.Open(filepath.Join(l.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, ErrNotFound
+	}
+
+	return &Object{
+		ReadSeekCloser: f,
+		Size:           info.Size(),
+		ModTime:        info.ModTime(),
+		ContentType:    mime.TypeByExtension(filepath.Ext(name)),
+	}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, name string) error {
+	err := checkName(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(l.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// List skips folders and the temporary files of uploads in progress.
+func (l *Local) List(ctx context.Context, fn func(name string, size int64, modTime time.Time) error) error {
+	entries, err := os.ReadDir(l.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !ValidName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(entry.Name(), info.Size(), info.ModTime())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Package media stores uploaded files such as avatars and post images. The
+// server writes and serves them through a Store, which keeps them either in a
+// local folder or in an S3-compatible bucket shared by every instance.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no file has the given name.
+var ErrNotFound = errors.New("media: file not found")
+
+// Store keeps files under flat names such as "3f9c0e.jpg".
+type Store interface {
+	// Put stores size bytes read from r under name, replacing any file
+	// with that name. A size of -1 means unknown.
+	Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error
+	// Open returns the file called name for reading.
+	Open(ctx context.Context, name string) (*Object, error)
+	Delete(ctx context.Context, name string) error
+	// List calls fn with every stored file, in no particular order, and
+	// stops at the first error fn returns.
+	List(ctx context.Context, fn func(name string, size int64, modTime time.Time) error) error
+}
+
+// Signer is implemented by stores that can hand out temporary URLs, so that
+// clients download files from the store directly.
+type Signer interface {
+	SignedURL(ctx context.Context, name string, expiry time.Duration) (string, error)
+}
+
+// Object is an open file. It must be closed after use.
+type Object struct {
+	io.ReadSeekCloser
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// ValidName reports whether name can be used as a file name in every store:
+// a single path element without a leading dot.
+func ValidName(name string) bool {
+	return name != "" && len(name) <= 255 && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, "/\\\x00")
+}
+
+func checkName(name string) error {
+	if !ValidName(name) {
+		return fmt.Errorf("media: invalid file name %q", name)
+	}
+	return nil
+}
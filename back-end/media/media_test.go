@@ -0,0 +1,147 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStore checks the behaviour every Store shares.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	name := "test-" + time.Now().Format("150405.000000000") + ".jpg"
+	t.Cleanup(func() { s.Delete(ctx, name) })
+
+	if _, err := s.Open(ctx, name); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open of a missing file = %v, want ErrNotFound", err)
+	}
+
+	content := "first version"
+	if err := s.Put(ctx, name, strings.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	content = "second version"
+	if err := s.Put(ctx, name, strings.NewReader(content), -1, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	var listed int64 = -1
+	err := s.List(ctx, func(n string, size int64, modTime time.Time) error {
+		if n == name {
+			listed = size
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed != int64(len(content)) {
+		t.Errorf("List gave size %d for %s, want %d", listed, name, len(content))
+	}
+
+	obj, err := s.Open(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Size != int64(len(content)) || obj.ContentType != "image/jpeg" {
+		t.Errorf("object size %d type %q, want %d image/jpeg", obj.Size, obj.ContentType, len(content))
+	}
+	if _, err := obj.Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "version" {
+		t.Fatalf("read %q after seeking, want %q", data, "version")
+	}
+
+	for _, bad := range []string{"", "../secret", "a/b.jpg", ".hidden"} {
+		if err := s.Put(ctx, bad, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put accepted the name %q", bad)
+		}
+		if _, err := s.Open(ctx, bad); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q) = %v, want ErrNotFound", bad, err)
+		}
+	}
+
+	if err := s.Delete(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(ctx, name); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open after Delete = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, name); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	s, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("left %d files behind", len(entries))
+	}
+}
+
+// TestS3 runs against the bucket named by MINIO_TEST_BUCKET on the server at
+// MINIO_TEST_ENDPOINT, for example a local MinIO started with
+//
+//	minio server /tmp/minio-data
+//	mc mb local/social-network-test
+//
+// It is skipped when MINIO_TEST_ENDPOINT is unset.
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("MINIO_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_TEST_ENDPOINT is not set")
+	}
+
+	s, err := NewS3(context.Background(), S3Config{
+		Endpoint:  endpoint,
+		Bucket:    os.Getenv("MINIO_TEST_BUCKET"),
+		AccessKey: os.Getenv("MINIO_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("MINIO_TEST_SECRET_KEY"),
+		UseSSL:    os.Getenv("MINIO_TEST_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	ctx := context.Background()
+	name := "signed-" + time.Now().Format("150405.000000000") + ".txt"
+	if err := s.Put(ctx, name, strings.NewReader("signed"), 6, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Delete(ctx, name)
+
+	url, err := s.SignedURL(ctx, name, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(data) != "signed" {
+		t.Fatalf("signed URL returned %d %q", res.StatusCode, data)
+	}
+}
@@ -0,0 +1,140 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config points at a bucket in S3 or any compatible service, such as
+// MinIO. Endpoint is a host and optional port, without a scheme.
+type S3Config struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3 keeps files as objects in a bucket.
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 connects to the bucket, which must already exist.
+func NewS3(ctx context.Context, cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("media: an S3 endpoint and bucket are required")
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("media: checking bucket %s: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("media: bucket %s does not exist", cfg.Bucket)
+	}
+
+	return &S3{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	err := checkName(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, name, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *S3) Open(ctx context.Context, name string) (*Object, error) {
+	if !ValidName(name) {
+		return nil, ErrNotFound
+	}
+
+	// GetObject does not contact the server; Stat does, and reports a
+	// missing key.
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, s3Error(err)
+	}
+
+	return &Object{
+		ReadSeekCloser: obj,
+		Size:           info.Size,
+		ModTime:        info.LastModified,
+		ContentType:    info.ContentType,
+	}, nil
+}
+
+// Delete reports ErrNotFound for a missing object, which S3 itself treats
+// as a successful delete.
+func (s *S3) Delete(ctx context.Context, name string) error {
+	err := checkName(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		return s3Error(err)
+	}
+	return s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) List(ctx context.Context, fn func(name string, size int64, modTime time.Time) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		err := fn(obj.Key, obj.Size, obj.LastModified)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3) SignedURL(ctx context.Context, name string, expiry time.Duration) (string, error) {
+	err := checkName(name)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, name, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func s3Error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,296 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// videoInfo is what the probes read from the headers of a video container.
+type videoInfo struct {
+	width, height int
+	duration      time.Duration
+}
+
+// probeMP4 reads the playing time from the movie header (mvhd) and the size
+// of the first visual track from its track header (tkhd). Tracks rotated a
+// quarter turn, as phones record portrait video, report the size they are
+// shown at.
+func probeMP4(data []byte) (videoInfo, bool) {
+	var info videoInfo
+
+	moov, ok := findBox(data, "moov")
+	if !ok {
+		return info, false
+	}
+	mvhd, ok := findBox(moov, "mvhd")
+	if !ok || len(mvhd) < 1 {
+		return info, false
+	}
+	var timescale, duration uint64
+	switch {
+	case mvhd[0] == 0 && len(mvhd) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:]))
+	case mvhd[0] == 1 && len(mvhd) >= 32:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:]))
+		duration = binary.BigEndian.Uint64(mvhd[24:])
+	default:
+		return info, false
+	}
+	if timescale == 0 {
+		return info, false
+	}
+	info.duration = seconds(float64(duration) / float64(timescale))
+
+	eachBox(moov, func(typ string, trak []byte) bool {
+		if typ != "trak" {
+			return true
+		}
+		tkhd, ok := findBox(trak, "tkhd")
+		if !ok || len(tkhd) < 1 {
+			return true
+		}
+		// The matrix and size follow fields that are twice as wide in
+		// version 1.
+		offset := 40
+		if tkhd[0] == 1 {
+			offset = 52
+		}
+		if len(tkhd) < offset+44 {
+			return true
+		}
+		a := int32(binary.BigEndian.Uint32(tkhd[offset:]))
+		b := int32(binary.BigEndian.Uint32(tkhd[offset+4:]))
+		w := int(binary.BigEndian.Uint32(tkhd[offset+36:]) >> 16)
+		h := int(binary.BigEndian.Uint32(tkhd[offset+40:]) >> 16)
+		if w == 0 || h == 0 {
+			return true
+		}
+		if a == 0 && b != 0 {
+			w, h = h, w
+		}
+		info.width, info.height = w, h
+		return false
+	})
+
+	return info, true
+}
+
+// eachBox calls fn with the type and contents of each MP4 box in data, in
+// order, until fn returns false. It reports false if a box runs past the end
+// of data.
+func eachBox(data []byte, fn func(typ string, body []byte) bool) bool {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return false
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return false
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return false
+		}
+		if !fn(string(data[4:8]), data[header:size]) {
+			return true
+		}
+		data = data[size:]
+	}
+	return true
+}
+
+func findBox(data []byte, typ string) ([]byte, bool) {
+	var found []byte
+	ok := false
+	eachBox(data, func(t string, body []byte) bool {
+		if t == typ {
+			found, ok = body, true
+		}
+		return !ok
+	})
+	return found, ok
+}
+
+// EBML element IDs read by probeWebM.
+const (
+	ebmlHeader         = 0x1A45DFA3
+	ebmlDocType        = 0x4282
+	webmSegment        = 0x18538067
+	webmInfo           = 0x1549A966
+	webmTimestampScale = 0x2AD7B1
+	webmDuration       = 0x4489
+	webmTracks         = 0x1654AE6B
+	webmTrackEntry     = 0xAE
+	webmVideo          = 0xE0
+	webmPixelWidth     = 0xB0
+	webmPixelHeight    = 0xBA
+	webmCluster        = 0x1F43B675
+)
+
+// probeWebM reads the playing time from the segment info and the size of
+// the first video track. Both come before the first cluster, where reading
+// stops. Recordings that do not declare their duration are not accepted,
+// since finding it would mean reading every cluster.
+func probeWebM(data []byte) (videoInfo, bool) {
+	var info videoInfo
+	docType := ""
+	scale := uint64(time.Millisecond)
+	var duration float64
+
+	eachElement(data, func(id uint32, body []byte) bool {
+		switch id {
+		case ebmlHeader:
+			eachElement(body, func(id uint32, body []byte) bool {
+				if id == ebmlDocType {
+					docType = string(body)
+				}
+				return true
+			})
+		case webmSegment:
+			eachElement(body, func(id uint32, body []byte) bool {
+				switch id {
+				case webmInfo:
+					eachElement(body, func(id uint32, body []byte) bool {
+						switch id {
+						case webmTimestampScale:
+							scale = ebmlUint(body)
+						case webmDuration:
+							duration = ebmlFloat(body)
+						}
+						return true
+					})
+				case webmTracks:
+					eachElement(body, func(id uint32, entry []byte) bool {
+						if id == webmTrackEntry && info.width == 0 {
+							if video, ok := findElement(entry, webmVideo); ok {
+								w, _ := findElement(video, webmPixelWidth)
+								h, _ := findElement(video, webmPixelHeight)
+								info.width, info.height = int(ebmlUint(w)), int(ebmlUint(h))
+							}
+						}
+						return true
+					})
+				case webmCluster:
+					return false
+				}
+				return true
+			})
+		}
+		return id != webmSegment
+	})
+
+	if docType != "webm" || !(duration > 0) || math.IsInf(duration, 0) || scale == 0 {
+		return info, false
+	}
+	info.duration = seconds(duration * float64(scale) / float64(time.Second))
+	return info, true
+}
+
+// eachElement calls fn with the ID and contents of each EBML element in
+// data, in order, until fn returns false. Elements of unknown size, as live
+// encoders write them, run to the end of data.
+func eachElement(data []byte, fn func(id uint32, body []byte) bool) bool {
+	for len(data) > 0 {
+		id, n := vint(data, true)
+		if n == 0 || n > 4 {
+			return false
+		}
+		data = data[n:]
+		size, n := vint(data, false)
+		if n == 0 {
+			return false
+		}
+		data = data[n:]
+		if size < 0 {
+			size = int64(len(data))
+		}
+		if size > int64(len(data)) {
+			return false
+		}
+		if !fn(uint32(id), data[:size]) {
+			return true
+		}
+		data = data[size:]
+	}
+	return true
+}
+
+func findElement(data []byte, id uint32) ([]byte, bool) {
+	var found []byte
+	ok := false
+	eachElement(data, func(i uint32, body []byte) bool {
+		if i == id {
+			found, ok = body, true
+		}
+		return !ok
+	})
+	return found, ok
+}
+
+// vint reads an EBML variable length integer and returns it with the number
+// of bytes it took, or 0 if it is malformed. IDs keep their length marker
+// and sizes do not; a size with every bit set is unknown and returned as -1.
+func vint(data []byte, id bool) (int64, int) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0
+	}
+	n := bits.LeadingZeros8(data[0]) + 1
+	if len(data) < n {
+		return 0, 0
+	}
+
+	mask := byte(0xFF) >> n
+	v := uint64(data[0] & mask)
+	if id {
+		v = uint64(data[0])
+	}
+	unknown := data[0]&mask == mask
+	for _, b := range data[1:n] {
+		v = v<<8 | uint64(b)
+		unknown = unknown && b == 0xFF
+	}
+	if !id && unknown {
+		return -1, n
+	}
+	return int64(v), n
+}
+
+func ebmlUint(data []byte) uint64 {
+	if len(data) > 8 {
+		return 0
+	}
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func ebmlFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
+
+// seconds converts a playing time, saturating rather than overflowing for
+// absurd values.
+func seconds(s float64) time.Duration {
+	if s >= math.MaxInt64/float64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(s * float64(time.Second))
+}
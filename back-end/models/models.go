@@ -1,17 +1,22 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"social-network/validator"
+)
 
 type UserData struct {
 	UserID      int    `json:"user_id"`
-	Email       string `json:"email"`
-	Password    string `json:"password"`
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	DateOfBirth string `json:"date_of_birth"`
+	Email       string `json:"email" validate:"required,email,max=30"`
+	Password    string `json:"password" validate:"required,min=5,max=20"`
+	FirstName   string `json:"first_name" validate:"required,max=20"`
+	LastName    string `json:"last_name" validate:"required,max=20"`
+	DateOfBirth string `json:"date_of_birth" validate:"required,date,minage=13"`
 	Avatar      string `json:"avatar"`
-	Nickname    string `json:"nickname"`
-	AboutMe     string `json:"about_me"`
+	Nickname    string `json:"nickname" validate:"max=10"`
+	AboutMe     string `json:"about_me" validate:"max=100"`
 	Public      bool   `json:"public"`
 	CurrentUser bool   `json:"currentUser"`
 	Online      bool   `json:"online"`
@@ -24,28 +29,140 @@ type FollowRequest struct {
 }
 
 type Post struct {
-	PostID         int       `json:"post_id"`
-	UserID         int       `json:"user_id"`
-	Content        string    `json:"content"`
-	FirstName      string    `json:"first_name"`
-	LastName       string    `json:"last_name"`
-	Privacy        string    `json:"privacy"`
-	SelectedUserID string    `json:"selected_user_id"`
-	Image          string    `json:"image"`
-	Date           time.Time `json:"date"`
-	GroupID        int       `json:"group_id"`
-	Comments       []Comment `json:"comments"`
+	PostID         int               `json:"post_id"`
+	UserID         int               `json:"user_id"`
+	Content        string            `json:"content" validate:"required,max=100"`
+	FirstName      string            `json:"first_name"`
+	LastName       string            `json:"last_name"`
+	Privacy        string            `json:"privacy" validate:"required,oneof=public private for-selected-users"`
+	SelectedUserID string            `json:"selected_user_id" validate:"ids"`
+	Image          string            `json:"image"`
+	ImageURL       string            `json:"image_url,omitempty"`
+	ImageVariants  map[string]string `json:"image_variants,omitempty"`
+	Attachments    []Attachment      `json:"attachments"`
+	Date           time.Time         `json:"date"`
+	EditedAt       *time.Time        `json:"edited_at"`
+	GroupID        int               `json:"group_id"`
+	Comments       []Comment         `json:"comments"`
+	Reactions      Reactions         `json:"reactions"`
+	Mentions       []Mention         `json:"mentions"`
+	Hashtags       []Hashtag         `json:"hashtags"`
+	FollowedTags   []string          `json:"followed_tags,omitempty"`
+}
+
+// Validate requires an audience for posts shared with selected users only.
+func (p *Post) Validate(errs validator.Errors) {
+	if p.Privacy == "for-selected-users" && p.SelectedUserID == "" {
+		errs.Add("selected_user_id", "is required when privacy is for-selected-users")
+	}
+	ValidateAttachments(errs, p.Attachments)
+}
+
+// PostRevision is a post as it was before one of its edits. Date is when
+// that version was written.
+type PostRevision struct {
+	RevisionID     int          `json:"revision_id"`
+	PostID         int          `json:"post_id"`
+	Content        string       `json:"content"`
+	Privacy        string       `json:"privacy"`
+	SelectedUserID string       `json:"selected_user_id"`
+	Attachments    []Attachment `json:"attachments"`
+	Date           time.Time    `json:"date"`
 }
 
 type Comment struct {
-	CommentID int       `json:"comment_id"`
-	PostID    int       `json:"post_id"`
-	UserID    int       `json:"user_id"`
-	Comment   string    `json:"comment"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Image     string    `json:"image"`
-	Date      time.Time `json:"date"`
+	CommentID     int               `json:"comment_id"`
+	PostID        int               `json:"post_id" validate:"required,min=1"`
+	UserID        int               `json:"user_id"`
+	Comment       string            `json:"comment" validate:"required,max=100"`
+	FirstName     string            `json:"first_name"`
+	LastName      string            `json:"last_name"`
+	Image         string            `json:"image"`
+	ImageURL      string            `json:"image_url,omitempty"`
+	ImageVariants map[string]string `json:"image_variants,omitempty"`
+	Attachments   []Attachment      `json:"attachments"`
+	Date          time.Time         `json:"date"`
+	EditedAt      *time.Time        `json:"edited_at"`
+	ParentID      int               `json:"parent_id" validate:"min=0"`
+	Depth         int               `json:"depth"`
+	Deleted       bool              `json:"deleted"`
+	ReplyCount    int               `json:"reply_count"`
+	Replies       []Comment         `json:"replies,omitempty"`
+	Reactions     Reactions         `json:"reactions"`
+	Mentions      []Mention         `json:"mentions"`
+	Hashtags      []Hashtag         `json:"hashtags"`
+}
+
+// Validate checks the attachments like those of posts.
+func (c *Comment) Validate(errs validator.Errors) {
+	ValidateAttachments(errs, c.Attachments)
+}
+
+// MaxAttachments is how many files a post, comment or message can carry.
+const MaxAttachments = 10
+
+// Attachment is a file attached to a post, comment or chat message, in the
+// order they were uploaded. Name is the stored file; URL and Variants are
+// signed links to it filled in for clients, the variants only for images.
+type Attachment struct {
+	AttachmentID int               `json:"attachment_id"`
+	Name         string            `json:"name"`
+	MimeType     string            `json:"mime_type"`
+	AltText      string            `json:"alt_text" validate:"max=200"`
+	Width        int               `json:"width,omitempty"`
+	Height       int               `json:"height,omitempty"`
+	Size         int64             `json:"size"`
+	URL          string            `json:"url,omitempty"`
+	Variants     map[string]string `json:"variants,omitempty"`
+}
+
+// ValidateAttachments limits the number of attachments and the length of
+// their alt text.
+func ValidateAttachments(errs validator.Errors, attachments []Attachment) {
+	if len(attachments) > MaxAttachments {
+		errs.Add("attachments", fmt.Sprintf("must not be more than %d files", MaxAttachments))
+	}
+	for i := range attachments {
+		for field, msg := range validator.Struct(&attachments[i]) {
+			errs.Add(field, msg)
+		}
+	}
+}
+
+// MediaFile records an uploaded file, variants included in its Size. Hash is
+// the SHA-256 of its contents, so that the same upload is stored once; files
+// from before uploads were hashed have none.
+type MediaFile struct {
+	Name string
+	Hash string
+	Size int64
+}
+
+// MediaUsage is how much storage the files a user refers to take up, each
+// file counted once. Quota is the user's own quota, nil if the default
+// applies; Limit is the quota in force, 0 for none.
+type MediaUsage struct {
+	UserID    int    `json:"user_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+	Quota     *int64 `json:"quota"`
+	Limit     int64  `json:"limit"`
+}
+
+// MediaQuota sets a user's quota in bytes. A nil Quota restores the default
+// and 0 lifts the limit.
+type MediaQuota struct {
+	UserID int    `json:"user_id" validate:"required,min=1"`
+	Quota  *int64 `json:"quota"`
+}
+
+func (q *MediaQuota) Validate(errs validator.Errors) {
+	if q.Quota != nil && *q.Quota < 0 {
+		errs.Add("quota", "must not be negative")
+	}
 }
 
 type Session struct {
@@ -59,20 +176,43 @@ type Session struct {
 type Message struct {
 	MessageID     int
 	Type          string    `json:"type"`
-	Message       string    `json:"message"`
+	Message       string    `json:"message" validate:"required,max=1000"`
+	UserIDFrom    int       `json:"user_id_from"`
+	UserIDTo      int       `json:"user_id_to,omitempty"`
+	GroupID       int       `json:"group_id,omitempty"`
 	FirstNameFrom string    `json:"first_name_from"`
 	FirstNameTo   string    `json:"first_name_to"`
 	Date          time.Time `json:"date"`
+	// AttachmentIDs names files uploaded beforehand to send with the
+	// message; Attachments is what the message carries once stored.
+	AttachmentIDs []int        `json:"attachment_ids,omitempty"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+	Reactions     *Reactions   `json:"reactions,omitempty"`
+	Mentions      []Mention    `json:"mentions,omitempty"`
+}
+
+// Validate requires a recipient. Older clients name it by first name or group
+// title instead of by ID.
+func (m *Message) Validate(errs validator.Errors) {
+	if m.UserIDTo == 0 && m.GroupID == 0 && m.FirstNameTo == "" {
+		errs.Add("user_id_to", "is required")
+	}
+	if m.UserIDTo != 0 && m.GroupID != 0 {
+		errs.Add("group_id", "cannot be set together with user_id_to")
+	}
+	if len(m.AttachmentIDs) > MaxAttachments {
+		errs.Add("attachment_ids", fmt.Sprintf("must not be more than %d files", MaxAttachments))
+	}
 }
 
 type Group struct {
 	GroupID        int    `json:"group_id"`
-	Title          string `json:"title"`
-	Description    string `json:"description"`
+	Title          string `json:"title" validate:"required,max=10"`
+	Description    string `json:"description" validate:"required,max=100"`
 	UserID         int    `json:"user_id"`
 	FirstName      string `json:"first_name"`
 	LastName       string `json:"last_name"`
-	SelectedUserID string `json:"selected_user_id"`
+	SelectedUserID string `json:"selected_user_id" validate:"ids"`
 }
 
 type GroupMembers struct {
@@ -86,13 +226,13 @@ type GroupMembers struct {
 
 type Event struct {
 	EventID     int    `json:"event_id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	Title       string `json:"title" validate:"required,max=10"`
+	Description string `json:"description" validate:"required,max=100"`
 	UserID      int    `json:"user_id"`
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
-	Time        string `json:"time"`
-	GroupID     int    `json:"group_id"`
+	Time        string `json:"time" validate:"required,future"`
+	GroupID     int    `json:"group_id" validate:"required,min=1"`
 }
 
 type EventParticipants struct {
@@ -108,3 +248,148 @@ type EventNotifications struct {
 	MemberID int `json:"member_id"`
 	GroupID  int `json:"group_id"`
 }
+
+// Target names a post, comment or chat message, such as the one a reaction
+// is to or a mention is in. Exactly one of the IDs is set.
+type Target struct {
+	PostID    int `json:"post_id,omitempty"`
+	CommentID int `json:"comment_id,omitempty"`
+	MessageID int `json:"message_id,omitempty"`
+}
+
+// Validate requires exactly one target.
+func (t *Target) Validate(errs validator.Errors) {
+	set := 0
+	for _, id := range []int{t.PostID, t.CommentID, t.MessageID} {
+		if id != 0 {
+			set++
+		}
+	}
+	if set != 1 {
+		errs.Add("post_id", "exactly one of post_id, comment_id and message_id is required")
+	}
+}
+
+// Reaction is a user's reaction to a target. Posted to /react, an empty
+// Emoji takes the user's reaction back.
+type Reaction struct {
+	Target
+	ReactionID int       `json:"reaction_id"`
+	UserID     int       `json:"user_id"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+	Emoji      string    `json:"emoji"`
+	Date       time.Time `json:"date"`
+}
+
+// Reactions counts the reactions to a post, comment or message by emoji.
+// Mine is the viewer's own, if they reacted.
+type Reactions struct {
+	Counts map[string]int `json:"counts"`
+	Mine   string         `json:"mine,omitempty"`
+}
+
+// ReactionUpdate is pushed over the chat websocket when the reactions to a
+// target change.
+type ReactionUpdate struct {
+	Type string `json:"type"`
+	Target
+	Counts map[string]int `json:"counts"`
+}
+
+// Mention is a user mentioned in a post, comment or message. Offset and
+// Length locate the mention in its text in UTF-16 code units, as JavaScript
+// counts them. In the list of a user's mentions, the author is the user who
+// mentioned them.
+type Mention struct {
+	Target
+	MentionID       int       `json:"mention_id"`
+	UserID          int       `json:"user_id"`
+	FirstName       string    `json:"first_name"`
+	LastName        string    `json:"last_name"`
+	Nickname        string    `json:"nickname"`
+	Offset          int       `json:"offset"`
+	Length          int       `json:"length"`
+	AuthorID        int       `json:"author_id,omitempty"`
+	AuthorFirstName string    `json:"author_first_name,omitempty"`
+	AuthorLastName  string    `json:"author_last_name,omitempty"`
+	Seen            bool      `json:"seen"`
+	Date            time.Time `json:"date"`
+}
+
+// Hashtag is a #tag in a post or comment. Tag is in lower case, without the
+// #; Offset and Length locate it in the text like those of a Mention.
+type Hashtag struct {
+	Tag    string `json:"tag"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
+// TrendingTag is a tag with how many posts and comments used it lately and
+// how many people wrote them.
+type TrendingTag struct {
+	Tag   string `json:"tag"`
+	Uses  int    `json:"uses"`
+	Users int    `json:"users"`
+}
+
+// HashtagFollow is whether a user follows a tag.
+type HashtagFollow struct {
+	Tag       string `json:"tag"`
+	Following bool   `json:"following"`
+}
+
+// SearchQuery is a full-text search. Every term must match the start of a
+// word. Types limits the search to some of the SearchResult types; the other
+// fields, when set, keep only what the author wrote, what is in the group, or
+// what was written in [From, To). Types with nothing to compare a filter to
+// are left out when it is set.
+type SearchQuery struct {
+	Terms    []string
+	Types    []string
+	AuthorID int
+	GroupID  int
+	From     time.Time
+	To       time.Time
+}
+
+// Search result types.
+const (
+	SearchUser    = "user"
+	SearchPost    = "post"
+	SearchComment = "comment"
+	SearchGroup   = "group"
+	SearchEvent   = "event"
+)
+
+// SearchResult is a user, post, comment, group or event that matched a
+// search. UserID and the names are the user's own or those of the author or
+// creator. Snippet is the part of the text that matched, with the matching
+// words located by Highlights like the mentions in a post.
+type SearchResult struct {
+	Type       string      `json:"type"`
+	ID         int         `json:"id"`
+	UserID     int         `json:"user_id"`
+	FirstName  string      `json:"first_name"`
+	LastName   string      `json:"last_name"`
+	Title      string      `json:"title,omitempty"`
+	PostID     int         `json:"post_id,omitempty"`
+	GroupID    int         `json:"group_id,omitempty"`
+	Snippet    string      `json:"snippet"`
+	Highlights []Highlight `json:"highlights"`
+	Date       *time.Time  `json:"date,omitempty"`
+	Rank       float64     `json:"rank"`
+}
+
+// Highlight locates a matching word in the snippet of a SearchResult.
+type Highlight struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// MentionUpdate is pushed over the chat websocket to a user who was just
+// mentioned.
+type MentionUpdate struct {
+	Type string `json:"type"`
+	Mention
+}
@@ -0,0 +1,180 @@
+// Package validator checks request payloads against rules declared in
+// `validate` struct tags, e.g.
+//
+//	Email string `json:"email" validate:"required,email,max=30"`
+//
+// Errors are keyed by the field's JSON name so they can be returned to the
+// client as-is.
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DateLayout is the format used for dates of birth and event times.
+const DateLayout = "2006-01-02"
+
+var emailRX = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// Errors maps a JSON field name to a human readable problem with it.
+type Errors map[string]string
+
+// Add records message for field unless the field already has an error.
+func (e Errors) Add(field, message string) {
+	if _, exists := e[field]; !exists {
+		e[field] = message
+	}
+}
+
+// Validatable is implemented by types with rules that span several fields.
+// Validate is called after the tag rules and may add to errs.
+type Validatable interface {
+	Validate(errs Errors)
+}
+
+// Struct validates v, which must be a struct or a pointer to one, and returns
+// nil when every rule passes.
+func Struct(v interface{}) Errors {
+	errs := Errors{}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name := jsonName(field)
+		for _, rule := range strings.Split(tag, ",") {
+			key, param, _ := strings.Cut(rule, "=")
+			if msg := check(key, param, rv.Field(i)); msg != "" {
+				errs.Add(name, msg)
+				break
+			}
+		}
+	}
+
+	if c, ok := v.(Validatable); ok {
+		c.Validate(errs)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// check applies a single rule to value and returns an error message, or an
+// empty string when the rule passes. Rules other than "required" skip empty
+// values so optional fields can still declare a format.
+func check(rule, param string, value reflect.Value) string {
+	if rule == "required" {
+		if isZero(value) {
+			return "is required"
+		}
+		return ""
+	}
+	if isZero(value) {
+		return ""
+	}
+
+	switch rule {
+	case "email":
+		if !emailRX.MatchString(value.String()) {
+			return "must be a valid email address"
+		}
+	case "min":
+		n := mustInt(param)
+		if value.Kind() == reflect.String {
+			if utf8.RuneCountInString(value.String()) < n {
+				return fmt.Sprintf("must be at least %d characters long", n)
+			}
+		} else if value.Int() < int64(n) {
+			return fmt.Sprintf("must be at least %d", n)
+		}
+	case "max":
+		n := mustInt(param)
+		if value.Kind() == reflect.String {
+			if utf8.RuneCountInString(value.String()) > n {
+				return fmt.Sprintf("must not be more than %d characters long", n)
+			}
+		} else if value.Int() > int64(n) {
+			return fmt.Sprintf("must not be more than %d", n)
+		}
+	case "oneof":
+		options := strings.Split(param, " ")
+		for _, option := range options {
+			if value.String() == option {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(options, ", ")
+	case "date":
+		if _, err := time.Parse(DateLayout, value.String()); err != nil {
+			return "must be a date in YYYY-MM-DD format"
+		}
+	case "future":
+		date, err := time.Parse(DateLayout, value.String())
+		if err != nil {
+			return "must be a date in YYYY-MM-DD format"
+		}
+		if date.Before(today()) {
+			return "must not be in the past"
+		}
+	case "minage":
+		dob, err := time.Parse(DateLayout, value.String())
+		if err != nil {
+			return "must be a date in YYYY-MM-DD format"
+		}
+		years := mustInt(param)
+		if dob.AddDate(years, 0, 0).After(today()) {
+			return fmt.Sprintf("you must be at least %d years old", years)
+		}
+	case "ids":
+		for _, id := range strings.Split(value.String(), ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(id)); err != nil || n <= 0 {
+				return "must be a comma-separated list of user IDs"
+			}
+		}
+	default:
+		panic(fmt.Sprintf("validator: unknown rule %q", rule))
+	}
+
+	return ""
+}
+
+func isZero(value reflect.Value) bool {
+	if value.Kind() == reflect.String {
+		return strings.TrimSpace(value.String()) == ""
+	}
+	return value.IsZero()
+}
+
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func mustInt(param string) int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("validator: bad rule parameter %q", param))
+	}
+	return n
+}
@@ -0,0 +1,188 @@
+package validator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validateField runs Struct on a struct with a single field holding value,
+// tagged with rules, and returns the error for it.
+func validateField(rules string, value interface{}) string {
+	typ := reflect.StructOf([]reflect.StructField{{
+		Name: "Field",
+		Type: reflect.TypeOf(value),
+		Tag:  reflect.StructTag(`json:"field" validate:"` + rules + `"`),
+	}})
+	v := reflect.New(typ)
+	v.Elem().Field(0).Set(reflect.ValueOf(value))
+	return Struct(v.Interface())["field"]
+}
+
+func TestRules(t *testing.T) {
+	day := func(years, days int) string {
+		return time.Now().AddDate(years, 0, days).Format(DateLayout)
+	}
+
+	tests := []struct {
+		rules string
+		value interface{}
+		want  string
+	}{
+		{"required", "ann", ""},
+		{"required", "", "is required"},
+		{"required", " \t", "is required"},
+		{"required", 0, "is required"},
+		{"required", 3, ""},
+
+		{"email", "ann@example.com", ""},
+		{"email", "ann.b+c@mail.example.org", ""},
+		{"email", "ann@", "must be a valid email address"},
+		{"email", "ann example.com", "must be a valid email address"},
+		{"email", "", ""},
+
+		{"min=5", "abcde", ""},
+		{"min=5", "abcd", "must be at least 5 characters long"},
+		// Lengths are counted in characters, not bytes.
+		{"min=5", "héllo", ""},
+		{"min=1", 1, ""},
+		{"min=1", -1, "must be at least 1"},
+		{"max=3", "abc", ""},
+		{"max=3", "abcd", "must not be more than 3 characters long"},
+		{"max=3", "ééé", ""},
+		{"max=10", 10, ""},
+		{"max=10", 11, "must not be more than 10"},
+		// Rules other than required skip empty values.
+		{"min=5", "", ""},
+		{"min=1", 0, ""},
+
+		{"oneof=public private", "private", ""},
+		{"oneof=public private", "secret", "must be one of: public, private"},
+		{"oneof=public private", "Public", "must be one of: public, private"},
+
+		{"date", "2000-02-29", ""},
+		{"date", "2001-02-29", "must be a date in YYYY-MM-DD format"},
+		{"date", "29.02.2000", "must be a date in YYYY-MM-DD format"},
+
+		{"future", day(0, 0), ""},
+		{"future", day(1, 0), ""},
+		{"future", day(0, -1), "must not be in the past"},
+		{"future", "soon", "must be a date in YYYY-MM-DD format"},
+
+		{"minage=13", day(-13, 0), ""},
+		{"minage=13", day(-13, 1), "you must be at least 13 years old"},
+		{"minage=13", day(0, 0), "you must be at least 13 years old"},
+		{"minage=13", "1990/01/01", "must be a date in YYYY-MM-DD format"},
+
+		{"ids", "1", ""},
+		{"ids", "1,2, 3", ""},
+		{"ids", "1,,2", "must be a comma-separated list of user IDs"},
+		{"ids", "0", "must be a comma-separated list of user IDs"},
+		{"ids", "-4", "must be a comma-separated list of user IDs"},
+		{"ids", "ann", "must be a comma-separated list of user IDs"},
+
+		// The first rule that fails is reported.
+		{"required,email,max=10", "", "is required"},
+		{"required,email,max=10", "ann", "must be a valid email address"},
+		{"required,email,max=10", "ann@example.com", "must not be more than 10 characters long"},
+	}
+
+	for _, test := range tests {
+		if got := validateField(test.rules, test.value); got != test.want {
+			t.Errorf("%s on %#v: got %q, want %q", test.rules, test.value, got, test.want)
+		}
+	}
+}
+
+func TestStructFieldNames(t *testing.T) {
+	var v struct {
+		Email    string `json:"email,omitempty" validate:"required"`
+		Nickname string `validate:"required"`
+		Secret   string `json:"-" validate:"required"`
+		Skipped  string `json:"skipped" validate:"-"`
+		Free     string `json:"free"`
+	}
+
+	got := Struct(&v)
+	want := Errors{"email": "is required", "Nickname": "is required", "Secret": "is required"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Struct = %v, want %v", got, want)
+	}
+
+	v.Email, v.Nickname, v.Secret = "ann@example.com", "ann", "x"
+	if got := Struct(v); got != nil {
+		t.Errorf("Struct of a valid value = %v, want nil", got)
+	}
+}
+
+func TestUnknownRules(t *testing.T) {
+	tests := []struct {
+		rules string
+		want  string
+	}{
+		{"required,uuid", `validator: unknown rule "uuid"`},
+		{"max=ten", `validator: bad rule parameter "ten"`},
+		{"min", `validator: bad rule parameter ""`},
+	}
+
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if got := recover(); got != test.want {
+					t.Errorf("%s: panicked with %v, want %q", test.rules, got, test.want)
+				}
+			}()
+			validateField(test.rules, "ann")
+		}()
+	}
+
+	// Unknown rules are not reached when an earlier one fails, and not
+	// checked on empty values.
+	if got := validateField("required,uuid", ""); got != "is required" {
+		t.Errorf("got %q, want the required error", got)
+	}
+	if got := validateField("uuid", ""); got != "" {
+		t.Errorf("got %q for an empty value", got)
+	}
+}
+
+type item struct {
+	AltText string `json:"alt_text" validate:"max=3"`
+}
+
+type order struct {
+	Title string `json:"title" validate:"required"`
+	Main  item   `json:"main"`
+	Items []item `json:"items"`
+}
+
+// Validate checks the items, which Struct does not descend into.
+func (o *order) Validate(errs Errors) {
+	errs.Add("title", "is taken")
+	for _, it := range o.Items {
+		for field, msg := range Struct(&it) {
+			errs.Add("items."+field, msg)
+		}
+	}
+}
+
+func TestNestedStructs(t *testing.T) {
+	// Tags of nested structs are not checked, so Main passes; Validate runs
+	// after the tag rules and does not replace their errors.
+	o := order{Main: item{AltText: "long"}, Items: []item{{AltText: "ok"}, {AltText: "too long"}}}
+	got := Struct(&o)
+	want := Errors{"title": "is required", "items.alt_text": "must not be more than 3 characters long"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Struct = %v, want %v", got, want)
+	}
+
+	// Validate is only found through a pointer receiver on a pointer.
+	o.Title = "lunch"
+	if got := Struct(o); got != nil {
+		t.Errorf("Struct of a value = %v, want nil", got)
+	}
+	if got := Struct(&o); !strings.Contains(got["title"], "taken") {
+		t.Errorf("Struct of a pointer = %v, want the error from Validate", got)
+	}
+}
@@ -2,6 +2,10 @@ import React, { useState, useEffect } from "react";
 import { useNavigate, useLocation } from 'react-router-dom';
 import { displayErrorMessage } from "./ErrorMessage";
 import CreateComment from "./CreateComment";
+import Comments, { insertComment } from "./Comments";
+import Gallery from "./Gallery";
+import Reactions from "./Reactions";
+import LinkedText from "./LinkedText";
 
 function AllPosts() {
   const [allPosts, setAllPosts] = useState([]);
@@ -34,7 +38,7 @@ function AllPosts() {
               ...post,
               //If post.comments is null, it means there are no existing comments on this post. So initializing the comments property as a new array containing only the newComment.
               //If post.comments is not null, it means there are already some comments on this post. In this case, using the spread operator (...) again to create a new array. Coping all the existing comments from post.comments and adding the newComment to the end of the array.
-              comments: post.comments === null ? [newComment] : [...post.comments, newComment],
+              comments: insertComment(post.comments, newComment),
             }
           //If the post_id doesn't match, simply returning the original post object without any changes.
           : post
@@ -54,30 +58,20 @@ function AllPosts() {
               <div>
                 <span className="poster">{post.first_name} {post.last_name}</span>
                 <span className="post-date">{new Date(post.date).toLocaleString()}</span>
+                {post.edited_at && <span className="post-date">(edited)</span>}
               </div>
               <div className="post-date">
                 {post.privacy} 
+                {post.followed_tags && ` · because you follow ${post.followed_tags.map((tag) => `#${tag}`).join(", ")}`}
               </div>
-              <p className="post">{post.content}</p>
-              {post.image && <img className="post-image" src={`/images/${post.image}`} alt="PostImage" />}
+              <p className="post"><LinkedText text={post.content} mentions={post.mentions} hashtags={post.hashtags} /></p>
+              <Gallery attachments={post.attachments} />
+              <Reactions target={{ post_id: post.post_id }} reactions={post.reactions} />
               <div className="comments">
                 {post.comments === null ? (
                   <p className="comment-text">No comments</p>
                 ) : (
-                  <div>
-                    {post.comments.map((comment, index) => (
-                      <div className="comment" key={`${comment.comment_id}-${index}`}>
-                        <div>
-                          <span className="poster">{comment.first_name} {comment.last_name}</span>
-                          <span className="post-date">{new Date(comment.date).toLocaleString()}</span>
-                        </div>
-                        <div className="comment-text">
-                          {comment.comment}
-                        </div>
-                        {comment.image && <img className="post-image" src={`/images/${comment.image}`} alt="CommentImage" />}
-                      </div>
-                    ))}
-                  </div>
+                  <Comments comments={post.comments} postID={post.post_id} addNewComment={addNewComment} />
                 )}
               </div>
               <CreateComment postID={post.post_id} addNewComment={addNewComment}/>
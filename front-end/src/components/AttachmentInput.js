@@ -0,0 +1,45 @@
+import React from "react";
+
+export const attachmentTypes = "image/jpeg, image/png, image/gif, image/webp, video/mp4, video/webm, application/pdf";
+
+// AttachmentInput picks files to attach, up to 10, with alt text for each.
+// files is a list of { file, altText }.
+function AttachmentInput({ files, setFiles }) {
+  const handleFilesChange = (e) => {
+    const picked = Array.from(e.target.files).map((file) => ({ file, altText: "" }));
+    setFiles([...files, ...picked].slice(0, 10));
+    e.target.value = "";
+  };
+
+  const handleAltTextChange = (index, altText) => {
+    setFiles(files.map((f, i) => (i === index ? { ...f, altText } : f)));
+  };
+
+  const handleRemove = (index) => {
+    setFiles(files.filter((_, i) => i !== index));
+  };
+
+  return (
+    <div>
+      <label htmlFor="attachments"></label>
+      <input className="insert" type="file" name="attachments" multiple accept={attachmentTypes} onChange={handleFilesChange} />
+      {files.map((f, index) => (
+        <div key={index} className="attachment-item">
+          <span>{f.file.name}</span>
+          <input placeholder="Describe it..." maxLength={200} value={f.altText} onChange={(e) => handleAltTextChange(index, e.target.value)} />
+          <button type="button" onClick={() => handleRemove(index)}>x</button>
+        </div>
+      ))}
+    </div>
+  );
+}
+
+// appendAttachments adds the files and their alt text to a form, in order.
+export function appendAttachments(formData, files) {
+  files.forEach((f) => {
+    formData.append("attachments", f.file);
+    formData.append("alt_text", f.altText);
+  });
+}
+
+export default AttachmentInput;
@@ -0,0 +1,62 @@
+import React from "react";
+import CreateComment from "./CreateComment";
+import Gallery from "./Gallery";
+import Reactions from "./Reactions";
+import LinkedText from "./LinkedText";
+
+//Shows comments with their replies nested under them. Deleted comments that still have replies are shown as a placeholder.
+function Comments({ comments, postID, addNewComment }) {
+  return (
+    <div>
+      {comments.map((comment) => (
+        <div className="comment" key={comment.comment_id}>
+          {comment.deleted ? (
+            <div className="comment-text">[deleted]</div>
+          ) : (
+            <>
+              <div>
+                <span className="poster">{comment.first_name} {comment.last_name}</span>
+                <span className="post-date">{new Date(comment.date).toLocaleString()}</span>
+                {comment.edited_at && <span className="post-date">(edited)</span>}
+              </div>
+              <div className="comment-text">
+                <LinkedText text={comment.comment} mentions={comment.mentions} hashtags={comment.hashtags} />
+              </div>
+              <Gallery attachments={comment.attachments} />
+              <Reactions target={{ comment_id: comment.comment_id }} reactions={comment.reactions} />
+              {addNewComment && (
+                <CreateComment postID={postID} parentID={comment.comment_id} addNewComment={addNewComment} />
+              )}
+            </>
+          )}
+          {comment.reply_count > 0 && (
+            <div className="replies">
+              <span className="post-date">{comment.reply_count === 1 ? "1 reply" : `${comment.reply_count} replies`}</span>
+              {comment.replies && (
+                <Comments comments={comment.replies} postID={postID} addNewComment={addNewComment} />
+              )}
+            </div>
+          )}
+        </div>
+      ))}
+    </div>
+  );
+}
+
+//Returns the comments with newComment added, under its parent if it is a reply.
+export function insertComment(comments, newComment) {
+  if (!newComment.parent_id) {
+    return comments === null ? [newComment] : [...comments, newComment];
+  }
+  return (comments || []).map((comment) =>
+    comment.comment_id === newComment.parent_id
+      ? {
+          ...comment,
+          reply_count: comment.reply_count + 1,
+          replies: [...(comment.replies || []), newComment],
+        }
+      : { ...comment, replies: comment.replies && insertComment(comment.replies, newComment) }
+  );
+}
+
+export default Comments;
@@ -1,9 +1,10 @@
 import React, { useState } from "react";
 import { displayErrorMessage } from "./ErrorMessage";
+import AttachmentInput, { appendAttachments } from "./AttachmentInput";
 
-function CreateComment({ postID, addNewComment }) {
+function CreateComment({ postID, parentID, addNewComment }) {
   const [commentContent, setCommentContent] = useState("");
-  const [imageOrGif, setImageOrGif] = useState(null);
+  const [attachments, setAttachments] = useState([]);
   const [isCommentFocused, setIsCommentFocused] = useState(false);
   const [errors, setErrors] =useState([]);
 
@@ -12,11 +13,6 @@ function CreateComment({ postID, addNewComment }) {
     setCommentContent(e.target.value);
   };
 
-  const handleImageChange = (e) => {
-    const file = e.target.files[0];
-    setImageOrGif(file);
-  };
-
   const handleSubmit = (e) => {
     e.preventDefault();
     setErrors([]);
@@ -38,7 +34,10 @@ function CreateComment({ postID, addNewComment }) {
     const commentData = new FormData();
     commentData.append("post_id", postID);
     commentData.append("comment", commentContent);
-    commentData.append("image", imageOrGif);
+    if (parentID) {
+      commentData.append("parent_id", parentID);
+    }
+    appendAttachments(commentData, attachments);
 
     const headers = new Headers();
 
@@ -52,7 +51,7 @@ function CreateComment({ postID, addNewComment }) {
       .then((response) => {
         if (response.ok) {
           setCommentContent("");
-          setImageOrGif("");
+          setAttachments([]);
           response.json().then((createdComment) => {
             const newComment = {
               comment_id: createdComment.comment_id,
@@ -60,7 +59,11 @@ function CreateComment({ postID, addNewComment }) {
               last_name: createdComment.last_name,
               comment: createdComment.comment,
               image: createdComment.image,
+              attachments: createdComment.attachments,
               date: createdComment.date,
+              parent_id: createdComment.parent_id,
+              depth: createdComment.depth,
+              reply_count: 0,
             };
             addNewComment(postID, newComment); 
           });
@@ -82,7 +85,7 @@ function CreateComment({ postID, addNewComment }) {
   return (
     <div>
       <form onSubmit={handleSubmit}>
-        <input className="content" placeholder="Comment..." value={commentContent} onChange={handleContentChange} onFocus={() => setIsCommentFocused(true)}/>
+        <input className="content" placeholder={parentID ? "Reply..." : "Comment..."} value={commentContent} onChange={handleContentChange} onFocus={() => setIsCommentFocused(true)}/>
         {errors.includes("comment") && (
             <p className="alert">Please fill in the comment field.</p>
           )}
@@ -91,9 +94,8 @@ function CreateComment({ postID, addNewComment }) {
           )}
             {isCommentFocused && (
                 <>
-                  <label htmlFor="image"></label>
-                  <input className="insert" type="file" name="image" accept="image/*, .gif" onChange={handleImageChange}/>
-                  <button className="comment-button" type="submit">Add Comment</button>
+                  <AttachmentInput files={attachments} setFiles={setAttachments} />
+                  <button className="comment-button" type="submit">{parentID ? "Reply" : "Add Comment"}</button>
                 </>
             )}
       </form>
@@ -124,7 +124,7 @@ function CreateGroup() {
                   <p className="alert">Description is too long (max 100 characters).</p>
                 )}
                 <div>
-                    <Search setSearchResults={setSearchResults} />
+                    <Search setSearchResults={setSearchResults} type="user" />
                     <div className="search-results">
                         {searchResults !== null && searchResults.length > 0 && (
                         searchResults.map((result) => (
@@ -2,12 +2,13 @@ import React, { useState } from "react";
 import { displayErrorMessage } from "./ErrorMessage";
 import { useNavigate } from "react-router-dom"
 import Search from "../components/Search";
+import AttachmentInput, { appendAttachments } from "./AttachmentInput";
 
 function CreatePost({ groupId }) {
   const [showFields, setShowFields] = useState(false);
   const [postContent, setPostContent] = useState("");
   const [postPrivacy, setPostPrivacy] = useState("public");
-  const [imageOrGif, setImageOrGif] = useState(null);
+  const [attachments, setAttachments] = useState([]);
   const [searchResults, setSearchResults] = useState(null);
   const [selectedUsers, setSelectedUsers] = useState([]);
   const [errors, setErrors] =useState([])
@@ -22,11 +23,6 @@ function CreatePost({ groupId }) {
     setPostPrivacy(e.target.value);
   };
 
-  const handleImageChange = (e) => {
-    const file = e.target.files[0];
-    setImageOrGif(file);
-  };
-
   const handleToggleFields = () => {
     setShowFields(!showFields);
   };
@@ -68,7 +64,7 @@ function CreatePost({ groupId }) {
     postData.append("content", postContent);
     postData.append("privacy", postPrivacy);
     postData.append("selected_user_id", selectedUserIdString);
-    postData.append("image", imageOrGif);
+    appendAttachments(postData, attachments);
     postData.append("group_id", groupId);
 
     const headers = new Headers();
@@ -84,7 +80,7 @@ function CreatePost({ groupId }) {
         if (response.ok) {
           setPostContent("");
           setPostPrivacy("public");
-          setImageOrGif("");
+          setAttachments([]);
           setSearchResults(null);
           setSelectedUsers([]);
           setShowFields(false);
@@ -131,7 +127,7 @@ function CreatePost({ groupId }) {
                   </select>
                   <div className="post-search">
                   {postPrivacy === "for-selected-users" && (
-                    <Search setSearchResults={setSearchResults} />
+                    <Search setSearchResults={setSearchResults} type="user" />
                   )}
                   <div className="search-results">
                     {searchResults !== null && searchResults.length > 0 && (
@@ -158,8 +154,7 @@ function CreatePost({ groupId }) {
               </div>
           )}
               <div className="right-container1">
-                  <label htmlFor="image"></label>
-                  <input className="insert" type="file" name="image" accept="image/*, .gif" onChange={handleImageChange}/>
+                  <AttachmentInput files={attachments} setFiles={setAttachments} />
               </div>
           </div>
               <button className="button" type="submit">Create Post</button>
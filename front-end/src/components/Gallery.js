@@ -0,0 +1,41 @@
+import React from "react";
+
+// Gallery shows the attachments of a post, comment or message in order:
+// images and videos inline, documents as download links.
+function Gallery({ attachments }) {
+  if (!attachments || attachments.length === 0) {
+    return null;
+  }
+
+  return (
+    <div className="gallery">
+      {attachments.map((attachment) => {
+        if (!attachment.url) {
+          return null;
+        }
+        if (attachment.mime_type.startsWith("image/")) {
+          return (
+            <img
+              key={attachment.attachment_id}
+              className="post-image"
+              src={attachment.variants ? attachment.variants.medium : attachment.url}
+              alt={attachment.alt_text}
+            />
+          );
+        }
+        if (attachment.mime_type.startsWith("video/")) {
+          return (
+            <video key={attachment.attachment_id} className="post-image" src={attachment.url} aria-label={attachment.alt_text} controls preload="metadata" />
+          );
+        }
+        return (
+          <a key={attachment.attachment_id} className="attachment-link" href={attachment.url} download>
+            {attachment.alt_text || "Document"}
+          </a>
+        );
+      })}
+    </div>
+  );
+}
+
+export default Gallery;
@@ -6,6 +6,7 @@ import GroupRequests from "../components/GroupRequests";
 import GroupInvitations from "../components/GroupInvitations";
 import { displayErrorMessage } from "../components/ErrorMessage";
 import GroupEventNotifications from './GroupEventNotifications';
+import MentionNotifications from './MentionNotifications';
 
 function Header() {
   const [userData, setUserData] = useState(null);
@@ -15,7 +16,7 @@ function Header() {
       .then((response) => response.json())
       .then((data) => {
         if (data.avatar) {
-          const avatarPath = `/images/${data.avatar}`;
+          const avatarPath = `/images/${data.avatar}?size=small`;
           data.avatar = avatarPath;
         } else {
           data.avatar = Avatar;
@@ -46,6 +47,7 @@ function Header() {
                   <GroupRequests />
                   <GroupInvitations />
                   <GroupEventNotifications />
+                  <MentionNotifications />
               </div>
               <div className="avatar">
                   <img
@@ -48,7 +48,7 @@ function InviteNewMember({ groupId }) {
       <div className="group-data">
         Invite new member:
       </div>
-      <Search setSearchResults={setSearchResults} />
+      <Search setSearchResults={setSearchResults} type="user" />
       <div className="search-results">
           {searchResults !== null && searchResults.length > 0 && (
             searchResults.map((result) => (
@@ -0,0 +1,34 @@
+import React from "react";
+import { Link } from "react-router-dom";
+
+//Text with its @mentions linked to the profiles of the users mentioned and its #hashtags to their tag pages. Offsets count UTF-16 code units, as string indexes do here.
+function LinkedText({ text, mentions, hashtags }) {
+  const links = [
+    ...(mentions || []).map((mention) => ({ ...mention, to: `/user/${mention.user_id}` })),
+    ...(hashtags || []).map((hashtag) => ({ ...hashtag, to: `/hashtag/${encodeURIComponent(hashtag.tag)}` })),
+  ].sort((a, b) => a.offset - b.offset);
+
+  if (!text || links.length === 0) {
+    return <>{text}</>;
+  }
+
+  const parts = [];
+  let last = 0;
+  links.forEach((link) => {
+    if (link.offset < last) {
+      return;
+    }
+    parts.push(text.slice(last, link.offset));
+    parts.push(
+      <Link className="mention" key={link.offset} to={link.to}>
+        {text.slice(link.offset, link.offset + link.length)}
+      </Link>
+    );
+    last = link.offset + link.length;
+  });
+  parts.push(text.slice(last));
+
+  return <>{parts}</>;
+}
+
+export default LinkedText;
@@ -0,0 +1,73 @@
+import React, { useState, useEffect } from 'react';
+import { Link } from 'react-router-dom';
+import { displayErrorMessage } from "../components/ErrorMessage";
+
+const places = { post_id: "a post", comment_id: "a comment", message_id: "a message" };
+
+//Mentions of the user that were not seen yet. New ones pushed over the chat websocket arrive as "mention" events on window.
+function MentionNotifications() {
+  const [mentions, setMentions] = useState([]);
+
+  useEffect(() => {
+    fetch('/mentions')
+    .then((response) => response.json())
+    .then((data) => {
+      if (Array.isArray(data)) {
+        setMentions(data.filter((mention) => !mention.seen));
+      }
+    })
+    .catch((error) => {
+      displayErrorMessage(`${error.message}`);
+    });
+
+    const handleMention = (event) => {
+      setMentions((prevMentions) => [event.detail, ...prevMentions]);
+    };
+    window.addEventListener("mention", handleMention);
+    return () => window.removeEventListener("mention", handleMention);
+  }, []);
+
+  const handleClick = (mentionID) => {
+    fetch('/mention-seen', {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ mention_id: mentionID }),
+    })
+    .then((response) => {
+      if (response.ok) {
+        setMentions((prevMentions) => prevMentions.filter((mention) => mention.mention_id !== mentionID));
+      } else {
+        return response.json().then((data) => {
+          throw new Error(data.message);
+        });
+      }
+    })
+    .catch((error) => {
+      displayErrorMessage(`${error.message}`);
+    });
+  };
+
+  const place = (mention) => places[Object.keys(places).find((key) => mention[key])];
+
+  return (
+    <div>
+      {mentions.length > 0 && <div className="following">Mentions:</div>}
+      <div className="user">
+      {mentions.map((mention) => (
+        <div className="requests" key={mention.mention_id}>
+          <div>
+            <Link className="link" to={`/user/${mention.author_id}`} onClick={() => handleClick(mention.mention_id)}>
+            {mention.author_first_name} {mention.author_last_name}
+            </Link>&nbsp;
+            mentioned you in {place(mention)}
+            <br/>
+          </div>
+        <hr/>
+        </div>
+      ))}
+      </div>
+    </div>
+  );
+}
+
+export default MentionNotifications;
@@ -0,0 +1,95 @@
+import React, { useState } from "react";
+import { displayErrorMessage } from "./ErrorMessage";
+import AttachmentInput, { appendAttachments } from "./AttachmentInput";
+
+//Edit and delete buttons for the author of a post. Attachments already on the post are kept unless removed.
+function PostControls({ post, onEdited, onDeleted }) {
+  const [editing, setEditing] = useState(false);
+  const [content, setContent] = useState(post.content);
+  const [kept, setKept] = useState(post.attachments || []);
+  const [attachments, setAttachments] = useState([]);
+
+  const startEditing = () => {
+    setContent(post.content);
+    setKept(post.attachments || []);
+    setAttachments([]);
+    setEditing(true);
+  };
+
+  const handleError = (response) =>
+    response.json().then((data) => {
+      throw new Error(data.message);
+    });
+
+  const handleSave = (e) => {
+    e.preventDefault();
+    if (content.trim() === "" || content.length > 100) {
+      displayErrorMessage("Post must be between 1 and 100 characters.");
+      return;
+    }
+
+    const postData = new FormData();
+    postData.append("post_id", post.post_id);
+    postData.append("content", content);
+    postData.append("privacy", post.privacy);
+    postData.append("selected_user_id", post.selected_user_id || "");
+    kept.forEach((attachment) => {
+      postData.append("keep", attachment.attachment_id);
+      postData.append("keep_alt_text", attachment.alt_text || "");
+    });
+    appendAttachments(postData, attachments);
+
+    fetch("/edit-post", { method: "POST", body: postData })
+      .then((response) => (response.ok ? response.json() : handleError(response)))
+      .then((edited) => {
+        setEditing(false);
+        onEdited({
+          ...post,
+          content: edited.content,
+          image: edited.image,
+          attachments: edited.attachments,
+          edited_at: edited.edited_at,
+        });
+      })
+      .catch((error) => {
+        displayErrorMessage(`${error.message}`);
+      });
+  };
+
+  const handleDelete = () => {
+    if (!window.confirm("Delete this post and its comments?")) {
+      return;
+    }
+    fetch("/delete-post", { method: "POST", body: JSON.stringify({ post_id: post.post_id }) })
+      .then((response) => (response.ok ? onDeleted(post.post_id) : handleError(response)))
+      .catch((error) => {
+        displayErrorMessage(`${error.message}`);
+      });
+  };
+
+  if (!editing) {
+    return (
+      <div className="post-controls">
+        <button className="comment-button" onClick={startEditing}>Edit</button>
+        <button className="comment-button" onClick={handleDelete}>Delete</button>
+      </div>
+    );
+  }
+
+  return (
+    <form className="post-controls" onSubmit={handleSave}>
+      <input className="content" value={content} onChange={(e) => setContent(e.target.value)} />
+      {kept.map((attachment) => (
+        <div key={attachment.attachment_id}>
+          <span className="post-date">{attachment.alt_text || attachment.name}</span>
+          <button type="button" className="comment-button" onClick={() => setKept(kept.filter((a) => a !== attachment))}>Remove</button>
+        </div>
+      ))}
+      <AttachmentInput files={attachments} setFiles={setAttachments} />
+      <button className="comment-button" type="submit">Save</button>
+      <button type="button" className="comment-button" onClick={() => setEditing(false)}>Cancel</button>
+    </form>
+  );
+}
+
+export default PostControls;
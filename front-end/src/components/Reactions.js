@@ -0,0 +1,109 @@
+import React, { useState, useEffect } from "react";
+import { displayErrorMessage } from "./ErrorMessage";
+
+let emojiRequest = null;
+
+//The emoji users can react with, fetched once.
+function reactionEmojis() {
+  if (!emojiRequest) {
+    emojiRequest = fetch("/reaction-emojis").then((response) => response.json());
+  }
+  return emojiRequest;
+}
+
+//Reaction buttons for a post or comment. target is {post_id} or {comment_id}. Counts pushed over the chat websocket arrive as "reactions" events on window.
+function Reactions({ target, reactions }) {
+  const [emojis, setEmojis] = useState([]);
+  const [counts, setCounts] = useState((reactions && reactions.counts) || {});
+  const [mine, setMine] = useState((reactions && reactions.mine) || "");
+  const [reactors, setReactors] = useState(null);
+
+  useEffect(() => {
+    reactionEmojis()
+    .then((data) => setEmojis(data))
+    .catch((error) => {
+      displayErrorMessage(`${error.message}`);
+    });
+  }, []);
+
+  useEffect(() => {
+    const handleUpdate = (event) => {
+      const update = event.detail;
+      if (update.post_id === target.post_id && update.comment_id === target.comment_id) {
+        setCounts(update.counts || {});
+      }
+    };
+    window.addEventListener("reactions", handleUpdate);
+    return () => window.removeEventListener("reactions", handleUpdate);
+  }, [target.post_id, target.comment_id]);
+
+  const react = (emoji) => {
+    fetch("/react", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ ...target, emoji: emoji === mine ? "" : emoji }),
+    })
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((data) => {
+          throw new Error(data.message);
+        });
+      }
+      return response.json();
+    })
+    .then((data) => {
+      setCounts(data.counts || {});
+      setMine(data.mine || "");
+      setReactors(null);
+    })
+    .catch((error) => {
+      displayErrorMessage(`${error.message}`);
+    });
+  };
+
+  const toggleReactors = () => {
+    if (reactors) {
+      setReactors(null);
+      return;
+    }
+    const query = target.post_id ? `postId=${target.post_id}` : `commentId=${target.comment_id}`;
+    fetch(`/reactions?${query}`)
+    .then((response) => response.json())
+    .then((data) => setReactors(Array.isArray(data) ? data : []))
+    .catch((error) => {
+      displayErrorMessage(`${error.message}`);
+    });
+  };
+
+  const total = Object.values(counts).reduce((sum, count) => sum + count, 0);
+
+  return (
+    <div className="reactions">
+      {emojis.map((emoji) => (
+        <button
+          key={emoji}
+          className={emoji === mine ? "reaction-button mine" : "reaction-button"}
+          onClick={() => react(emoji)}
+        >
+          {emoji} {counts[emoji] || ""}
+        </button>
+      ))}
+      {total > 0 && (
+        <span className="post-date reactors-link" onClick={toggleReactors}>
+          {total === 1 ? "1 reaction" : `${total} reactions`}
+        </span>
+      )}
+      {reactors && (
+        <div className="reactors">
+          {reactors.map((reaction) => (
+            <div key={reaction.reaction_id}>
+              {reaction.emoji} {reaction.first_name} {reaction.last_name}
+            </div>
+          ))}
+        </div>
+      )}
+    </div>
+  );
+}
+
+export default Reactions;
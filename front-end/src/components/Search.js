@@ -1,16 +1,19 @@
 import React, { useState } from 'react';
 import { displayErrorMessage } from "./ErrorMessage";
 
-function Search({ setSearchResults }) {
+//Without a type, the user picks what to search for.
+function Search({ setSearchResults, type }) {
   const [searchTerm, setSearchTerm] = useState('');
+  const [searchType, setSearchType] = useState(type || '');
 
-  const performSearch = (query) => {
+  const performSearch = (query, resultType) => {
     if (query === '') {
       setSearchResults(null); 
       return;
     }
 
-    fetch(`/search?query=${query}`)
+    const typeParam = resultType !== '' ? `&type=${resultType}` : '';
+    fetch(`/search?query=${encodeURIComponent(query)}${typeParam}`)
     .then((response) => response.json())
     .then((data) => {
       setSearchResults(data !== null ? data : []);
@@ -24,12 +27,28 @@ function Search({ setSearchResults }) {
   const handleChange = (event) => {
     const value = event.target.value;
     setSearchTerm(value);
-    performSearch(value);
+    performSearch(value, searchType);
+  };
+
+  const handleTypeChange = (event) => {
+    const value = event.target.value;
+    setSearchType(value);
+    performSearch(searchTerm, value);
   };
 
   return (
     <div>
-      <input className="search" type="text" placeholder="Search users..." value={searchTerm} onChange={handleChange} />
+      <input className="search" type="text" placeholder={type === "user" ? "Search users..." : "Search..."} value={searchTerm} onChange={handleChange} />
+      {!type && (
+        <select className="search-type" value={searchType} onChange={handleTypeChange}>
+          <option value="">Everything</option>
+          <option value="user">People</option>
+          <option value="post">Posts</option>
+          <option value="comment">Comments</option>
+          <option value="group">Groups</option>
+          <option value="event">Events</option>
+        </select>
+      )}
       <div id="error" className="alert"></div>
     </div>
   );
@@ -0,0 +1,58 @@
+import React from "react";
+import { Link } from "react-router-dom";
+
+//Where each type of search result leads. Posts and comments have no page of their own, so they lead to their group or their author.
+function resultLink(result) {
+  switch (result.type) {
+    case "group":
+      return `/group/${result.id}`;
+    case "event":
+      return `/group-event/${result.id}`;
+    default:
+      return result.group_id ? `/group/${result.group_id}` : `/user/${result.user_id}`;
+  }
+}
+
+function Snippet({ text, highlights }) {
+  if (!highlights || highlights.length === 0) {
+    return <>{text}</>;
+  }
+
+  const parts = [];
+  let last = 0;
+  highlights.forEach((highlight) => {
+    parts.push(text.slice(last, highlight.offset));
+    parts.push(<mark key={highlight.offset}>{text.slice(highlight.offset, highlight.offset + highlight.length)}</mark>);
+    last = highlight.offset + highlight.length;
+  });
+  parts.push(text.slice(last));
+
+  return <>{parts}</>;
+}
+
+function SearchResults({ results }) {
+  if (results === null) {
+    return null;
+  }
+  if (results.length === 0) {
+    return <p>No results found for your search query.</p>;
+  }
+
+  return (
+    <div className="search-results">
+      {results.map((result) => (
+        <div key={`${result.type}-${result.id}`} className="search-result-item">
+          <Link className="link-btn" to={resultLink(result)}>
+            {result.type === "group" || result.type === "event" ? result.title : `${result.first_name} ${result.last_name}`}
+          </Link>
+          <span className="post-date">{result.type}</span>
+          <div className="search-snippet">
+            <Snippet text={result.snippet} highlights={result.highlights} />
+          </div>
+        </div>
+      ))}
+    </div>
+  );
+}
+
+export default SearchResults;
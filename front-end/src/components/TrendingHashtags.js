@@ -0,0 +1,41 @@
+import React, { useState, useEffect } from 'react';
+import { Link } from 'react-router-dom';
+import { displayErrorMessage } from "./ErrorMessage";
+
+function TrendingHashtags() {
+    const [tags, setTags] = useState([]);
+
+    useEffect(() => {
+    fetch('/trending-hashtags')
+    .then((response) => response.json())
+    .then((data) => {
+        if (Array.isArray(data)) {
+            setTags(data);
+        }
+    })
+    .catch((error) => {
+        displayErrorMessage(`${error.message}`);
+    });
+    }, []);
+
+    return (
+        <div>
+            <div className="group-list">Trending hashtags</div>
+            {tags.length === 0 ? (
+                <p className="group">Nothing trending.</p>
+            ) : (
+                <div className="group">
+                    {tags.map((tag) => (
+                        <div key={tag.tag}>
+                            <Link className="link-btn" to={`/hashtag/${encodeURIComponent(tag.tag)}`}>
+                                #{tag.tag}
+                            </Link>
+                            <span className="post-date">{tag.uses} {tag.uses === 1 ? "post" : "posts"}</span>
+                        </div>
+                    ))}
+                </div>
+            )}
+        </div>
+    );
+}
+export default TrendingHashtags;
@@ -20,6 +20,14 @@ function WebSocketComponent({ firstNameTo, firstNameFrom, closeChat }) {
 
     websocket.onmessage = (event) => {
       const eventData = JSON.parse(event.data);
+      if (eventData.type === "reactions") {
+        window.dispatchEvent(new CustomEvent("reactions", { detail: eventData }));
+        return;
+      }
+      if (eventData.type === "mention") {
+        window.dispatchEvent(new CustomEvent("mention", { detail: eventData }));
+        return;
+      }
       const message = eventData.message;
       const from = eventData.first_name_from;
       const to = eventData.first_name_to;
@@ -32,7 +40,7 @@ function WebSocketComponent({ firstNameTo, firstNameFrom, closeChat }) {
     };
 
     function fetchConversationHistory() {
-      fetch(`/conversation-history/?firstNameTo=${firstNameTo.first_name}`)
+      fetch(`/conversation-history/?userId=${firstNameTo.user_id}`)
       .then(response => response.json())
       .then(messagesData => {  
         if (messagesData && messagesData.length > 0) {
@@ -108,6 +116,7 @@ function WebSocketComponent({ firstNameTo, firstNameFrom, closeChat }) {
     const data = {
       message: messageInput,
       first_name_from: firstNameFrom,
+      user_id_to: firstNameTo.user_id,
       first_name_to: firstNameTo.first_name,
       date: new Date(),
     };
@@ -3,7 +3,7 @@ import { displayErrorMessage } from "../components/ErrorMessage";
 import Picker from '@emoji-mart/react'
 import data from '@emoji-mart/data/sets/14/twitter.json'
 
-function WebSocketComponentForGroup({ groupName, firstNameFrom }) {
+function WebSocketComponentForGroup({ groupId, groupName, firstNameFrom }) {
   const [messages, setMessages] = useState([]);
   const [messageInput, setMessageInput] = useState('');
   const [ws, setWs] = useState(null);
@@ -11,7 +11,7 @@ function WebSocketComponentForGroup({ groupName, firstNameFrom }) {
   const [errors, setErrors] =useState([])
 
   useEffect(() => {
-    const websocket = new WebSocket(`ws://localhost:8080/chatroom/?group=${groupName}`);
+    const websocket = new WebSocket(`ws://localhost:8080/chatroom/?groupId=${groupId}`);
     websocket.onopen = () => {
       console.log('WebSocket connected');
       setWs(websocket);
@@ -20,6 +20,9 @@ function WebSocketComponentForGroup({ groupName, firstNameFrom }) {
 
     websocket.onmessage = (event) => {
       const eventData = JSON.parse(event.data);
+      if (eventData.type === "reactions") {
+        return;
+      }
       const message = eventData.message;
       const from = eventData.first_name_from;
       const to = eventData.first_name_to;
@@ -35,7 +38,7 @@ function WebSocketComponentForGroup({ groupName, firstNameFrom }) {
     };
 
     function fetchConversationHistory() {
-        fetch(`/group-conversation-history/?groupName=${groupName}`)
+        fetch(`/group-conversation-history/?groupId=${groupId}`)
         .then(response => response.json())
         .then(messagesData => { 
             if (messagesData && messagesData.length > 0) {
@@ -53,7 +56,7 @@ function WebSocketComponentForGroup({ groupName, firstNameFrom }) {
         });
     }
 
-  }, [groupName, firstNameFrom]);
+  }, [groupId, groupName, firstNameFrom]);
   
   const handleInputChange = (event) => {
     setMessageInput(event.target.value);
@@ -101,6 +104,7 @@ function WebSocketComponentForGroup({ groupName, firstNameFrom }) {
     const data = {
       message: messageInput,
       first_name_from: firstNameFrom,
+      group_id: groupId,
       first_name_to: groupName,
       date: new Date(),
     };
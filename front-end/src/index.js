@@ -12,6 +12,7 @@ import Profile from "./pages/Profile"
 import User from "./pages/User"
 import Group from "./pages/Group"
 import Event from "./pages/Event"
+import Hashtag from "./pages/Hashtag"
 
 const router = createBrowserRouter([
   {
@@ -49,6 +50,10 @@ const router = createBrowserRouter([
     path: "/group-event/:eventId",
     element: <Event />,
   },
+  {
+    path: "/hashtag/:tag",
+    element: <Hashtag />,
+  },
   {
     path: "/logout",
     element: <Logout />,
@@ -95,7 +95,7 @@ function Group() {
                       <div className="group-chat" onClick={handleToggleFields}>Open group chatroom</div>
                       {showFields && (
                       <div className="chat">
-                        {<WebSocketComponentForGroup groupName={groupData.group.title} firstNameFrom={firstNameFrom}/>}
+                        {<WebSocketComponentForGroup groupId={groupData.group.group_id} groupName={groupData.group.title} firstNameFrom={firstNameFrom}/>}
                       </div>
                          )}
                     </div>
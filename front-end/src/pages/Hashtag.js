@@ -0,0 +1,145 @@
+import React, { useState, useEffect } from "react";
+import { useNavigate, useParams } from 'react-router-dom';
+import { displayErrorMessage } from "../components/ErrorMessage";
+import Header from "../components/Header";
+import Footer from "../components/Footer";
+import CreateComment from "../components/CreateComment";
+import Comments, { insertComment } from "../components/Comments";
+import Gallery from "../components/Gallery";
+import Reactions from "../components/Reactions";
+import LinkedText from "../components/LinkedText";
+import TrendingHashtags from "../components/TrendingHashtags";
+
+function Hashtag() {
+  const navigate = useNavigate();
+  const { tag } = useParams();
+  const [posts, setPosts] = useState([]);
+  const [following, setFollowing] = useState(false);
+
+  const token = document.cookie
+  .split("; ")
+  .find((row) => row.startsWith("sessionId="))
+  ?.split("=")[1];
+
+  useEffect(() => {
+    if (!token) {
+      navigate("/login");
+      return;
+    }
+    fetch(`/hashtag?tag=${encodeURIComponent(tag)}`)
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((data) => {
+          throw new Error(data.message);
+        });
+      }
+      return response.json();
+    })
+    .then((data) => {
+      setPosts(Array.isArray(data) ? data : []);
+    })
+    .catch((error) => {
+      displayErrorMessage(`${error.message}`);
+    });
+
+    fetch('/followed-hashtags')
+    .then((response) => response.json())
+    .then((data) => {
+      setFollowing(Array.isArray(data) && data.includes(tag.toLowerCase()));
+    })
+    .catch((error) => {
+      displayErrorMessage(`${error.message}`);
+    });
+  }, [navigate, tag, token]);
+
+  const handleFollow = () => {
+    fetch('/follow-hashtag', {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ tag: tag, following: !following }),
+    })
+    .then((response) => {
+      if (!response.ok) {
+        return response.json().then((data) => {
+          throw new Error(data.message);
+        });
+      }
+      return response.json();
+    })
+    .then((data) => {
+      setFollowing(data.following);
+    })
+    .catch((error) => {
+      displayErrorMessage(`${error.message}`);
+    });
+  };
+
+  const addNewComment = (postID, newComment) => {
+    setPosts((prevPosts) =>
+      prevPosts.map((post) =>
+        post.post_id === postID
+          ? {
+              ...post,
+              comments: insertComment(post.comments, newComment),
+            }
+          : post
+      )
+    );
+  };
+
+  return (
+    <div className="app-container">
+      <Header />
+      <div className="home">
+        <div>
+          <div id="error" className="alert"></div>
+          <div className="container">
+            <div className="left-container">
+              <TrendingHashtags />
+            </div>
+            <div className="middle-container">
+              <div className="hashtag-header">
+                <span className="poster">#{tag}</span>
+                <button className="btn" onClick={handleFollow}>
+                  {following ? "Unfollow" : "Follow"}
+                </button>
+              </div>
+              {posts.length === 0 ? (
+                <p className="nothing">No posts.</p>
+              ) : (
+                posts.map((post) => (
+                  <div className="posts" key={post.post_id}>
+                    <div>
+                      <span className="poster">{post.first_name} {post.last_name}</span>
+                      <span className="post-date">{new Date(post.date).toLocaleString()}</span>
+                      {post.edited_at && <span className="post-date">(edited)</span>}
+                    </div>
+                    <div className="post-date">
+                      {post.privacy} 
+                    </div>
+                    <p className="post"><LinkedText text={post.content} mentions={post.mentions} hashtags={post.hashtags} /></p>
+                    <Gallery attachments={post.attachments} />
+                    <Reactions target={{ post_id: post.post_id }} reactions={post.reactions} />
+                    <div className="comments">
+                      {post.comments === null ? (
+                        <p className="comment-text">No comments</p>
+                      ) : (
+                        <Comments comments={post.comments} postID={post.post_id} addNewComment={addNewComment} />
+                      )}
+                    </div>
+                    <CreateComment postID={post.post_id} addNewComment={addNewComment}/>
+                  </div>
+                ))
+              )}
+            </div>
+          </div>
+        </div>
+      </div>
+      <Footer />
+    </div>
+  );
+}
+
+export default Hashtag;
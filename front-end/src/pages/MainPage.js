@@ -2,7 +2,7 @@
 import Footer from "../components/Footer"
 import Header from "../components/Header"
 import React, { useState, useEffect } from 'react';
-import { useNavigate, Link } from 'react-router-dom';
+import { useNavigate } from 'react-router-dom';
 import { displayErrorMessage } from "../components/ErrorMessage";
 import CreatePost from "../components/CreatePost";
 import AllPosts from "../components/AllPosts";
@@ -10,6 +10,8 @@ import Users from "../components/Users";
 import Groups from "../components/AllGroups";
 import CreateGroup from "../components/CreateGroup";
 import Search from "../components/Search";
+import SearchResults from "../components/SearchResults";
+import TrendingHashtags from "../components/TrendingHashtags";
 
 function MainPage() {
   const navigate = useNavigate();
@@ -65,19 +67,9 @@ function MainPage() {
             </div>
             <div className="right-container2">
             <Search setSearchResults={setSearchResults}/>
-              <div className="search-results">
-                {searchResults !== null && searchResults.length > 0 && (
-                  searchResults.map((result) => (
-                    <div key={result.user_id} className="search-result-item">
-                      <Link className="link-btn" to={`/user/${result.user_id}`} >{result.first_name} {result.last_name}</Link>
-                    </div>
-                  ))
-                )}
-                {searchResults !== null && searchResults.length === 0 && (
-                  <p>No results found for your search query.</p>
-                )}
-              </div>
+              <SearchResults results={searchResults} />
               <Groups />
+              <TrendingHashtags />
             </div>
           </div>
           ) : (
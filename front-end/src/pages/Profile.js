@@ -10,6 +10,11 @@ import CreateComment from "../components/CreateComment";
 import Following from "../components/Following";
 import Followers from "../components/Followers";
 import ProfileType from "../components/ProfileType";
+import Comments from "../components/Comments";
+import Gallery from "../components/Gallery";
+import Reactions from "../components/Reactions";
+import LinkedText from "../components/LinkedText";
+import PostControls from "../components/PostControls";
 
 function Profile() {
   const navigate = useNavigate();
@@ -47,6 +52,20 @@ function Profile() {
     }
   }, [navigate, token]);
 
+  const updatePost = (editedPost) => {
+    setUserData((prevUserData) => ({
+      ...prevUserData,
+      posts: prevUserData.posts.map((post) => (post.post_id === editedPost.post_id ? editedPost : post)),
+    }));
+  };
+
+  const removePost = (postID) => {
+    setUserData((prevUserData) => ({
+      ...prevUserData,
+      posts: prevUserData.posts.filter((post) => post.post_id !== postID),
+    }));
+  };
+
   const sortedPosts = Array.isArray(userData.posts)
   ? userData.posts.sort((a, b) => new Date(b.date) - new Date(a.date))
   : [];
@@ -87,30 +106,20 @@ function Profile() {
                   <div>
                     <span className="poster">{post.first_name} {post.last_name}</span>
                     <span className="post-date">{new Date(post.date).toLocaleString()}</span>
+                    {post.edited_at && <span className="post-date">(edited)</span>}
                   </div>
                   <div className="post-date">
                     {post.privacy} 
                   </div>
-                  <p className="post">{post.content}</p>
-                  {post.image && <img className="post-image" src={`/images/${post.image}`} alt="PostImage" />}
+                  <p className="post"><LinkedText text={post.content} mentions={post.mentions} hashtags={post.hashtags} /></p>
+                  <Gallery attachments={post.attachments} />
+                  <Reactions target={{ post_id: post.post_id }} reactions={post.reactions} />
+                  <PostControls post={post} onEdited={updatePost} onDeleted={removePost} />
                   <div className="comments">
                     {post.comments === null ? (
                       <p className="comment-text">No comments</p>
                     ) : (
-                      <div>
-                        {post.comments.map((comment) => (
-                          <div className="comment" key={comment.comment_id}>
-                            <div>
-                              <span className="poster">{comment.first_name} {comment.last_name}</span>
-                              <span className="post-date">{new Date(comment.date).toLocaleString()}</span>
-                            </div>
-                            <div className="comment-text">
-                              {comment.comment}
-                            </div>
-                            {comment.image && <img className="post-image" src={`/images/${comment.image}`} alt="CommentImage" />}
-                          </div>
-                        ))}
-                      </div>
+                      <Comments comments={post.comments} postID={post.post_id} />
                     )}
                   </div>
                   <CreateComment postID={post.post_id}/>
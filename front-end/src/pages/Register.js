@@ -150,7 +150,7 @@ function Register () {
                         <p className="alert">Please select a date of birth.</p>
                       )}
                     <label htmlFor="avatar">Avatar/Image(Optional)</label>
-                    <input onChange={(e) => setAvatar(e.target.files[0])} type="file" accept="image/*" id="avatar" name="avatar"/>
+                    <input onChange={(e) => setAvatar(e.target.files[0])} type="file" accept="image/jpeg, image/png, image/gif, image/webp" id="avatar" name="avatar"/>
                     <label htmlFor="nickname">Nickname (Optional)</label>
                     <input value={nickname} onChange={(e) => setNickname(e.target.value)} type="text" placeholder="Nickname" id="nickname" name="nickname"/>
                     {errors.includes("nickname") && (
@@ -9,6 +9,10 @@ import About from './../images/about.PNG';
 import Avatar from './../images/avatar.PNG';
 import CreateComment from "../components/CreateComment";
 import Follow from "../components/Follow";
+import Comments from "../components/Comments";
+import Gallery from "../components/Gallery";
+import Reactions from "../components/Reactions";
+import LinkedText from "../components/LinkedText";
 
 function User() {
   const navigate = useNavigate();
@@ -45,7 +49,7 @@ function User() {
       })
       .then((data) => {
         if (data.user_data.avatar) {
-        const avatarPath = `/images/${data.user_data.avatar}`;
+        const avatarPath = `/images/${data.user_data.avatar}?size=medium`;
         data.user_data.avatar = avatarPath;
         } else{
           data.user_data.avatar = Avatar
@@ -162,34 +166,19 @@ function User() {
                                 <span className="post-date">
                                   {new Date(post.date).toLocaleString()}
                                 </span>
+                                {post.edited_at && <span className="post-date">(edited)</span>}
                                 <div className="post-date">
                                   {post.privacy} 
                                 </div>
                               </div>
-                              <p className="post">{post.content}</p>
-                              {post.image && <img className="post-image" src={`/images/${post.image}`} alt="PostImage" />}
+                              <p className="post"><LinkedText text={post.content} mentions={post.mentions} hashtags={post.hashtags} /></p>
+                              <Gallery attachments={post.attachments} />
+                              <Reactions target={{ post_id: post.post_id }} reactions={post.reactions} />
                               <div className="comments">
                                 {post.comments === null ? (
                                   <p className="comment-text">No comments</p>
                                 ) : (
-                                  <div>
-                                    {post.comments.map((comment) => (
-                                      <div className="comment" key={comment.comment_id}>
-                                        <div>
-                                          <span className="poster">
-                                            {comment.first_name} {comment.last_name}
-                                          </span>
-                                          <span className="post-date">
-                                            {new Date(comment.date).toLocaleString()}
-                                          </span>
-                                        </div>
-                                        <div className="comment-text">
-                                          {comment.comment}
-                                        </div>
-                                        {comment.image && <img className="post-image" src={`/images/${comment.image}`} alt="CommentImage" />}
-                                      </div>
-                                    ))}
-                                  </div>
+                                  <Comments comments={post.comments} postID={post.post_id} />
                                 )}
                               </div>
                               <CreateComment postID={post.post_id} />